@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/wowsims/sod/sim/core/proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	googleProto "google.golang.org/protobuf/proto"
+)
+
+type asyncResult interface {
+	googleProto.Message
+	GetErrorResult() string
+}
+
+// Sets up cmd to load a request from --infile, run it while reporting progress and write the
+// final result to --outfile in protojson format. name is used in error messages, e.g. "gear optimizer".
+func newAsyncCmd[Req googleProto.Message, Res asyncResult](
+	cmd *cobra.Command,
+	name string,
+	run func(context.Context, Req, chan *proto.ProgressMetrics),
+	finalResult func(*proto.ProgressMetrics) Res,
+) *cobra.Command {
+	var zero Req
+	requestType := zero.ProtoReflect().Type()
+
+	cmd.Flags().StringVar(&infile, "infile", "input.json", fmt.Sprintf("location of input file (%s in protojson format)", requestType.Descriptor().Name()))
+	cmd.Flags().StringVar(&outfile, "outfile", "", "location of output file, defaults to stdout")
+	cmd.Flags().BoolVar(&verbose, "verbose", false, "print information during runtime")
+	cmd.MarkFlagRequired("infile")
+
+	cmd.Run = func(cmd *cobra.Command, args []string) {
+		data, err := os.ReadFile(infile)
+		if err != nil {
+			log.Fatalf("failed to load input json file %q: %v", infile, err)
+		}
+		input := requestType.New().Interface().(Req)
+
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, input)
+		if err != nil {
+			log.Fatalf("failed to load input json file: %s", err)
+		}
+
+		reporter := make(chan *proto.ProgressMetrics, 10)
+		run(context.Background(), input, reporter)
+
+		var result Res
+		for v := range reporter {
+			if final := finalResult(v); final.ProtoReflect().IsValid() {
+				result = final
+				break
+			}
+			if verbose {
+				fmt.Printf("Progress: %d / %d sims, %d iterations\n", v.CompletedSims, v.TotalSims, v.CompletedIterations)
+			}
+		}
+		if !result.ProtoReflect().IsValid() {
+			log.Fatalf("%s stopped without a result", name)
+		}
+		if result.GetErrorResult() != "" {
+			log.Fatalf("%s failed: %s", name, result.GetErrorResult())
+		}
+
+		output, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(result)
+		if err != nil {
+			log.Fatalf("failed to marshal final results: %s", err)
+		}
+
+		if outfile == "" {
+			fmt.Print(string(output))
+		} else {
+			err = os.WriteFile(outfile, output, 0666)
+			if err != nil {
+				log.Fatalf("failed to write output file:: %s", err)
+			}
+			if verbose {
+				fmt.Printf("Wrote output file: `%s` successfully.\n", outfile)
+			}
+		}
+	}
+	return cmd
+}
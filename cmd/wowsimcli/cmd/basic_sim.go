@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/wowsims/sod/sim/core"
@@ -17,10 +18,19 @@ var simCmd = &cobra.Command{
 	Run:   simMain,
 }
 
+var (
+	combatLogFile   string
+	combatLogFormat string
+	replaySeed      int64
+)
+
 func init() {
 	simCmd.Flags().StringVar(&infile, "infile", "input.json", "location of input file (RaidSimRequest in protojson format)")
 	simCmd.Flags().StringVar(&outfile, "outfile", "", "location of output file, defaults to stdout")
 	simCmd.Flags().BoolVar(&verbose, "verbose", false, "print information during runtime")
+	simCmd.Flags().StringVar(&combatLogFile, "combat-log", "", "location to write the combat log of the first iteration to")
+	simCmd.Flags().StringVar(&combatLogFormat, "combat-log-format", "json", "format of the combat log: json (JSON lines), proto or wow (WoWCombatLog.txt)")
+	simCmd.Flags().Int64Var(&replaySeed, "replay-seed", 0, "only sim the iteration with this seed (e.g. max_seed or min_seed of a previous result), with full logs")
 	simCmd.MarkFlagRequired("infile")
 }
 
@@ -36,6 +46,14 @@ func simMain(cmd *cobra.Command, args []string) {
 		log.Fatalf("failed to load input json file: %s", err)
 	}
 
+	if combatLogFile != "" || replaySeed != 0 {
+		if input.SimOptions == nil {
+			input.SimOptions = &proto.SimOptions{}
+		}
+		input.SimOptions.CombatLog = input.SimOptions.CombatLog || combatLogFile != ""
+		input.SimOptions.ReplaySeed = replaySeed
+	}
+
 	var output []byte
 	reporter := make(chan *proto.ProgressMetrics, 10)
 	core.RunRaidSimAsync(input, reporter)
@@ -51,6 +69,10 @@ func simMain(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	if combatLogFile != "" && finalResult.ErrorResult == "" {
+		writeCombatLog(finalResult.CombatLog)
+	}
+
 	output, err = protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(finalResult)
 	if err != nil {
 		log.Fatalf("failed to marshal final results: %s", err)
@@ -68,3 +90,28 @@ func simMain(cmd *cobra.Command, args []string) {
 		}
 	}
 }
+
+func writeCombatLog(events []*proto.CombatLogEvent) {
+	file, err := os.Create(combatLogFile)
+	if err != nil {
+		log.Fatalf("failed to create combat log file %q: %v", combatLogFile, err)
+	}
+	defer file.Close()
+
+	switch combatLogFormat {
+	case "json":
+		err = core.WriteCombatLogJSON(file, events)
+	case "proto":
+		err = core.WriteCombatLogProto(file, events)
+	case "wow":
+		err = core.WriteWoWCombatLog(file, events, time.Now())
+	default:
+		log.Fatalf("unknown combat log format %q", combatLogFormat)
+	}
+	if err != nil {
+		log.Fatalf("failed to write combat log: %s", err)
+	}
+	if verbose {
+		fmt.Printf("Wrote combat log with %d events to `%s`.\n", len(events), combatLogFile)
+	}
+}
@@ -69,6 +69,7 @@ type ItemReplacementInput struct {
 	Combinations bool              `json:"combinations"`
 	FastMode     bool              `json:"fast_mode"`
 	Items        []*proto.ItemSpec // spec for replacement
+	Player       *int32            `json:"player"` // raid index of the player to bulk sim, if the raid has more than one
 }
 
 type ReplaceIter struct {
@@ -97,6 +98,9 @@ func BulkSim(input *proto.RaidSimRequest, replaceFile string, verbose bool) stri
 			FastMode:           replaceInput.FastMode,
 		},
 	}
+	if replaceInput.Player != nil {
+		bsr.BulkSettings.Player = &proto.UnitReference{Type: proto.UnitReference_Player, Index: *replaceInput.Player}
+	}
 	progress := make(chan *proto.ProgressMetrics, 100)
 	core.RunBulkSimAsync(context.Background(), bsr, progress)
 
@@ -0,0 +1,13 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wowsims/sod/sim/core"
+	"github.com/wowsims/sod/sim/core/proto"
+)
+
+var optimizeConsumesCmd = newAsyncCmd(&cobra.Command{
+	Use:   "optimize-consumes",
+	Short: "search for better consumables and world buffs",
+	Long:  "search for the best combinations of consumables and world buffs within the constraints of the settings, like a gold limit or no world buffs",
+}, "consumes optimizer", core.RunConsumesOptimizerAsync, (*proto.ProgressMetrics).GetFinalConsumesOptimizerResult)
@@ -0,0 +1,13 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wowsims/sod/sim/core"
+	"github.com/wowsims/sod/sim/core/proto"
+)
+
+var optimizeGearCmd = newAsyncCmd(&cobra.Command{
+	Use:   "optimize-gear",
+	Short: "search for the best gear in the item database",
+	Long:  "search the item database for the best complete equipment sets, ranking items by EP before simming the best sets",
+}, "gear optimizer", core.RunGearOptimizerAsync, (*proto.ProgressMetrics).GetFinalGearOptimizerResult)
@@ -0,0 +1,13 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wowsims/sod/sim/core"
+	"github.com/wowsims/sod/sim/core/proto"
+)
+
+var optimizeRotationCmd = newAsyncCmd(&cobra.Command{
+	Use:   "optimize-rotation",
+	Short: "search for a better APL priority list",
+	Long:  "search for a better APL priority list by reordering items, toggling them and tuning thresholds",
+}, "rotation optimizer", core.RunRotationOptimizerAsync, (*proto.ProgressMetrics).GetFinalRotationResult)
@@ -0,0 +1,13 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wowsims/sod/sim/core"
+	"github.com/wowsims/sod/sim/core/proto"
+)
+
+var optimizeRunesCmd = newAsyncCmd(&cobra.Command{
+	Use:   "optimize-runes",
+	Short: "search for the best rune loadout",
+	Long:  "compare all rune loadouts of the player, pruning the worse half of the loadouts after each round of sims",
+}, "rune optimizer", core.RunRuneOptimizerAsync, (*proto.ProgressMetrics).GetFinalRuneOptimizerResult)
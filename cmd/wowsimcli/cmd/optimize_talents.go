@@ -0,0 +1,13 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wowsims/sod/sim/core"
+	"github.com/wowsims/sod/sim/core/proto"
+)
+
+var optimizeTalentsCmd = newAsyncCmd(&cobra.Command{
+	Use:   "optimize-talents",
+	Short: "search for a better talent build",
+	Long:  "search for better talent builds within the player's point budget, racing builds to drop clearly worse ones early",
+}, "talent optimizer", core.RunTalentOptimizerAsync, (*proto.ProgressMetrics).GetFinalTalentOptimizerResult)
@@ -18,6 +18,12 @@ func Execute(version string) {
 	rootCmd.AddCommand(simCmd)
 	rootCmd.AddCommand(bulkCmd)
 	rootCmd.AddCommand(decodeLinkCmd)
+	rootCmd.AddCommand(optimizeRotationCmd)
+	rootCmd.AddCommand(optimizeGearCmd)
+	rootCmd.AddCommand(optimizeRunesCmd)
+	rootCmd.AddCommand(optimizeTalentsCmd)
+	rootCmd.AddCommand(optimizeConsumesCmd)
+	rootCmd.AddCommand(upgradesCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
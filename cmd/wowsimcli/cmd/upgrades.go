@@ -0,0 +1,13 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wowsims/sod/sim/core"
+	"github.com/wowsims/sod/sim/core/proto"
+)
+
+var upgradesCmd = newAsyncCmd(&cobra.Command{
+	Use:   "upgrades",
+	Short: "find the best items for each slot",
+	Long:  "rank every item the player may equip in each slot by EP, then sim the best ones of each slot and report their DPS gain and where they drop",
+}, "upgrade finder", core.RunUpgradeFinderAsync, (*proto.ProgressMetrics).GetFinalUpgradeFinderResult)
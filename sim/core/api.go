@@ -3,6 +3,7 @@ package core
 
 import (
 	"context"
+	"strings"
 
 	"github.com/wowsims/sod/sim/core/proto"
 	"github.com/wowsims/sod/sim/core/stats"
@@ -42,6 +43,72 @@ func StatWeightsAsync(request *proto.StatWeightsRequest, progress chan *proto.Pr
 	}()
 }
 
+/**
+ * Returns the raid DPS added by each raid buff, debuff, party buff and buffing player.
+ */
+func RunBuffAttribution(request *proto.BuffAttributionRequest) *proto.BuffAttributionResult {
+	return BuffAttribution(context.Background(), request, nil)
+}
+
+func RunBuffAttributionAsync(ctx context.Context, request *proto.BuffAttributionRequest, progress chan *proto.ProgressMetrics) {
+	go BuffAttribution(ctx, request, progress)
+}
+
+/**
+ * Searches the item database for the best complete equipment sets of a player.
+ */
+func RunGearOptimizer(request *proto.GearOptimizerRequest) *proto.GearOptimizerResult {
+	return GearOptimizer(context.Background(), request, nil)
+}
+
+func RunGearOptimizerAsync(ctx context.Context, request *proto.GearOptimizerRequest, progress chan *proto.ProgressMetrics) {
+	go GearOptimizer(ctx, request, progress)
+}
+
+/**
+ * Compares all rune loadouts of a player.
+ */
+func RunRuneOptimizer(request *proto.RuneOptimizerRequest) *proto.RuneOptimizerResult {
+	return RuneOptimizer(context.Background(), request, nil)
+}
+
+func RunRuneOptimizerAsync(ctx context.Context, request *proto.RuneOptimizerRequest, progress chan *proto.ProgressMetrics) {
+	go RuneOptimizer(ctx, request, progress)
+}
+
+/**
+ * Searches for better talent builds of a player.
+ */
+func RunTalentOptimizer(request *proto.TalentOptimizerRequest) *proto.TalentOptimizerResult {
+	return TalentOptimizer(context.Background(), request, nil)
+}
+
+func RunTalentOptimizerAsync(ctx context.Context, request *proto.TalentOptimizerRequest, progress chan *proto.ProgressMetrics) {
+	go TalentOptimizer(ctx, request, progress)
+}
+
+/**
+ * Finds the best consumables and world buffs of a player.
+ */
+func RunConsumesOptimizer(request *proto.ConsumesOptimizerRequest) *proto.ConsumesOptimizerResult {
+	return ConsumesOptimizer(context.Background(), request, nil)
+}
+
+func RunConsumesOptimizerAsync(ctx context.Context, request *proto.ConsumesOptimizerRequest, progress chan *proto.ProgressMetrics) {
+	go ConsumesOptimizer(ctx, request, progress)
+}
+
+/**
+ * Ranks the items of the database for each slot of a player and sims the best ones.
+ */
+func RunUpgradeFinder(request *proto.UpgradeFinderRequest) *proto.UpgradeFinderResult {
+	return UpgradeFinder(context.Background(), request, nil)
+}
+
+func RunUpgradeFinderAsync(ctx context.Context, request *proto.UpgradeFinderRequest, progress chan *proto.ProgressMetrics) {
+	go UpgradeFinder(ctx, request, progress)
+}
+
 /**
  * Runs multiple iterations of the sim with a full raid.
  */
@@ -60,3 +127,24 @@ func RunBulkSim(request *proto.BulkSimRequest) *proto.BulkSimResult {
 func RunBulkSimAsync(ctx context.Context, request *proto.BulkSimRequest, progress chan *proto.ProgressMetrics) {
 	go BulkSim(ctx, request, progress)
 }
+
+func RunRotationOptimizer(request *proto.RotationOptimizerRequest) *proto.RotationOptimizerResult {
+	return RotationOptimizer(context.Background(), request, nil)
+}
+
+func RunRotationOptimizerAsync(ctx context.Context, request *proto.RotationOptimizerRequest, progress chan *proto.ProgressMetrics) {
+	go RotationOptimizer(ctx, request, progress)
+}
+
+// Whether the progress holds the final result of an async API call, i.e. one of its final_*
+// fields is set.
+func IsFinalProgress(progress *proto.ProgressMetrics) bool {
+	msg := progress.ProtoReflect()
+	fields := msg.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		if strings.HasPrefix(string(fields.Get(i).Name()), "final_") && msg.Has(fields.Get(i)) {
+			return true
+		}
+	}
+	return false
+}
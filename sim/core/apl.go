@@ -16,6 +16,16 @@ type APLRotation struct {
 	// Action currently controlling this rotation (only used for certain actions, such as StrictSequence).
 	controllingActions []APLActionImpl
 
+	// Coverage metrics for each item in priorityList, with matching indices.
+	itemMetrics []*aplListItemMetrics
+
+	// Priority list item the last action returned by getNextAction() is attributed to,
+	// the item whose action is currently being performed, and the items which pushed
+	// each of the controllingActions.
+	nextItem         *aplListItemMetrics
+	executingItem    *aplListItemMetrics
+	controllingItems []*aplListItemMetrics
+
 	// Value that should evaluate to 'true' if the current channel is to be interrupted.
 	// Will be nil when there is no active channel.
 	interruptChannelIf APLValue
@@ -129,6 +139,7 @@ func (unit *Unit) newAPLRotation(config *proto.APLRotation) *APLRotation {
 		rotation.doAndRecordWarnings(&rotation.priorityListWarnings[i], false, func() {
 			action.Finalize(rotation)
 		})
+		rotation.itemMetrics = append(rotation.itemMetrics, newAPLListItemMetrics(unit, action, configIdxs[i]))
 	}
 
 	// Remove MCDs that are referenced by APL actions, so that the Autocast Other Cooldowns
@@ -183,12 +194,31 @@ func (rot *APLRotation) allPrepullActions() []*APLAction {
 
 func (rot *APLRotation) reset(sim *Simulation) {
 	rot.controllingActions = nil
+	rot.nextItem = nil
+	rot.executingItem = nil
+	rot.controllingItems = nil
 	rot.inLoop = false
 	rot.interruptChannelIf = nil
 	rot.allowChannelRecastOnInterrupt = false
 	for _, action := range rot.allAPLActions() {
 		action.impl.Reset(sim)
 	}
+	for _, itemMetrics := range rot.itemMetrics {
+		itemMetrics.reset()
+	}
+}
+
+// This should be called when a Sim iteration is complete.
+func (rot *APLRotation) doneIteration(_ *Simulation) {
+	for _, itemMetrics := range rot.itemMetrics {
+		itemMetrics.doneIteration()
+	}
+}
+
+func (rot *APLRotation) getMetricsProto() []*proto.APLListItemMetrics {
+	return MapSlice(rot.itemMetrics, func(itemMetrics *aplListItemMetrics) *proto.APLListItemMetrics {
+		return itemMetrics.ToProto()
+	})
 }
 
 // We intentionally try to mimic the behavior of simc APL to avoid confusion
@@ -215,7 +245,9 @@ func (apl *APLRotation) DoNextAction(sim *Simulation) {
 			panic(fmt.Sprintf("[USER_ERROR] Infinite loop detected, current action:\n%s", nextAction))
 		}
 
-		nextAction.Execute(sim)
+		apl.executingItem = apl.nextItem
+		apl.executingItem.execute(sim, nextAction)
+		apl.executingItem = nil
 	}
 	apl.inLoop = false
 
@@ -230,21 +262,35 @@ func (apl *APLRotation) DoNextAction(sim *Simulation) {
 }
 
 func (apl *APLRotation) getNextAction(sim *Simulation) *APLAction {
-	if len(apl.controllingActions) != 0 {
-		return apl.controllingActions[len(apl.controllingActions)-1].GetNextAction(sim)
+	if numControlling := len(apl.controllingActions); numControlling != 0 {
+		nextAction := apl.controllingActions[numControlling-1].GetNextAction(sim)
+		// If the controlling action finished, nextItem was already set by the nested getNextAction() call.
+		if len(apl.controllingActions) == numControlling {
+			apl.nextItem = apl.controllingItems[numControlling-1]
+		}
+		return nextAction
 	}
 
-	for _, action := range apl.priorityList {
-		if action.IsReady(sim) {
+	for i, action := range apl.priorityList {
+		itemMetrics := apl.itemMetrics[i]
+		itemMetrics.Evaluations++
+		if action.condition != nil && !action.condition.GetBool(sim) {
+			continue
+		}
+		itemMetrics.ConditionPasses++
+		if action.impl.IsReady(sim) {
+			apl.nextItem = itemMetrics
 			return action
 		}
 	}
 
+	apl.nextItem = nil
 	return nil
 }
 
 func (apl *APLRotation) pushControllingAction(ca APLActionImpl) {
 	apl.controllingActions = append(apl.controllingActions, ca)
+	apl.controllingItems = append(apl.controllingItems, apl.executingItem)
 }
 
 func (apl *APLRotation) popControllingAction(ca APLActionImpl) {
@@ -252,6 +298,7 @@ func (apl *APLRotation) popControllingAction(ca APLActionImpl) {
 		panic("Wrong APL controllingAction in pop()")
 	}
 	apl.controllingActions = apl.controllingActions[:len(apl.controllingActions)-1]
+	apl.controllingItems = apl.controllingItems[:len(apl.controllingItems)-1]
 }
 
 func (apl *APLRotation) shouldInterruptChannel(sim *Simulation) bool {
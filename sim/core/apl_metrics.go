@@ -0,0 +1,134 @@
+package core
+
+import (
+	"slices"
+
+	"github.com/wowsims/sod/sim/core/proto"
+)
+
+// Tracks how often a single priority list item is checked, passes its condition
+// and actually fires, along with the damage of the casts it triggered.
+type aplListItemMetrics struct {
+	unit      *Unit
+	configIdx int32
+	spells    []*Spell
+
+	// Metrics for the current iteration.
+	Evaluations     int64
+	ConditionPasses int64
+	Executions      int64
+	triggeredCasts  []int32 // Casts started by this item, for each of spells.
+	castsBefore     []int
+
+	// Aggregate values. These are updated after each iteration.
+	iterations         int32
+	evaluationsSum     int64
+	conditionPassesSum int64
+	executionsSum      int64
+	damageSum          float64
+}
+
+func newAPLListItemMetrics(unit *Unit, action *APLAction, configIdx int) *aplListItemMetrics {
+	var spells []*Spell
+	for _, spell := range action.GetAllSpells() {
+		if spell != nil && !slices.Contains(spells, spell) {
+			spells = append(spells, spell)
+		}
+	}
+
+	return &aplListItemMetrics{
+		unit:           unit,
+		configIdx:      int32(configIdx),
+		spells:         spells,
+		triggeredCasts: make([]int32, len(spells)),
+		castsBefore:    make([]int, len(spells)),
+	}
+}
+
+func (metrics *aplListItemMetrics) reset() {
+	metrics.Evaluations = 0
+	metrics.ConditionPasses = 0
+	metrics.Executions = 0
+	for i := range metrics.triggeredCasts {
+		metrics.triggeredCasts[i] = 0
+	}
+}
+
+// Performs the action on behalf of this item, recording which of its spells were cast.
+func (metrics *aplListItemMetrics) execute(sim *Simulation, action *APLAction) {
+	if metrics == nil {
+		action.Execute(sim)
+		return
+	}
+
+	metrics.Executions++
+	if len(metrics.spells) == 0 {
+		action.Execute(sim)
+		return
+	}
+
+	unit := metrics.unit
+	wasCasting := unit.Hardcast.Expires > sim.CurrentTime
+	for i, spell := range metrics.spells {
+		metrics.castsBefore[i] = spell.casts
+	}
+
+	action.Execute(sim)
+
+	startedHardcast := !wasCasting && unit.Hardcast.Expires > sim.CurrentTime
+	for i, spell := range metrics.spells {
+		metrics.triggeredCasts[i] += int32(spell.casts - metrics.castsBefore[i])
+		// Hardcasts only count as a cast once they complete, so attribute them when started.
+		if startedHardcast && unit.Hardcast.ActionID.SameAction(spell.ActionID) {
+			metrics.triggeredCasts[i]++
+		}
+	}
+}
+
+// This should be called when a Sim iteration is complete, before spells are reset.
+func (metrics *aplListItemMetrics) doneIteration() {
+	metrics.iterations++
+	metrics.evaluationsSum += metrics.Evaluations
+	metrics.conditionPassesSum += metrics.ConditionPasses
+	metrics.executionsSum += metrics.Executions
+
+	for i, spell := range metrics.spells {
+		triggered := metrics.triggeredCasts[i]
+		if triggered == 0 {
+			continue
+		}
+
+		damage := 0.0
+		for _, spellMetrics := range spell.splitSpellMetrics {
+			for _, targetMetrics := range spellMetrics {
+				damage += targetMetrics.TotalDamage
+			}
+		}
+
+		// Casts still in progress at the end of the fight may push triggered above the total.
+		share := 1.0
+		if casts := int32(spell.casts); casts > triggered {
+			share = float64(triggered) / float64(casts)
+		}
+		metrics.damageSum += damage * share
+	}
+}
+
+func (metrics *aplListItemMetrics) mergeMetrics(other *aplListItemMetrics) {
+	metrics.iterations += other.iterations
+	metrics.evaluationsSum += other.evaluationsSum
+	metrics.conditionPassesSum += other.conditionPassesSum
+	metrics.executionsSum += other.executionsSum
+	metrics.damageSum += other.damageSum
+}
+
+func (metrics *aplListItemMetrics) ToProto() *proto.APLListItemMetrics {
+	n := float64(max(metrics.iterations, 1))
+	return &proto.APLListItemMetrics{
+		ListIndex:          metrics.configIdx,
+		EvaluationsAvg:     float64(metrics.evaluationsSum) / n,
+		ConditionPassesAvg: float64(metrics.conditionPassesSum) / n,
+		ExecutionsAvg:      float64(metrics.executionsSum) / n,
+		DamageAvg:          metrics.damageSum / n,
+	}
+}
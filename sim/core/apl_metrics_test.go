@@ -0,0 +1,56 @@
+package core
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/wowsims/sod/sim/core/proto"
+	googleProto "google.golang.org/protobuf/proto"
+)
+
+func TestAPLItemMetrics(t *testing.T) {
+	rsr := fakeCasterRaidSimRequest()
+
+	// Prepend an item that can never fire, casting the same spell as the live item.
+	rotation := rsr.Raid.Parties[0].Players[0].Rotation
+	deadItem := googleProto.Clone(rotation.PriorityList[0]).(*proto.APLListItem)
+	deadItem.Action.Condition = &proto.APLValue{Value: &proto.APLValue_Const{Const: &proto.APLValueConst{Val: "false"}}}
+	rotation.PriorityList = append([]*proto.APLListItem{deadItem}, rotation.PriorityList...)
+
+	result := RunRaidSim(rsr)
+	if result.ErrorResult != "" {
+		t.Fatalf("Sim failed with error: %s", result.ErrorResult)
+	}
+
+	player := result.RaidMetrics.Parties[0].Players[0]
+	if len(player.AplItems) != 2 {
+		t.Fatalf("Expected metrics for 2 items, got %v", player.AplItems)
+	}
+	dead, live := player.AplItems[0], player.AplItems[1]
+	if dead.ListIndex != 0 || dead.EvaluationsAvg == 0 {
+		t.Fatalf("Expected the never-true item to be evaluated, got %v", dead)
+	}
+	if dead.ConditionPassesAvg != 0 || dead.ExecutionsAvg != 0 || dead.DamageAvg != 0 {
+		t.Fatalf("Never-true item passed %.1f times, executed %.1f times for %.1f damage", dead.ConditionPassesAvg, dead.ExecutionsAvg, dead.DamageAvg)
+	}
+	if live.ConditionPassesAvg > live.EvaluationsAvg || live.ExecutionsAvg > live.ConditionPassesAvg {
+		t.Fatalf("Item has %.1f evaluations, %.1f condition passes and %.1f executions", live.EvaluationsAvg, live.ConditionPassesAvg, live.ExecutionsAvg)
+	}
+
+	// The live item casts every fake dot, so it has all of the spell's casts and damage, per iteration.
+	iterations := float64(result.Iterations)
+	actionIdx := slices.IndexFunc(player.Actions, func(action *proto.ActionMetrics) bool {
+		return action.Id.GetSpellId() == 42
+	})
+	if actionIdx == -1 {
+		t.Fatalf("Expected action metrics of the fake dot, got %v", player.Actions)
+	}
+	spell := player.Actions[actionIdx].Targets[0]
+	if expected := float64(spell.Casts) / iterations; math.Abs(live.ExecutionsAvg-expected) > 1e-6 {
+		t.Errorf("Expected %.3f executions per iteration, got %.3f", expected, live.ExecutionsAvg)
+	}
+	if expected := spell.Damage / iterations; expected == 0 || math.Abs(live.DamageAvg-expected) > 1e-6*expected {
+		t.Errorf("Expected %.3f damage per iteration, got %.3f", expected, live.DamageAvg)
+	}
+}
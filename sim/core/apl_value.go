@@ -109,6 +109,10 @@ func (rot *APLRotation) newAPLValue(config *proto.APLValue) APLValue {
 		return rot.newValueCurrentEnergy(config.GetCurrentEnergy())
 	case *proto.APLValue_CurrentComboPoints:
 		return rot.newValueCurrentComboPoints(config.GetCurrentComboPoints())
+	case *proto.APLValue_ResourceAt:
+		return rot.newValueResourceAt(config.GetResourceAt())
+	case *proto.APLValue_TimeToResource:
+		return rot.newValueTimeToResource(config.GetTimeToResource())
 
 	// GCD
 	case *proto.APLValue_GcdIsReady:
@@ -119,6 +123,14 @@ func (rot *APLRotation) newAPLValue(config *proto.APLValue) APLValue {
 	// Auto attacks
 	case *proto.APLValue_AutoTimeToNext:
 		return rot.newValueAutoTimeToNext(config.GetAutoTimeToNext())
+	case *proto.APLValue_AutoSwingSpeed:
+		return rot.newValueAutoSwingSpeed(config.GetAutoSwingSpeed())
+	case *proto.APLValue_AutoTimeSinceLast:
+		return rot.newValueAutoTimeSinceLast(config.GetAutoTimeSinceLast())
+	case *proto.APLValue_AutoAttackChance:
+		return rot.newValueAutoAttackChance(config.GetAutoAttackChance())
+	case *proto.APLValue_AutoNextSwingParryHasted:
+		return rot.newValueAutoNextSwingParryHasted(config.GetAutoNextSwingParryHasted())
 
 	// Spells
 	case *proto.APLValue_SpellCanCast:
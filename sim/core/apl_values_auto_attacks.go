@@ -1,6 +1,7 @@
 package core
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/wowsims/sod/sim/core/proto"
@@ -38,3 +39,158 @@ func (value *APLValueAutoTimeToNext) GetDuration(sim *Simulation) time.Duration
 func (value *APLValueAutoTimeToNext) String() string {
 	return "Auto Time To Next"
 }
+
+type APLValueAutoSwingSpeed struct {
+	DefaultAPLValueImpl
+	unit     *Unit
+	autoType proto.APLValueAutoTimeToNext_AutoType
+}
+
+func (rot *APLRotation) newValueAutoSwingSpeed(config *proto.APLValueAutoSwingSpeed) APLValue {
+	return &APLValueAutoSwingSpeed{
+		unit:     rot.unit,
+		autoType: config.AutoType,
+	}
+}
+func (value *APLValueAutoSwingSpeed) Type() proto.APLValueType {
+	return proto.APLValueType_ValueTypeDuration
+}
+func (value *APLValueAutoSwingSpeed) GetDuration(_ *Simulation) time.Duration {
+	switch value.autoType {
+	case proto.APLValueAutoTimeToNext_OffHand:
+		if !value.unit.AutoAttacks.IsDualWielding {
+			return 0
+		}
+		return value.unit.AutoAttacks.OffhandSwingSpeed()
+	case proto.APLValueAutoTimeToNext_Ranged:
+		return value.unit.AutoAttacks.RangedSwingSpeed()
+	}
+	// defaults to MainHand
+	return value.unit.AutoAttacks.MainhandSwingSpeed()
+}
+func (value *APLValueAutoSwingSpeed) String() string {
+	return "Auto Swing Speed"
+}
+
+type APLValueAutoTimeSinceLast struct {
+	DefaultAPLValueImpl
+	unit     *Unit
+	autoType proto.APLValueAutoTimeToNext_AutoType
+}
+
+func (rot *APLRotation) newValueAutoTimeSinceLast(config *proto.APLValueAutoTimeSinceLast) APLValue {
+	return &APLValueAutoTimeSinceLast{
+		unit:     rot.unit,
+		autoType: config.AutoType,
+	}
+}
+func (value *APLValueAutoTimeSinceLast) Type() proto.APLValueType {
+	return proto.APLValueType_ValueTypeDuration
+}
+func (value *APLValueAutoTimeSinceLast) GetDuration(sim *Simulation) time.Duration {
+	aa := &value.unit.AutoAttacks
+	var lastSwingAt time.Duration
+	switch value.autoType {
+	case proto.APLValueAutoTimeToNext_Melee:
+		lastSwingAt = max(aa.MainhandLastSwingAt(), aa.OffhandLastSwingAt())
+	case proto.APLValueAutoTimeToNext_MainHand:
+		lastSwingAt = aa.MainhandLastSwingAt()
+	case proto.APLValueAutoTimeToNext_OffHand:
+		lastSwingAt = aa.OffhandLastSwingAt()
+	case proto.APLValueAutoTimeToNext_Ranged:
+		lastSwingAt = aa.RangedLastSwingAt()
+	default:
+		lastSwingAt = max(aa.MainhandLastSwingAt(), aa.OffhandLastSwingAt(), aa.RangedLastSwingAt())
+	}
+	return max(0, sim.CurrentTime-lastSwingAt)
+}
+func (value *APLValueAutoTimeSinceLast) String() string {
+	return "Auto Time Since Last"
+}
+
+type APLValueAutoAttackChance struct {
+	DefaultAPLValueImpl
+	unit    *Unit
+	spell   *Spell
+	outcome proto.APLValueAutoAttackChance_Outcome
+}
+
+func (rot *APLRotation) newValueAutoAttackChance(config *proto.APLValueAutoAttackChance) APLValue {
+	var spell *Spell
+	switch config.AutoType {
+	case proto.APLValueAutoTimeToNext_OffHand:
+		spell = rot.unit.AutoAttacks.OHAuto()
+	case proto.APLValueAutoTimeToNext_Ranged:
+		spell = rot.unit.AutoAttacks.RangedAuto()
+	default:
+		spell = rot.unit.AutoAttacks.MHAuto()
+	}
+	if spell == nil {
+		rot.ValidationWarning("No auto attack found for %s", config.AutoType)
+		return nil
+	}
+	if config.Outcome == proto.APLValueAutoAttackChance_Unknown {
+		rot.ValidationWarning("Auto attack chance requires an outcome")
+		return nil
+	}
+	return &APLValueAutoAttackChance{
+		unit:    rot.unit,
+		spell:   spell,
+		outcome: config.Outcome,
+	}
+}
+func (value *APLValueAutoAttackChance) Type() proto.APLValueType {
+	return proto.APLValueType_ValueTypeFloat
+}
+func (value *APLValueAutoAttackChance) GetFloat(_ *Simulation) float64 {
+	attackTable := value.unit.AttackTables[value.unit.CurrentTarget.UnitIndex][value.spell.CastType]
+
+	var chances WhiteAttackChances
+	if value.spell.CastType == proto.CastType_CastTypeRanged {
+		chances = value.spell.RangedWhiteChances(attackTable)
+	} else {
+		chances = value.spell.MeleeWhiteChances(attackTable)
+	}
+
+	switch value.outcome {
+	case proto.APLValueAutoAttackChance_Miss:
+		return chances.Miss
+	case proto.APLValueAutoAttackChance_Dodge:
+		return chances.Dodge
+	case proto.APLValueAutoAttackChance_Parry:
+		return chances.Parry
+	case proto.APLValueAutoAttackChance_Glance:
+		return chances.Glance
+	case proto.APLValueAutoAttackChance_Block:
+		return chances.Block
+	case proto.APLValueAutoAttackChance_Crit:
+		return chances.Crit
+	}
+	return chances.Landed()
+}
+func (value *APLValueAutoAttackChance) String() string {
+	return fmt.Sprintf("Auto Attack Chance(%s)", value.outcome)
+}
+
+type APLValueAutoNextSwingParryHasted struct {
+	DefaultAPLValueImpl
+	unit *Unit
+}
+
+func (rot *APLRotation) newValueAutoNextSwingParryHasted(_ *proto.APLValueAutoNextSwingParryHasted) APLValue {
+	if !rot.unit.PseudoStats.ParryHaste {
+		rot.ValidationWarning("%s does not gain parry haste", rot.unit.Label)
+	}
+	return &APLValueAutoNextSwingParryHasted{
+		unit: rot.unit,
+	}
+}
+func (value *APLValueAutoNextSwingParryHasted) Type() proto.APLValueType {
+	return proto.APLValueType_ValueTypeBool
+}
+func (value *APLValueAutoNextSwingParryHasted) GetBool(_ *Simulation) bool {
+	return value.unit.AutoAttacks.MainhandParryHasted()
+}
+func (value *APLValueAutoNextSwingParryHasted) String() string {
+	return "Auto Next Swing Parry Hasted"
+}
@@ -2,6 +2,7 @@ package core
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/wowsims/sod/sim/core/proto"
 )
@@ -192,3 +193,130 @@ func (value *APLValueCurrentComboPoints) GetInt(sim *Simulation) int32 {
 func (value *APLValueCurrentComboPoints) String() string {
 	return "Current Combo Points"
 }
+
+// Checks that the unit uses the projected resource.
+func (rot *APLRotation) validateProjectedResource(unit *Unit, resource proto.APLValueResourceAt_Resource) bool {
+	switch resource {
+	case proto.APLValueResourceAt_Mana:
+		if !unit.HasManaBar() {
+			rot.ValidationWarning("%s does not use Mana", unit.Label)
+			return false
+		}
+	case proto.APLValueResourceAt_Energy:
+		if !unit.HasEnergyBar() {
+			rot.ValidationWarning("%s does not use Energy", unit.Label)
+			return false
+		}
+	case proto.APLValueResourceAt_Focus:
+		if !unit.HasFocusBar() {
+			rot.ValidationWarning("%s does not use Focus", unit.Label)
+			return false
+		}
+	default:
+		rot.ValidationWarning("Unknown resource type")
+		return false
+	}
+	return true
+}
+
+type APLValueResourceAt struct {
+	DefaultAPLValueImpl
+	unit     *Unit
+	resource proto.APLValueResourceAt_Resource
+	delay    APLValue
+}
+
+func (rot *APLRotation) newValueResourceAt(config *proto.APLValueResourceAt) APLValue {
+	unit := rot.unit
+	if !rot.validateProjectedResource(unit, config.Resource) {
+		return nil
+	}
+
+	delay := rot.coerceTo(rot.newAPLValue(config.Delay), proto.APLValueType_ValueTypeDuration)
+	if delay == nil {
+		delay = rot.newValueConst(&proto.APLValueConst{Val: "0ms"})
+	}
+
+	return &APLValueResourceAt{
+		unit:     unit,
+		resource: config.Resource,
+		delay:    delay,
+	}
+}
+func (value *APLValueResourceAt) GetInnerValues() []APLValue {
+	return []APLValue{value.delay}
+}
+func (value *APLValueResourceAt) Type() proto.APLValueType {
+	return proto.APLValueType_ValueTypeFloat
+}
+func (value *APLValueResourceAt) GetFloat(sim *Simulation) float64 {
+	delay := max(0, value.delay.GetDuration(sim))
+	switch value.resource {
+	case proto.APLValueResourceAt_Mana:
+		return value.unit.ManaAt(sim, delay)
+	case proto.APLValueResourceAt_Energy:
+		return value.unit.EnergyAt(sim, delay)
+	default:
+		return value.unit.FocusAt(sim, delay)
+	}
+}
+func (value *APLValueResourceAt) String() string {
+	return fmt.Sprintf("%s At(%s)", value.resource, value.delay)
+}
+
+type APLValueTimeToResource struct {
+	DefaultAPLValueImpl
+	unit     *Unit
+	resource proto.APLValueResourceAt_Resource
+	amount   APLValue
+}
+
+func (rot *APLRotation) newValueTimeToResource(config *proto.APLValueTimeToResource) APLValue {
+	unit := rot.unit
+	if !rot.validateProjectedResource(unit, config.Resource) {
+		return nil
+	}
+
+	amount := rot.coerceTo(rot.newAPLValue(config.Amount), proto.APLValueType_ValueTypeFloat)
+	if amount == nil {
+		rot.ValidationWarning("Missing resource amount")
+		return nil
+	}
+
+	return &APLValueTimeToResource{
+		unit:     unit,
+		resource: config.Resource,
+		amount:   amount,
+	}
+}
+func (value *APLValueTimeToResource) GetInnerValues() []APLValue {
+	return []APLValue{value.amount}
+}
+func (value *APLValueTimeToResource) Type() proto.APLValueType {
+	return proto.APLValueType_ValueTypeDuration
+}
+func (value *APLValueTimeToResource) GetDuration(sim *Simulation) time.Duration {
+	amount := value.amount.GetFloat(sim)
+	switch value.resource {
+	case proto.APLValueResourceAt_Mana:
+		return value.unit.TimeToMana(sim, amount)
+	case proto.APLValueResourceAt_Energy:
+		return value.unit.TimeToEnergy(sim, amount)
+	default:
+		return value.unit.TimeToFocus(sim, amount)
+	}
+}
+func (value *APLValueTimeToResource) String() string {
+	return fmt.Sprintf("Time To %s(%s)", value.resource, value.amount)
+}
+
+// Whether the value projects the unit's energy, in which case every energy tick can change its result.
+func isEnergyProjection(value APLValue) bool {
+	switch projection := value.(type) {
+	case *APLValueResourceAt:
+		return projection.resource == proto.APLValueResourceAt_Energy
+	case *APLValueTimeToResource:
+		return projection.resource == proto.APLValueResourceAt_Energy
+	}
+	return false
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/wowsims/sod/sim/core/proto"
+	"github.com/wowsims/sod/sim/core/stats"
 )
 
 func TestValueConst(t *testing.T) {
@@ -42,3 +43,62 @@ func TestValueConst(t *testing.T) {
 		t.Fatalf("Unexpected coerced duration value %s", coercedDurVal.GetDuration(sim))
 	}
 }
+
+func TestValueResourceProjection(t *testing.T) {
+	sim := &Simulation{CurrentTime: time.Second * 10, nextManaTick: time.Second * 11}
+	unit := &Unit{PseudoStats: stats.NewPseudoStats()}
+	rot := &APLRotation{
+		unit: unit,
+	}
+	constVal := func(val string) APLValue {
+		return rot.newValueConst(&proto.APLValueConst{Val: val})
+	}
+
+	unit.energyBar = energyBar{
+		unit:                 unit,
+		maxEnergy:            100,
+		currentEnergy:        30,
+		EnergyTickMultiplier: 1,
+		nextEnergyTick:       time.Second * 11,
+	}
+
+	energyAt := func(delay string) float64 {
+		return (&APLValueResourceAt{unit: unit, resource: proto.APLValueResourceAt_Energy, delay: constVal(delay)}).GetFloat(sim)
+	}
+	if energy := energyAt("0s"); energy != 30 {
+		t.Fatalf("Unexpected energy now %f", energy)
+	}
+	if energy := energyAt("3.02s"); !WithinToleranceFloat64(70.4, energy, 1e-9) {
+		t.Fatalf("Unexpected energy after two ticks %f", energy)
+	}
+	if energy := energyAt("10s"); energy != 100 {
+		t.Fatalf("Unexpected capped energy %f", energy)
+	}
+
+	timeToEnergy := func(amount string) time.Duration {
+		return (&APLValueTimeToResource{unit: unit, resource: proto.APLValueResourceAt_Energy, amount: constVal(amount)}).GetDuration(sim)
+	}
+	if dur := timeToEnergy("60"); dur != time.Millisecond*3020 {
+		t.Fatalf("Unexpected time to 60 energy %s", dur)
+	}
+	if dur := timeToEnergy("101"); dur != NeverExpires {
+		t.Fatalf("Unexpected time to unreachable energy %s", dur)
+	}
+
+	// The 5-second rule ends at 13s, so only the tick at 11s gives the lower casting regen.
+	unit.manaBar.unit = unit
+	unit.stats[stats.Mana] = 1000
+	unit.currentMana = 500
+	unit.manaTickWhileCasting = 10
+	unit.manaTickWhileNotCasting = 50
+	unit.PseudoStats.FiveSecondRuleRefreshTime = time.Second * 13
+
+	manaAt := (&APLValueResourceAt{unit: unit, resource: proto.APLValueResourceAt_Mana, delay: constVal("4s")}).GetFloat(sim)
+	if manaAt != 560 {
+		t.Fatalf("Unexpected projected mana %f", manaAt)
+	}
+	timeToMana := (&APLValueTimeToResource{unit: unit, resource: proto.APLValueResourceAt_Mana, amount: constVal("600")}).GetDuration(sim)
+	if timeToMana != time.Second*5 {
+		t.Fatalf("Unexpected time to mana %s", timeToMana)
+	}
+}
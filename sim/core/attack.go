@@ -239,7 +239,9 @@ type WeaponAttack struct {
 
 	replaceSwing ReplaceMHSwing
 
-	swingAt time.Duration
+	swingAt     time.Duration
+	lastSwingAt time.Duration
+	parryHasted bool // Whether the pending swing was moved forward by parry haste.
 
 	curSwingSpeed    float64
 	curSwingDuration time.Duration
@@ -281,6 +283,11 @@ func (wa *WeaponAttack) swing(sim *Simulation) time.Duration {
 		// Update swing timer BEFORE the cast, so that APL checks for TimeToNextAuto behave correctly
 		// if the attack causes APL evaluations (e.g. from rage gain).
 		wa.swingAt = sim.CurrentTime + wa.curSwingDuration
+		wa.lastSwingAt = sim.CurrentTime
+		wa.parryHasted = false
+		if sim.CombatLog != nil {
+			sim.CombatLog.swing(sim, wa, attackSpell, wa.unit.CurrentTarget)
+		}
 		attackSpell.Cast(sim, wa.unit.CurrentTarget)
 
 		if !sim.Options.Interactive && wa.unit.Rotation != nil {
@@ -458,6 +465,10 @@ func (aa *AutoAttacks) reset(sim *Simulation) {
 
 	aa.mh.swingAt = NeverExpires
 	aa.oh.swingAt = NeverExpires
+	aa.mh.lastSwingAt = 0
+	aa.oh.lastSwingAt = 0
+	aa.ranged.lastSwingAt = 0
+	aa.mh.parryHasted = false
 
 	if aa.AutoSwingMelee {
 		aa.mh.updateSwingDuration(aa.mh.unit.SwingSpeed())
@@ -574,6 +585,31 @@ func (aa *AutoAttacks) OffhandSwingSpeed() time.Duration {
 	return aa.oh.curSwingDuration
 }
 
+// The amount of time between two ranged attacks.
+func (aa *AutoAttacks) RangedSwingSpeed() time.Duration {
+	return aa.ranged.curSwingDuration
+}
+
+// Returns the time at which the last MH swing happened, or 0 if there was none yet.
+func (aa *AutoAttacks) MainhandLastSwingAt() time.Duration {
+	return aa.mh.lastSwingAt
+}
+
+// Returns the time at which the last OH swing happened, or 0 if there was none yet.
+func (aa *AutoAttacks) OffhandLastSwingAt() time.Duration {
+	return aa.oh.lastSwingAt
+}
+
+// Returns the time at which the last ranged attack happened, or 0 if there was none yet.
+func (aa *AutoAttacks) RangedLastSwingAt() time.Duration {
+	return aa.ranged.lastSwingAt
+}
+
+// Returns whether the pending MH swing was moved forward by parry haste.
+func (aa *AutoAttacks) MainhandParryHasted() bool {
+	return aa.mh.parryHasted
+}
+
 // Optionally replaces the given swing spell with an Agent-specified MH Swing replacer.
 // This is for effects like Heroic Strike or Raptor Strike.
 func (aa *AutoAttacks) MaybeReplaceMHSwing(sim *Simulation, mhSwingSpell *Spell) *Spell {
@@ -823,6 +859,7 @@ func (unit *Unit) applyParryHaste() {
 			}
 
 			aura.Unit.AutoAttacks.mh.swingAt = newReadyAt
+			aura.Unit.AutoAttacks.mh.parryHasted = true
 			sim.rescheduleWeaponAttack(newReadyAt)
 		},
 	})
@@ -3,6 +3,7 @@ package core
 import (
 	"fmt"
 	"math"
+	"slices"
 	"strconv"
 	"time"
 
@@ -203,6 +204,9 @@ func (aura *Aura) SetStacks(sim *Simulation, newStacks int32) {
 		aura.Unit.Log(sim, "%s stacks: %d --> %d", aura.ActionID, oldStacks, newStacks)
 	}
 	aura.stacks = newStacks
+	if sim.CombatLog != nil && !aura.ActionID.IsEmptyAction() {
+		sim.CombatLog.auraChanged(sim, aura, proto.CombatLogEvent_AuraStacksChanged)
+	}
 	if aura.OnStacksChange != nil {
 		aura.OnStacksChange(aura, sim, oldStacks, newStacks)
 	}
@@ -549,9 +553,13 @@ restart:
 func (aura *Aura) Activate(sim *Simulation) {
 	aura.metrics.Procs++
 	if aura.IsActive() {
+		aura.metrics.Refreshes++
 		if sim.Log != nil && !aura.ActionID.IsEmptyAction() {
 			aura.Unit.Log(sim, "Aura refreshed: %s", aura.ActionID)
 		}
+		if sim.CombatLog != nil && !aura.ActionID.IsEmptyAction() {
+			sim.CombatLog.auraChanged(sim, aura, proto.CombatLogEvent_AuraRefreshed)
+		}
 		aura.Refresh(sim)
 		return
 	}
@@ -636,6 +644,9 @@ func (aura *Aura) Activate(sim *Simulation) {
 	if sim.Log != nil && !aura.ActionID.IsEmptyAction() {
 		aura.Unit.Log(sim, "Aura gained: %s", aura.ActionID)
 	}
+	if sim.CombatLog != nil && !aura.ActionID.IsEmptyAction() {
+		sim.CombatLog.auraChanged(sim, aura, proto.CombatLogEvent_AuraGained)
+	}
 
 	// don't invoke possible callbacks until the internal state is consistent
 	if aura.OnGain != nil {
@@ -643,6 +654,29 @@ func (aura *Aura) Activate(sim *Simulation) {
 	}
 }
 
+// Removes everything this aura does while active, leaving only its state and metrics.
+func (aura *Aura) disableEffects() {
+	for _, ee := range aura.ExclusiveEffects {
+		ee.Category.effects = slices.DeleteFunc(ee.Category.effects, func(effect *ExclusiveEffect) bool { return effect == ee })
+	}
+	aura.ExclusiveEffects = nil
+
+	aura.OnGain = nil
+	aura.OnExpire = nil
+	aura.OnStacksChange = nil
+	aura.OnStatsChange = nil
+	aura.OnCastComplete = nil
+	aura.OnSpellHitDealt = nil
+	aura.OnSpellHitTaken = nil
+	aura.OnPeriodicDamageDealt = nil
+	aura.OnPeriodicDamageTaken = nil
+	aura.OnHealDealt = nil
+	aura.OnHealTaken = nil
+	aura.OnPeriodicHealDealt = nil
+	aura.OnPeriodicHealTaken = nil
+	aura.OnRageChange = nil
+}
+
 // Remove an aura by its ID
 func (aura *Aura) Deactivate(sim *Simulation) {
 	if !aura.active {
@@ -651,16 +685,22 @@ func (aura *Aura) Deactivate(sim *Simulation) {
 	aura.active = false
 
 	if !aura.ActionID.IsEmptyAction() {
-		if sim.CurrentTime > aura.expires {
-			aura.metrics.Uptime += aura.expires - max(aura.startTime, 0)
-		} else {
-			aura.metrics.Uptime += sim.CurrentTime - max(aura.startTime, 0)
+		if aura.expires <= sim.CurrentTime {
+			aura.metrics.Expirations++
+		}
+		end := min(sim.CurrentTime, aura.expires)
+		aura.metrics.Uptime += end - max(aura.startTime, 0)
+		if aura.Unit.Metrics.timeline != nil {
+			aura.Unit.Metrics.timeline.addAuraUptime(aura.ActionID, aura.startTime, end)
 		}
 	}
 
 	if sim.Log != nil && !aura.ActionID.IsEmptyAction() {
 		aura.Unit.Log(sim, "Aura faded: %s", aura.ActionID)
 	}
+	if sim.CombatLog != nil && !aura.ActionID.IsEmptyAction() {
+		sim.CombatLog.auraChanged(sim, aura, proto.CombatLogEvent_AuraFaded)
+	}
 
 	aura.expires = 0
 	if aura.activeIndex != Inactive {
@@ -860,6 +900,22 @@ func (at *auraTracker) OnPeriodicHealTaken(sim *Simulation, spell *Spell, result
 	}
 }
 
+// Adds the aura metrics of another copy of this unit, matching auras by label.
+func (at *auraTracker) mergeMetrics(other *auraTracker) {
+	for i, otherAura := range other.auras {
+		if i < len(at.auras) && at.auras[i].Label == otherAura.Label {
+			at.auras[i].metrics.mergeMetrics(&otherAura.metrics)
+			continue
+		}
+		if aura := at.GetAura(otherAura.Label); aura != nil {
+			aura.metrics.mergeMetrics(&otherAura.metrics)
+		} else {
+			// Only the metrics of the aura are used once all iterations are done.
+			at.auras = append(at.auras, otherAura)
+		}
+	}
+}
+
 func (at *auraTracker) GetMetricsProto() []*proto.AuraMetrics {
 	metrics := make([]*proto.AuraMetrics, 0, len(at.auras))
 
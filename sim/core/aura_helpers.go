@@ -187,6 +187,49 @@ func MakePermanent(aura *Aura) *Aura {
 	return aura
 }
 
+// Makes an external debuff build up over the start of the fight, the way it would when applied by
+// another raid member. The aura is applied at startTime and gains a stack every period until it
+// reaches numStacks, then stays active for the rest of the fight.
+func MakeRampingUp(aura *Aura, startTime time.Duration, period time.Duration, numStacks int32) *Aura {
+	if aura == nil {
+		return nil
+	}
+
+	aura.Duration = NeverExpires
+	oldOnReset := aura.OnReset
+	aura.OnReset = func(aura *Aura, sim *Simulation) {
+		if oldOnReset != nil {
+			oldOnReset(aura, sim)
+		}
+		StartDelayedAction(sim, DelayedActionOptions{
+			DoAt:     startTime,
+			Priority: ActionPriorityDOT, // High prio so it comes before the player's own applications.
+			OnAction: func(sim *Simulation) {
+				aura.Activate(sim)
+				if aura.MaxStacks == 0 {
+					return
+				}
+				if aura.GetStacks() == 0 {
+					aura.AddStack(sim)
+				}
+				if numStacks > 1 {
+					StartPeriodicAction(sim, PeriodicActionOptions{
+						Period:   period,
+						NumTicks: int(numStacks - 1),
+						Priority: ActionPriorityDOT,
+						OnAction: func(sim *Simulation) {
+							if aura.IsActive() {
+								aura.AddStack(sim)
+							}
+						},
+					})
+				}
+			},
+		})
+	}
+	return aura
+}
+
 // Helper for the common case of making an aura that adds stats.
 func (character *Character) NewTemporaryStatsAura(auraLabel string, actionID ActionID, tempStats stats.Stats, duration time.Duration) *Aura {
 	return character.NewTemporaryStatsAuraWrapped(auraLabel, actionID, tempStats, duration, nil)
@@ -0,0 +1,329 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"slices"
+
+	googleProto "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/wowsims/sod/sim/core/proto"
+)
+
+const defaultBuffAttributionIterations = 3000
+
+func BuffAttribution(ctx context.Context, request *proto.BuffAttributionRequest, progress chan *proto.ProgressMetrics) *proto.BuffAttributionResult {
+	attribution := &buffAttribution{
+		SingleRaidSimRunner: runSim,
+		Request:             request,
+	}
+
+	result, err := attribution.Run(ctx, progress)
+	if err != nil {
+		result = &proto.BuffAttributionResult{
+			ErrorResult: err.Error(),
+		}
+	}
+
+	if progress != nil {
+		progress <- &proto.ProgressMetrics{
+			FinalBuffAttributionResult: result,
+		}
+		close(progress)
+	}
+
+	return result
+}
+
+// buffAttribution measures how much raid DPS each buff and debuff provider adds, by simming the
+// raid once with every provider removed and comparing against the full raid with common random
+// numbers. Providers are the individual raid buff, debuff and party buff settings, each player's
+// own raid and party buffs, and each debuff that a player applies through their rotation. The
+// rotation still casts the spells applying a removed debuff, only the debuff has no effect.
+type buffAttribution struct {
+	// SingleRaidSimRunner used to run each batch of iterations.
+	SingleRaidSimRunner raidSimRunner
+	// Request used for this attribution.
+	Request *proto.BuffAttributionRequest
+
+	baseRequest *proto.RaidSimRequest
+}
+
+type buffCandidate struct {
+	contribution *proto.BuffContribution
+	race         *raceCandidate
+}
+
+func (ba *buffAttribution) Run(pctx context.Context, progress chan *proto.ProgressMetrics) (result *proto.BuffAttributionResult, resultErr error) {
+	ctx, cancel := context.WithCancel(pctx)
+	defer func() {
+		if err := recover(); err != nil {
+			result = &proto.BuffAttributionResult{
+				ErrorResult: fmt.Sprintf("%v\nStack Trace:\n%s", err, string(debug.Stack())),
+			}
+		}
+		cancel()
+	}()
+
+	if ba.Request.GetBaseSettings().GetRaid() == nil {
+		return nil, fmt.Errorf("buff attribution: missing base settings")
+	}
+	ba.baseRequest = googleProto.Clone(ba.Request.BaseSettings).(*proto.RaidSimRequest)
+	if ba.baseRequest.SimOptions == nil {
+		ba.baseRequest.SimOptions = &proto.SimOptions{}
+	}
+	for _, party := range ba.baseRequest.Raid.Parties {
+		for _, player := range party.GetPlayers() {
+			if player.GetDatabase() != nil {
+				addToDatabase(player.GetDatabase())
+			}
+		}
+	}
+
+	iterations := int(ba.baseRequest.SimOptions.Iterations)
+	if iterations <= 0 {
+		iterations = defaultBuffAttributionIterations
+	}
+	iterations = max(iterations, 2)
+
+	candidates := ba.candidates()
+
+	race := newSimRace(ba.SingleRaidSimRunner, ba.baseRequest, 0, 0, progress)
+	race.metric = func(result *proto.RaidSimResult) *proto.DistributionMetrics {
+		return result.RaidMetrics.Dps
+	}
+	race.expect(len(candidates)+1, (len(candidates)+1)*iterations)
+
+	base := &raceCandidate{Request: ba.baseRequest}
+	all := append([]*raceCandidate{base}, MapSlice(candidates, func(c *buffCandidate) *raceCandidate { return c.race })...)
+	if err := race.extend(ctx, all, iterations); err != nil {
+		return nil, err
+	}
+
+	result = &proto.BuffAttributionResult{
+		BaseRaidDps: base.Mean(),
+		Iterations:  int32(iterations),
+	}
+	for _, candidate := range candidates {
+		delta, halfWidth := compareRaceCandidates(base, candidate.race)
+		candidate.contribution.RaidDpsDelta = delta
+		candidate.contribution.RaidDpsDeltaCiLow = delta - halfWidth
+		candidate.contribution.RaidDpsDeltaCiHigh = delta + halfWidth
+		result.Contributions = append(result.Contributions, candidate.contribution)
+	}
+	return result, nil
+}
+
+// Builds a request for every provider, each with that provider removed from the base raid.
+func (ba *buffAttribution) candidates() []*buffCandidate {
+	var candidates []*buffCandidate
+	newCandidate := func(contribution *proto.BuffContribution, modify func(raid *proto.Raid)) *buffCandidate {
+		request := googleProto.Clone(ba.baseRequest).(*proto.RaidSimRequest)
+		modify(request.Raid)
+		candidate := &buffCandidate{
+			contribution: contribution,
+			race:         &raceCandidate{Request: request},
+		}
+		candidates = append(candidates, candidate)
+		return candidate
+	}
+
+	for _, field := range setFieldNames(ba.baseRequest.Raid.Buffs) {
+		newCandidate(&proto.BuffContribution{
+			Source: proto.BuffContribution_SourceRaidBuffs,
+			Buffs:  []string{field},
+		}, func(raid *proto.Raid) { clearField(raid.Buffs, field) })
+	}
+	for _, field := range setFieldNames(ba.baseRequest.Raid.Debuffs) {
+		newCandidate(&proto.BuffContribution{
+			Source: proto.BuffContribution_SourceDebuffs,
+			Buffs:  []string{field},
+		}, func(raid *proto.Raid) { clearField(raid.Debuffs, field) })
+	}
+	for partyIdx, party := range ba.baseRequest.Raid.Parties {
+		if countEmptyPlayers(party.GetPlayers()) == len(party.GetPlayers()) {
+			continue
+		}
+		for _, field := range setFieldNames(party.GetBuffs()) {
+			partyIdx := partyIdx
+			newCandidate(&proto.BuffContribution{
+				Source:     proto.BuffContribution_SourcePartyBuffs,
+				PartyIndex: int32(partyIdx),
+				Buffs:      []string{field},
+			}, func(raid *proto.Raid) { clearField(raid.Parties[partyIdx].Buffs, field) })
+		}
+	}
+
+	for partyIdx, party := range ba.baseRequest.Raid.Parties {
+		for playerIdx, player := range party.GetPlayers() {
+			if player == nil || player.Class == proto.Class_ClassUnknown {
+				continue
+			}
+			raidIndex := int32(partyIdx*5 + playerIdx)
+			lost := ba.buffsProvidedBy(partyIdx, raidIndex)
+			if len(lost) == 0 {
+				// Nothing to attribute to this player.
+				continue
+			}
+			candidate := newCandidate(&proto.BuffContribution{
+				Source:     proto.BuffContribution_SourcePlayer,
+				PartyIndex: int32(partyIdx),
+				Player:     &proto.UnitReference{Type: proto.UnitReference_Player, Index: raidIndex},
+				PlayerName: player.Name,
+				Buffs:      lost,
+			}, func(raid *proto.Raid) {})
+			candidate.race.runner = func(request *proto.RaidSimRequest, progress chan *proto.ProgressMetrics, skipPresim bool) *proto.RaidSimResult {
+				return runSimWithExclusions(request, progress, skipPresim, simExclusions{buffProviders: []int32{raidIndex}})
+			}
+		}
+	}
+
+	for _, debuff := range ba.rotationDebuffs() {
+		debuff := debuff
+		player := ba.baseRequest.Raid.Parties[debuff.partyIdx].Players[debuff.playerIdx]
+		candidate := newCandidate(&proto.BuffContribution{
+			Source:     proto.BuffContribution_SourceRotationDebuff,
+			PartyIndex: int32(debuff.partyIdx),
+			Player:     &proto.UnitReference{Type: proto.UnitReference_Player, Index: int32(debuff.partyIdx*5 + debuff.playerIdx)},
+			PlayerName: player.Name,
+			Buffs:      []string{debuff.label},
+		}, func(raid *proto.Raid) {})
+		candidate.race.runner = func(request *proto.RaidSimRequest, progress chan *proto.ProgressMetrics, skipPresim bool) *proto.RaidSimResult {
+			return runSimWithExclusions(request, progress, skipPresim, simExclusions{debuffs: []string{debuff.label}})
+		}
+	}
+	return candidates
+}
+
+// Returns the names of the raid and party buff fields that change when the buffs of the player
+// at the given raid index are excluded.
+func (ba *buffAttribution) buffsProvidedBy(partyIdx int, raidIndex int32) []string {
+	effectiveBuffs := func(excluded []int32) (*proto.RaidBuffs, *proto.PartyBuffs) {
+		raidConfig := googleProto.Clone(ba.baseRequest.Raid).(*proto.Raid)
+		raid := newRaid(raidConfig, excluded)
+		return raid.GetRaidBuffs(raidConfig.Buffs), raid.Parties[partyIdx].GetPartyBuffs(raidConfig.Parties[partyIdx].Buffs)
+	}
+
+	withRaidBuffs, withPartyBuffs := effectiveBuffs(nil)
+	withoutRaidBuffs, withoutPartyBuffs := effectiveBuffs([]int32{raidIndex})
+	return append(changedFieldNames(withRaidBuffs, withoutRaidBuffs), changedFieldNames(withPartyBuffs, withoutPartyBuffs)...)
+}
+
+// A debuff that a player applies through their rotation.
+type rotationDebuff struct {
+	partyIdx  int
+	playerIdx int
+	label     string
+}
+
+// Finds the debuffs that players apply to enemies with the spells their rotation casts.
+func (ba *buffAttribution) rotationDebuffs() []*rotationDebuff {
+	env, _, _ := NewEnvironment(googleProto.Clone(ba.baseRequest.Raid).(*proto.Raid), ba.baseRequest.Encounter, false)
+
+	var debuffs []*rotationDebuff
+	for partyIdx, party := range ba.baseRequest.Raid.Parties {
+		for playerIdx, player := range party.GetPlayers() {
+			rotation := player.GetRotation()
+			character := findCharacter(env, int32(partyIdx*5+playerIdx))
+			if rotation == nil || character == nil {
+				continue
+			}
+
+			var labels []string
+			addLabels := func(action *proto.APLAction) {
+				for _, label := range appliedDebuffLabels(env, character, action) {
+					if !slices.Contains(labels, label) {
+						labels = append(labels, label)
+						debuffs = append(debuffs, &rotationDebuff{partyIdx: partyIdx, playerIdx: playerIdx, label: label})
+					}
+				}
+			}
+			for _, item := range rotation.PrepullActions {
+				addLabels(item.GetAction())
+			}
+			for _, item := range rotation.PriorityList {
+				addLabels(item.GetAction())
+			}
+		}
+	}
+	return debuffs
+}
+
+func findCharacter(env *Environment, raidIndex int32) *Character {
+	for _, party := range env.Raid.Parties {
+		for _, player := range party.Players {
+			if player.GetCharacter().Index == raidIndex {
+				return player.GetCharacter()
+			}
+		}
+	}
+	return nil
+}
+
+// Labels of the enemy auras related to the spell that action casts, if any.
+func appliedDebuffLabels(env *Environment, character *Character, action *proto.APLAction) []string {
+	var spellID *proto.ActionID
+	switch action := action.GetAction().(type) {
+	case *proto.APLAction_CastSpell:
+		spellID = action.CastSpell.GetSpellId()
+	case *proto.APLAction_ChannelSpell:
+		spellID = action.ChannelSpell.GetSpellId()
+	case *proto.APLAction_Multidot:
+		spellID = action.Multidot.GetSpellId()
+	}
+	if spellID == nil {
+		return nil
+	}
+	spell := character.GetSpell(ProtoToActionID(spellID))
+	if spell == nil {
+		return nil
+	}
+
+	var labels []string
+	for _, auras := range spell.RelatedAuras {
+		for _, target := range env.Encounter.TargetUnits {
+			if aura := auras.Get(target); aura != nil {
+				labels = append(labels, aura.Label)
+				break
+			}
+		}
+	}
+	return labels
+}
+
+// Names of the fields that are set in msg, in field number order.
+func setFieldNames(msg googleProto.Message) []string {
+	var names []string
+	if msg == nil || !msg.ProtoReflect().IsValid() {
+		return names
+	}
+	fields := msg.ProtoReflect().Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		if msg.ProtoReflect().Has(fields.Get(i)) {
+			names = append(names, string(fields.Get(i).Name()))
+		}
+	}
+	return names
+}
+
+// Names of the fields whose values differ between a and b, which are of the same message type.
+func changedFieldNames(a googleProto.Message, b googleProto.Message) []string {
+	var names []string
+	fields := a.ProtoReflect().Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if !a.ProtoReflect().Get(fd).Equal(b.ProtoReflect().Get(fd)) {
+			names = append(names, string(fd.Name()))
+		}
+	}
+	return names
+}
+
+func clearField(msg googleProto.Message, name string) {
+	fd := msg.ProtoReflect().Descriptor().Fields().ByName(protoreflect.Name(name))
+	if fd != nil {
+		msg.ProtoReflect().Clear(fd)
+	}
+}
@@ -0,0 +1,162 @@
+package core
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wowsims/sod/sim/core/proto"
+	"github.com/wowsims/sod/sim/core/stats"
+)
+
+func init() {
+	RegisterAgentFactory(
+		proto.Player_Warlock{},
+		proto.Spec_SpecWarlock,
+		newFakeWarlock,
+		func(player *proto.Player, spec interface{}) {
+			playerSpec, ok := spec.(*proto.Player_Warlock)
+			if !ok {
+				panic("Invalid spec value for Warlock!")
+			}
+			player.Spec = playerSpec
+		},
+	)
+}
+
+// A fake Warlock that provides Blood Pact and has a spell applying Curse of Shadow.
+type fakeWarlock struct {
+	Character
+}
+
+func newFakeWarlock(char *Character, _ *proto.Player) Agent {
+	return &fakeWarlock{Character: *char}
+}
+
+func (warlock *fakeWarlock) GetCharacter() *Character {
+	return &warlock.Character
+}
+
+func (warlock *fakeWarlock) AddRaidBuffs(raidBuffs *proto.RaidBuffs) {
+	raidBuffs.BloodPact = proto.TristateEffect_TristateEffectRegular
+}
+
+func (warlock *fakeWarlock) Initialize() {
+	curses := warlock.NewEnemyAuraArray(CurseOfShadowAura)
+	warlock.RegisterSpell(SpellConfig{
+		ActionID:     ActionID{SpellID: 17937},
+		SpellSchool:  SpellSchoolShadow,
+		ProcMask:     ProcMaskEmpty,
+		RelatedAuras: []AuraArray{curses},
+		ApplyEffects: func(sim *Simulation, target *Unit, _ *Spell) {
+			curses.Get(target).Activate(sim)
+		},
+	})
+}
+
+func (warlock *fakeWarlock) ApplyTalents()            {}
+func (warlock *fakeWarlock) ApplyRunes()              {}
+func (warlock *fakeWarlock) Reset(_ *Simulation)      {}
+func (warlock *fakeWarlock) OnGCDReady(_ *Simulation) {}
+
+func TestBuffAttribution(t *testing.T) {
+	rsr := fakeCasterRaidSimRequest()
+	rsr.Raid.Buffs = &proto.RaidBuffs{BattleShout: proto.TristateEffect_TristateEffectImproved}
+	rsr.Raid.Debuffs = &proto.Debuffs{ShadowWeaving: true}
+	curse := ActionID{SpellID: 17937}.ToProto()
+	rsr.Raid.Parties[0].Players = append(rsr.Raid.Parties[0].Players, &proto.Player{
+		Name:      "Warlock",
+		Class:     proto.Class_ClassWarlock,
+		Level:     60,
+		Equipment: &proto.EquipmentSpec{},
+		Spec:      &proto.Player_Warlock{Warlock: &proto.Warlock{}},
+		Rotation: &proto.APLRotation{
+			Type: proto.APLRotation_TypeAPL,
+			PriorityList: []*proto.APLListItem{
+				{Action: &proto.APLAction{
+					Condition: &proto.APLValue{Value: &proto.APLValue_Not{Not: &proto.APLValueNot{Val: &proto.APLValue{Value: &proto.APLValue_AuraIsActive{AuraIsActive: &proto.APLValueAuraIsActive{
+						SourceUnit: &proto.UnitReference{Type: proto.UnitReference_CurrentTarget},
+						AuraId:     curse,
+					}}}}}},
+					Action: &proto.APLAction_CastSpell{CastSpell: &proto.APLActionCastSpell{SpellId: curse}},
+				}},
+			},
+		},
+	})
+
+	result := RunBuffAttribution(&proto.BuffAttributionRequest{BaseSettings: rsr})
+	if result.ErrorResult != "" {
+		t.Fatalf("Attribution failed with error: %s", result.ErrorResult)
+	}
+
+	contributions := map[string]*proto.BuffContribution{}
+	for _, contribution := range result.Contributions {
+		contributions[contribution.Source.String()+"/"+strings.Join(contribution.Buffs, ",")] = contribution
+	}
+	if len(result.Contributions) != 4 {
+		t.Fatalf("Expected 4 contributions, got %v", result.Contributions)
+	}
+	for _, key := range []string{"SourceRaidBuffs/battle_shout", "SourceDebuffs/shadow_weaving", "SourcePlayer/blood_pact", "SourceRotationDebuff/Curse of Shadow"} {
+		if contributions[key] == nil {
+			t.Fatalf("Missing contribution %s in %v", key, result.Contributions)
+		}
+	}
+
+	// Neither Battle Shout nor Blood Pact change the damage of the fake dot.
+	for _, key := range []string{"SourceRaidBuffs/battle_shout", "SourcePlayer/blood_pact"} {
+		if contribution := contributions[key]; contribution.RaidDpsDelta != 0 {
+			t.Errorf("Expected no contribution from %s, got %.3f", key, contribution.RaidDpsDelta)
+		}
+	}
+	if warlock := contributions["SourcePlayer/blood_pact"]; warlock.PlayerName != "Warlock" || warlock.Player.Index != 1 {
+		t.Errorf("Unexpected player contribution %v", warlock)
+	}
+	if weaving := contributions["SourceDebuffs/shadow_weaving"]; weaving.RaidDpsDeltaCiLow <= 0 {
+		t.Errorf("Expected a positive contribution from Shadow Weaving, got %.3f [%.3f, %.3f]", weaving.RaidDpsDelta, weaving.RaidDpsDeltaCiLow, weaving.RaidDpsDeltaCiHigh)
+	}
+
+	// Curse of Shadow multiplies all of the raid's damage by 1.1.
+	curseContribution := contributions["SourceRotationDebuff/Curse of Shadow"]
+	if curseContribution.PlayerName != "Warlock" || curseContribution.Player.Index != 1 {
+		t.Errorf("Expected the Warlock's Curse of Shadow, got %v", curseContribution)
+	}
+	if expected := result.BaseRaidDps * (1 - 1/1.1); curseContribution.RaidDpsDeltaCiLow <= 0 || math.Abs(curseContribution.RaidDpsDelta-expected) > 0.01*expected {
+		t.Errorf("Expected a contribution of %.3f from Curse of Shadow, got %.3f [%.3f, %.3f]", expected, curseContribution.RaidDpsDelta, curseContribution.RaidDpsDeltaCiLow, curseContribution.RaidDpsDeltaCiHigh)
+	}
+}
+
+func TestExcludedDebuffHasNoEffect(t *testing.T) {
+	debuffs := &proto.Debuffs{CurseOfElements: true}
+	for _, excluded := range []bool{false, true} {
+		exclusions := simExclusions{}
+		if excluded {
+			exclusions.debuffs = []string{"Curse of Elements"}
+		}
+		sim := newSim(debuffsSimRequest(debuffs), exclusions)
+		target := sim.Encounter.TargetUnits[0]
+
+		active, multiplier := false, 0.0
+		sim.reset()
+		sim.PrePull()
+		StartDelayedAction(sim, DelayedActionOptions{
+			DoAt:     time.Second * 10,
+			Priority: ActionPriorityLow,
+			OnAction: func(sim *Simulation) {
+				active = target.GetAura("Curse of Elements").IsActive()
+				multiplier = target.PseudoStats.SchoolDamageTakenMultiplier[stats.SchoolIndexFire]
+			},
+		})
+		sim.runPendingActions()
+		sim.Cleanup()
+
+		// The excluded curse is still applied, so rotations see it, but doesn't increase damage.
+		expected := 1.1
+		if excluded {
+			expected = 1
+		}
+		if !active || !WithinToleranceFloat64(expected, multiplier, 1e-9) {
+			t.Errorf("Excluded: %t, curse active: %t with fire damage taken multiplier %.3f, expected %.3f", excluded, active, multiplier, expected)
+		}
+	}
+}
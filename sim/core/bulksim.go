@@ -1,24 +1,24 @@
 package core
 
 import (
+	"cmp"
 	"context"
-	"errors"
 	"fmt"
 	"math"
-	"runtime"
 	"runtime/debug"
+	"slices"
 	"sort"
 	"strings"
-	"sync/atomic"
-	"time"
 
 	goproto "google.golang.org/protobuf/proto"
 
 	"github.com/wowsims/sod/sim/core/proto"
+	"github.com/wowsims/sod/sim/core/stats"
 )
 
 const (
 	defaultIterationsPerCombo = 1000
+	defaultEnchantsPerItem    = 2
 )
 
 // raidSimRunner runs a standard raid simulation.
@@ -30,6 +30,20 @@ type bulkSimRunner struct {
 	SingleRaidSimRunner raidSimRunner
 	// Request used for this bulk simulation.
 	Request *proto.BulkSimRequest
+
+	// Location of the bulk simmed player in the raid.
+	partyIdx  int
+	playerIdx int
+	// Index of the player within its party's metrics, which skip empty player slots.
+	metricsIdx int
+
+	// Enchants to try on each replacement item, when optimizing enchants.
+	enchantOptions map[bulkEnchantKey][]int32
+}
+
+type bulkEnchantKey struct {
+	itemID int32
+	slot   proto.ItemSlot
 }
 
 func BulkSim(ctx context.Context, request *proto.BulkSimRequest, progress chan *proto.ProgressMetrics) *proto.BulkSimResult {
@@ -72,29 +86,10 @@ func (b *bulkSimRunner) Run(pctx context.Context, progress chan *proto.ProgressM
 		cancel()
 	}()
 
-	// Bulk simming is only supported for the single-player use (i.e. not whole raid-wide simming).
-	// Verify that we have exactly 1 player.
-	var playerCount int
-	var player *proto.Player
-	for _, p := range b.Request.GetBaseSettings().GetRaid().GetParties() {
-		for _, pl := range p.GetPlayers() {
-			// TODO(Riotdog-GehennasEU): Better way to check if a player is valid/set?
-			if pl.Name != "" {
-				player = pl
-				playerCount++
-			}
-		}
-	}
-	if playerCount != 1 || player == nil {
-		return nil, fmt.Errorf("bulksim: expected exactly 1 player, found %d", playerCount)
-	}
-	if player.GetDatabase() != nil {
-		addToDatabase(player.GetDatabase())
+	player, err := b.setupPlayer()
+	if err != nil {
+		return nil, err
 	}
-	// reduce to just base party.
-	b.Request.BaseSettings.Raid.Parties = []*proto.Party{b.Request.BaseSettings.Raid.Parties[0]}
-	// clean to reduce memory
-	player.Database = nil
 
 	// Gemming for now can happen before slots are decided.
 	// We might have to add logic after slot decisions if we want to enforce keeping meta gem active.
@@ -130,113 +125,60 @@ func (b *bulkSimRunner) Run(pctx context.Context, progress chan *proto.ProgressM
 	}
 	baseItems := player.Equipment.Items
 
+	if b.Request.BulkSettings.OptimizeEnchants {
+		b.enchantOptions = b.collectEnchantOptions(player, distinctItemSlotCombos)
+	}
+
 	allCombos := generateAllEquipmentSubstitutions(ctx, baseItems, b.Request.BulkSettings.Combinations, distinctItemSlotCombos)
 
 	var validCombos []singleBulkSim
 	count := 0
 	for sub := range allCombos {
-		count++
-		if count > 1000000 {
-			panic("over 1 million combos, abandoning attempt")
-		}
-		substitutedRequest, changeLog := createNewRequestWithSubstitution(b.Request.BaseSettings, sub, b.Request.BulkSettings.AutoEnchant)
-		if isValidEquipment(substitutedRequest.Raid.Parties[0].Players[0].Equipment) {
-			validCombos = append(validCombos, singleBulkSim{req: substitutedRequest, cl: changeLog, eq: sub})
+		for _, variant := range b.enchantVariants(sub) {
+			count++
+			if count > 1000000 {
+				panic("over 1 million combos, abandoning attempt")
+			}
+			substitutedRequest, changeLog := createNewRequestWithSubstitution(b.Request.BaseSettings, b.partyIdx, b.playerIdx, variant, b.Request.BulkSettings.AutoEnchant)
+			if isValidEquipment(substitutedRequest.Raid.Parties[b.partyIdx].Players[b.playerIdx].Equipment) {
+				validCombos = append(validCombos, singleBulkSim{req: substitutedRequest, cl: changeLog, eq: variant})
+			}
 		}
 	}
 
 	// TODO(Riotdog-GehennasEU): Make this configurable?
 	maxResults := 30
 
-	var rankedResults []*itemSubstitutionSimResult
-	var baseResult *itemSubstitutionSimResult
-	newIters := int64(iterations)
-	if b.Request.BulkSettings.FastMode {
-		newIters /= 100
-
-		// In fast mode try to keep starting iterations between 50 and 1000.
-		if newIters < 50 {
-			newIters = 50
-		}
-		if newIters > 1000 {
-			newIters = 1000
-		}
-	}
-
-	maxIterations := newIters * int64(len(validCombos))
-	if maxIterations > math.MaxInt32 {
-		return nil, fmt.Errorf("number of total iterations %d too large", maxIterations)
+	totalIterations := int64(iterations) * int64(len(validCombos))
+	if totalIterations > math.MaxInt32 {
+		return nil, fmt.Errorf("number of total iterations %d too large", totalIterations)
 	}
 
-	for {
-		var tempBase *itemSubstitutionSimResult
-		var err error
-		// TODO: we could theoretically make getRankedResults accept a channel of validCombos that stream in to it and launches sims as it gets them...
-		rankedResults, tempBase, err = b.getRankedResults(ctx, validCombos, newIters, progress)
+	// Combos start racing at fewer iterations, between 50 and 1000, and iterations is the upper limit.
+	minIterations := min(max(iterations/100, 50), 1000, iterations)
 
-		if err != nil {
-			return nil, err
-		}
-		// keep replacing the base result with more refined base until we don't have base in the ranked results anymore.
-		if tempBase != nil {
-			baseResult = tempBase
-		}
-
-		// If we aren't doing fast mode, or if halving our results will be less than the maxResults, be done.
-		if !b.Request.BulkSettings.FastMode || len(rankedResults) <= maxResults*2 {
-			break
-		}
-
-		// we have reached max accuracy now
-		if newIters >= int64(iterations) {
-			break
-		}
-
-		// Increase accuracy
-		newIters *= 2
-		newNumCombos := len(rankedResults) / 2
-		validCombos = validCombos[:newNumCombos]
-		rankedResults = rankedResults[:newNumCombos]
-		for i, comb := range rankedResults {
-			validCombos[i] = singleBulkSim{
-				req: comb.Request,
-				cl:  comb.ChangeLog,
-				eq:  comb.Substitution,
-			}
-		}
+	rankedResults, baseResult, err := b.getRankedResults(ctx, validCombos, int(minIterations), int(iterations), maxResults, progress)
+	if err != nil {
+		return nil, err
 	}
-
 	if baseResult == nil {
 		return nil, fmt.Errorf("no base result for equipped gear found in bulk sim")
 	}
 
+	if b.Request.BulkSettings.OptimizeEnchants {
+		rankedResults = bestEnchantVariants(rankedResults)
+	}
+
 	if len(rankedResults) > maxResults {
 		rankedResults = rankedResults[:maxResults]
 	}
 
-	bum := baseResult.Result.GetRaidMetrics().GetParties()[0].GetPlayers()[0]
-	bum.Actions = nil
-	bum.Auras = nil
-	bum.Resources = nil
-	bum.Pets = nil
-
 	result = &proto.BulkSimResult{
-		EquippedGearResult: &proto.BulkComboResult{
-			UnitMetrics: bum,
-		},
+		EquippedGearResult: b.comboResult(baseResult, baseResult),
 	}
 
 	for _, r := range rankedResults {
-		um := r.Result.GetRaidMetrics().GetParties()[0].GetPlayers()[0]
-		um.Actions = nil
-		um.Auras = nil
-		um.Resources = nil
-		um.Pets = nil
-
-		result.Results = append(result.Results, &proto.BulkComboResult{
-			ItemsAdded:  r.ChangeLog.AddedItems,
-			UnitMetrics: um,
-		})
+		result.Results = append(result.Results, b.comboResult(r, baseResult))
 	}
 
 	if progress != nil {
@@ -248,118 +190,257 @@ func (b *bulkSimRunner) Run(pctx context.Context, progress chan *proto.ProgressM
 	return result, nil
 }
 
-func (b *bulkSimRunner) getRankedResults(pctx context.Context, validCombos []singleBulkSim, iterations int64, progress chan *proto.ProgressMetrics) ([]*itemSubstitutionSimResult, *itemSubstitutionSimResult, error) {
-	concurrency := runtime.NumCPU() + 1
-	if concurrency <= 0 {
-		concurrency = 2
+// Finds the player to bulk sim and loads the item databases of all players.
+func (b *bulkSimRunner) setupPlayer() (*proto.Player, error) {
+	raid := b.Request.GetBaseSettings().GetRaid()
+	ref := b.Request.GetBulkSettings().GetPlayer()
+
+	var playerCount int
+	for _, p := range raid.GetParties() {
+		for _, pl := range p.GetPlayers() {
+			// TODO(Riotdog-GehennasEU): Better way to check if a player is valid/set?
+			if pl.GetName() != "" {
+				playerCount++
+			}
+			if pl.GetDatabase() != nil {
+				addToDatabase(pl.GetDatabase())
+				// clean to reduce memory
+				pl.Database = nil
+			}
+		}
+	}
+
+	if ref == nil || ref.Type == proto.UnitReference_Unknown {
+		// Without a chosen player, only single-player raids are supported.
+		if playerCount != 1 {
+			return nil, fmt.Errorf("bulksim: expected exactly 1 player, found %d; choose one with bulk settings player", playerCount)
+		}
+		partyIdx, _, err := findRaidPlayer(raid, nil)
+		if err != nil {
+			return nil, fmt.Errorf("bulksim: %w", err)
+		}
+		// reduce to just base party.
+		raid.Parties = []*proto.Party{raid.Parties[partyIdx]}
 	}
 
-	tickets := make(chan struct{}, concurrency)
-	for i := 0; i < concurrency; i++ {
-		tickets <- struct{}{}
+	partyIdx, playerIdx, err := findRaidPlayer(raid, ref)
+	if err != nil {
+		return nil, fmt.Errorf("bulksim: %w", err)
 	}
+	b.partyIdx = partyIdx
+	b.playerIdx = playerIdx
+	b.metricsIdx = playerIdx - countEmptyPlayers(raid.Parties[partyIdx].Players[:playerIdx])
+	return raid.Parties[partyIdx].Players[playerIdx], nil
+}
 
-	results := make(chan *itemSubstitutionSimResult, 10)
+// Finds the enchants to try on each replacement item: the best legal ones by EP, plus every
+// enchant with an effect implemented by the sim, since stat weights can't value those.
+func (b *bulkSimRunner) collectEnchantOptions(player *proto.Player, items []*itemWithSlot) map[bulkEnchantKey][]int32 {
+	legal := make(map[bulkEnchantKey][]int32)
+	var statsToWeigh []proto.Stat
+	for _, is := range items {
+		key := bulkEnchantKey{itemID: is.Item.Id, slot: is.Slot}
+		if _, ok := legal[key]; ok {
+			continue
+		}
+		item := ItemsByID[is.Item.Id]
+		legal[key] = []int32{}
+		for _, id := range sortedKeys(EnchantsByEffectID) {
+			enchant := EnchantsByEffectID[id]
+			if !enchantAppliesToItem(enchant, item) || !playerCanUseEnchant(enchant, player) {
+				continue
+			}
+			if !HasEnchantEffect(id) && enchant.Stats == (stats.Stats{}) {
+				continue // Does nothing in the sim.
+			}
+			legal[key] = append(legal[key], id)
+			for stat, value := range enchant.Stats {
+				if value != 0 && !slices.Contains(statsToWeigh, proto.Stat(stat)) {
+					statsToWeigh = append(statsToWeigh, proto.Stat(stat))
+				}
+			}
+		}
+	}
 
-	numCombinations := int32(len(validCombos))
-	totalIterationsUpperBound := int64(numCombinations) * iterations
+	var weights UnitStats
+	if b.Request.BulkSettings.EnchantEpWeights != nil {
+		weights = unitStatsFromProto(b.Request.BulkSettings.EnchantEpWeights)
+	} else {
+		weights = dpsStatWeights(b.Request.BaseSettings, b.partyIdx, player, statsToWeigh, nil, nil)
+	}
+	enchantEP := func(id int32) float64 {
+		ep := 0.0
+		for stat, value := range EnchantsByEffectID[id].Stats {
+			ep += value * weights.Stats[stat]
+		}
+		return ep
+	}
 
-	var totalCompletedIterations int32
-	var totalCompletedSims int32
+	enchantsPerItem := int(b.Request.BulkSettings.EnchantsPerItem)
+	if enchantsPerItem <= 0 {
+		enchantsPerItem = defaultEnchantsPerItem
+	}
+	options := make(map[bulkEnchantKey][]int32, len(legal))
+	for key, ids := range legal {
+		effects := FilterSlice(ids, HasEnchantEffect)
+		statEnchants := FilterSlice(ids, func(id int32) bool { return !HasEnchantEffect(id) })
+		slices.SortStableFunc(statEnchants, func(a, c int32) int {
+			return cmp.Compare(enchantEP(c), enchantEP(a))
+		})
+		options[key] = append(statEnchants[:min(len(statEnchants), enchantsPerItem)], effects...)
+	}
+	return options
+}
 
-	ctx, cancel := context.WithCancel(pctx)
-	// reporter for all sims combined.
-	go func() {
-		for ctx.Err() == nil {
-			complIters := atomic.LoadInt32(&totalCompletedIterations)
-			complSims := atomic.LoadInt32(&totalCompletedSims)
+// Returns the substitution once for each combination of enchants to try on its items. Items
+// that specify an enchant keep it. Without enchant optimization this is only the substitution.
+func (b *bulkSimRunner) enchantVariants(sub *equipmentSubstitution) []*equipmentSubstitution {
+	if b.enchantOptions == nil {
+		return []*equipmentSubstitution{sub}
+	}
 
-			// stop reporting
-			if complIters == int32(totalIterationsUpperBound) || numCombinations == complSims {
-				return
+	variants := []*equipmentSubstitution{{}}
+	for _, is := range sub.Items {
+		enchants := b.enchantOptions[bulkEnchantKey{itemID: is.Item.Id, slot: is.Slot}]
+		if is.Item.Enchant != 0 || len(enchants) == 0 {
+			for _, variant := range variants {
+				variant.Items = append(variant.Items, is)
 			}
+			continue
+		}
 
-			progress <- &proto.ProgressMetrics{
-				TotalSims:           numCombinations,
-				CompletedSims:       complSims,
-				CompletedIterations: complIters,
-				TotalIterations:     int32(totalIterationsUpperBound),
+		var next []*equipmentSubstitution
+		for _, variant := range variants {
+			for _, id := range enchants {
+				item := goproto.Clone(is.Item).(*proto.ItemSpec)
+				item.Enchant = id
+				replacement := createReplacement(*variant, &itemWithSlot{Item: item, Slot: is.Slot, Index: is.Index})
+				next = append(next, &replacement)
 			}
-			time.Sleep(time.Second)
 		}
-	}()
+		variants = next
+	}
+	return variants
+}
 
-	// launcher for all combos (limited by concurrency max)
-	go func() {
-		for _, singleCombo := range validCombos {
-			<-tickets
-			singleSimProgress := make(chan *proto.ProgressMetrics)
-			// watches this progress and pushes up to main reporter.
-			go func(prog chan *proto.ProgressMetrics) {
-				var prevDone int32
-				for p := range singleSimProgress {
-					delta := p.CompletedIterations - prevDone
-					atomic.AddInt32(&totalCompletedIterations, delta)
-					prevDone = p.CompletedIterations
-					if p.FinalRaidResult != nil {
-						break
-					}
-				}
-			}(singleSimProgress)
-			// actually run the sim in here.
-			go func(sub singleBulkSim) {
-				// overwrite the requests iterations with the input for this function.
-				sub.req.SimOptions.Iterations = int32(iterations)
-				results <- &itemSubstitutionSimResult{
-					Request:      sub.req,
-					Result:       b.SingleRaidSimRunner(sub.req, singleSimProgress, false),
-					Substitution: sub.eq,
-					ChangeLog:    sub.cl,
-				}
-				atomic.AddInt32(&totalCompletedSims, 1)
-				tickets <- struct{}{} // when done, allow for new sim to be launched.
-			}(singleCombo)
+// Keeps only the best enchant variant of each combination of items, from results sorted best
+// first.
+func bestEnchantVariants(results []*itemSubstitutionSimResult) []*itemSubstitutionSimResult {
+	seen := make(map[string]bool)
+	return FilterSlice(results, func(result *itemSubstitutionSimResult) bool {
+		key := result.Substitution.CanonicalHash()
+		if seen[key] {
+			return false
 		}
-	}()
+		seen[key] = true
+		return true
+	})
+}
 
-	rankedResults := make([]*itemSubstitutionSimResult, numCombinations)
-	var baseResult *itemSubstitutionSimResult
+// Metrics of the bulk simmed player.
+func (b *bulkSimRunner) playerMetrics(result *proto.RaidSimResult) *proto.UnitMetrics {
+	return result.GetRaidMetrics().GetParties()[b.partyIdx].GetPlayers()[b.metricsIdx]
+}
 
-	for i := range rankedResults {
-		result := <-results
-		if result.Result == nil || result.Result.ErrorResult != "" {
-			cancel() // cancel reporter
-			return nil, nil, errors.New("simulation failed: " + result.Result.ErrorResult)
+// Races the combos against each other using common random numbers, see simRace. Starting at
+// minIterations, each round doubles the iterations of the remaining combos and drops those whose
+// raid DPS is lower than the leader's with 95% confidence, based on their paired differences,
+// until only keep combos remain or they reach maxIterations. The surviving combos and the
+// equipped gear are then simmed up to maxIterations, or with a precision target in the base
+// settings, up to the iterations at which the leading combo met it. Returns the surviving combos
+// sorted by raid DPS, and the equipped gear.
+func (b *bulkSimRunner) getRankedResults(ctx context.Context, validCombos []singleBulkSim, minIterations int, maxIterations int, keep int, progress chan *proto.ProgressMetrics) ([]*itemSubstitutionSimResult, *itemSubstitutionSimResult, error) {
+	var baseResult *itemSubstitutionSimResult
+	results := MapSlice(validCombos, func(combo singleBulkSim) *itemSubstitutionSimResult {
+		result := &itemSubstitutionSimResult{
+			Request:      combo.req,
+			Substitution: combo.eq,
+			ChangeLog:    combo.cl,
+			race:         &raceCandidate{Request: combo.req},
 		}
-		if !result.Substitution.HasItemReplacements() {
+		if !combo.eq.HasItemReplacements() {
 			baseResult = result
 		}
-		rankedResults[i] = result
+		return result
+	})
+	if baseResult == nil {
+		return nil, nil, nil
+	}
+
+	race := newSimRace(b.SingleRaidSimRunner, b.Request.BaseSettings, b.partyIdx, b.playerIdx, progress)
+	race.reported = race.metric
+	race.metric = func(result *proto.RaidSimResult) *proto.DistributionMetrics {
+		return result.RaidMetrics.Dps
+	}
+	if options := b.Request.BaseSettings.GetSimOptions(); options != nil && hasPrecisionTarget(options) {
+		race.precision = options
+	}
+	race.expect(len(results), len(results)*maxIterations)
+
+	if err := race.run(ctx, MapSlice(results, func(r *itemSubstitutionSimResult) *raceCandidate { return r.race }), minIterations, maxIterations, keep); err != nil {
+		return nil, nil, err
+	}
+	rankedResults := FilterSlice(results, func(r *itemSubstitutionSimResult) bool { return !r.race.Eliminated })
+	toExtend := MapSlice(rankedResults, func(r *itemSubstitutionSimResult) *raceCandidate { return r.race })
+	if baseResult.race.Eliminated {
+		toExtend = append(toExtend, baseResult.race)
+	}
+	// With a precision target, the race stopped as soon as the leading combo met it, and all
+	// surviving combos have as many iterations as the leader.
+	iterations := maxIterations
+	if race.precision != nil {
+		iterations = len(rankedResults[0].race.Values)
+	}
+	if err := race.extend(ctx, toExtend, iterations); err != nil {
+		return nil, nil, err
 	}
-	cancel() // cancel reporter
 
-	sort.Slice(rankedResults, func(i, j int) bool {
+	sort.SliceStable(rankedResults, func(i, j int) bool {
 		return rankedResults[i].Score() > rankedResults[j].Score()
 	})
 	return rankedResults, baseResult, nil
 }
 
-// itemSubstitutionSimResult stores the request and response of a simulation, along with the used
-// equipment susbstitution and a changelog of which items were added and removed from the base
-// equipment set.
+// Result of a combo, with the metrics of the bulk simmed player and the raid DPS compared to
+// the equipped gear.
+func (b *bulkSimRunner) comboResult(r *itemSubstitutionSimResult, baseResult *itemSubstitutionSimResult) *proto.BulkComboResult {
+	// The other metrics are from the last batch of iterations only, the DPS covers all of them.
+	um := goproto.Clone(b.playerMetrics(r.race.LastResult)).(*proto.UnitMetrics)
+	um.Dps = distributionFromValues(r.race.ReportedValues)
+	um.Actions = nil
+	um.Auras = nil
+	um.Resources = nil
+	um.Pets = nil
+
+	delta, halfWidth := 0.0, 0.0
+	if r != baseResult {
+		delta, halfWidth = compareRaceCandidates(r.race, baseResult.race)
+	}
+	return &proto.BulkComboResult{
+		ItemsAdded:         r.ChangeLog.AddedItems,
+		UnitMetrics:        um,
+		Iterations:         int32(len(r.race.Values)),
+		RaidDps:            r.Score(),
+		RaidDpsDelta:       delta,
+		RaidDpsDeltaCiLow:  delta - halfWidth,
+		RaidDpsDeltaCiHigh: delta + halfWidth,
+	}
+}
+
+// itemSubstitutionSimResult stores the request and the raced results of a simulation, along
+// with the used equipment susbstitution and a changelog of which items were added and removed
+// from the base equipment set.
 type itemSubstitutionSimResult struct {
 	Request      *proto.RaidSimRequest
-	Result       *proto.RaidSimResult
 	Substitution *equipmentSubstitution
 	ChangeLog    *raidSimRequestChangeLog
+
+	race *raceCandidate
 }
 
 // Score used to rank results.
 func (r *itemSubstitutionSimResult) Score() float64 {
-	if r.Result == nil || r.Result.ErrorResult != "" {
-		return 0
-	}
-	return r.Result.RaidMetrics.Dps.Avg
+	return r.race.Mean()
 }
 
 // equipmentSubstitution specifies all items to be used as replacements for the equipped gear.
@@ -581,11 +662,12 @@ type raidSimRequestChangeLog struct {
 }
 
 // createNewRequestWithSubstitution creates a copy of the input RaidSimRequest and applis the given
-// equipment susbstitution to the player's equipment. Copies enchant if specified and possible.
-func createNewRequestWithSubstitution(readonlyInputRequest *proto.RaidSimRequest, substitution *equipmentSubstitution, autoEnchant bool) (*proto.RaidSimRequest, *raidSimRequestChangeLog) {
+// equipment susbstitution to the equipment of the player at the given party and player index.
+// Copies enchant if specified and possible.
+func createNewRequestWithSubstitution(readonlyInputRequest *proto.RaidSimRequest, partyIdx int, playerIdx int, substitution *equipmentSubstitution, autoEnchant bool) (*proto.RaidSimRequest, *raidSimRequestChangeLog) {
 	request := goproto.Clone(readonlyInputRequest).(*proto.RaidSimRequest)
 	changeLog := &raidSimRequestChangeLog{}
-	player := request.Raid.Parties[0].Players[0]
+	player := request.Raid.Parties[partyIdx].Players[playerIdx]
 	equipment := player.Equipment
 	for _, is := range substitution.Items {
 		oldItem := equipment.Items[is.Slot]
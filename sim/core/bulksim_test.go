@@ -2,10 +2,13 @@ package core
 
 import (
 	"context"
+	"slices"
+	"sync"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/wowsims/sod/sim/core/proto"
+	"github.com/wowsims/sod/sim/core/stats"
 	"google.golang.org/protobuf/encoding/protojson"
 )
 
@@ -113,6 +116,191 @@ func TestBulkSim(t *testing.T) {
 	}
 }
 
+func TestBulkSimRaidPlayer(t *testing.T) {
+	addToDatabase(tinyItemDatabase)
+
+	// Raid DPS is the number of items equipped by the bulk simmed player.
+	fakeRunSim := func(rsr *proto.RaidSimRequest, progress chan *proto.ProgressMetrics, skipPresim bool) *proto.RaidSimResult {
+		dps := 0.0
+		for _, item := range rsr.Raid.Parties[1].Players[1].Equipment.Items {
+			if item.Id != 0 {
+				dps++
+			}
+		}
+		return fakeBulkSimResult(rsr, dps)
+	}
+
+	newPlayer := func(name string) *proto.Player {
+		return &proto.Player{Name: name, Class: proto.Class_ClassWarrior, Equipment: createEquipmentFromItems(starshardEdge1)}
+	}
+	bulk := &bulkSimRunner{
+		SingleRaidSimRunner: fakeRunSim,
+		Request: &proto.BulkSimRequest{
+			BaseSettings: &proto.RaidSimRequest{
+				Raid: &proto.Raid{Parties: []*proto.Party{
+					{Players: []*proto.Player{newPlayer("Other")}},
+					{Players: []*proto.Player{{}, newPlayer("Target")}},
+				}},
+				SimOptions: &proto.SimOptions{},
+			},
+			BulkSettings: &proto.BulkSettings{
+				Items:              []*proto.ItemSpec{ironmender.Item},
+				IterationsPerCombo: 10,
+				Player:             &proto.UnitReference{Type: proto.UnitReference_Player, Index: 6},
+			},
+		},
+	}
+
+	got, err := bulk.Run(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("BulkSim() returned error: %v", err)
+	}
+	if got.EquippedGearResult.UnitMetrics.Name != "Target" {
+		t.Fatalf("Expected metrics of the bulk simmed player, got %s", got.EquippedGearResult.UnitMetrics.Name)
+	}
+	// The base gear is ranked along with the substitutions.
+	if len(got.Results) != 2 || len(got.Results[0].ItemsAdded) != 1 || got.Results[0].ItemsAdded[0].Item.Id != itemIronmender {
+		t.Fatalf("Unexpected results: %v", got.Results)
+	}
+	if len(bulk.Request.BaseSettings.Raid.Parties) != 2 {
+		t.Fatalf("Expected the raid to keep all parties")
+	}
+}
+
+func TestBulkSimFastModeRacing(t *testing.T) {
+	// Heads with increasing DPS, more than the number of results returned.
+	const firstHead = 991000
+	var items []*proto.ItemSpec
+	db := &proto.SimDatabase{}
+	for i := int32(1); i <= 40; i++ {
+		db.Items = append(db.Items, &proto.SimItem{Id: firstHead + i, Type: proto.ItemType_ItemTypeHead})
+		items = append(items, &proto.ItemSpec{Id: firstHead + i})
+	}
+	addToDatabase(db)
+
+	fakeRunSim := func(rsr *proto.RaidSimRequest, progress chan *proto.ProgressMetrics, skipPresim bool) *proto.RaidSimResult {
+		head := rsr.Raid.Parties[0].Players[0].Equipment.Items[proto.ItemSlot_ItemSlotHead].Id
+		return fakeBulkSimResult(rsr, float64(max(head-firstHead, 0)))
+	}
+	bulk := &bulkSimRunner{
+		SingleRaidSimRunner: fakeRunSim,
+		Request: &proto.BulkSimRequest{
+			BaseSettings: &proto.RaidSimRequest{
+				Raid: &proto.Raid{Parties: []*proto.Party{{Players: []*proto.Player{{
+					Name:      "Target",
+					Class:     proto.Class_ClassWarrior,
+					Equipment: createEquipmentFromItems(),
+				}}}}},
+				SimOptions: &proto.SimOptions{},
+			},
+			BulkSettings: &proto.BulkSettings{
+				Items:              items,
+				FastMode:           true,
+				IterationsPerCombo: 6400,
+			},
+		},
+	}
+
+	got, err := bulk.Run(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("BulkSim() returned error: %v", err)
+	}
+	// Without noise, every combo that isn't kept is dropped after the first round.
+	if len(got.Results) != 30 {
+		t.Fatalf("Expected 30 results, got %d", len(got.Results))
+	}
+	for i, result := range got.Results {
+		wantDps := float64(40 - i)
+		if result.RaidDps != wantDps || result.RaidDpsDelta != wantDps || result.RaidDpsDeltaCiLow != wantDps || result.Iterations != 6400 {
+			t.Errorf("Unexpected result %d: %v", i, result)
+		}
+		if result.UnitMetrics.Dps.Avg != wantDps {
+			t.Errorf("Unexpected player DPS %.1f, want %.1f", result.UnitMetrics.Dps.Avg, wantDps)
+		}
+	}
+	if got.EquippedGearResult.Iterations != 6400 || got.EquippedGearResult.RaidDps != 0 {
+		t.Errorf("Unexpected equipped gear result: %v", got.EquippedGearResult)
+	}
+}
+
+func TestBulkSimTargetPrecision(t *testing.T) {
+	const firstHead = 992000
+	var items []*proto.ItemSpec
+	db := &proto.SimDatabase{}
+	for i := int32(1); i <= 3; i++ {
+		db.Items = append(db.Items, &proto.SimItem{Id: firstHead + i, Type: proto.ItemType_ItemTypeHead})
+		items = append(items, &proto.ItemSpec{Id: firstHead + i})
+	}
+	addToDatabase(db)
+
+	fakeRunSim := func(rsr *proto.RaidSimRequest, progress chan *proto.ProgressMetrics, skipPresim bool) *proto.RaidSimResult {
+		if hasPrecisionTarget(rsr.SimOptions) {
+			return &proto.RaidSimResult{ErrorResult: "batch with a precision target"}
+		}
+		head := rsr.Raid.Parties[0].Players[0].Equipment.Items[proto.ItemSlot_ItemSlotHead].Id
+		return fakeBulkSimResult(rsr, float64(max(head-firstHead, 0)))
+	}
+	bulk := &bulkSimRunner{
+		SingleRaidSimRunner: fakeRunSim,
+		Request: &proto.BulkSimRequest{
+			BaseSettings: &proto.RaidSimRequest{
+				Raid: &proto.Raid{Parties: []*proto.Party{{Players: []*proto.Player{{
+					Name:      "Target",
+					Class:     proto.Class_ClassWarrior,
+					Equipment: createEquipmentFromItems(),
+				}}}}},
+				SimOptions: &proto.SimOptions{TargetDpsStderr: 1},
+			},
+			BulkSettings: &proto.BulkSettings{
+				Items:              items,
+				IterationsPerCombo: 6400,
+			},
+		},
+	}
+
+	got, err := bulk.Run(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("BulkSim() returned error: %v", err)
+	}
+	// Without noise, the best combo meets the target after the first round of 6400/100 iterations.
+	// The equipped gear is one of the results too.
+	if len(got.Results) != 4 {
+		t.Fatalf("Expected 4 results, got %d", len(got.Results))
+	}
+	for i, result := range got.Results {
+		if wantDps := float64(3 - i); result.RaidDps != wantDps || result.Iterations != 64 {
+			t.Errorf("Unexpected result %d: %v", i, result)
+		}
+	}
+	if got.EquippedGearResult.Iterations != 64 {
+		t.Errorf("Unexpected equipped gear result: %v", got.EquippedGearResult)
+	}
+}
+
+// Result of a fake sim in which every player and the raid have the same DPS in every iteration.
+func fakeBulkSimResult(rsr *proto.RaidSimRequest, dps float64) *proto.RaidSimResult {
+	newDps := func() *proto.DistributionMetrics {
+		values := make([]float64, rsr.SimOptions.Iterations)
+		for i := range values {
+			values[i] = dps
+		}
+		return &proto.DistributionMetrics{Avg: dps, AllValues: values}
+	}
+
+	result := &proto.RaidSimResult{RaidMetrics: &proto.RaidMetrics{Dps: newDps()}}
+	for _, party := range rsr.Raid.Parties {
+		partyMetrics := &proto.PartyMetrics{}
+		for _, player := range party.Players {
+			if player.Class == proto.Class_ClassUnknown {
+				continue
+			}
+			partyMetrics.Players = append(partyMetrics.Players, &proto.UnitMetrics{Name: player.Name, Dps: newDps()})
+		}
+		result.RaidMetrics.Parties = append(result.RaidMetrics.Parties, partyMetrics)
+	}
+	return result
+}
+
 func TestGenerateAllEquipmentSubstitutions(t *testing.T) {
 	baseItems := make([]*proto.ItemSpec, len(proto.ItemSlot_name))
 	for i := range baseItems {
@@ -380,3 +568,81 @@ func TestGenerateAllEquipmentSubstitutions(t *testing.T) {
 		})
 	}
 }
+
+func TestBulkSimOptimizeEnchants(t *testing.T) {
+	addToDatabase(tinyItemDatabase)
+	const (
+		enchantWeak   = 990001
+		enchantStrong = 990002
+		enchantShield = 990003
+		enchantMage   = 990004
+		enchantBest   = 990005
+	)
+	// Only the test enchants, so the result doesn't depend on the database.
+	allEnchants := EnchantsByEffectID
+	EnchantsByEffectID = map[int32]Enchant{}
+	t.Cleanup(func() { EnchantsByEffectID = allEnchants })
+	addToDatabase(&proto.SimDatabase{Enchants: []*proto.SimEnchant{
+		{EffectId: enchantWeak, Type: proto.ItemType_ItemTypeWeapon, Stats: stats.Stats{stats.Strength: 5}.ToFloatArray()},
+		{EffectId: enchantStrong, Type: proto.ItemType_ItemTypeWeapon, Stats: stats.Stats{stats.Strength: 10}.ToFloatArray()},
+		{EffectId: enchantShield, Type: proto.ItemType_ItemTypeWeapon, EnchantType: proto.EnchantType_EnchantTypeShield, Stats: stats.Stats{stats.Strength: 50}.ToFloatArray()},
+		{EffectId: enchantMage, Type: proto.ItemType_ItemTypeWeapon, ClassAllowlist: []proto.Class{proto.Class_ClassMage}, Stats: stats.Stats{stats.Strength: 50}.ToFloatArray()},
+		// Ranked last by EP, so only simmed with more enchants per item.
+		{EffectId: enchantBest, Type: proto.ItemType_ItemTypeWeapon, Stats: stats.Stats{stats.Agility: 1}.ToFloatArray()},
+	}})
+
+	// DPS is the strength of the main hand enchant, with a large bonus for the agility enchant.
+	var simmedEnchants []int32
+	var mutex sync.Mutex
+	fakeRunSim := func(rsr *proto.RaidSimRequest, progress chan *proto.ProgressMetrics, skipPresim bool) *proto.RaidSimResult {
+		enchant := rsr.Raid.Parties[0].Players[0].Equipment.Items[proto.ItemSlot_ItemSlotMainHand].Enchant
+		mutex.Lock()
+		simmedEnchants = append(simmedEnchants, enchant)
+		mutex.Unlock()
+		return fakeBulkSimResult(rsr, EnchantsByEffectID[enchant].Stats[stats.Strength]+100*EnchantsByEffectID[enchant].Stats[stats.Agility])
+	}
+
+	for _, tc := range []struct {
+		enchantsPerItem int32
+		wantEnchant     int32
+		wantSimmed      []int32
+	}{
+		{enchantsPerItem: 1, wantEnchant: enchantStrong, wantSimmed: []int32{0, enchantStrong}},
+		{enchantsPerItem: 3, wantEnchant: enchantBest, wantSimmed: []int32{0, enchantWeak, enchantStrong, enchantBest}},
+	} {
+		simmedEnchants = nil
+		bulk := &bulkSimRunner{
+			SingleRaidSimRunner: fakeRunSim,
+			Request: &proto.BulkSimRequest{
+				BaseSettings: &proto.RaidSimRequest{
+					Raid: &proto.Raid{Parties: []*proto.Party{{Players: []*proto.Player{{
+						Name:      "Target",
+						Class:     proto.Class_ClassWarrior,
+						Equipment: createEquipmentFromItems(),
+					}}}}},
+					SimOptions: &proto.SimOptions{},
+				},
+				BulkSettings: &proto.BulkSettings{
+					Items:              []*proto.ItemSpec{starshardEdge1.Item},
+					IterationsPerCombo: 10,
+					OptimizeEnchants:   true,
+					EnchantsPerItem:    tc.enchantsPerItem,
+					EnchantEpWeights:   &proto.UnitStats{Stats: stats.Stats{stats.Strength: 1, stats.Agility: 1}.ToFloatArray()},
+				},
+			},
+		}
+
+		got, err := bulk.Run(context.Background(), nil)
+		if err != nil {
+			t.Fatalf("BulkSim() returned error: %v", err)
+		}
+		slices.Sort(simmedEnchants)
+		if !slices.Equal(simmedEnchants, tc.wantSimmed) {
+			t.Errorf("%d enchants per item: simmed enchants %v, want %v", tc.enchantsPerItem, simmedEnchants, tc.wantSimmed)
+		}
+		// Only the best enchant of the item is returned, followed by the base gear.
+		if len(got.Results) != 2 || got.Results[0].ItemsAdded[0].Item.Enchant != tc.wantEnchant {
+			t.Errorf("%d enchants per item: unexpected results %v", tc.enchantsPerItem, got.Results)
+		}
+	}
+}
@@ -214,6 +214,9 @@ func (spell *Spell) makeCastFunc(config CastConfig) CastSuccessFunc {
 				spell.Unit.Log(sim, "Casting %s (Cost = %0.03f, Cast Time = %s, Effective Time = %s)",
 					spell.ActionID, max(0, spell.CurCast.Cost), spell.CurCast.CastTime, spell.CurCast.EffectiveTime())
 			}
+			if sim.CombatLog != nil && !spell.Flags.Matches(SpellFlagNoLogs) {
+				sim.CombatLog.castStarted(sim, spell, target, spell.CurCast.CastTime, spell.CurCast.Cost)
+			}
 
 			spell.Unit.Hardcast = Hardcast{
 				Expires:  sim.CurrentTime + spell.CurCast.CastTime,
@@ -223,6 +226,9 @@ func (spell *Spell) makeCastFunc(config CastConfig) CastSuccessFunc {
 					if sim.Log != nil && !spell.Flags.Matches(SpellFlagNoLogs) {
 						spell.Unit.Log(sim, "Completed cast %s", spell.ActionID)
 					}
+					if sim.CombatLog != nil && !spell.Flags.Matches(SpellFlagNoLogs) {
+						sim.CombatLog.castCompleted(sim, spell, target)
+					}
 
 					if spell.Cost != nil {
 						spell.Cost.SpendCost(sim, spell)
@@ -253,6 +259,10 @@ func (spell *Spell) makeCastFunc(config CastConfig) CastSuccessFunc {
 				spell.ActionID, max(0, spell.CurCast.Cost), spell.CurCast.CastTime, spell.CurCast.EffectiveTime())
 			spell.Unit.Log(sim, "Completed cast %s", spell.ActionID)
 		}
+		if sim.CombatLog != nil && !spell.Flags.Matches(SpellFlagNoLogs) {
+			sim.CombatLog.castStarted(sim, spell, target, 0, spell.CurCast.Cost)
+			sim.CombatLog.castCompleted(sim, spell, target)
+		}
 
 		if spell.Cost != nil {
 			spell.Cost.SpendCost(sim, spell)
@@ -299,6 +309,10 @@ func (spell *Spell) makeCastFuncSimple() CastSuccessFunc {
 				spell.ActionID, 0.0, "0s", "0s")
 			spell.Unit.Log(sim, "Completed cast %s", spell.ActionID)
 		}
+		if sim.CombatLog != nil && !spell.Flags.Matches(SpellFlagNoLogs) {
+			sim.CombatLog.castStarted(sim, spell, target, 0, 0)
+			sim.CombatLog.castCompleted(sim, spell, target)
+		}
 
 		spell.applyEffects(sim, target)
 
@@ -317,6 +331,10 @@ func (spell *Spell) makeCastFuncAutosOrProcs() CastSuccessFunc {
 				spell.ActionID, 0.0, "0s", "0s")
 			spell.Unit.Log(sim, "Completed cast %s", spell.ActionID)
 		}
+		if sim.CombatLog != nil && !spell.Flags.Matches(SpellFlagNoLogs) {
+			sim.CombatLog.castStarted(sim, spell, target, 0, 0)
+			sim.CombatLog.castCompleted(sim, spell, target)
+		}
 
 		spell.applyEffects(sim, target)
 
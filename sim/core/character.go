@@ -600,6 +600,19 @@ func (character *Character) doneIteration(sim *Simulation) {
 	character.Unit.doneIteration(sim)
 }
 
+func (character *Character) mergeMetrics(other *Character) {
+	for i, pet := range character.Pets {
+		pet.mergeMetrics(&other.Pets[i].Character)
+	}
+
+	character.Unit.mergeMetrics(&other.Unit)
+	if character.Rotation != nil && other.Rotation != nil {
+		for i, itemMetrics := range character.Rotation.itemMetrics {
+			itemMetrics.mergeMetrics(other.Rotation.itemMetrics[i])
+		}
+	}
+}
+
 func (character *Character) GetPseudoStatsProto() []float64 {
 	return []float64{
 		proto.PseudoStat_PseudoStatMainHandDps:          character.AutoAttacks.MH().DPS(),
@@ -630,6 +643,9 @@ func (character *Character) GetMetricsProto() *proto.UnitMetrics {
 	metrics.Name = character.Name
 	metrics.UnitIndex = character.UnitIndex
 	metrics.Auras = character.auraTracker.GetMetricsProto()
+	if character.Type == PlayerUnit && character.Rotation != nil {
+		metrics.AplItems = character.Rotation.getMetricsProto()
+	}
 
 	metrics.Pets = make([]*proto.UnitMetrics, len(character.Pets))
 	for i, pet := range character.Pets {
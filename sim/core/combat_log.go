@@ -0,0 +1,385 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/wowsims/sod/sim/core/proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	googleProto "google.golang.org/protobuf/proto"
+)
+
+// CombatLog records structured events for a single iteration. Like sim.Log, it is nil unless
+// recording is enabled, so every call site has to check for nil first.
+type CombatLog struct {
+	Events []*proto.CombatLogEvent
+
+	env      *Environment
+	unitRefs map[*Unit]*proto.UnitReference
+}
+
+func newCombatLog(env *Environment) *CombatLog {
+	return &CombatLog{
+		env:      env,
+		unitRefs: make(map[*Unit]*proto.UnitReference),
+	}
+}
+
+func (cl *CombatLog) unitReference(unit *Unit) *proto.UnitReference {
+	if ref, ok := cl.unitRefs[unit]; ok {
+		return ref
+	}
+
+	var ref *proto.UnitReference
+	switch unit.Type {
+	case PlayerUnit:
+		ref = &proto.UnitReference{Type: proto.UnitReference_Player, Index: unit.Index}
+	case EnemyUnit:
+		ref = &proto.UnitReference{Type: proto.UnitReference_Target, Index: unit.Index}
+	case PetUnit:
+		ref = &proto.UnitReference{Type: proto.UnitReference_Pet}
+		if petAgent, ok := cl.env.Raid.GetPlayerFromUnit(unit).(PetAgent); ok {
+			owner := petAgent.GetPet().Owner
+			ref.Owner = cl.unitReference(&owner.Unit)
+			for i, ownerPet := range owner.PetAgents {
+				if &ownerPet.GetCharacter().Unit == unit {
+					ref.Index = int32(i)
+				}
+			}
+		}
+	}
+	cl.unitRefs[unit] = ref
+	return ref
+}
+
+func (cl *CombatLog) newEvent(sim *Simulation, eventType proto.CombatLogEvent_Type, source *Unit, target *Unit, actionID ActionID) *proto.CombatLogEvent {
+	event := &proto.CombatLogEvent{
+		Type:      eventType,
+		Timestamp: sim.CurrentTime.Seconds(),
+		ActionId:  actionID.ToProto(),
+	}
+	if source != nil {
+		event.Source = cl.unitReference(source)
+		event.SourceName = source.Label
+	}
+	if target != nil {
+		event.Target = cl.unitReference(target)
+		event.TargetName = target.Label
+	}
+	cl.Events = append(cl.Events, event)
+	return event
+}
+
+func (cl *CombatLog) castStarted(sim *Simulation, spell *Spell, target *Unit, castTime time.Duration, cost float64) {
+	event := cl.newEvent(sim, proto.CombatLogEvent_CastStart, spell.Unit, target, spell.ActionID)
+	event.Schools = spellSchoolsToProto(spell.SpellSchool)
+	event.CastTime = castTime.Seconds()
+	event.Cost = max(0, cost)
+}
+
+func (cl *CombatLog) castCompleted(sim *Simulation, spell *Spell, target *Unit) {
+	event := cl.newEvent(sim, proto.CombatLogEvent_CastComplete, spell.Unit, target, spell.ActionID)
+	event.Schools = spellSchoolsToProto(spell.SpellSchool)
+}
+
+func (cl *CombatLog) spellResult(sim *Simulation, spell *Spell, result *SpellResult, isPeriodic bool, isHealing bool) {
+	eventType := proto.CombatLogEvent_Damage
+	if isHealing {
+		eventType = proto.CombatLogEvent_Healing
+	}
+	event := cl.newEvent(sim, eventType, spell.Unit, result.Target, spell.ActionID)
+	event.Schools = spellSchoolsToProto(spell.SpellSchool)
+	event.Outcome = outcomeToProto(result.Outcome)
+	event.Blocked = result.Outcome.Matches(OutcomeBlock)
+	event.ResistedQuarters = resistedQuarters(result.Outcome)
+	event.Periodic = isPeriodic
+	event.Amount = result.Damage
+}
+
+func (cl *CombatLog) auraChanged(sim *Simulation, aura *Aura, eventType proto.CombatLogEvent_Type) {
+	event := cl.newEvent(sim, eventType, nil, aura.Unit, aura.ActionID)
+	event.Stacks = aura.stacks
+}
+
+func (cl *CombatLog) resourceChanged(sim *Simulation, unit *Unit, resourceType proto.ResourceType, metrics *ResourceMetrics, before float64, after float64) {
+	event := cl.newEvent(sim, proto.CombatLogEvent_ResourceChanged, unit, unit, metrics.ActionID)
+	event.ResourceType = resourceType
+	event.Amount = after - before
+	event.ValueBefore = before
+	event.ValueAfter = after
+}
+
+func (cl *CombatLog) swing(sim *Simulation, wa *WeaponAttack, spell *Spell, target *Unit) {
+	event := cl.newEvent(sim, proto.CombatLogEvent_Swing, wa.unit, target, spell.ActionID)
+	event.Schools = spellSchoolsToProto(spell.SpellSchool)
+	event.SwingDuration = wa.curSwingDuration.Seconds()
+}
+
+var spellSchoolProtos = []struct {
+	school SpellSchool
+	proto  proto.SpellSchool
+}{
+	{SpellSchoolPhysical, proto.SpellSchool_SpellSchoolPhysical},
+	{SpellSchoolArcane, proto.SpellSchool_SpellSchoolArcane},
+	{SpellSchoolFire, proto.SpellSchool_SpellSchoolFire},
+	{SpellSchoolFrost, proto.SpellSchool_SpellSchoolFrost},
+	{SpellSchoolHoly, proto.SpellSchool_SpellSchoolHoly},
+	{SpellSchoolNature, proto.SpellSchool_SpellSchoolNature},
+	{SpellSchoolShadow, proto.SpellSchool_SpellSchoolShadow},
+}
+
+func spellSchoolsToProto(school SpellSchool) []proto.SpellSchool {
+	var schools []proto.SpellSchool
+	for _, ssp := range spellSchoolProtos {
+		if school.Matches(ssp.school) {
+			schools = append(schools, ssp.proto)
+		}
+	}
+	return schools
+}
+
+func outcomeToProto(outcome HitOutcome) proto.CombatLogEvent_Outcome {
+	switch {
+	case outcome.Matches(OutcomeMiss):
+		return proto.CombatLogEvent_Miss
+	case outcome.Matches(OutcomeDodge):
+		return proto.CombatLogEvent_Dodge
+	case outcome.Matches(OutcomeParry):
+		return proto.CombatLogEvent_Parry
+	case outcome.Matches(OutcomeGlance):
+		return proto.CombatLogEvent_Glance
+	case outcome.Matches(OutcomeCrit):
+		return proto.CombatLogEvent_Crit
+	case outcome.Matches(OutcomeBlock):
+		return proto.CombatLogEvent_Block
+	case outcome.Matches(OutcomeHit):
+		return proto.CombatLogEvent_Hit
+	case outcome.Matches(OutcomeCrush):
+		return proto.CombatLogEvent_Crush
+	default:
+		return proto.CombatLogEvent_OutcomeUnknown
+	}
+}
+
+func resistedQuarters(outcome HitOutcome) int32 {
+	switch {
+	case outcome.Matches(OutcomePartial1_4):
+		return 1
+	case outcome.Matches(OutcomePartial2_4):
+		return 2
+	case outcome.Matches(OutcomePartial3_4):
+		return 3
+	default:
+		return 0
+	}
+}
+
+// Writes the events as JSON lines, one protojson encoded event per line.
+func WriteCombatLogJSON(w io.Writer, events []*proto.CombatLogEvent) error {
+	bw := bufio.NewWriter(w)
+	for _, event := range events {
+		line, err := protojson.Marshal(event)
+		if err != nil {
+			return err
+		}
+		bw.Write(line)
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// Writes the events as a single binary CombatLog message.
+func WriteCombatLogProto(w io.Writer, events []*proto.CombatLogEvent) error {
+	data, err := googleProto.Marshal(&proto.CombatLog{Events: events})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// Writes the events in the format of the game client's WoWCombatLog.txt, so the log can be
+// uploaded to the usual log analysis sites. Events are timestamped relative to combatStart.
+// The sim doesn't know spell names, so action IDs are used in their place.
+func WriteWoWCombatLog(w io.Writer, events []*proto.CombatLogEvent, combatStart time.Time) error {
+	bw := bufio.NewWriter(w)
+	logStart := combatStart
+	if len(events) > 0 {
+		logStart = combatStart.Add(min(0, DurationFromSeconds(events[0].Timestamp)))
+	}
+	bw.WriteString(logStart.Format("1/2 15:04:05.000") + "  COMBAT_LOG_VERSION,9,ADVANCED_LOG_ENABLED,0,BUILD_VERSION,1.15.0,PROJECT_ID,2\n")
+
+	for _, event := range events {
+		line := wowCombatLogLine(event)
+		if line == "" {
+			continue
+		}
+		timestamp := combatStart.Add(DurationFromSeconds(event.Timestamp))
+		bw.WriteString(timestamp.Format("1/2 15:04:05.000") + "  " + line + "\n")
+	}
+	return bw.Flush()
+}
+
+// Returns the WoWCombatLog.txt line for the event without timestamp, or "" if the event has no
+// equivalent in the game's log.
+func wowCombatLogLine(event *proto.CombatLogEvent) string {
+	source := wowCombatLogUnit(event.Source, event.SourceName)
+	target := wowCombatLogUnit(event.Target, event.TargetName)
+	spell := wowCombatLogSpell(event)
+	isSwing := event.ActionId.GetOtherId() == proto.OtherAction_OtherActionAttack
+
+	switch event.Type {
+	case proto.CombatLogEvent_CastStart:
+		if event.CastTime == 0 {
+			return ""
+		}
+		return strings.Join([]string{"SPELL_CAST_START", source, wowCombatLogUnit(nil, ""), spell}, ",")
+	case proto.CombatLogEvent_CastComplete:
+		if isSwing {
+			return ""
+		}
+		return strings.Join([]string{"SPELL_CAST_SUCCESS", source, target, spell}, ",")
+	case proto.CombatLogEvent_Damage:
+		prefix := "SPELL"
+		if isSwing {
+			prefix = "SWING"
+		} else if event.Periodic {
+			prefix = "SPELL_PERIODIC"
+		}
+		params := []string{"", source, target}
+		if !isSwing {
+			params = append(params, spell)
+		}
+
+		switch event.Outcome {
+		case proto.CombatLogEvent_Miss, proto.CombatLogEvent_Dodge, proto.CombatLogEvent_Parry:
+			params[0] = prefix + "_MISSED"
+			params = append(params, wowCombatLogMissType(event, isSwing))
+		default:
+			resisted := 0.0
+			if event.ResistedQuarters > 0 {
+				resisted = event.Amount * float64(event.ResistedQuarters) / float64(4-event.ResistedQuarters)
+			}
+			params[0] = prefix + "_DAMAGE"
+			params = append(params, fmt.Sprintf("%d,-1,%s,%d,0,0,%s,%s,%s",
+				int64(event.Amount), wowCombatLogSchool(event.Schools), int64(resisted),
+				wowCombatLogFlag(event.Outcome == proto.CombatLogEvent_Crit),
+				wowCombatLogFlag(event.Outcome == proto.CombatLogEvent_Glance),
+				wowCombatLogFlag(event.Outcome == proto.CombatLogEvent_Crush)))
+		}
+		return strings.Join(params, ",")
+	case proto.CombatLogEvent_Healing:
+		eventName := "SPELL_HEAL"
+		if event.Periodic {
+			eventName = "SPELL_PERIODIC_HEAL"
+		}
+		return strings.Join([]string{eventName, source, target, spell,
+			fmt.Sprintf("%d,0,0,%s", int64(event.Amount), wowCombatLogFlag(event.Outcome == proto.CombatLogEvent_Crit))}, ",")
+	case proto.CombatLogEvent_AuraGained, proto.CombatLogEvent_AuraFaded, proto.CombatLogEvent_AuraRefreshed:
+		return strings.Join([]string{wowCombatLogAuraEvents[event.Type], source, target, spell, wowCombatLogAuraType(event)}, ",")
+	case proto.CombatLogEvent_AuraStacksChanged:
+		if event.Stacks == 0 {
+			return ""
+		}
+		return strings.Join([]string{"SPELL_AURA_APPLIED_DOSE", source, target, spell, wowCombatLogAuraType(event), fmt.Sprintf("%d", event.Stacks)}, ",")
+	case proto.CombatLogEvent_ResourceChanged:
+		powerType, ok := wowCombatLogPowerTypes[event.ResourceType]
+		if !ok || event.Amount <= 0 {
+			return ""
+		}
+		return strings.Join([]string{"SPELL_ENERGIZE", source, target, spell, fmt.Sprintf("%d,0,%d", int64(event.Amount), powerType)}, ",")
+	default:
+		return ""
+	}
+}
+
+var wowCombatLogAuraEvents = map[proto.CombatLogEvent_Type]string{
+	proto.CombatLogEvent_AuraGained:    "SPELL_AURA_APPLIED",
+	proto.CombatLogEvent_AuraFaded:     "SPELL_AURA_REMOVED",
+	proto.CombatLogEvent_AuraRefreshed: "SPELL_AURA_REFRESH",
+}
+
+var wowCombatLogPowerTypes = map[proto.ResourceType]int{
+	proto.ResourceType_ResourceTypeMana:        0,
+	proto.ResourceType_ResourceTypeRage:        1,
+	proto.ResourceType_ResourceTypeFocus:       2,
+	proto.ResourceType_ResourceTypeEnergy:      3,
+	proto.ResourceType_ResourceTypeComboPoints: 4,
+}
+
+var wowCombatLogSchoolMasks = map[proto.SpellSchool]int{
+	proto.SpellSchool_SpellSchoolPhysical: 0x1,
+	proto.SpellSchool_SpellSchoolHoly:     0x2,
+	proto.SpellSchool_SpellSchoolFire:     0x4,
+	proto.SpellSchool_SpellSchoolNature:   0x8,
+	proto.SpellSchool_SpellSchoolFrost:    0x10,
+	proto.SpellSchool_SpellSchoolShadow:   0x20,
+	proto.SpellSchool_SpellSchoolArcane:   0x40,
+}
+
+// Returns the GUID, name, flags and raid flags of a unit.
+func wowCombatLogUnit(ref *proto.UnitReference, name string) string {
+	switch ref.GetType() {
+	case proto.UnitReference_Player:
+		flags := "0x514"
+		if ref.Index == 0 {
+			flags = "0x511"
+		}
+		return fmt.Sprintf("Player-0-%08X,\"%s\",%s,0x0", ref.Index+1, name, flags)
+	case proto.UnitReference_Pet:
+		return fmt.Sprintf("Pet-0-0-0-0-0-%010X,\"%s\",0x1111,0x0", ref.GetOwner().GetIndex()<<8|ref.Index, name)
+	case proto.UnitReference_Target:
+		return fmt.Sprintf("Creature-0-0-0-0-0-%010X,\"%s\",0x10a48,0x0", ref.Index+1, name)
+	default:
+		return "0000000000000000,nil,0x80000000,0x80000000"
+	}
+}
+
+// Returns the spell ID, name and school of the event's action.
+func wowCombatLogSpell(event *proto.CombatLogEvent) string {
+	return fmt.Sprintf("%d,\"%s\",%s", event.ActionId.GetSpellId(), ProtoToActionID(event.ActionId), wowCombatLogSchool(event.Schools))
+}
+
+// Converts the schools to the game's school bitmask.
+func wowCombatLogSchool(schools []proto.SpellSchool) string {
+	mask := 0
+	for _, school := range schools {
+		mask |= wowCombatLogSchoolMasks[school]
+	}
+	if mask == 0 {
+		mask = 0x1
+	}
+	return fmt.Sprintf("0x%x", mask)
+}
+
+func wowCombatLogMissType(event *proto.CombatLogEvent, isSwing bool) string {
+	switch event.Outcome {
+	case proto.CombatLogEvent_Dodge:
+		return "DODGE"
+	case proto.CombatLogEvent_Parry:
+		return "PARRY"
+	}
+	// Misses of non-physical spells show up as resists.
+	if !isSwing && !slices.Contains(event.Schools, proto.SpellSchool_SpellSchoolPhysical) {
+		return "RESIST"
+	}
+	return "MISS"
+}
+
+func wowCombatLogAuraType(event *proto.CombatLogEvent) string {
+	if event.Target.GetType() == proto.UnitReference_Target {
+		return "DEBUFF"
+	}
+	return "BUFF"
+}
+
+func wowCombatLogFlag(flag bool) string {
+	if flag {
+		return "1"
+	}
+	return "nil"
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/wowsims/sod/sim/core/proto"
+)
+
+func TestWoWCombatLogLine(t *testing.T) {
+	player := &proto.UnitReference{Type: proto.UnitReference_Player}
+	target := &proto.UnitReference{Type: proto.UnitReference_Target}
+	newEvent := func(eventType proto.CombatLogEvent_Type, actionID ActionID) *proto.CombatLogEvent {
+		return &proto.CombatLogEvent{
+			Type:       eventType,
+			Source:     player,
+			SourceName: "Player",
+			Target:     target,
+			TargetName: "Target",
+			ActionId:   actionID.ToProto(),
+		}
+	}
+
+	swing := newEvent(proto.CombatLogEvent_Damage, ActionID{OtherID: proto.OtherAction_OtherActionAttack})
+	swing.Outcome = proto.CombatLogEvent_Crit
+	swing.Amount = 450.6
+	swing.Schools = []proto.SpellSchool{proto.SpellSchool_SpellSchoolPhysical}
+
+	resisted := newEvent(proto.CombatLogEvent_Damage, ActionID{SpellID: 10151})
+	resisted.Outcome = proto.CombatLogEvent_Hit
+	resisted.ResistedQuarters = 2
+	resisted.Amount = 300
+	resisted.Schools = []proto.SpellSchool{proto.SpellSchool_SpellSchoolFire}
+
+	missed := newEvent(proto.CombatLogEvent_Damage, ActionID{SpellID: 10151})
+	missed.Outcome = proto.CombatLogEvent_Miss
+	missed.Schools = []proto.SpellSchool{proto.SpellSchool_SpellSchoolFire}
+
+	spend := newEvent(proto.CombatLogEvent_ResourceChanged, ActionID{SpellID: 10151})
+	spend.ResourceType = proto.ResourceType_ResourceTypeMana
+	spend.Amount = -100
+
+	testCases := []struct {
+		event *proto.CombatLogEvent
+		want  string
+	}{
+		{swing, `SWING_DAMAGE,Player-0-00000001,"Player",0x511,0x0,Creature-0-0-0-0-0-0000000001,"Target",0x10a48,0x0,450,-1,0x1,0,0,0,1,nil,nil`},
+		{resisted, `SPELL_DAMAGE,Player-0-00000001,"Player",0x511,0x0,Creature-0-0-0-0-0-0000000001,"Target",0x10a48,0x0,10151,"{SpellID: 10151}",0x4,300,-1,0x4,300,0,0,nil,nil,nil`},
+		{missed, `SPELL_MISSED,Player-0-00000001,"Player",0x511,0x0,Creature-0-0-0-0-0-0000000001,"Target",0x10a48,0x0,10151,"{SpellID: 10151}",0x4,RESIST`},
+		{spend, ``},
+	}
+
+	for _, tc := range testCases {
+		if got := wowCombatLogLine(tc.event); got != tc.want {
+			t.Errorf("Unexpected combat log line:\n%s\nexpected:\n%s", got, tc.want)
+		}
+	}
+}
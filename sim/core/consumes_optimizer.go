@@ -0,0 +1,538 @@
+package core
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"runtime/debug"
+	"slices"
+
+	googleProto "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/wowsims/sod/sim/core/proto"
+	"github.com/wowsims/sod/sim/core/stats"
+)
+
+const (
+	defaultConsumesOptimizerNumResults      = 10
+	defaultConsumesOptimizerMinIterations   = 100
+	defaultConsumesOptimizerMaxIterations   = 3200
+	defaultConsumesOptimizerOptionsPerSlot  = 2
+	defaultConsumesOptimizerMaxCombinations = 256
+)
+
+// Fields of IndividualBuffs that are world buffs. The others are cast by other players.
+var worldBuffFields = []protoreflect.Name{
+	"rallying_cry_of_the_dragonslayer",
+	"sayges_fortune",
+	"spirit_of_zandalar",
+	"songflower_serenade",
+	"warchiefs_blessing",
+	"fengus_ferocity",
+	"moldars_moxie",
+	"slipkiks_savvy",
+	"boon_of_blackfathom",
+	"ashenvale_pvp_buff",
+	"spark_of_inspiration",
+}
+
+// Choices that only one faction can get, keyed like the gold costs.
+var factionOnlyChoices = map[string]proto.Faction{
+	"warchiefs_blessing": proto.Faction_Horde,
+}
+
+func ConsumesOptimizer(ctx context.Context, request *proto.ConsumesOptimizerRequest, progress chan *proto.ProgressMetrics) *proto.ConsumesOptimizerResult {
+	optimizer := &consumesOptimizer{
+		SingleRaidSimRunner: runSim,
+		Request:             request,
+	}
+
+	result, err := optimizer.Run(ctx, progress)
+	if err != nil {
+		result = &proto.ConsumesOptimizerResult{
+			ErrorResult: err.Error(),
+		}
+	}
+
+	if progress != nil {
+		progress <- &proto.ProgressMetrics{
+			FinalConsumesOptimizerResult: result,
+		}
+		close(progress)
+	}
+
+	return result
+}
+
+// consumesOptimizer picks the consumables and world buffs of a player. Every field of Consumes
+// and every world buff of IndividualBuffs is a slot holding one of mutually exclusive values.
+// Each legal value is first simmed on its own to rank the values of its slot, then the best
+// combinations of the top values are compared with successive halving.
+//
+// Values that share an exclusive effect category with a value of another slot are never
+// combined, as only one of them would be active. Values that don't change the character at
+// all, like a sapper without engineering, are skipped.
+type consumesOptimizer struct {
+	// SingleRaidSimRunner used to run each batch of iterations.
+	SingleRaidSimRunner raidSimRunner
+	// Request used for this optimization.
+	Request *proto.ConsumesOptimizerRequest
+
+	settings    *proto.ConsumesOptimizerSettings
+	baseRequest *proto.RaidSimRequest
+	partyIdx    int
+	playerIdx   int
+	player      *proto.Player
+
+	slots   []*consumeSlot
+	skipped []string
+}
+
+// consumeSlot is one field of Consumes or IndividualBuffs. Enum fields choose one of their
+// values, bool fields choose between off (0) and on (1).
+type consumeSlot struct {
+	field     protoreflect.FieldDescriptor
+	worldBuff bool
+
+	current int32
+	// Legal values, sorted by their single choice DPS delta once screened.
+	values []int32
+	scores []float64
+	// Exclusive effect categories that each value adds effects to.
+	categories map[int32][]string
+}
+
+// Everything a consumable may change on a character.
+type consumeEffects struct {
+	stats       stats.Stats
+	pseudoStats stats.PseudoStats
+	weapons     [3]Weapon // Main hand, off hand and ranged.
+	auras       []string
+	spells      []ActionID
+	cooldowns   []ActionID
+	// Number of effects in each exclusive effect category.
+	categories map[string]int
+}
+
+func (effects *consumeEffects) equals(other *consumeEffects) bool {
+	return effects.stats == other.stats && effects.pseudoStats == other.pseudoStats && effects.weapons == other.weapons &&
+		slices.Equal(effects.auras, other.auras) && slices.Equal(effects.spells, other.spells) &&
+		slices.Equal(effects.cooldowns, other.cooldowns) && maps.Equal(effects.categories, other.categories)
+}
+
+type consumesLoadout struct {
+	values []int32 // Indexed like the slots.
+	race   *raceCandidate
+}
+
+func (co *consumesOptimizer) Run(pctx context.Context, progress chan *proto.ProgressMetrics) (result *proto.ConsumesOptimizerResult, resultErr error) {
+	ctx, cancel := context.WithCancel(pctx)
+	defer func() {
+		if err := recover(); err != nil {
+			result = &proto.ConsumesOptimizerResult{
+				ErrorResult: fmt.Sprintf("%v\nStack Trace:\n%s", err, string(debug.Stack())),
+			}
+		}
+		cancel()
+	}()
+
+	co.settings = co.Request.GetSettings()
+	if co.settings == nil {
+		co.settings = &proto.ConsumesOptimizerSettings{}
+	}
+	if co.Request.GetBaseSettings().GetRaid() == nil {
+		return nil, fmt.Errorf("consumes optimizer: missing base settings")
+	}
+	co.baseRequest = googleProto.Clone(co.Request.BaseSettings).(*proto.RaidSimRequest)
+	if co.baseRequest.SimOptions == nil {
+		co.baseRequest.SimOptions = &proto.SimOptions{}
+	}
+	if co.baseRequest.Encounter == nil {
+		co.baseRequest.Encounter = &proto.Encounter{}
+	}
+
+	partyIdx, playerIdx, err := findRaidPlayer(co.baseRequest.Raid, co.settings.Player)
+	if err != nil {
+		return nil, fmt.Errorf("consumes optimizer: %w", err)
+	}
+	co.partyIdx, co.playerIdx = partyIdx, playerIdx
+	co.player = co.baseRequest.Raid.Parties[partyIdx].Players[playerIdx]
+	if co.player.Consumes == nil {
+		co.player.Consumes = &proto.Consumes{}
+	}
+	if co.player.Buffs == nil {
+		co.player.Buffs = &proto.IndividualBuffs{}
+	}
+	for _, party := range co.baseRequest.Raid.Parties {
+		for _, player := range party.GetPlayers() {
+			if player.GetDatabase() != nil {
+				addToDatabase(player.GetDatabase())
+			}
+		}
+	}
+
+	numResults := int(co.settings.NumResults)
+	if numResults <= 0 {
+		numResults = defaultConsumesOptimizerNumResults
+	}
+	minIterations := int(co.settings.MinIterations)
+	if minIterations <= 0 {
+		minIterations = defaultConsumesOptimizerMinIterations
+	}
+	maxIterations := int(co.settings.MaxIterations)
+	if maxIterations <= 0 {
+		maxIterations = defaultConsumesOptimizerMaxIterations
+	}
+	maxIterations = max(maxIterations, minIterations)
+	optionsPerSlot := int(co.settings.OptionsPerSlot)
+	if optionsPerSlot <= 0 {
+		optionsPerSlot = defaultConsumesOptimizerOptionsPerSlot
+	}
+	maxCombinations := int(co.settings.MaxCombinations)
+	if maxCombinations <= 0 {
+		maxCombinations = defaultConsumesOptimizerMaxCombinations
+	}
+
+	co.collectSlots()
+
+	// Candidates are shared by loadout, so single choices that make it into the combinations
+	// keep their iterations.
+	loadoutsByKey := make(map[string]*consumesLoadout)
+	loadoutFor := func(values []int32) *consumesLoadout {
+		key := fmt.Sprint(values)
+		if loadout, ok := loadoutsByKey[key]; ok {
+			return loadout
+		}
+		loadout := &consumesLoadout{values: values, race: &raceCandidate{Request: co.requestFor(values)}}
+		loadoutsByKey[key] = loadout
+		return loadout
+	}
+
+	current := loadoutFor(MapSlice(co.slots, func(slot *consumeSlot) int32 { return slot.current }))
+	screened := []*raceCandidate{current.race}
+	singleChoices := make([]map[int32]*consumesLoadout, len(co.slots))
+	for i, slot := range co.slots {
+		singleChoices[i] = make(map[int32]*consumesLoadout)
+		if len(slot.values) < 2 {
+			continue
+		}
+		for _, value := range slot.values {
+			if value == slot.current {
+				continue
+			}
+			values := slices.Clone(current.values)
+			values[i] = value
+			singleChoices[i][value] = loadoutFor(values)
+			screened = append(screened, singleChoices[i][value].race)
+		}
+	}
+
+	race := newSimRace(co.SingleRaidSimRunner, co.baseRequest, partyIdx, playerIdx, progress)
+	race.expect(len(screened), len(screened)*minIterations)
+	if err := race.extend(ctx, screened, minIterations); err != nil {
+		return nil, err
+	}
+
+	for i, slot := range co.slots {
+		co.rankValues(slot, singleChoices[i], current, optionsPerSlot)
+	}
+
+	var loadouts []*consumesLoadout
+	for _, choice := range bestCombinations(MapSlice(co.slots, func(slot *consumeSlot) []float64 { return slot.scores }), maxCombinations*4) {
+		if len(loadouts) >= maxCombinations {
+			break
+		}
+		values := make([]int32, len(co.slots))
+		for i, slot := range co.slots {
+			values[i] = slot.values[choice[i]]
+		}
+		if co.isLegal(values) {
+			loadouts = append(loadouts, loadoutFor(values))
+		}
+	}
+	if len(loadouts) == 0 {
+		return nil, fmt.Errorf("consumes optimizer: no combination fits the constraints")
+	}
+
+	sims, iterations := halvingWork(len(loadouts), minIterations, maxIterations, numResults)
+	race.expect(sims+numResults+1, iterations+(numResults+1)*maxIterations)
+	if err := race.halve(ctx, MapSlice(loadouts, func(l *consumesLoadout) *raceCandidate { return l.race }), minIterations, maxIterations, numResults); err != nil {
+		return nil, err
+	}
+
+	// The best survivors are compared against the current consumes on fresh seeds, as the
+	// baseline for the deltas.
+	survivors := FilterSlice(loadouts, func(l *consumesLoadout) bool { return !l.race.Eliminated && l != current })
+	slices.SortStableFunc(survivors, func(a, b *consumesLoadout) int {
+		return cmp.Compare(b.race.Mean(), a.race.Mean())
+	})
+	finalists := slices.Clone(survivors[:min(len(survivors), numResults)])
+	currentSurvived := slices.Contains(loadouts, current) && !current.race.Eliminated
+	confirmed, err := race.confirm(ctx, MapSlice(append([]*consumesLoadout{current}, finalists...), func(l *consumesLoadout) *raceCandidate { return l.race }), maxIterations)
+	if err != nil {
+		return nil, err
+	}
+	current.race = confirmed[0]
+	for i, loadout := range finalists {
+		loadout.race = confirmed[i+1]
+	}
+	if currentSurvived {
+		finalists = append(finalists, current)
+	}
+	slices.SortStableFunc(finalists, func(a, b *consumesLoadout) int {
+		return cmp.Compare(b.race.Mean(), a.race.Mean())
+	})
+
+	result = &proto.ConsumesOptimizerResult{
+		Current:            co.loadoutToProto(current, current),
+		CombinationsSimmed: int32(len(loadouts)),
+		Iterations:         int32(maxIterations),
+		SkippedChoices:     co.skipped,
+	}
+	for _, loadout := range finalists[:min(len(finalists), numResults)] {
+		result.Loadouts = append(result.Loadouts, co.loadoutToProto(loadout, current))
+	}
+	return result, nil
+}
+
+// Builds the slots of the player with their legal values, applying the constraints of the
+// settings and skipping values without effect.
+func (co *consumesOptimizer) collectSlots() {
+	var fields []*consumeSlot
+	consumeFields := co.player.Consumes.ProtoReflect().Descriptor().Fields()
+	for i := 0; i < consumeFields.Len(); i++ {
+		field := consumeFields.Get(i)
+		if field.Kind() == protoreflect.EnumKind || field.Kind() == protoreflect.BoolKind {
+			fields = append(fields, &consumeSlot{field: field})
+		}
+	}
+	buffFields := co.player.Buffs.ProtoReflect().Descriptor().Fields()
+	for _, name := range worldBuffFields {
+		fields = append(fields, &consumeSlot{field: buffFields.ByName(name), worldBuff: true})
+	}
+
+	for _, slot := range fields {
+		slot.current = slot.get(co.player)
+		slot.categories = make(map[int32][]string)
+		if slices.Contains(co.settings.FixedSlots, string(slot.field.Name())) {
+			slot.values = []int32{slot.current}
+		} else if slot.worldBuff && co.settings.NoWorldBuffs {
+			slot.values = []int32{0}
+		} else {
+			co.collectValues(slot)
+		}
+		slot.scores = make([]float64, len(slot.values))
+		co.slots = append(co.slots, slot)
+	}
+}
+
+func (co *consumesOptimizer) collectValues(slot *consumeSlot) {
+	var values []int32
+	if slot.field.Kind() == protoreflect.BoolKind {
+		values = []int32{0, 1}
+	} else {
+		enumValues := slot.field.Enum().Values()
+		for i := 0; i < enumValues.Len(); i++ {
+			values = append(values, int32(enumValues.Get(i).Number()))
+		}
+	}
+
+	noneEffects := co.effectsWith(slot, 0)
+	slot.values = []int32{0}
+	for _, value := range values {
+		if value == 0 {
+			continue
+		}
+		name := slot.valueName(value)
+		if faction, ok := factionOnlyChoices[name]; ok && co.settings.OwnFactionOnly && faction != raceFaction(co.player.Race) {
+			co.skip(slot, value, fmt.Sprintf("only available to %s", faction))
+			continue
+		}
+		if co.settings.MaxGold > 0 && co.settings.GoldCosts[name] > co.settings.MaxGold {
+			co.skip(slot, value, "costs more than the gold limit")
+			continue
+		}
+
+		effects := co.effectsWith(slot, value)
+		if effects.equals(noneEffects) {
+			co.skip(slot, value, "has no effect")
+			continue
+		}
+		for _, name := range sortedKeys(effects.categories) {
+			if effects.categories[name] > noneEffects.categories[name] {
+				slot.categories[value] = append(slot.categories[value], name)
+			}
+		}
+		slot.values = append(slot.values, value)
+	}
+}
+
+func (co *consumesOptimizer) skip(slot *consumeSlot, value int32, reason string) {
+	co.skipped = append(co.skipped, fmt.Sprintf("%s: %s %s", slot.field.Name(), slot.displayValue(value), reason))
+}
+
+// Constructs the player on its own with the value in the slot, and returns its effects.
+func (co *consumesOptimizer) effectsWith(slot *consumeSlot, value int32) *consumeEffects {
+	player := googleProto.Clone(co.player).(*proto.Player)
+	slot.set(player, value)
+	raid := googleProto.Clone(co.baseRequest.Raid).(*proto.Raid)
+	raid.Parties = []*proto.Party{{
+		Players: []*proto.Player{player},
+		Buffs:   raid.Parties[co.partyIdx].Buffs,
+	}}
+	env, _, _ := NewEnvironment(raid, co.baseRequest.Encounter, false)
+	character := env.Raid.Parties[0].Players[0].GetCharacter()
+
+	effects := &consumeEffects{
+		stats:       character.GetStats(),
+		pseudoStats: character.PseudoStats,
+		weapons:     [3]Weapon{*character.AutoAttacks.MH(), *character.AutoAttacks.OH(), *character.AutoAttacks.Ranged()},
+		auras:       MapSlice(character.auras, func(aura *Aura) string { return aura.Label }),
+		spells:      MapSlice(character.Spellbook, func(spell *Spell) ActionID { return spell.ActionID }),
+		cooldowns:   MapSlice(character.initialMajorCooldowns, func(mcd MajorCooldown) ActionID { return mcd.Spell.ActionID }),
+		categories:  make(map[string]int),
+	}
+	for _, category := range character.ExclusiveEffectManager.categories {
+		effects.categories[category.Name] += len(category.effects)
+	}
+	return effects
+}
+
+// Sorts the values of the slot by the DPS delta of simming each on its own, and keeps the best
+// ones. With a gold limit, the free value 0 is kept too so cheaper loadouts remain possible.
+func (co *consumesOptimizer) rankValues(slot *consumeSlot, singleChoices map[int32]*consumesLoadout, current *consumesLoadout, optionsPerSlot int) {
+	if len(slot.values) < 2 {
+		return
+	}
+	score := func(value int32) float64 {
+		if value == slot.current {
+			return 0
+		}
+		delta, _ := compareRaceCandidates(singleChoices[value].race, current.race)
+		return delta
+	}
+
+	values := slices.Clone(slot.values)
+	slices.SortStableFunc(values, func(a, b int32) int {
+		return cmp.Compare(score(b), score(a))
+	})
+	kept := values[:min(len(values), optionsPerSlot)]
+	if co.settings.MaxGold > 0 && !slices.Contains(kept, 0) {
+		kept = append(kept, 0)
+	}
+	slot.values = kept
+	slot.scores = MapSlice(kept, score)
+}
+
+// Whether the loadout fits the gold limit and has no two values adding effects to the same
+// exclusive effect category.
+func (co *consumesOptimizer) isLegal(values []int32) bool {
+	if co.settings.MaxGold > 0 && co.goldCost(values) > co.settings.MaxGold {
+		return false
+	}
+	seen := make(map[string]bool)
+	for i, slot := range co.slots {
+		for _, category := range slot.categories[values[i]] {
+			if seen[category] {
+				return false
+			}
+			seen[category] = true
+		}
+	}
+	return true
+}
+
+func (co *consumesOptimizer) goldCost(values []int32) float64 {
+	cost := 0.0
+	for i, slot := range co.slots {
+		if values[i] != 0 {
+			cost += co.settings.GoldCosts[slot.valueName(values[i])]
+		}
+	}
+	return cost
+}
+
+func (co *consumesOptimizer) requestFor(values []int32) *proto.RaidSimRequest {
+	request := googleProto.Clone(co.baseRequest).(*proto.RaidSimRequest)
+	player := request.Raid.Parties[co.partyIdx].Players[co.playerIdx]
+	for i, slot := range co.slots {
+		slot.set(player, values[i])
+	}
+	return request
+}
+
+func (co *consumesOptimizer) loadoutToProto(loadout *consumesLoadout, current *consumesLoadout) *proto.ConsumesLoadout {
+	delta, halfWidth := 0.0, 0.0
+	if loadout != current {
+		delta, halfWidth = compareRaceCandidates(loadout.race, current.race)
+	}
+	player := loadout.race.Request.Raid.Parties[co.partyIdx].Players[co.playerIdx]
+	result := &proto.ConsumesLoadout{
+		Consumes:       player.Consumes,
+		Buffs:          player.Buffs,
+		GoldCost:       co.goldCost(loadout.values),
+		Dps:            loadout.race.Mean(),
+		DpsDelta:       delta,
+		DpsDeltaCiLow:  delta - halfWidth,
+		DpsDeltaCiHigh: delta + halfWidth,
+	}
+	for i, slot := range co.slots {
+		if loadout.values[i] != current.values[i] {
+			result.Changes = append(result.Changes, fmt.Sprintf("%s: %s -> %s", slot.field.Name(), slot.displayValue(current.values[i]), slot.displayValue(loadout.values[i])))
+		}
+	}
+	return result
+}
+
+func (slot *consumeSlot) message(player *proto.Player) protoreflect.Message {
+	if slot.worldBuff {
+		return player.Buffs.ProtoReflect()
+	}
+	return player.Consumes.ProtoReflect()
+}
+
+func (slot *consumeSlot) get(player *proto.Player) int32 {
+	value := slot.message(player).Get(slot.field)
+	if slot.field.Kind() == protoreflect.BoolKind {
+		if value.Bool() {
+			return 1
+		}
+		return 0
+	}
+	return int32(value.Enum())
+}
+
+func (slot *consumeSlot) set(player *proto.Player, value int32) {
+	if slot.field.Kind() == protoreflect.BoolKind {
+		slot.message(player).Set(slot.field, protoreflect.ValueOfBool(value != 0))
+	} else {
+		slot.message(player).Set(slot.field, protoreflect.ValueOfEnum(protoreflect.EnumNumber(value)))
+	}
+}
+
+// Name of the value used for gold costs: the enum value name, or the field name for bools
+// that are on.
+func (slot *consumeSlot) valueName(value int32) string {
+	if slot.field.Kind() == protoreflect.BoolKind {
+		if value != 0 {
+			return string(slot.field.Name())
+		}
+		return ""
+	}
+	if enumValue := slot.field.Enum().Values().ByNumber(protoreflect.EnumNumber(value)); enumValue != nil {
+		return string(enumValue.Name())
+	}
+	return fmt.Sprint(value)
+}
+
+func (slot *consumeSlot) displayValue(value int32) string {
+	if slot.field.Kind() == protoreflect.BoolKind {
+		if value != 0 {
+			return "on"
+		}
+		return "off"
+	}
+	return slot.valueName(value)
+}
@@ -0,0 +1,111 @@
+package core
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/wowsims/sod/sim/core/proto"
+	"github.com/wowsims/sod/sim/core/stats"
+)
+
+func TestWorldBuffFields(t *testing.T) {
+	fields := (&proto.IndividualBuffs{}).ProtoReflect().Descriptor().Fields()
+	for _, name := range worldBuffFields {
+		field := fields.ByName(name)
+		if field == nil {
+			t.Errorf("IndividualBuffs has no field %s", name)
+		} else if field.Kind() != protoreflect.BoolKind && field.Kind() != protoreflect.EnumKind {
+			t.Errorf("World buff %s is neither a bool nor an enum", name)
+		}
+	}
+	for name := range factionOnlyChoices {
+		if !slices.Contains(worldBuffFields, protoreflect.Name(name)) {
+			t.Errorf("Faction only choice %s is not a world buff", name)
+		}
+	}
+}
+
+// A fake runner whose raid DPS is 100 plus the spell power and spell damage the player gets
+// from its consumes, the same in every iteration.
+func fakeConsumesSimRunner(rsr *proto.RaidSimRequest, _ chan *proto.ProgressMetrics, _ bool) *proto.RaidSimResult {
+	env, _, _ := NewEnvironment(rsr.Raid, rsr.Encounter, false)
+	playerStats := env.Raid.Parties[0].Players[0].GetCharacter().GetStats()
+	return fakeBulkSimResult(rsr, 100+playerStats[stats.SpellPower]+playerStats[stats.SpellDamage])
+}
+
+func TestConsumesOptimizer(t *testing.T) {
+	rsr := fakeCasterRaidSimRequest()
+	rsr.Raid.Parties[0].Players[0].Race = proto.Race_RaceHuman
+	openSlots := []string{"flask", "spell_power_buff", "sapper", "warchiefs_blessing"}
+	var fixedSlots []string
+	for _, message := range []protoreflect.ProtoMessage{&proto.Consumes{}, &proto.IndividualBuffs{}} {
+		fields := message.ProtoReflect().Descriptor().Fields()
+		for i := 0; i < fields.Len(); i++ {
+			if name := string(fields.Get(i).Name()); !slices.Contains(openSlots, name) {
+				fixedSlots = append(fixedSlots, name)
+			}
+		}
+	}
+
+	optimizer := &consumesOptimizer{
+		SingleRaidSimRunner: fakeConsumesSimRunner,
+		Request: &proto.ConsumesOptimizerRequest{
+			BaseSettings: rsr,
+			Settings: &proto.ConsumesOptimizerSettings{
+				OwnFactionOnly: true,
+				GoldCosts:      map[string]float64{"FlaskOfSupremePower": 15, "FlaskOfTheTitans": 30, "GreaterArcaneElixir": 10, "ArcaneElixir": 4},
+				MaxGold:        20,
+				FixedSlots:     fixedSlots,
+				NumResults:     3,
+				MinIterations:  20,
+				MaxIterations:  80,
+			},
+		},
+	}
+	result, err := optimizer.Run(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Consumes optimizer failed with error: %s", err)
+	}
+	if result.ErrorResult != "" {
+		t.Fatalf("Consumes optimizer failed with error: %s", result.ErrorResult)
+	}
+
+	expectedSkipped := []string{
+		"flask: FlaskOfTheTitans costs more than the gold limit",
+		"sapper: on has no effect",
+		"warchiefs_blessing: on only available to Horde",
+	}
+	if !slices.Equal(result.SkippedChoices, expectedSkipped) {
+		t.Errorf("Expected skipped choices %v, got %v", expectedSkipped, result.SkippedChoices)
+	}
+	if result.Current.Dps != 100 {
+		t.Errorf("Expected the current consumes to have 100 DPS, got %.3f", result.Current.Dps)
+	}
+
+	// Supreme Power with Greater Arcane Elixir is over the gold limit, so the best loadout has
+	// to settle for the cheaper elixir.
+	expected := []struct {
+		flask          proto.Flask
+		spellPowerBuff proto.SpellPowerBuff
+		goldCost       float64
+		dpsDelta       float64
+	}{
+		{proto.Flask_FlaskOfSupremePower, proto.SpellPowerBuff_ArcaneElixir, 19, 170},
+		{proto.Flask_FlaskOfSupremePower, proto.SpellPowerBuff_SpellPowerBuffUnknown, 15, 150},
+		{proto.Flask_FlaskUnknown, proto.SpellPowerBuff_GreaterArcaneElixir, 10, 35},
+	}
+	if len(result.Loadouts) != len(expected) {
+		t.Fatalf("Expected %d loadouts, got %d", len(expected), len(result.Loadouts))
+	}
+	for i, loadout := range result.Loadouts {
+		if loadout.Consumes.Flask != expected[i].flask || loadout.Consumes.SpellPowerBuff != expected[i].spellPowerBuff {
+			t.Errorf("Expected loadout %d to use %s and %s, got %v", i, expected[i].flask, expected[i].spellPowerBuff, loadout.Changes)
+		}
+		if loadout.GoldCost != expected[i].goldCost || loadout.DpsDelta != expected[i].dpsDelta {
+			t.Errorf("Expected loadout %d to cost %.0f gold for %.0f DPS, got %.0f gold for %.3f DPS", i, expected[i].goldCost, expected[i].dpsDelta, loadout.GoldCost, loadout.DpsDelta)
+		}
+	}
+}
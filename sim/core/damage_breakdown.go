@@ -0,0 +1,148 @@
+package core
+
+import (
+	"time"
+
+	"github.com/wowsims/sod/sim/core/proto"
+)
+
+// Target health thresholds of the execute phases, see Simulation.IsExecutePhase35 etc.
+var executePhaseThresholds = [3]int32{35, 25, 20}
+
+// damageBreakdown splits up the damage of a unit by spell school, execute phase and major
+// cooldown windows.
+type damageBreakdown struct {
+	// Metrics for the current iteration.
+	executeDamage        [len(executePhaseThresholds)]float64
+	majorCooldownDamage  float64
+	majorCooldownTime    time.Duration
+	activeMajorCooldowns int
+	majorCooldownStart   time.Duration
+
+	// Aggregate values. These are updated after each iteration.
+	schoolDamageSum        map[SpellSchool]float64
+	totalDamageSum         float64
+	totalSecondsSum        float64
+	executeDamageSum       [len(executePhaseThresholds)]float64
+	executeSecondsSum      [len(executePhaseThresholds)]float64
+	majorCooldownDamageSum float64
+	majorCooldownSeconds   float64
+}
+
+func newDamageBreakdown() damageBreakdown {
+	return damageBreakdown{
+		schoolDamageSum: make(map[SpellSchool]float64),
+	}
+}
+
+func (db *damageBreakdown) reset() {
+	db.executeDamage = [len(executePhaseThresholds)]float64{}
+	db.majorCooldownDamage = 0
+	db.majorCooldownTime = 0
+	db.activeMajorCooldowns = 0
+}
+
+func (db *damageBreakdown) addDamage(sim *Simulation, damage float64) {
+	for i, threshold := range executePhaseThresholds {
+		if sim.executePhase <= threshold {
+			db.executeDamage[i] += damage
+		}
+	}
+	if db.activeMajorCooldowns > 0 {
+		db.majorCooldownDamage += damage
+	}
+}
+
+// Adds the damage a spell did in the current iteration.
+func (db *damageBreakdown) addSpellDamage(spell *Spell, damage float64) {
+	if damage != 0 {
+		db.schoolDamageSum[spell.SpellSchool] += damage
+		db.totalDamageSum += damage
+	}
+}
+
+// Tracks the windows in which aura, which is applied by a major cooldown, is active.
+func (db *damageBreakdown) trackMajorCooldownAura(aura *Aura) {
+	aura.ApplyOnGain(func(_ *Aura, sim *Simulation) {
+		if db.activeMajorCooldowns == 0 {
+			db.majorCooldownStart = max(sim.CurrentTime, 0)
+		}
+		db.activeMajorCooldowns++
+	})
+	aura.ApplyOnExpire(func(_ *Aura, sim *Simulation) {
+		db.activeMajorCooldowns--
+		if db.activeMajorCooldowns == 0 {
+			db.majorCooldownTime += max(sim.CurrentTime-db.majorCooldownStart, 0)
+		}
+	})
+}
+
+// This should be called when a Sim iteration is complete, after all auras have expired.
+func (db *damageBreakdown) doneIteration(sim *Simulation) {
+	db.totalSecondsSum += sim.CurrentTime.Seconds()
+	for i := range executePhaseThresholds {
+		db.executeDamageSum[i] += db.executeDamage[i]
+		db.executeSecondsSum[i] += max(sim.CurrentTime-sim.executePhaseStarts[i], 0).Seconds()
+	}
+	db.majorCooldownDamageSum += db.majorCooldownDamage
+	db.majorCooldownSeconds += db.majorCooldownTime.Seconds()
+}
+
+// Adds the aggregate values of other, which covers the iterations right after those of db.
+func (db *damageBreakdown) mergeMetrics(other *damageBreakdown) {
+	for school, damage := range other.schoolDamageSum {
+		db.schoolDamageSum[school] += damage
+	}
+	db.totalDamageSum += other.totalDamageSum
+	db.totalSecondsSum += other.totalSecondsSum
+	for i := range executePhaseThresholds {
+		db.executeDamageSum[i] += other.executeDamageSum[i]
+		db.executeSecondsSum[i] += other.executeSecondsSum[i]
+	}
+	db.majorCooldownDamageSum += other.majorCooldownDamageSum
+	db.majorCooldownSeconds += other.majorCooldownSeconds
+}
+
+func phaseDamageToProto(damageSum float64, secondsSum float64, n float64) *proto.PhaseDamage {
+	phaseDamage := &proto.PhaseDamage{
+		Avg:        damageSum / n,
+		SecondsAvg: secondsSum / n,
+	}
+	if secondsSum > 0 {
+		phaseDamage.Dps = damageSum / secondsSum
+	}
+	return phaseDamage
+}
+
+func (db *damageBreakdown) ToProto(numIterations int) *proto.DamageBreakdown {
+	n := float64(numIterations)
+	breakdown := &proto.DamageBreakdown{
+		PreExecute:            phaseDamageToProto(db.totalDamageSum-db.executeDamageSum[0], db.totalSecondsSum-db.executeSecondsSum[0], n),
+		MajorCooldowns:        phaseDamageToProto(db.majorCooldownDamageSum, db.majorCooldownSeconds, n),
+		OutsideMajorCooldowns: phaseDamageToProto(db.totalDamageSum-db.majorCooldownDamageSum, db.totalSecondsSum-db.majorCooldownSeconds, n),
+	}
+
+	for _, school := range sortedKeys(db.schoolDamageSum) {
+		breakdown.Schools = append(breakdown.Schools, &proto.SchoolDamage{
+			Schools: spellSchoolsToProto(school),
+			Avg:     db.schoolDamageSum[school] / n,
+		})
+	}
+	for i, threshold := range executePhaseThresholds {
+		phaseDamage := phaseDamageToProto(db.executeDamageSum[i], db.executeSecondsSum[i], n)
+		phaseDamage.ExecuteThreshold = threshold
+		breakdown.ExecutePhases = append(breakdown.ExecutePhases, phaseDamage)
+	}
+	return breakdown
+}
+
+// Returns the aura applied by a major cooldown, if any.
+func majorCooldownAura(character *Character, mcd *MajorCooldown) *Aura {
+	if aura := character.GetAuraByID(mcd.Spell.ActionID); aura != nil {
+		return aura
+	}
+	if itemID := mcd.Spell.ActionID.ItemID; itemID != 0 {
+		return findTrinketAura(character, itemID)
+	}
+	return nil
+}
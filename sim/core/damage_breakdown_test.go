@@ -0,0 +1,56 @@
+package core
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/wowsims/sod/sim/core/proto"
+)
+
+func TestDamageBreakdown(t *testing.T) {
+	rsr := fakeCasterRaidSimRequest()
+	rsr.Encounter.ExecuteProportion_35 = 0.35
+	rsr.Encounter.ExecuteProportion_25 = 0.25
+	rsr.Encounter.ExecuteProportion_20 = 0.2
+	result := RunRaidSim(rsr)
+	if result.ErrorResult != "" {
+		t.Fatalf("Sim failed with error: %s", result.ErrorResult)
+	}
+	player := result.RaidMetrics.Parties[0].Players[0]
+	breakdown := player.DamageBreakdown
+
+	// All damage comes from the fake dot.
+	if len(breakdown.Schools) != 1 || !slices.Equal(breakdown.Schools[0].Schools, []proto.SpellSchool{proto.SpellSchool_SpellSchoolShadow}) {
+		t.Fatalf("Expected only shadow damage, got %v", breakdown.Schools)
+	}
+	totalDamage := breakdown.Schools[0].Avg
+
+	expectTotal := func(name string, damage float64) {
+		if math.Abs(damage-totalDamage) > 1e-6*totalDamage {
+			t.Errorf("%s damage adds up to %.3f, expected %.3f", name, damage, totalDamage)
+		}
+	}
+	expectTotal("Execute phase", breakdown.PreExecute.Avg+breakdown.ExecutePhases[0].Avg)
+	expectTotal("Major cooldown", breakdown.MajorCooldowns.Avg+breakdown.OutsideMajorCooldowns.Avg)
+
+	// The execute phases cover the last part of the fight given by the encounter.
+	fightSeconds := breakdown.PreExecute.SecondsAvg + breakdown.ExecutePhases[0].SecondsAvg
+	if math.Abs(totalDamage-player.Dps.Avg*fightSeconds) > 0.01*totalDamage {
+		t.Errorf("Shadow damage %.3f over %.3fs doesn't match %.3f dps", totalDamage, fightSeconds, player.Dps.Avg)
+	}
+	for i, proportion := range []float64{0.35, 0.25, 0.2} {
+		phase := breakdown.ExecutePhases[i]
+		if math.Abs(phase.SecondsAvg-proportion*fightSeconds) > 0.1 {
+			t.Errorf("Execute phase %d lasts %.3fs, expected %.3fs", phase.ExecuteThreshold, phase.SecondsAvg, proportion*fightSeconds)
+		}
+		if phase.Avg <= 0 || phase.Avg >= totalDamage {
+			t.Errorf("Expected some of the damage in execute phase %d, got %.3f", phase.ExecuteThreshold, phase.Avg)
+		}
+	}
+
+	// The fake caster has no major cooldowns.
+	if breakdown.MajorCooldowns.Avg != 0 || breakdown.MajorCooldowns.SecondsAvg != 0 {
+		t.Errorf("Expected no major cooldown windows, got %v", breakdown.MajorCooldowns)
+	}
+}
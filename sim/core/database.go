@@ -2,6 +2,7 @@ package core
 
 import (
 	"fmt"
+	"slices"
 	"sync"
 
 	"github.com/wowsims/sod/sim/core/proto"
@@ -15,6 +16,15 @@ var rwMutex = sync.RWMutex{}
 var ItemsByID = map[int32]Item{}
 var RandomSuffixesByID = map[int32]RandomSuffix{}
 var EnchantsByEffectID = map[int32]Enchant{}
+var RunesByID = map[int32]Rune{}
+
+// Full item data, including item sources, used to filter items in the gear optimizer. Only
+// filled when the sim is built with the database.
+var uiItemsByID = map[int32]*proto.UIItem{}
+
+// Names of zones and NPCs, used to describe item sources.
+var uiZonesByID = map[int32]*proto.UIZone{}
+var uiNpcsByID = map[int32]*proto.UINPC{}
 
 func addToDatabase(newDB *proto.SimDatabase) {
 	for _, v := range newDB.Items {
@@ -35,14 +45,27 @@ func addToDatabase(newDB *proto.SimDatabase) {
 
 	for _, v := range newDB.Enchants {
 		rwMutex.Lock()
-		if _, ok := EnchantsByEffectID[v.EffectId]; !ok {
+		if enchant, ok := EnchantsByEffectID[v.EffectId]; !ok {
 			EnchantsByEffectID[v.EffectId] = EnchantFromProto(v)
+		} else {
+			// Enchants are only unique by effect ID and slot, e.g. the same effect may exist
+			// for bracers and for gloves. Items refer to them by effect ID, so merge the types.
+			for _, itemType := range EnchantFromProto(v).Types {
+				if !slices.Contains(enchant.Types, itemType) {
+					enchant.Types = append(enchant.Types, itemType)
+				}
+			}
+			EnchantsByEffectID[v.EffectId] = enchant
 		}
 		rwMutex.Unlock()
 	}
 
 	for _, v := range newDB.Runes {
-		fmt.Println(RuneFromProto(v))
+		rwMutex.Lock()
+		if _, ok := RunesByID[v.Id]; !ok {
+			RunesByID[v.Id] = RuneFromProto(v)
+		}
+		rwMutex.Unlock()
 	}
 }
 
@@ -73,6 +96,24 @@ type Item struct {
 	TempEnchant int32
 }
 
+func SimItemFromUIItem(item *proto.UIItem) *proto.SimItem {
+	return &proto.SimItem{
+		Id:               item.Id,
+		Name:             item.Name,
+		Type:             item.Type,
+		ArmorType:        item.ArmorType,
+		WeaponType:       item.WeaponType,
+		HandType:         item.HandType,
+		RangedWeaponType: item.RangedWeaponType,
+		Stats:            item.Stats,
+		WeaponDamageMin:  item.WeaponDamageMin,
+		WeaponDamageMax:  item.WeaponDamageMax,
+		WeaponSpeed:      item.WeaponSpeed,
+		SetName:          item.SetName,
+		WeaponSkills:     item.WeaponSkills,
+	}
+}
+
 func ItemFromProto(pData *proto.SimItem) Item {
 	return Item{
 		ID:               pData.Id,
@@ -118,22 +159,43 @@ func RandomSuffixFromProto(pData *proto.ItemRandomSuffix) RandomSuffix {
 type Enchant struct {
 	EffectID int32 // Used by UI to apply effect to tooltip
 	Stats    stats.Stats
+
+	// Items the enchant applies to, see enchantAppliesToItem.
+	Types              []proto.ItemType
+	EnchantType        proto.EnchantType
+	ClassAllowlist     []proto.Class
+	RequiredProfession proto.Profession
 }
 
 func EnchantFromProto(pData *proto.SimEnchant) Enchant {
-	return Enchant{
-		EffectID: pData.EffectId,
-		Stats:    stats.FromFloatArray(pData.Stats),
+	enchant := Enchant{
+		EffectID:           pData.EffectId,
+		Stats:              stats.FromFloatArray(pData.Stats),
+		EnchantType:        pData.EnchantType,
+		ClassAllowlist:     pData.ClassAllowlist,
+		RequiredProfession: pData.RequiredProfession,
 	}
+	if pData.Type != proto.ItemType_ItemTypeUnknown {
+		enchant.Types = append([]proto.ItemType{pData.Type}, pData.ExtraTypes...)
+	}
+	return enchant
 }
 
 type Rune struct {
-	ID int32
+	ID            int32
+	Name          string
+	Class         proto.Class
+	Type          proto.ItemType // The type of item the rune is engraved on.
+	RequiresLevel int32
 }
 
 func RuneFromProto(pData *proto.SimRune) Rune {
 	return Rune{
-		ID: pData.Id,
+		ID:            pData.Id,
+		Name:          pData.Name,
+		Class:         pData.Class,
+		Type:          pData.Type,
+		RequiresLevel: pData.RequiresLevel,
 	}
 }
 
@@ -398,3 +460,51 @@ func eligibleSlotsForItem(item Item) []proto.ItemSlot {
 
 	return nil
 }
+
+// Whether the enchant can be applied to the item, like enchantAppliesToItem in utils.ts.
+func enchantAppliesToItem(enchant Enchant, item Item) bool {
+	itemSlots := eligibleSlotsForItem(item)
+	var sharedSlots []proto.ItemSlot
+	for _, itemType := range enchant.Types {
+		slots := itemTypeToSlotsMap[itemType]
+		if itemType == proto.ItemType_ItemTypeWeapon {
+			slots = []proto.ItemSlot{proto.ItemSlot_ItemSlotMainHand, proto.ItemSlot_ItemSlotOffHand}
+		}
+		sharedSlots = append(sharedSlots, FilterSlice(slots, func(slot proto.ItemSlot) bool { return slices.Contains(itemSlots, slot) })...)
+	}
+	if len(sharedSlots) == 0 {
+		return false
+	}
+
+	if enchant.EnchantType == proto.EnchantType_EnchantTypeTwoHand && item.HandType != proto.HandType_HandTypeTwoHand {
+		return false
+	}
+	if (enchant.EnchantType == proto.EnchantType_EnchantTypeShield) != (item.WeaponType == proto.WeaponType_WeaponTypeShield) {
+		return false
+	}
+	if enchant.EnchantType == proto.EnchantType_EnchantTypeStaff && item.WeaponType != proto.WeaponType_WeaponTypeStaff {
+		return false
+	}
+	if item.WeaponType == proto.WeaponType_WeaponTypeOffHand {
+		return false
+	}
+	if slices.Contains(sharedSlots, proto.ItemSlot_ItemSlotRanged) {
+		switch item.RangedWeaponType {
+		case proto.RangedWeaponType_RangedWeaponTypeBow, proto.RangedWeaponType_RangedWeaponTypeCrossbow, proto.RangedWeaponType_RangedWeaponTypeGun:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Whether the player is allowed to use the enchant, based on class and professions.
+func playerCanUseEnchant(enchant Enchant, player *proto.Player) bool {
+	if len(enchant.ClassAllowlist) > 0 && !slices.Contains(enchant.ClassAllowlist, player.Class) {
+		return false
+	}
+	if enchant.RequiredProfession != proto.Profession_ProfessionUnknown && enchant.RequiredProfession != player.Profession1 && enchant.RequiredProfession != player.Profession2 {
+		return false
+	}
+	return true
+}
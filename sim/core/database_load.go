@@ -17,30 +17,29 @@ func init() {
 		Items:          make([]*proto.SimItem, len(db.Items)),
 		Enchants:       make([]*proto.SimEnchant, len(db.Enchants)),
 		RandomSuffixes: make([]*proto.ItemRandomSuffix, len(db.RandomSuffixes)),
+		Runes:          make([]*proto.SimRune, len(db.Runes)),
 	}
 
 	for i, item := range db.Items {
-		simDB.Items[i] = &proto.SimItem{
-			Id:               item.Id,
-			Name:             item.Name,
-			Type:             item.Type,
-			ArmorType:        item.ArmorType,
-			WeaponType:       item.WeaponType,
-			HandType:         item.HandType,
-			RangedWeaponType: item.RangedWeaponType,
-			Stats:            item.Stats,
-			WeaponDamageMin:  item.WeaponDamageMin,
-			WeaponDamageMax:  item.WeaponDamageMax,
-			WeaponSpeed:      item.WeaponSpeed,
-			SetName:          item.SetName,
-			WeaponSkills:     item.WeaponSkills,
-		}
+		simDB.Items[i] = SimItemFromUIItem(item)
+		uiItemsByID[item.Id] = item
+	}
+	for _, zone := range db.Zones {
+		uiZonesByID[zone.Id] = zone
+	}
+	for _, npc := range db.Npcs {
+		uiNpcsByID[npc.Id] = npc
 	}
 
 	for i, enchant := range db.Enchants {
 		simDB.Enchants[i] = &proto.SimEnchant{
-			EffectId: enchant.EffectId,
-			Stats:    enchant.Stats,
+			EffectId:           enchant.EffectId,
+			Stats:              enchant.Stats,
+			Type:               enchant.Type,
+			ExtraTypes:         enchant.ExtraTypes,
+			EnchantType:        enchant.EnchantType,
+			ClassAllowlist:     enchant.ClassAllowlist,
+			RequiredProfession: enchant.RequiredProfession,
 		}
 	}
 
@@ -52,5 +51,15 @@ func init() {
 		}
 	}
 
+	for i, uiRune := range db.Runes {
+		simDB.Runes[i] = &proto.SimRune{
+			Id:            uiRune.Id,
+			Name:          uiRune.Name,
+			Class:         uiRune.Class,
+			Type:          uiRune.Type,
+			RequiresLevel: uiRune.RequiresLevel,
+		}
+	}
+
 	addToDatabase(simDB)
 }
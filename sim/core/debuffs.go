@@ -26,6 +26,15 @@ var LevelToDebuffRank = map[DebuffName]map[int32]int32{
 
 func applyDebuffEffects(target *Unit, targetIdx int, debuffs *proto.Debuffs, raid *proto.Raid) {
 	level := raid.Parties[0].Players[0].Level
+
+	// Debuffs that other raid members have to apply after the pull. These are active from the
+	// start of the fight, unless ramp up is enabled.
+	applyExternal := func(aura *Aura) *Aura {
+		if debuffs.RampUp {
+			return MakeRampingUp(aura, GCDDefault, 0, 1)
+		}
+		return MakePermanent(aura)
+	}
 	if debuffs.JudgementOfWisdom && targetIdx == 0 {
 		jowAura := JudgementOfWisdomAura(target, level)
 		if jowAura != nil {
@@ -55,25 +64,35 @@ func applyDebuffEffects(target *Unit, targetIdx int, debuffs *proto.Debuffs, rai
 	}
 
 	if debuffs.CurseOfElements {
-		MakePermanent(CurseOfElementsAura(target, level))
+		applyExternal(CurseOfElementsAura(target, level))
 	}
 
 	if debuffs.CurseOfShadow {
-		MakePermanent(CurseOfShadowAura(target, level))
+		applyExternal(CurseOfShadowAura(target, level))
 	}
 
 	if debuffs.ImprovedScorch && targetIdx == 0 {
-		MakePermanent(ImprovedScorchAura(target))
+		if debuffs.RampUp {
+			// One stack per Scorch.
+			MakeRampingUp(ImprovedScorchAura(target, 0), time.Millisecond*1500, time.Millisecond*1500, 5)
+		} else {
+			MakePermanent(ImprovedScorchAura(target, 5))
+		}
 	}
 
 	if debuffs.WintersChill && targetIdx == 0 {
-		MakePermanent(WintersChillAura(target, 5))
+		if debuffs.RampUp {
+			// One stack per Frostbolt.
+			MakeRampingUp(WintersChillAura(target, 0), time.Millisecond*2500, time.Millisecond*2500, 5)
+		} else {
+			MakePermanent(WintersChillAura(target, 5))
+		}
 	}
 
 	if debuffs.Stormstrike {
-		MakePermanent(StormstrikeAura(target, level))
+		applyExternal(StormstrikeAura(target, level))
 	} else if debuffs.Dreamstate {
-		MakePermanent(DreamstateAura(target))
+		applyExternal(DreamstateAura(target))
 	}
 
 	if debuffs.GiftOfArthas {
@@ -81,11 +100,11 @@ func applyDebuffEffects(target *Unit, targetIdx int, debuffs *proto.Debuffs, rai
 	}
 
 	if debuffs.CurseOfVulnerability {
-		MakePermanent(CurseOfVulnerabilityAura(target))
+		applyExternal(CurseOfVulnerabilityAura(target))
 	}
 
 	if debuffs.Mangle {
-		MakePermanent(MangleAura(target, level))
+		applyExternal(MangleAura(target, level))
 	}
 
 	if debuffs.CrystalYield {
@@ -111,12 +130,12 @@ func applyDebuffEffects(target *Unit, targetIdx int, debuffs *proto.Debuffs, rai
 		}
 
 		if debuffs.SunderArmor {
-			// Sunder Armor
+			// Sunder Armor, with ramp up starting after the warrior's first GCD.
 			aura := SunderArmorAura(target, level)
 			ScheduledMajorArmorAura(aura, PeriodicActionOptions{
 				Period:          time.Millisecond * 1500,
 				NumTicks:        5,
-				TickImmediately: true,
+				TickImmediately: !debuffs.RampUp,
 				Priority:        ActionPriorityDOT, // High prio so it comes before actual warrior sunders.
 				OnAction: func(sim *Simulation) {
 					aura.Activate(sim)
@@ -136,38 +155,38 @@ func applyDebuffEffects(target *Unit, targetIdx int, debuffs *proto.Debuffs, rai
 	}
 
 	if debuffs.CurseOfRecklessness {
-		MakePermanent(CurseOfRecklessnessAura(target, level))
+		applyExternal(CurseOfRecklessnessAura(target, level))
 	}
 
 	if debuffs.FaerieFire {
-		MakePermanent(FaerieFireAura(target, level))
+		applyExternal(FaerieFireAura(target, level))
 	}
 
 	if debuffs.CurseOfWeakness != proto.TristateEffect_TristateEffectMissing {
-		MakePermanent(CurseOfWeaknessAura(target, GetTristateValueInt32(debuffs.CurseOfWeakness, 1, 2), level))
+		applyExternal(CurseOfWeaknessAura(target, GetTristateValueInt32(debuffs.CurseOfWeakness, 1, 2), level))
 	}
 
 	if debuffs.DemoralizingRoar != proto.TristateEffect_TristateEffectMissing {
-		MakePermanent(DemoralizingRoarAura(target, GetTristateValueInt32(debuffs.DemoralizingRoar, 0, 5), level))
+		applyExternal(DemoralizingRoarAura(target, GetTristateValueInt32(debuffs.DemoralizingRoar, 0, 5), level))
 	}
 	if debuffs.DemoralizingShout != proto.TristateEffect_TristateEffectMissing {
-		MakePermanent(DemoralizingShoutAura(target, 0, GetTristateValueInt32(debuffs.DemoralizingShout, 0, 5), level))
+		applyExternal(DemoralizingShoutAura(target, 0, GetTristateValueInt32(debuffs.DemoralizingShout, 0, 5), level))
 	}
 	if debuffs.HuntersMark != proto.TristateEffect_TristateEffectMissing {
-		MakePermanent(HuntersMarkAura(target, GetTristateValueInt32(debuffs.HuntersMark, 0, 5), level))
+		applyExternal(HuntersMarkAura(target, GetTristateValueInt32(debuffs.HuntersMark, 0, 5), level))
 	}
 
 	// Atk spd reduction
 	if debuffs.ThunderClap != proto.TristateEffect_TristateEffectMissing {
-		MakePermanent(ThunderClapAura(target, GetTristateValueInt32(debuffs.ThunderClap, 0, 3), level))
+		applyExternal(ThunderClapAura(target, GetTristateValueInt32(debuffs.ThunderClap, 0, 3), level))
 	}
 
 	// Miss
 	if debuffs.InsectSwarm && targetIdx == 0 {
-		MakePermanent(InsectSwarmAura(target))
+		applyExternal(InsectSwarmAura(target))
 	}
 	if debuffs.ScorpidSting && targetIdx == 0 {
-		MakePermanent(ScorpidStingAura(target))
+		applyExternal(ScorpidStingAura(target))
 	}
 }
 
@@ -499,20 +518,28 @@ func bleedDamageAura(target *Unit, config Aura, multiplier float64) *Aura {
 
 const SpellFirePowerEffectCategory = "spellFirePowerdebuff"
 
-func ImprovedScorchAura(target *Unit) *Aura {
+func ImprovedScorchAura(target *Unit, startingStacks int32) *Aura {
+	var effect *ExclusiveEffect
 	aura := target.GetOrRegisterAura(Aura{
-		Label:    "Improved Scorch",
-		ActionID: ActionID{SpellID: 12873},
-		Duration: time.Second * 30,
+		Label:     "Improved Scorch",
+		ActionID:  ActionID{SpellID: 12873},
+		Duration:  time.Second * 30,
+		MaxStacks: 5,
+		OnGain: func(aura *Aura, sim *Simulation) {
+			aura.SetStacks(sim, startingStacks)
+		},
+		OnStacksChange: func(aura *Aura, sim *Simulation, oldStacks int32, newStacks int32) {
+			effect.SetPriority(sim, 0.03*float64(newStacks))
+		},
 	})
 
-	aura.NewExclusiveEffect(SpellFirePowerEffectCategory, true, ExclusiveEffect{
-		Priority: 0.15,
+	effect = aura.NewExclusiveEffect(SpellFirePowerEffectCategory, true, ExclusiveEffect{
+		Priority: 0,
 		OnGain: func(ee *ExclusiveEffect, sim *Simulation) {
-			ee.Aura.Unit.PseudoStats.SchoolDamageTakenMultiplier[stats.SchoolIndexFire] *= 1.15
+			ee.Aura.Unit.PseudoStats.SchoolDamageTakenMultiplier[stats.SchoolIndexFire] *= 1 + ee.Priority
 		},
 		OnExpire: func(ee *ExclusiveEffect, sim *Simulation) {
-			ee.Aura.Unit.PseudoStats.SchoolDamageTakenMultiplier[stats.SchoolIndexFire] /= 1.15
+			ee.Aura.Unit.PseudoStats.SchoolDamageTakenMultiplier[stats.SchoolIndexFire] /= 1 + ee.Priority
 		},
 	})
 
@@ -0,0 +1,180 @@
+package core
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/wowsims/sod/sim/core/proto"
+	"github.com/wowsims/sod/sim/core/stats"
+)
+
+func setupDebuffsSim(debuffs *proto.Debuffs) *Simulation {
+	return NewSim(debuffsSimRequest(debuffs))
+}
+
+func debuffsSimRequest(debuffs *proto.Debuffs) *proto.RaidSimRequest {
+	return &proto.RaidSimRequest{
+		SimOptions: &proto.SimOptions{
+			RandomSeed: 100,
+		},
+		Raid: &proto.Raid{
+			Parties: []*proto.Party{
+				{
+					Players: []*proto.Player{
+						{
+							Name:      "Caster",
+							Class:     proto.Class_ClassShaman,
+							Level:     60,
+							Consumes:  &proto.Consumes{},
+							Buffs:     &proto.IndividualBuffs{},
+							Spec:      &proto.Player_ElementalShaman{},
+							Equipment: &proto.EquipmentSpec{},
+						},
+					},
+					Buffs: &proto.PartyBuffs{},
+				},
+			},
+			Debuffs: debuffs,
+		},
+		Encounter: &proto.Encounter{
+			Targets: []*proto.Target{
+				{Name: "target", Level: 63, MobType: proto.MobType_MobTypeDemon},
+			},
+			Duration: 30,
+		},
+	}
+}
+
+// Runs an iteration, returning the stacks of each aura at the given times.
+func debuffStacksOverTime(sim *Simulation, labels []string, times []time.Duration) map[string][]int32 {
+	target := sim.Encounter.TargetUnits[0]
+	stacks := make(map[string][]int32, len(labels))
+
+	sim.reset()
+	sim.PrePull()
+	for _, t := range times {
+		StartDelayedAction(sim, DelayedActionOptions{
+			DoAt:     t,
+			Priority: ActionPriorityLow, // After the debuffs were applied at the same time.
+			OnAction: func(sim *Simulation) {
+				for _, label := range labels {
+					aura := target.GetAura(label)
+					if aura.IsActive() {
+						stacks[label] = append(stacks[label], aura.GetStacks())
+					} else {
+						stacks[label] = append(stacks[label], 0)
+					}
+				}
+			},
+		})
+	}
+	sim.runPendingActions()
+	sim.Cleanup()
+	return stacks
+}
+
+func expectStacks(t *testing.T, label string, actual []int32, expected []int32) {
+	t.Helper()
+	for i := range expected {
+		if i >= len(actual) || actual[i] != expected[i] {
+			t.Fatalf("%s has stacks %v over time, expected %v", label, actual, expected)
+		}
+	}
+}
+
+func TestDebuffsRampUp(t *testing.T) {
+	sim := setupDebuffsSim(&proto.Debuffs{
+		SunderArmor:    true,
+		WintersChill:   true,
+		ImprovedScorch: true,
+		RampUp:         true,
+	})
+
+	times := []time.Duration{0, time.Millisecond * 1500, time.Millisecond * 2500, time.Millisecond * 4500, time.Second * 5, time.Millisecond * 7500, time.Millisecond * 12500, time.Second * 20}
+	stacks := debuffStacksOverTime(sim, []string{"Sunder Armor", "Winter's Chill", "Improved Scorch"}, times)
+
+	// Sunder Armor and Improved Scorch gain a stack every 1.5s, Winter's Chill every 2.5s.
+	expectStacks(t, "Sunder Armor", stacks["Sunder Armor"], []int32{0, 1, 1, 3, 3, 5, 5, 5})
+	expectStacks(t, "Improved Scorch", stacks["Improved Scorch"], []int32{0, 1, 1, 3, 3, 5, 5, 5})
+	expectStacks(t, "Winter's Chill", stacks["Winter's Chill"], []int32{0, 0, 1, 1, 2, 3, 5, 5})
+
+	// The effects have to reset between iterations, so a second run sees the same ramp.
+	stacks = debuffStacksOverTime(sim, []string{"Sunder Armor"}, times)
+	expectStacks(t, "Sunder Armor", stacks["Sunder Armor"], []int32{0, 1, 1, 3, 3, 5, 5, 5})
+}
+
+func TestDebuffsRampUpHuntersMark(t *testing.T) {
+	sim := setupDebuffsSim(&proto.Debuffs{
+		HuntersMark: proto.TristateEffect_TristateEffectRegular,
+		RampUp:      true,
+	})
+	target := sim.Encounter.TargetUnits[0]
+
+	var active []bool
+	sim.reset()
+	sim.PrePull()
+	for _, t := range []time.Duration{0, time.Millisecond * 1500, time.Second * 20} {
+		StartDelayedAction(sim, DelayedActionOptions{
+			DoAt:     t,
+			Priority: ActionPriorityLow,
+			OnAction: func(sim *Simulation) {
+				active = append(active, target.GetAura("HuntersMark-110").IsActive())
+			},
+		})
+	}
+	sim.runPendingActions()
+	sim.Cleanup()
+
+	// Applied by the hunter after the first GCD, then kept up.
+	if expected := []bool{false, true, true}; !slices.Equal(active, expected) {
+		t.Fatalf("Hunter's Mark active over time %v, expected %v", active, expected)
+	}
+}
+
+func TestDebuffsRampUpMajorArmorExclusive(t *testing.T) {
+	armorAt20s := func(debuffs *proto.Debuffs) float64 {
+		sim := setupDebuffsSim(debuffs)
+		target := sim.Encounter.TargetUnits[0]
+		armor := 0.0
+		sim.reset()
+		sim.PrePull()
+		StartDelayedAction(sim, DelayedActionOptions{
+			DoAt:     time.Second * 20,
+			Priority: ActionPriorityLow,
+			OnAction: func(sim *Simulation) {
+				armor = target.GetStat(stats.Armor)
+			},
+		})
+		sim.runPendingActions()
+		sim.Cleanup()
+		return armor
+	}
+
+	sunder := armorAt20s(&proto.Debuffs{SunderArmor: true, RampUp: true})
+	exposeArmor := armorAt20s(&proto.Debuffs{ExposeArmor: proto.TristateEffect_TristateEffectImproved, RampUp: true})
+	both := armorAt20s(&proto.Debuffs{SunderArmor: true, ExposeArmor: proto.TristateEffect_TristateEffectImproved, RampUp: true})
+
+	// Only the strongest major armor reduction applies.
+	if both != min(sunder, exposeArmor) {
+		t.Fatalf("Armor with Sunder Armor and Expose Armor is %.0f, expected the lower of %.0f and %.0f", both, sunder, exposeArmor)
+	}
+}
+
+func TestDebuffsWithoutRampUp(t *testing.T) {
+	sim := setupDebuffsSim(&proto.Debuffs{
+		WintersChill:   true,
+		ImprovedScorch: true,
+	})
+
+	times := []time.Duration{0, time.Second * 20}
+	stacks := debuffStacksOverTime(sim, []string{"Winter's Chill", "Improved Scorch"}, times)
+	expectStacks(t, "Winter's Chill", stacks["Winter's Chill"], []int32{5, 5})
+	expectStacks(t, "Improved Scorch", stacks["Improved Scorch"], []int32{5, 5})
+
+	target := sim.Encounter.TargetUnits[0]
+	sim.reset()
+	if multiplier := target.PseudoStats.SchoolDamageTakenMultiplier[stats.SchoolIndexFire]; !WithinToleranceFloat64(1.15, multiplier, 1e-9) {
+		t.Fatalf("Improved Scorch at 5 stacks gives a fire damage taken multiplier of %.4f, expected 1.15", multiplier)
+	}
+}
@@ -129,6 +129,52 @@ func SetupFakeSim() *Simulation {
 	return sim
 }
 
+// A fake Elemental Shaman whose rotation keeps the fake dot up on the target, for tests that run
+// whole sims.
+func fakeCasterRaidSimRequest() *proto.RaidSimRequest {
+	fakeDot := ActionID{SpellID: 42}.ToProto()
+	return &proto.RaidSimRequest{
+		SimOptions: &proto.SimOptions{
+			Iterations: 200,
+			RandomSeed: 101,
+		},
+		Raid: &proto.Raid{
+			Parties: []*proto.Party{
+				{
+					Players: []*proto.Player{
+						{
+							Name:      "Caster",
+							Class:     proto.Class_ClassShaman,
+							Level:     60,
+							Consumes:  &proto.Consumes{},
+							Buffs:     &proto.IndividualBuffs{},
+							Spec:      &proto.Player_ElementalShaman{},
+							Equipment: &proto.EquipmentSpec{},
+							Rotation: &proto.APLRotation{
+								Type: proto.APLRotation_TypeAPL,
+								PriorityList: []*proto.APLListItem{
+									{Action: &proto.APLAction{
+										Condition: &proto.APLValue{Value: &proto.APLValue_Not{Not: &proto.APLValueNot{Val: &proto.APLValue{Value: &proto.APLValue_DotIsActive{DotIsActive: &proto.APLValueDotIsActive{SpellId: fakeDot}}}}}},
+										Action:    &proto.APLAction_CastSpell{CastSpell: &proto.APLActionCastSpell{SpellId: fakeDot}},
+									}},
+								},
+							},
+						},
+					},
+					Buffs: &proto.PartyBuffs{},
+				},
+			},
+		},
+		Encounter: &proto.Encounter{
+			Targets: []*proto.Target{
+				{Name: "target", Level: 63, MobType: proto.MobType_MobTypeDemon},
+			},
+			Duration:          60,
+			DurationVariation: 5,
+		},
+	}
+}
+
 func expectDotTickDamage(t *testing.T, sim *Simulation, dot *Dot, expectedDamage float64) {
 	damageBefore := dot.Spell.SpellMetrics[0].TotalDamage
 	dot.TickOnce(sim)
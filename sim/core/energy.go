@@ -37,6 +37,7 @@ type energyBar struct {
 
 	regenMetrics        *ResourceMetrics
 	EnergyRefundMetrics *ResourceMetrics
+	capMetrics          *ResourceCapMetrics
 }
 
 func (unit *Unit) EnableEnergyBar(maxEnergy float64) {
@@ -48,6 +49,7 @@ func (unit *Unit) EnableEnergyBar(maxEnergy float64) {
 		EnergyTickMultiplier: 1,
 		regenMetrics:         unit.NewEnergyMetrics(ActionID{OtherID: proto.OtherAction_OtherActionEnergyRegen}),
 		EnergyRefundMetrics:  unit.NewEnergyMetrics(ActionID{OtherID: proto.OtherAction_OtherActionRefund}),
+		capMetrics:           unit.Metrics.NewResourceCapMetrics(proto.ResourceType_ResourceTypeEnergy),
 	}
 }
 
@@ -70,6 +72,11 @@ func (eb *energyBar) setupEnergyThresholds() {
 	// Energy thresholds from conditional comparisons.
 	for _, action := range eb.unit.Rotation.allAPLActions() {
 		for _, value := range action.GetAllAPLValues() {
+			// Projected energy changes on every tick, so every energy gain needs a new decision.
+			if isEnergyProjection(value) {
+				return
+			}
+
 			if cmpValue, ok := value.(*APLValueCompare); ok {
 				_, lhsIsEnergy := cmpValue.lhs.(*APLValueCurrentEnergy)
 				_, rhsIsEnergy := cmpValue.rhs.(*APLValueCurrentEnergy)
@@ -130,6 +137,19 @@ func (eb *energyBar) NextEnergyTickAt() time.Duration {
 	return eb.nextEnergyTick
 }
 
+// Projects the amount of energy after the given delay, assuming no energy is spent or gained
+// other than from regular energy ticks.
+func (eb *energyBar) EnergyAt(sim *Simulation, delay time.Duration) float64 {
+	ticks := numTicksUntil(eb.nextEnergyTick, EnergyTickDuration, sim.CurrentTime+delay)
+	return min(eb.currentEnergy+float64(ticks)*EnergyPerTick*eb.EnergyTickMultiplier, eb.maxEnergy)
+}
+
+// Returns how long it takes until energy ticks bring the unit to the desired amount of energy,
+// or NeverExpires if that amount can not be reached from regen.
+func (eb *energyBar) TimeToEnergy(sim *Simulation, desiredEnergy float64) time.Duration {
+	return timeToTickedResource(sim, eb.currentEnergy, eb.maxEnergy, desiredEnergy, EnergyPerTick*eb.EnergyTickMultiplier, eb.nextEnergyTick, EnergyTickDuration)
+}
+
 func (eb *energyBar) onEnergyGain(sim *Simulation, crossedThreshold bool) {
 	if sim.CurrentTime < 0 {
 		return
@@ -151,6 +171,11 @@ func (eb *energyBar) addEnergyInternal(sim *Simulation, amount float64, metrics
 	if sim.Log != nil {
 		eb.unit.Log(sim, "Gained %0.3f energy from %s (%0.3f --> %0.3f).", amount, metrics.ActionID, eb.currentEnergy, newEnergy)
 	}
+	if sim.CombatLog != nil {
+		sim.CombatLog.resourceChanged(sim, eb.unit, proto.ResourceType_ResourceTypeEnergy, metrics, eb.currentEnergy, newEnergy)
+	}
+
+	eb.capMetrics.resourceChanged(sim, eb.currentEnergy, newEnergy, eb.maxEnergy)
 
 	crossedThreshold := eb.cumulativeEnergyDecisionThresholds == nil || eb.cumulativeEnergyDecisionThresholds[int(eb.currentEnergy)] != eb.cumulativeEnergyDecisionThresholds[int(newEnergy)]
 	eb.currentEnergy = newEnergy
@@ -173,6 +198,10 @@ func (eb *energyBar) SpendEnergy(sim *Simulation, amount float64, metrics *Resou
 	if sim.Log != nil {
 		eb.unit.Log(sim, "Spent %0.3f energy from %s (%0.3f --> %0.3f).", amount, metrics.ActionID, eb.currentEnergy, newEnergy)
 	}
+	if sim.CombatLog != nil {
+		sim.CombatLog.resourceChanged(sim, eb.unit, proto.ResourceType_ResourceTypeEnergy, metrics, eb.currentEnergy, newEnergy)
+	}
+	eb.capMetrics.resourceChanged(sim, eb.currentEnergy, newEnergy, eb.maxEnergy)
 
 	eb.currentEnergy = newEnergy
 }
@@ -200,6 +229,9 @@ func (eb *energyBar) AddComboPoints(sim *Simulation, pointsToAdd int32, metrics
 	if sim.Log != nil {
 		eb.unit.Log(sim, "Gained %d combo points from %s (%d --> %d)", pointsToAdd, metrics.ActionID, eb.comboPoints, newComboPoints)
 	}
+	if sim.CombatLog != nil {
+		sim.CombatLog.resourceChanged(sim, eb.unit, proto.ResourceType_ResourceTypeComboPoints, metrics, float64(eb.comboPoints), float64(newComboPoints))
+	}
 
 	eb.comboPoints = newComboPoints
 }
@@ -208,6 +240,9 @@ func (eb *energyBar) SpendComboPoints(sim *Simulation, metrics *ResourceMetrics)
 	if sim.Log != nil {
 		eb.unit.Log(sim, "Spent %d combo points from %s (%d --> %d).", eb.comboPoints, metrics.ActionID, eb.comboPoints, 0)
 	}
+	if sim.CombatLog != nil {
+		sim.CombatLog.resourceChanged(sim, eb.unit, proto.ResourceType_ResourceTypeComboPoints, metrics, float64(eb.comboPoints), 0)
+	}
 	metrics.AddEvent(float64(-eb.comboPoints), float64(-eb.comboPoints))
 	eb.comboPoints = 0
 }
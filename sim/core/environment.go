@@ -44,11 +44,27 @@ type Environment struct {
 	postFinalizeEffects []PostFinalizeEffect
 
 	prepullActions []PrepullAction
+
+	exclusions simExclusions
+}
+
+// Parts of the raid that are left out of a sim, to measure what they are worth. These aren't
+// part of the request, see buffAttribution.
+type simExclusions struct {
+	// Raid indices of players whose buffs aren't added to the raid and party buffs.
+	buffProviders []int32
+	// Labels of enemy auras that are still applied, but have no effect.
+	debuffs []string
 }
 
 func NewEnvironment(raidProto *proto.Raid, encounterProto *proto.Encounter, runFakePrepull bool) (*Environment, *proto.RaidStats, *proto.EncounterStats) {
+	return newEnvironment(raidProto, encounterProto, runFakePrepull, simExclusions{})
+}
+
+func newEnvironment(raidProto *proto.Raid, encounterProto *proto.Encounter, runFakePrepull bool, exclusions simExclusions) (*Environment, *proto.RaidStats, *proto.EncounterStats) {
 	env := &Environment{
-		State: Created,
+		State:      Created,
+		exclusions: exclusions,
 	}
 
 	env.construct(raidProto, encounterProto)
@@ -70,7 +86,7 @@ func (env *Environment) construct(raidProto *proto.Raid, encounterProto *proto.E
 	env.Encounter = NewEncounter(encounterProto)
 	env.BaseDuration = env.Encounter.Duration
 	env.DurationVariation = env.Encounter.DurationVariation
-	env.Raid = NewRaid(raidProto)
+	env.Raid = newRaid(raidProto, env.exclusions.buffProviders)
 
 	env.Raid.updatePlayersAndPets()
 
@@ -182,6 +198,8 @@ func (env *Environment) finalize(raidProto *proto.Raid, _ *proto.Encounter, raid
 	}
 	env.postFinalizeEffects = nil
 
+	env.disableExcludedDebuffs()
+
 	slices.SortStableFunc(env.prepullActions, func(a1, a2 PrepullAction) int {
 		return int(a1.DoAt - a2.DoAt)
 	})
@@ -401,3 +419,15 @@ func (env *Environment) PrepullStartTime() time.Duration {
 		return env.prepullActions[0].DoAt
 	}
 }
+
+// Takes the effects off the excluded debuffs, once everything has been attached to them. They are
+// still applied and tracked, so rotations checking them make the same choices.
+func (env *Environment) disableExcludedDebuffs() {
+	for _, target := range env.Encounter.TargetUnits {
+		for _, aura := range target.auras {
+			if slices.Contains(env.exclusions.debuffs, aura.Label) {
+				aura.disableEffects()
+			}
+		}
+	}
+}
@@ -28,6 +28,7 @@ type focusBar struct {
 
 	regenMetrics  *ResourceMetrics
 	refundMetrics *ResourceMetrics
+	capMetrics    *ResourceCapMetrics
 }
 
 func (unit *Unit) EnableFocusBar(regenMultiplier float64, onFocusGain OnFocusGain) {
@@ -37,6 +38,7 @@ func (unit *Unit) EnableFocusBar(regenMultiplier float64, onFocusGain OnFocusGai
 		onFocusGain:   onFocusGain,
 		regenMetrics:  unit.NewEnergyMetrics(ActionID{OtherID: proto.OtherAction_OtherActionFocusRegen}),
 		refundMetrics: unit.NewEnergyMetrics(ActionID{OtherID: proto.OtherAction_OtherActionRefund}),
+		capMetrics:    unit.Metrics.NewResourceCapMetrics(proto.ResourceType_ResourceTypeFocus),
 	}
 }
 
@@ -48,6 +50,19 @@ func (fb *focusBar) CurrentFocus() float64 {
 	return fb.currentFocus
 }
 
+// Projects the amount of focus after the given delay, assuming no focus is spent or gained
+// other than from regular focus ticks.
+func (fb *focusBar) FocusAt(sim *Simulation, delay time.Duration) float64 {
+	ticks := numTicksUntil(fb.nextFocusTick, tickDuration, sim.CurrentTime+delay)
+	return min(fb.currentFocus+float64(ticks)*fb.focusPerTick, MaxFocus)
+}
+
+// Returns how long it takes until focus ticks bring the unit to the desired amount of focus,
+// or NeverExpires if that amount can not be reached from regen.
+func (fb *focusBar) TimeToFocus(sim *Simulation, desiredFocus float64) time.Duration {
+	return timeToTickedResource(sim, fb.currentFocus, MaxFocus, desiredFocus, fb.focusPerTick, fb.nextFocusTick, tickDuration)
+}
+
 func (fb *focusBar) AddFocus(sim *Simulation, amount float64, metrics *ResourceMetrics) {
 	if amount < 0 {
 		panic("Trying to add negative focus!")
@@ -59,6 +74,10 @@ func (fb *focusBar) AddFocus(sim *Simulation, amount float64, metrics *ResourceM
 	if sim.Log != nil {
 		fb.unit.Log(sim, "Gained %0.3f focus from %s (%0.3f --> %0.3f).", amount, metrics.ActionID, fb.currentFocus, newFocus)
 	}
+	if sim.CombatLog != nil {
+		sim.CombatLog.resourceChanged(sim, fb.unit, proto.ResourceType_ResourceTypeFocus, metrics, fb.currentFocus, newFocus)
+	}
+	fb.capMetrics.resourceChanged(sim, fb.currentFocus, newFocus, MaxFocus)
 
 	fb.currentFocus = newFocus
 
@@ -78,6 +97,10 @@ func (fb *focusBar) SpendFocus(sim *Simulation, amount float64, metrics *Resourc
 	if sim.Log != nil {
 		fb.unit.Log(sim, "Spent %0.3f focus from %s (%0.3f --> %0.3f).", amount, metrics.ActionID, fb.currentFocus, newFocus)
 	}
+	if sim.CombatLog != nil {
+		sim.CombatLog.resourceChanged(sim, fb.unit, proto.ResourceType_ResourceTypeFocus, metrics, fb.currentFocus, newFocus)
+	}
+	fb.capMetrics.resourceChanged(sim, fb.currentFocus, newFocus, MaxFocus)
 
 	fb.currentFocus = newFocus
 }
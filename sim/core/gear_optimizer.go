@@ -0,0 +1,838 @@
+package core
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"runtime/debug"
+	"slices"
+	"strings"
+
+	googleProto "google.golang.org/protobuf/proto"
+
+	"github.com/wowsims/sod/sim/core/proto"
+	"github.com/wowsims/sod/sim/core/stats"
+)
+
+const (
+	defaultGearOptimizerCandidatesPerSlot = 4
+	defaultGearOptimizerSetsToSim         = 20
+	defaultGearOptimizerNumResults        = 5
+	defaultGearOptimizerMinIterations     = 200
+	defaultGearOptimizerMaxIterations     = 3200
+)
+
+func GearOptimizer(ctx context.Context, request *proto.GearOptimizerRequest, progress chan *proto.ProgressMetrics) *proto.GearOptimizerResult {
+	optimizer := &gearOptimizer{
+		SingleRaidSimRunner: runSim,
+		Request:             request,
+	}
+
+	result, err := optimizer.Run(ctx, progress)
+	if err != nil {
+		result = &proto.GearOptimizerResult{
+			ErrorResult: err.Error(),
+		}
+	}
+
+	if progress != nil {
+		progress <- &proto.ProgressMetrics{
+			FinalGearOptimizerResult: result,
+		}
+		close(progress)
+	}
+
+	return result
+}
+
+// gearOptimizer searches the item database for the best complete equipment sets of a player.
+// Items passing the filters are ranked by EP in each slot, the best combinations of the top
+// items are built along with combinations that complete set bonuses, and those sets are then
+// compared with a simRace.
+type gearOptimizer struct {
+	// SingleRaidSimRunner used to run each batch of iterations.
+	SingleRaidSimRunner raidSimRunner
+	// Request used for this optimization.
+	Request *proto.GearOptimizerRequest
+
+	settings    *proto.GearOptimizerSettings
+	filters     *proto.GearOptimizerFilters
+	baseRequest *proto.RaidSimRequest
+	partyIdx    int
+	playerIdx   int
+	player      *proto.Player
+	equipment   *proto.EquipmentSpec
+	weights     UnitStats
+	dualWield   bool
+}
+
+// gearCandidate is an item that may be equipped in a slot, with its EP in that slot.
+type gearCandidate struct {
+	item     Item
+	spec     *proto.ItemSpec
+	suffixes []int32 // Random suffixes to pick from, if any.
+	unique   bool
+	ep       float64
+}
+
+// gearOption is one choice of items for a gearSlotGroup, e.g. a pair of rings.
+type gearOption struct {
+	items []*gearCandidate // Indexed like the slots of the group, nil for an empty slot.
+	ep    float64
+}
+
+// gearSlotGroup is a set of slots whose items depend on each other, so they are picked together.
+type gearSlotGroup struct {
+	slots   []proto.ItemSlot
+	options []*gearOption // Sorted by EP, best first.
+}
+
+type gearSet struct {
+	equipment *proto.EquipmentSpec
+	ep        float64
+	race      *raceCandidate
+}
+
+func (gear *gearOptimizer) Run(pctx context.Context, progress chan *proto.ProgressMetrics) (result *proto.GearOptimizerResult, resultErr error) {
+	ctx, cancel := context.WithCancel(pctx)
+	defer func() {
+		if err := recover(); err != nil {
+			result = &proto.GearOptimizerResult{
+				ErrorResult: fmt.Sprintf("%v\nStack Trace:\n%s", err, string(debug.Stack())),
+			}
+		}
+		cancel()
+	}()
+
+	if err := gear.setup(); err != nil {
+		return nil, fmt.Errorf("gear optimizer: %w", err)
+	}
+
+	numResults := int(gear.settings.NumResults)
+	if numResults <= 0 {
+		numResults = defaultGearOptimizerNumResults
+	}
+	setsToSim := int(gear.settings.SetsToSim)
+	if setsToSim <= 0 {
+		setsToSim = defaultGearOptimizerSetsToSim
+	}
+	minIterations := int(gear.settings.MinIterations)
+	if minIterations <= 0 {
+		minIterations = defaultGearOptimizerMinIterations
+	}
+	maxIterations := int(gear.settings.MaxIterations)
+	if maxIterations <= 0 {
+		maxIterations = defaultGearOptimizerMaxIterations
+	}
+	maxIterations = max(maxIterations, minIterations)
+
+	candidates := gear.collectCandidates()
+	if gear.settings.EpWeights != nil {
+		gear.weights = unitStatsFromProto(gear.settings.EpWeights)
+	} else {
+		gear.weights = gear.computeWeights(candidates, progress)
+	}
+	for _, slotCandidates := range candidates {
+		for _, candidate := range slotCandidates {
+			gear.pickRandomSuffix(candidate)
+			candidate.ep = gear.itemEP(candidate)
+		}
+	}
+	groups := gear.slotGroups(gear.pruneCandidates(candidates))
+
+	base := &gearSet{equipment: gear.equipment}
+	sets := []*gearSet{base}
+	seen := map[string]bool{gearSetKey(base.equipment): true}
+	addSet := func(choice []int) {
+		equipment, ep := gear.equipmentFor(groups, choice)
+		// Slot groups only hold valid combinations of weapons, rings and trinkets.
+		if key := gearSetKey(equipment); !seen[key] {
+			seen[key] = true
+			sets = append(sets, &gearSet{equipment: equipment, ep: ep})
+		}
+	}
+	for _, choice := range bestGearCombinations(groups, setsToSim) {
+		addSet(choice)
+	}
+	for _, choice := range setBonusCombinations(groups) {
+		addSet(choice)
+	}
+	base.ep = gear.equipmentEP(base.equipment)
+
+	race := newSimRace(gear.SingleRaidSimRunner, gear.baseRequest, gear.partyIdx, gear.playerIdx, progress)
+	race.expect(len(sets)*2+numResults+1, len(sets)*minIterations*2+(numResults+1)*maxIterations)
+	for _, set := range sets {
+		request := googleProto.Clone(gear.baseRequest).(*proto.RaidSimRequest)
+		request.Raid.Parties[gear.partyIdx].Players[gear.playerIdx].Equipment = set.equipment
+		set.race = &raceCandidate{Request: request}
+	}
+	if err := race.run(ctx, MapSlice(sets, func(s *gearSet) *raceCandidate { return s.race }), minIterations, maxIterations, numResults); err != nil {
+		return nil, err
+	}
+
+	// Final paired comparison of the best survivors and the equipped gear, on fresh seeds.
+	survivors := FilterSlice(sets, func(s *gearSet) bool { return !s.race.Eliminated && s != base })
+	slices.SortStableFunc(survivors, func(a, b *gearSet) int {
+		return cmp.Compare(b.race.Mean(), a.race.Mean())
+	})
+	finalists := append([]*gearSet{base}, survivors[:min(len(survivors), numResults)]...)
+	confirmed, err := race.confirm(ctx, MapSlice(finalists, func(s *gearSet) *raceCandidate { return s.race }), maxIterations)
+	if err != nil {
+		return nil, err
+	}
+	for i, set := range finalists {
+		set.race = confirmed[i]
+	}
+	slices.SortStableFunc(finalists, func(a, b *gearSet) int {
+		return cmp.Compare(b.race.Mean(), a.race.Mean())
+	})
+
+	result = &proto.GearOptimizerResult{
+		Equipped:   gear.setToProto(base, base),
+		SetsSimmed: int32(len(sets)),
+		Iterations: int32(maxIterations),
+	}
+	for _, set := range finalists[:min(len(finalists), numResults)] {
+		result.Sets = append(result.Sets, gear.setToProto(set, base))
+	}
+	return result, nil
+}
+
+// Validates the request and finds the player to optimize.
+func (gear *gearOptimizer) setup() error {
+	gear.settings = gear.Request.GetSettings()
+	if gear.settings == nil {
+		gear.settings = &proto.GearOptimizerSettings{}
+	}
+	gear.filters = gear.settings.GetFilters()
+	if gear.filters == nil {
+		gear.filters = &proto.GearOptimizerFilters{}
+	}
+	if gear.Request.GetBaseSettings().GetRaid() == nil {
+		return fmt.Errorf("missing base settings")
+	}
+	gear.baseRequest = googleProto.Clone(gear.Request.BaseSettings).(*proto.RaidSimRequest)
+	if gear.baseRequest.SimOptions == nil {
+		gear.baseRequest.SimOptions = &proto.SimOptions{}
+	}
+
+	partyIdx, playerIdx, err := findRaidPlayer(gear.baseRequest.Raid, gear.settings.Player)
+	if err != nil {
+		return err
+	}
+	gear.partyIdx, gear.playerIdx = partyIdx, playerIdx
+	gear.player = gear.baseRequest.Raid.Parties[partyIdx].Players[playerIdx]
+	for _, party := range gear.baseRequest.Raid.Parties {
+		for _, player := range party.GetPlayers() {
+			if player.GetDatabase() != nil {
+				addToDatabase(player.GetDatabase())
+			}
+		}
+	}
+
+	gear.equipment = googleProto.Clone(gear.player.GetEquipment()).(*proto.EquipmentSpec)
+	if gear.equipment == nil {
+		gear.equipment = &proto.EquipmentSpec{}
+	}
+	for len(gear.equipment.Items) < len(proto.ItemSlot_name) {
+		gear.equipment.Items = append(gear.equipment.Items, &proto.ItemSpec{})
+	}
+
+	offHand, ok := ItemsByID[gear.equipment.Items[proto.ItemSlot_ItemSlotOffHand].Id]
+	gear.dualWield = gear.settings.DualWield || (ok && isOffHandWeapon(offHand))
+	gear.setDefaultFilters()
+	return nil
+}
+
+func isOffHandWeapon(item Item) bool {
+	return item.Type == proto.ItemType_ItemTypeWeapon && item.WeaponType != proto.WeaponType_WeaponTypeShield && item.WeaponType != proto.WeaponType_WeaponTypeOffHand
+}
+
+// Without explicit armor and weapon types, only allow types the player already uses.
+func (gear *gearOptimizer) setDefaultFilters() {
+	filters := googleProto.Clone(gear.filters).(*proto.GearOptimizerFilters)
+	var heaviestArmor proto.ArmorType
+	var weaponTypes []proto.WeaponType
+	var rangedTypes []proto.RangedWeaponType
+	for slot, spec := range gear.equipment.Items {
+		item, ok := ItemsByID[spec.Id]
+		if !ok {
+			continue
+		}
+		switch {
+		case isArmorSlot(proto.ItemSlot(slot)):
+			heaviestArmor = max(heaviestArmor, item.ArmorType)
+		case slot == int(proto.ItemSlot_ItemSlotMainHand) || slot == int(proto.ItemSlot_ItemSlotOffHand):
+			weaponTypes = append(weaponTypes, item.WeaponType)
+		case slot == int(proto.ItemSlot_ItemSlotRanged):
+			rangedTypes = append(rangedTypes, item.RangedWeaponType)
+		}
+	}
+
+	if len(filters.ArmorTypes) == 0 && heaviestArmor != proto.ArmorType_ArmorTypeUnknown {
+		for armorType := proto.ArmorType_ArmorTypeCloth; armorType <= heaviestArmor; armorType++ {
+			filters.ArmorTypes = append(filters.ArmorTypes, armorType)
+		}
+	}
+	if len(filters.WeaponTypes) == 0 {
+		filters.WeaponTypes = weaponTypes
+	}
+	if len(filters.RangedWeaponTypes) == 0 {
+		filters.RangedWeaponTypes = rangedTypes
+	}
+	gear.filters = filters
+}
+
+// See Player.ARMOR_SLOTS in player.ts.
+func isArmorSlot(slot proto.ItemSlot) bool {
+	switch slot {
+	case proto.ItemSlot_ItemSlotHead, proto.ItemSlot_ItemSlotShoulder, proto.ItemSlot_ItemSlotChest, proto.ItemSlot_ItemSlotWrist,
+		proto.ItemSlot_ItemSlotHands, proto.ItemSlot_ItemSlotLegs, proto.ItemSlot_ItemSlotWaist, proto.ItemSlot_ItemSlotFeet:
+		return true
+	}
+	return false
+}
+
+func raceFaction(race proto.Race) proto.Faction {
+	switch race {
+	case proto.Race_RaceDwarf, proto.Race_RaceGnome, proto.Race_RaceHuman, proto.Race_RaceNightElf:
+		return proto.Faction_Alliance
+	case proto.Race_RaceOrc, proto.Race_RaceTauren, proto.Race_RaceTroll, proto.Race_RaceUndead:
+		return proto.Faction_Horde
+	}
+	return proto.Faction_Unknown
+}
+
+// Whether the player may use the item, based on the item data of the full database.
+func (gear *gearOptimizer) allowsItem(uiItem *proto.UIItem) bool {
+	filters := gear.filters
+	if filters.Phase > 0 && uiItem.Phase > filters.Phase {
+		return false
+	}
+	if uiItem.Quality < filters.MinQuality {
+		return false
+	}
+	if uiItem.RequiresLevel > gear.player.Level {
+		return false
+	}
+	if len(uiItem.ClassAllowlist) > 0 && !slices.Contains(uiItem.ClassAllowlist, gear.player.Class) {
+		return false
+	}
+	if uiItem.RequiredProfession != proto.Profession_ProfessionUnknown && uiItem.RequiredProfession != gear.player.Profession1 && uiItem.RequiredProfession != gear.player.Profession2 {
+		return false
+	}
+	switch raceFaction(gear.player.Race) {
+	case proto.Faction_Alliance:
+		if uiItem.FactionRestriction == proto.UIItem_FACTION_RESTRICTION_HORDE_ONLY {
+			return false
+		}
+	case proto.Faction_Horde:
+		if uiItem.FactionRestriction == proto.UIItem_FACTION_RESTRICTION_ALLIANCE_ONLY {
+			return false
+		}
+	}
+	return gear.allowsSources(uiItem)
+}
+
+// Mirrors the source filters of filterItemData in player.ts, along with raid and zone filters.
+func (gear *gearOptimizer) allowsSources(uiItem *proto.UIItem) bool {
+	filters := gear.filters
+	allowsSource := func(option proto.SourceFilterOption) bool {
+		return len(filters.Sources) == 0 || slices.Contains(filters.Sources, int32(option))
+	}
+
+	var zoneIDs []int32
+	for _, source := range uiItem.Sources {
+		switch source := source.Source.(type) {
+		case *proto.UIItemSource_Crafted:
+			if !allowsSource(proto.SourceFilterOption_SourceCrafting) {
+				return false
+			}
+		case *proto.UIItemSource_Quest:
+			if !allowsSource(proto.SourceFilterOption_SourceQuest) {
+				return false
+			}
+		case *proto.UIItemSource_Drop:
+			zoneID := source.Drop.ZoneId
+			if _, ok := proto.DungeonFilterOption_name[zoneID]; ok && zoneID != 0 && !allowsSource(proto.SourceFilterOption_SourceDungeon) {
+				return false
+			}
+			if _, ok := proto.RaidFilterOption_name[zoneID]; ok && zoneID != 0 {
+				if !allowsSource(proto.SourceFilterOption_SourceRaid) || (len(filters.Raids) > 0 && !slices.Contains(filters.Raids, zoneID)) {
+					return false
+				}
+			}
+			zoneIDs = append(zoneIDs, zoneID)
+		case *proto.UIItemSource_SoldBy:
+			zoneIDs = append(zoneIDs, source.SoldBy.ZoneId)
+		}
+	}
+	if len(uiItem.RandomSuffixOptions) > 0 && !allowsSource(proto.SourceFilterOption_SourceWorldBOE) {
+		return false
+	}
+	if len(filters.ZoneIds) > 0 && len(zoneIDs) > 0 && !slices.ContainsFunc(zoneIDs, func(zoneID int32) bool { return slices.Contains(filters.ZoneIds, zoneID) }) {
+		return false
+	}
+	return true
+}
+
+// Whether the item fits the armor and weapon types allowed in the slot.
+func (gear *gearOptimizer) allowsItemInSlot(item Item, slot proto.ItemSlot) bool {
+	filters := gear.filters
+	switch {
+	case isArmorSlot(slot):
+		return len(filters.ArmorTypes) == 0 || slices.Contains(filters.ArmorTypes, item.ArmorType)
+	case slot == proto.ItemSlot_ItemSlotMainHand || slot == proto.ItemSlot_ItemSlotOffHand:
+		if slot == proto.ItemSlot_ItemSlotOffHand && !gear.dualWield && isOffHandWeapon(item) {
+			return false
+		}
+		return len(filters.WeaponTypes) == 0 || slices.Contains(filters.WeaponTypes, item.WeaponType)
+	case slot == proto.ItemSlot_ItemSlotRanged:
+		return len(filters.RangedWeaponTypes) == 0 || slices.Contains(filters.RangedWeaponTypes, item.RangedWeaponType)
+	}
+	return true
+}
+
+// Collects the items the player may equip in each slot. The equipped items are always included.
+func (gear *gearOptimizer) collectCandidates() [][]*gearCandidate {
+	candidates := make([][]*gearCandidate, len(proto.ItemSlot_name))
+	for slot, spec := range gear.equipment.Items {
+		if item, ok := ItemsByID[spec.Id]; ok {
+			candidates[slot] = append(candidates[slot], &gearCandidate{
+				item:   item,
+				spec:   &proto.ItemSpec{Id: spec.Id, RandomSuffix: spec.RandomSuffix},
+				unique: uiItemsByID[spec.Id].GetUnique(),
+			})
+		}
+	}
+
+	for _, id := range sortedKeys(ItemsByID) {
+		item := ItemsByID[id]
+		if slices.Contains(gear.filters.ExcludedItems, id) {
+			continue
+		}
+		uiItem := uiItemsByID[id]
+		if uiItem != nil && !gear.allowsItem(uiItem) {
+			continue
+		}
+
+		// The suffix is picked once the weights are known, see pickRandomSuffix.
+		suffixes := FilterSlice(uiItem.GetRandomSuffixOptions(), func(suffixID int32) bool {
+			_, ok := RandomSuffixesByID[suffixID]
+			return ok
+		})
+		spec := &proto.ItemSpec{Id: id}
+		if len(uiItem.GetRandomSuffixOptions()) > 0 {
+			if len(suffixes) == 0 {
+				continue
+			}
+			spec.RandomSuffix = suffixes[0]
+		}
+		for _, slot := range eligibleSlotsForItem(item) {
+			if !gear.allowsItemInSlot(item, slot) || slices.ContainsFunc(candidates[slot], func(c *gearCandidate) bool { return c.spec.Id == id }) {
+				continue
+			}
+			candidates[slot] = append(candidates[slot], &gearCandidate{
+				item:     item,
+				spec:     spec,
+				suffixes: suffixes,
+				unique:   uiItem.GetUnique(),
+			})
+		}
+	}
+	return candidates
+}
+
+// Picks the random suffix of the candidate with the highest EP.
+func (gear *gearOptimizer) pickRandomSuffix(candidate *gearCandidate) {
+	bestEP := math.Inf(-1)
+	for _, suffixID := range candidate.suffixes {
+		spec := &proto.ItemSpec{Id: candidate.spec.Id, RandomSuffix: suffixID}
+		if ep := gear.itemEP(&gearCandidate{item: candidate.item, spec: spec}); ep > bestEP {
+			bestEP = ep
+			candidate.spec.RandomSuffix = suffixID
+		}
+	}
+}
+
+func unitStatsFromProto(unitStats *proto.UnitStats) UnitStats {
+	result := NewUnitStats()
+	result.Stats = stats.FromFloatArray(unitStats.Stats)
+	copy(result.PseudoStats, unitStats.PseudoStats)
+	return result
+}
+
+// Computes DPS stat weights for the stats of the candidate items.
+func (gear *gearOptimizer) computeWeights(candidates [][]*gearCandidate, progress chan *proto.ProgressMetrics) UnitStats {
+	var statsToWeigh []proto.Stat
+	var pseudoStatsToWeigh []proto.PseudoStat
+	for slot, slotCandidates := range candidates {
+		for _, candidate := range slotCandidates {
+			for stat, value := range gear.candidateStats(candidate) {
+				if value != 0 && !slices.Contains(statsToWeigh, proto.Stat(stat)) {
+					statsToWeigh = append(statsToWeigh, proto.Stat(stat))
+				}
+			}
+			if pseudoStat, ok := weaponDpsPseudoStat(proto.ItemSlot(slot)); ok && candidate.item.SwingSpeed > 0 && !slices.Contains(pseudoStatsToWeigh, pseudoStat) {
+				pseudoStatsToWeigh = append(pseudoStatsToWeigh, pseudoStat)
+			}
+		}
+	}
+	return dpsStatWeights(gear.baseRequest, gear.partyIdx, gear.player, statsToWeigh, pseudoStatsToWeigh, progress)
+}
+
+// Computes DPS stat weights of the player for the given stats, in the raid of the request.
+func dpsStatWeights(request *proto.RaidSimRequest, partyIdx int, player *proto.Player, statsToWeigh []proto.Stat, pseudoStatsToWeigh []proto.PseudoStat, progress chan *proto.ProgressMetrics) UnitStats {
+	if len(statsToWeigh) == 0 {
+		return NewUnitStats()
+	}
+	slices.Sort(statsToWeigh)
+
+	result := CalcStatWeight(&proto.StatWeightsRequest{
+		Player:             googleProto.Clone(player).(*proto.Player),
+		RaidBuffs:          request.Raid.Buffs,
+		PartyBuffs:         request.Raid.Parties[partyIdx].Buffs,
+		Debuffs:            request.Raid.Debuffs,
+		Encounter:          request.Encounter,
+		SimOptions:         googleProto.Clone(request.SimOptions).(*proto.SimOptions),
+		Tanks:              request.Raid.Tanks,
+		StatsToWeigh:       statsToWeigh,
+		PseudoStatsToWeigh: pseudoStatsToWeigh,
+		EpReferenceStat:    statsToWeigh[0],
+	}, stats.Stat(statsToWeigh[0]), progress)
+	return result.Dps.Weights
+}
+
+func weaponDpsPseudoStat(slot proto.ItemSlot) (proto.PseudoStat, bool) {
+	switch slot {
+	case proto.ItemSlot_ItemSlotMainHand:
+		return proto.PseudoStat_PseudoStatMainHandDps, true
+	case proto.ItemSlot_ItemSlotOffHand:
+		return proto.PseudoStat_PseudoStatOffHandDps, true
+	case proto.ItemSlot_ItemSlotRanged:
+		return proto.PseudoStat_PseudoStatRangedDps, true
+	}
+	return 0, false
+}
+
+func (gear *gearOptimizer) candidateStats(candidate *gearCandidate) stats.Stats {
+	itemStats := candidate.item.Stats
+	if suffix, ok := RandomSuffixesByID[candidate.spec.RandomSuffix]; ok {
+		itemStats = itemStats.Add(suffix.Stats)
+	}
+	return itemStats
+}
+
+// EP of an item, including the DPS of weapons like computeItemEP in player.ts.
+func (gear *gearOptimizer) itemEP(candidate *gearCandidate) float64 {
+	ep := 0.0
+	for stat, value := range gear.candidateStats(candidate) {
+		ep += value * gear.weights.Stats[stat]
+	}
+	for _, slot := range eligibleSlotsForItem(candidate.item) {
+		if candidate.item.SwingSpeed > 0 {
+			if pseudoStat, ok := weaponDpsPseudoStat(slot); ok {
+				weaponDps := (candidate.item.WeaponDamageMin + candidate.item.WeaponDamageMax) / 2 / candidate.item.SwingSpeed
+				ep += weaponDps * gear.weights.PseudoStats[pseudoStat]
+				break
+			}
+		}
+	}
+	return ep
+}
+
+func (gear *gearOptimizer) slotEP(candidate *gearCandidate, slot proto.ItemSlot) float64 {
+	ep := candidate.ep
+	if candidate.item.SwingSpeed > 0 && slot == proto.ItemSlot_ItemSlotOffHand {
+		// Weapon DPS was counted with the main hand weight.
+		weaponDps := (candidate.item.WeaponDamageMin + candidate.item.WeaponDamageMax) / 2 / candidate.item.SwingSpeed
+		ep += weaponDps * (gear.weights.PseudoStats[proto.PseudoStat_PseudoStatOffHandDps] - gear.weights.PseudoStats[proto.PseudoStat_PseudoStatMainHandDps])
+	}
+	return ep
+}
+
+// Keeps the best items of each slot by EP, along with the best piece of each item set so set
+// bonuses can still be completed.
+func (gear *gearOptimizer) pruneCandidates(candidates [][]*gearCandidate) [][]*gearCandidate {
+	perSlot := int(gear.settings.CandidatesPerSlot)
+	if perSlot <= 0 {
+		perSlot = defaultGearOptimizerCandidatesPerSlot
+	}
+
+	pruned := make([][]*gearCandidate, len(candidates))
+	for slot, slotCandidates := range candidates {
+		slotCandidates = slices.Clone(slotCandidates)
+		slices.SortStableFunc(slotCandidates, func(a, b *gearCandidate) int {
+			return cmp.Compare(gear.slotEP(b, proto.ItemSlot(slot)), gear.slotEP(a, proto.ItemSlot(slot)))
+		})
+
+		setPieces := map[string]bool{}
+		for i, candidate := range slotCandidates {
+			setName := candidate.item.SetName
+			isEquipped := candidate.spec.Id == gear.equipment.Items[slot].Id
+			if i < perSlot || isEquipped || (setName != "" && !setPieces[setName]) {
+				pruned[slot] = append(pruned[slot], candidate)
+			}
+			if setName != "" {
+				setPieces[setName] = true
+			}
+		}
+	}
+	return pruned
+}
+
+// Builds the slot groups and their options from the candidates of each slot.
+func (gear *gearOptimizer) slotGroups(candidates [][]*gearCandidate) []*gearSlotGroup {
+	var groups []*gearSlotGroup
+	addGroup := func(slots []proto.ItemSlot, options []*gearOption) {
+		if len(options) == 0 {
+			options = append(options, &gearOption{items: make([]*gearCandidate, len(slots))})
+		}
+		slices.SortStableFunc(options, func(a, b *gearOption) int {
+			return cmp.Compare(b.ep, a.ep)
+		})
+		groups = append(groups, &gearSlotGroup{slots: slots, options: options})
+	}
+
+	for _, slot := range []proto.ItemSlot{
+		proto.ItemSlot_ItemSlotHead, proto.ItemSlot_ItemSlotNeck, proto.ItemSlot_ItemSlotShoulder, proto.ItemSlot_ItemSlotBack,
+		proto.ItemSlot_ItemSlotChest, proto.ItemSlot_ItemSlotWrist, proto.ItemSlot_ItemSlotHands, proto.ItemSlot_ItemSlotWaist,
+		proto.ItemSlot_ItemSlotLegs, proto.ItemSlot_ItemSlotFeet, proto.ItemSlot_ItemSlotRanged,
+	} {
+		addGroup([]proto.ItemSlot{slot}, MapSlice(candidates[slot], func(c *gearCandidate) *gearOption {
+			return &gearOption{items: []*gearCandidate{c}, ep: c.ep}
+		}))
+	}
+
+	// Rings and trinkets are picked in pairs, which may only hold the same item twice if it
+	// isn't unique. Both slots are seeded with their own equipped item, so the pairs are built
+	// from the candidates of both.
+	for _, slots := range [][]proto.ItemSlot{
+		{proto.ItemSlot_ItemSlotFinger1, proto.ItemSlot_ItemSlotFinger2},
+		{proto.ItemSlot_ItemSlotTrinket1, proto.ItemSlot_ItemSlotTrinket2},
+	} {
+		slotCandidates := slices.Clone(candidates[slots[0]])
+		for _, candidate := range candidates[slots[1]] {
+			if !slices.ContainsFunc(slotCandidates, func(c *gearCandidate) bool {
+				return c.spec.Id == candidate.spec.Id && c.spec.RandomSuffix == candidate.spec.RandomSuffix
+			}) {
+				slotCandidates = append(slotCandidates, candidate)
+			}
+		}
+		var options []*gearOption
+		for i, a := range slotCandidates {
+			for _, b := range slotCandidates[i:] {
+				if a.item.ID == b.item.ID && a.unique {
+					continue
+				}
+				options = append(options, &gearOption{items: []*gearCandidate{a, b}, ep: a.ep + b.ep})
+			}
+		}
+		if len(options) == 0 && len(slotCandidates) > 0 {
+			options = append(options, &gearOption{items: []*gearCandidate{slotCandidates[0], nil}, ep: slotCandidates[0].ep})
+		}
+		addGroup(slots, options)
+	}
+
+	// Either a two-hander, or a main hand with an off hand.
+	var weaponOptions []*gearOption
+	for _, mainHand := range candidates[proto.ItemSlot_ItemSlotMainHand] {
+		if mainHand.item.HandType == proto.HandType_HandTypeTwoHand {
+			weaponOptions = append(weaponOptions, &gearOption{items: []*gearCandidate{mainHand, nil}, ep: mainHand.ep})
+			continue
+		}
+		for _, offHand := range append(slices.Clone(candidates[proto.ItemSlot_ItemSlotOffHand]), nil) {
+			if offHand != nil && offHand.item.ID == mainHand.item.ID && offHand.unique {
+				continue
+			}
+			ep := mainHand.ep
+			if offHand != nil {
+				ep += gear.slotEP(offHand, proto.ItemSlot_ItemSlotOffHand)
+			}
+			weaponOptions = append(weaponOptions, &gearOption{items: []*gearCandidate{mainHand, offHand}, ep: ep})
+		}
+	}
+	addGroup([]proto.ItemSlot{proto.ItemSlot_ItemSlotMainHand, proto.ItemSlot_ItemSlotOffHand}, weaponOptions)
+	return groups
+}
+
+// Returns up to n choices of one option per group with the highest total EP, best first.
+// Each choice holds the index of the option picked in each group.
+func bestGearCombinations(groups []*gearSlotGroup, n int) [][]int {
+	return bestCombinations(MapSlice(groups, func(group *gearSlotGroup) []float64 {
+		return MapSlice(group.options, func(option *gearOption) float64 { return option.ep })
+	}), n)
+}
+
+// Returns up to n choices of one score per group with the highest total score, best first.
+// Scores of each group must be sorted from best to worst.
+func bestCombinations(scores [][]float64, n int) [][]int {
+	type state struct {
+		choice []int
+		score  float64
+		// Only groups from this one on are advanced, so every choice is generated only once.
+		firstGroup int
+	}
+	choiceScore := func(choice []int) float64 {
+		score := 0.0
+		for g, idx := range choice {
+			score += scores[g][idx]
+		}
+		return score
+	}
+
+	start := make([]int, len(scores))
+	frontier := []state{{choice: start, score: choiceScore(start)}}
+	var results [][]int
+	for len(results) < n && len(frontier) > 0 {
+		best := 0
+		for i := range frontier {
+			if frontier[i].score > frontier[best].score {
+				best = i
+			}
+		}
+		current := frontier[best]
+		frontier = slices.Delete(frontier, best, best+1)
+		results = append(results, current.choice)
+
+		for g := current.firstGroup; g < len(scores); g++ {
+			if current.choice[g]+1 < len(scores[g]) {
+				next := slices.Clone(current.choice)
+				next[g]++
+				frontier = append(frontier, state{choice: next, score: choiceScore(next), firstGroup: g})
+			}
+		}
+	}
+	return results
+}
+
+// Returns, for each bonus of each item set with pieces among the options, the best choice that
+// completes that bonus.
+func setBonusCombinations(groups []*gearSlotGroup) [][]int {
+	var results [][]int
+	for _, set := range sets {
+		isPiece := func(c *gearCandidate) bool {
+			return c != nil && c.item.SetName != "" && (c.item.SetName == set.Name || c.item.SetName == set.AlternativeName)
+		}
+
+		// The cheapest option with set pieces in each group, by EP lost compared to the best option.
+		type groupPick struct {
+			group  int
+			option int
+			pieces int
+			loss   float64
+		}
+		var picks []groupPick
+		for g, group := range groups {
+			for idx, option := range group.options {
+				pieces := len(FilterSlice(option.items, isPiece))
+				if pieces > 0 {
+					picks = append(picks, groupPick{group: g, option: idx, pieces: pieces, loss: group.options[0].ep - option.ep})
+					break
+				}
+			}
+		}
+		if len(picks) == 0 {
+			continue
+		}
+		slices.SortStableFunc(picks, func(a, b groupPick) int {
+			return cmp.Compare(a.loss/float64(a.pieces), b.loss/float64(b.pieces))
+		})
+
+		for _, numPieces := range sortedKeys(set.Bonuses) {
+			choice := make([]int, len(groups))
+			pieces := 0
+			for _, pick := range picks {
+				if pieces >= int(numPieces) {
+					break
+				}
+				choice[pick.group] = pick.option
+				pieces += pick.pieces
+			}
+			if pieces >= int(numPieces) {
+				results = append(results, choice)
+			}
+		}
+	}
+	return results
+}
+
+// Builds the equipment for a choice of options, keeping the runes and enchants of the
+// equipped gear where they still fit.
+func (gear *gearOptimizer) equipmentFor(groups []*gearSlotGroup, choice []int) (*proto.EquipmentSpec, float64) {
+	equipment := &proto.EquipmentSpec{Items: make([]*proto.ItemSpec, len(gear.equipment.Items))}
+	ep := 0.0
+	for g, idx := range choice {
+		option := groups[g].options[idx]
+		ep += option.ep
+		for i, slot := range groups[g].slots {
+			spec := &proto.ItemSpec{}
+			if candidate := option.items[i]; candidate != nil {
+				spec = googleProto.Clone(candidate.spec).(*proto.ItemSpec)
+				if equipped, ok := ItemsByID[gear.equipment.Items[slot].Id]; ok && equipped.HandType == candidate.item.HandType && equipped.Type == candidate.item.Type {
+					spec.Enchant = gear.equipment.Items[slot].Enchant
+				}
+			}
+			spec.Rune = gear.equipment.Items[slot].Rune
+			equipment.Items[slot] = spec
+		}
+	}
+	return equipment, ep
+}
+
+func (gear *gearOptimizer) equipmentEP(equipment *proto.EquipmentSpec) float64 {
+	ep := 0.0
+	for slot, spec := range equipment.Items {
+		if item, ok := ItemsByID[spec.Id]; ok {
+			candidate := &gearCandidate{item: item, spec: spec}
+			candidate.ep = gear.itemEP(candidate)
+			ep += gear.slotEP(candidate, proto.ItemSlot(slot))
+		}
+	}
+	return ep
+}
+
+func gearSetKey(equipment *proto.EquipmentSpec) string {
+	return strings.Join(MapSlice(equipment.Items, func(spec *proto.ItemSpec) string {
+		return fmt.Sprintf("%d:%d", spec.Id, spec.RandomSuffix)
+	}), ",")
+}
+
+// Returns the active set bonuses of the equipment, as "<set name> (<pieces>)".
+func activeSetBonusNames(equipment *proto.EquipmentSpec) []string {
+	setItemCount := make(map[*ItemSet]int32)
+	var names []string
+	for _, spec := range equipment.Items {
+		item, ok := ItemsByID[spec.Id]
+		if !ok || item.SetName == "" {
+			continue
+		}
+		for _, set := range sets {
+			if set.Name == item.SetName || set.AlternativeName == item.SetName {
+				setItemCount[set]++
+				if _, ok := set.Bonuses[setItemCount[set]]; ok {
+					names = append(names, fmt.Sprintf("%s (%d)", set.Name, setItemCount[set]))
+				}
+				break
+			}
+		}
+	}
+	return names
+}
+
+func (gear *gearOptimizer) setToProto(set *gearSet, base *gearSet) *proto.GearOptimizerSet {
+	delta, halfWidth := 0.0, 0.0
+	if set != base {
+		delta, halfWidth = compareRaceCandidates(set.race, base.race)
+	}
+	return &proto.GearOptimizerSet{
+		Equipment:      set.equipment,
+		Ep:             set.ep,
+		Dps:            set.race.Mean(),
+		DpsDelta:       delta,
+		DpsDeltaCiLow:  delta - halfWidth,
+		DpsDeltaCiHigh: delta + halfWidth,
+		SetBonuses:     activeSetBonusNames(set.equipment),
+	}
+}
@@ -0,0 +1,146 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/wowsims/sod/sim/core/proto"
+	"github.com/wowsims/sod/sim/core/stats"
+)
+
+// Replaces the item database with the items of db for the rest of the test.
+func useTestDatabase(t *testing.T, db *proto.SimDatabase, uiItems ...*proto.UIItem) {
+	items, uiItemsBefore, runes := ItemsByID, uiItemsByID, RunesByID
+	ItemsByID, uiItemsByID, RunesByID = map[int32]Item{}, map[int32]*proto.UIItem{}, map[int32]Rune{}
+	t.Cleanup(func() {
+		ItemsByID, uiItemsByID, RunesByID = items, uiItemsBefore, runes
+	})
+
+	addToDatabase(db)
+	for _, uiItem := range uiItems {
+		uiItemsByID[uiItem.Id] = uiItem
+	}
+}
+
+// A fake runner whose raid DPS is the spell power of the equipped items, the same in every
+// iteration.
+func fakeSpellPowerSimRunner(rsr *proto.RaidSimRequest, _ chan *proto.ProgressMetrics, _ bool) *proto.RaidSimResult {
+	spellPower := 0.0
+	for _, spec := range rsr.Raid.Parties[0].Players[0].Equipment.Items {
+		spellPower += ItemsByID[spec.Id].Stats[stats.SpellPower]
+	}
+	return fakeBulkSimResult(rsr, spellPower)
+}
+
+func newSpellPowerItem(id int32, itemType proto.ItemType, spellPower float64) *proto.SimItem {
+	return &proto.SimItem{Id: id, Type: itemType, Stats: stats.Stats{stats.SpellPower: spellPower}.ToFloatArray()}
+}
+
+func TestBestGearCombinations(t *testing.T) {
+	newGroup := func(eps ...float64) *gearSlotGroup {
+		return &gearSlotGroup{options: MapSlice(eps, func(ep float64) *gearOption { return &gearOption{ep: ep} })}
+	}
+	groups := []*gearSlotGroup{newGroup(10, 8, 1), newGroup(5, 4), newGroup(3)}
+
+	var totals []float64
+	seen := map[string]bool{}
+	for _, choice := range bestGearCombinations(groups, 10) {
+		if key := fmt.Sprint(choice); seen[key] {
+			t.Errorf("Duplicate choice %v", choice)
+		} else {
+			seen[key] = true
+		}
+		total := 0.0
+		for g, idx := range choice {
+			total += groups[g].options[idx].ep
+		}
+		totals = append(totals, total)
+	}
+
+	if expected := []float64{18, 17, 16, 15, 9, 8}; !slices.Equal(totals, expected) {
+		t.Errorf("Unexpected totals %v, expected %v", totals, expected)
+	}
+}
+
+func TestGearRingPairs(t *testing.T) {
+	candidates := make([][]*gearCandidate, len(proto.ItemSlot_name))
+	newRing := func(id int32, unique bool, ep float64) *gearCandidate {
+		return &gearCandidate{item: Item{ID: id}, spec: &proto.ItemSpec{Id: id}, unique: unique, ep: ep}
+	}
+	candidates[proto.ItemSlot_ItemSlotFinger1] = []*gearCandidate{newRing(1, true, 10), newRing(2, false, 8)}
+	// The equipped ring of the second slot, which isn't a candidate of the first one.
+	candidates[proto.ItemSlot_ItemSlotFinger2] = []*gearCandidate{newRing(3, true, 1), newRing(2, false, 8)}
+
+	gear := &gearOptimizer{}
+	for _, group := range gear.slotGroups(candidates) {
+		if group.slots[0] != proto.ItemSlot_ItemSlotFinger1 {
+			continue
+		}
+		pairs := MapSlice(group.options, func(option *gearOption) string {
+			return fmt.Sprintf("%d+%d", option.items[0].item.ID, option.items[1].item.ID)
+		})
+		// The unique rings can't be worn twice, the other one can.
+		if expected := []string{"1+2", "2+2", "1+3", "2+3"}; !slices.Equal(pairs, expected) {
+			t.Errorf("Unexpected ring pairs %v, expected %v", pairs, expected)
+		}
+		return
+	}
+	t.Fatalf("Missing ring group")
+}
+
+func TestGearOptimizer(t *testing.T) {
+	useTestDatabase(t, &proto.SimDatabase{Items: []*proto.SimItem{
+		newSpellPowerItem(1, proto.ItemType_ItemTypeHead, 5),
+		newSpellPowerItem(2, proto.ItemType_ItemTypeHead, 20),
+		newSpellPowerItem(3, proto.ItemType_ItemTypeHead, 15),
+		newSpellPowerItem(11, proto.ItemType_ItemTypeFinger, 30),
+		newSpellPowerItem(12, proto.ItemType_ItemTypeFinger, 25),
+		newSpellPowerItem(13, proto.ItemType_ItemTypeFinger, 10),
+	}}, &proto.UIItem{Id: 11, Unique: true}, &proto.UIItem{Id: 12, Unique: true}, &proto.UIItem{Id: 13, Unique: true})
+
+	rsr := fakeCasterRaidSimRequest()
+	rsr.Raid.Parties[0].Players[0].Equipment = createEquipmentFromItems(
+		&itemWithSlot{Slot: proto.ItemSlot_ItemSlotHead, Item: &proto.ItemSpec{Id: 1}},
+		&itemWithSlot{Slot: proto.ItemSlot_ItemSlotFinger1, Item: &proto.ItemSpec{Id: 11}},
+		&itemWithSlot{Slot: proto.ItemSlot_ItemSlotFinger2, Item: &proto.ItemSpec{Id: 12}},
+	)
+
+	gear := &gearOptimizer{
+		SingleRaidSimRunner: fakeSpellPowerSimRunner,
+		Request: &proto.GearOptimizerRequest{
+			BaseSettings: rsr,
+			Settings: &proto.GearOptimizerSettings{
+				EpWeights:         &proto.UnitStats{Stats: stats.Stats{stats.SpellPower: 1}.ToFloatArray()},
+				CandidatesPerSlot: 3,
+				SetsToSim:         4,
+				NumResults:        2,
+				MinIterations:     50,
+				MaxIterations:     100,
+			},
+		},
+	}
+	result, err := gear.Run(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Gear optimizer failed with error: %v", err)
+	}
+	if result.Equipped.Dps != 60 || len(result.Sets) != 2 || result.SetsSimmed < 4 {
+		t.Fatalf("Expected 2 of at least 4 simmed sets over 60 dps, got %d of %d over %.3f dps", len(result.Sets), result.SetsSimmed, result.Equipped.Dps)
+	}
+
+	// Both heads are upgrades, no ring beats the equipped pair.
+	for i, expectedHead := range []int32{2, 3} {
+		set := result.Sets[i]
+		items := set.Equipment.Items
+		if head := items[proto.ItemSlot_ItemSlotHead].Id; head != expectedHead {
+			t.Errorf("Expected head %d in set %d, got %d", expectedHead, i, head)
+		}
+		if rings := []int32{items[proto.ItemSlot_ItemSlotFinger1].Id, items[proto.ItemSlot_ItemSlotFinger2].Id}; !slices.Contains(rings, 11) || !slices.Contains(rings, 12) {
+			t.Errorf("Expected the equipped rings in set %d, got %v", i, rings)
+		}
+		if expectedDelta := ItemsByID[expectedHead].Stats[stats.SpellPower] - 5; set.DpsDelta != expectedDelta || set.DpsDeltaCiLow != expectedDelta {
+			t.Errorf("Expected a gain of %.3f dps for set %d, got %.3f [%.3f, %.3f]", expectedDelta, i, set.DpsDelta, set.DpsDeltaCiLow, set.DpsDeltaCiHigh)
+		}
+	}
+}
@@ -222,6 +222,10 @@ func (mcdm *majorCooldownManager) finalize() {
 				break
 			}
 		}
+
+		if aura := majorCooldownAura(mcdm.character, mcd); aura != nil {
+			mcdm.character.Metrics.damageBreakdown.trackMajorCooldownAura(aura)
+		}
 	}
 
 	mcdm.majorCooldowns = make([]*MajorCooldown, len(mcdm.initialMajorCooldowns))
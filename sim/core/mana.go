@@ -2,6 +2,7 @@ package core
 
 import (
 	"fmt"
+	"math"
 	"time"
 
 	"github.com/wowsims/sod/sim/core/proto"
@@ -10,6 +11,9 @@ import (
 
 const ThreatPerManaGained = 0.5
 
+// Time between mana ticks.
+const ManaTickDuration = time.Second * 2
+
 type SpiritManaRegenPerSecond func() float64
 
 type manaBar struct {
@@ -24,6 +28,7 @@ type manaBar struct {
 	JowManaMetrics        *ResourceMetrics
 	VtManaMetrics         *ResourceMetrics
 	JowiseManaMetrics     *ResourceMetrics
+	manaCapMetrics        *ResourceCapMetrics
 
 	ReplenishmentAura *Aura
 
@@ -55,6 +60,7 @@ func (character *Character) EnableManaBarWithModifier(modifier float64) {
 
 	character.manaCastingMetrics = character.NewManaMetrics(ActionID{OtherID: proto.OtherAction_OtherActionManaRegen, Tag: 1})
 	character.manaNotCastingMetrics = character.NewManaMetrics(ActionID{OtherID: proto.OtherAction_OtherActionManaRegen, Tag: 2})
+	character.manaCapMetrics = character.Metrics.NewResourceCapMetrics(proto.ResourceType_ResourceTypeMana)
 
 	character.BaseMana = character.GetBaseStats()[stats.Mana]
 	character.Unit.manaBar.unit = &character.Unit
@@ -87,6 +93,10 @@ func (unit *Unit) AddMana(sim *Simulation, amount float64, metrics *ResourceMetr
 	if sim.Log != nil {
 		unit.Log(sim, "Gained %0.3f mana from %s (%0.3f --> %0.3f).", amount, metrics.ActionID, oldMana, newMana)
 	}
+	if sim.CombatLog != nil {
+		sim.CombatLog.resourceChanged(sim, unit, proto.ResourceType_ResourceTypeMana, metrics, oldMana, newMana)
+	}
+	unit.manaCapMetrics.resourceChanged(sim, oldMana, newMana, unit.MaxMana())
 
 	unit.currentMana = newMana
 	unit.Metrics.ManaGained += newMana - oldMana
@@ -103,6 +113,10 @@ func (unit *Unit) SpendMana(sim *Simulation, amount float64, metrics *ResourceMe
 	if sim.Log != nil {
 		unit.Log(sim, "Spent %0.3f mana from %s (%0.3f --> %0.3f).", amount, metrics.ActionID, unit.CurrentMana(), newMana)
 	}
+	if sim.CombatLog != nil {
+		sim.CombatLog.resourceChanged(sim, unit, proto.ResourceType_ResourceTypeMana, metrics, unit.CurrentMana(), newMana)
+	}
+	unit.manaCapMetrics.resourceChanged(sim, unit.CurrentMana(), newMana, unit.MaxMana())
 
 	unit.currentMana = newMana
 	unit.Metrics.ManaSpent += amount
@@ -234,6 +248,55 @@ func (unit *Unit) TimeUntilManaRegen(desiredMana float64) time.Duration {
 	return regenTime
 }
 
+// Number of mana ticks at or after the first tick and before the end of the 5-second rule,
+// i.e. the ticks that only give regen while casting.
+func (unit *Unit) numCastingManaTicks(firstTick time.Duration) int {
+	fsrEnd := unit.PseudoStats.FiveSecondRuleRefreshTime
+	if fsrEnd <= firstTick {
+		return 0
+	}
+	return int((fsrEnd - firstTick + ManaTickDuration - 1) / ManaTickDuration)
+}
+
+// Projects the amount of mana after the given delay, assuming the unit does not spend mana
+// (and so does not refresh the 5-second rule) and only gains mana from regular mana ticks.
+func (unit *Unit) ManaAt(sim *Simulation, delay time.Duration) float64 {
+	ticks := numTicksUntil(sim.nextManaTick, ManaTickDuration, sim.CurrentTime+delay)
+	castingTicks := min(ticks, unit.numCastingManaTicks(sim.nextManaTick))
+
+	regen := float64(castingTicks)*max(0, unit.manaTickWhileCasting) + float64(ticks-castingTicks)*max(0, unit.manaTickWhileNotCasting)
+	return min(unit.CurrentMana()+regen, unit.MaxMana())
+}
+
+// Returns how long it takes until mana ticks bring the unit to the desired amount of mana, or
+// NeverExpires if that amount can not be reached from regen. Like ManaAt, this assumes the unit
+// will not refresh the 5-second rule in the meantime.
+func (unit *Unit) TimeToMana(sim *Simulation, desiredMana float64) time.Duration {
+	if unit.CurrentMana() >= desiredMana {
+		return 0
+	}
+	if desiredMana > unit.MaxMana() || sim.nextManaTick == NeverExpires {
+		return NeverExpires
+	}
+
+	manaNeeded := desiredMana - unit.CurrentMana()
+	castingTicks := unit.numCastingManaTicks(sim.nextManaTick)
+	castingRegen := max(0, unit.manaTickWhileCasting)
+	notCastingRegen := max(0, unit.manaTickWhileNotCasting)
+
+	var ticks int
+	if castingRegen > 0 && manaNeeded <= float64(castingTicks)*castingRegen {
+		ticks = int(math.Ceil(manaNeeded / castingRegen))
+	} else if notCastingRegen > 0 {
+		manaNeeded -= float64(castingTicks) * castingRegen
+		ticks = castingTicks + int(math.Ceil(manaNeeded/notCastingRegen))
+	} else {
+		return NeverExpires
+	}
+
+	return sim.nextManaTick + time.Duration(ticks-1)*ManaTickDuration - sim.CurrentTime
+}
+
 func (sim *Simulation) initManaTickAction() {
 	var unitsWithManaBars []*Unit
 
@@ -252,13 +315,13 @@ func (sim *Simulation) initManaTickAction() {
 		}
 	}
 
+	sim.nextManaTick = NeverExpires
 	if len(unitsWithManaBars) == 0 {
 		return
 	}
 
-	interval := time.Second * 2
 	pa := &PendingAction{
-		NextActionAt: sim.Environment.PrepullStartTime() + interval,
+		NextActionAt: sim.Environment.PrepullStartTime() + ManaTickDuration,
 		Priority:     ActionPriorityRegen,
 	}
 	pa.OnAction = func(sim *Simulation) {
@@ -268,9 +331,11 @@ func (sim *Simulation) initManaTickAction() {
 			}
 		}
 
-		pa.NextActionAt = sim.CurrentTime + interval
+		pa.NextActionAt = sim.CurrentTime + ManaTickDuration
+		sim.nextManaTick = pa.NextActionAt
 		sim.AddPendingAction(pa)
 	}
+	sim.nextManaTick = pa.NextActionAt
 	sim.AddPendingAction(pa)
 }
 
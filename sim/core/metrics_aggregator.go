@@ -2,6 +2,7 @@ package core
 
 import (
 	"math"
+	"slices"
 	"time"
 
 	"github.com/wowsims/sod/sim/core/proto"
@@ -23,6 +24,7 @@ type DistributionMetrics struct {
 	maxSeed int64
 	minSeed int64
 	hist    map[int32]int32 // rounded DPS to count
+	sketch  quantileSketch
 	sample  []float64
 }
 
@@ -33,7 +35,7 @@ func (distMetrics *DistributionMetrics) reset() {
 // This should be called when a Sim iteration is complete.
 func (distMetrics *DistributionMetrics) doneIteration(sim *Simulation) {
 	dps := distMetrics.Total / sim.Duration.Seconds()
-	distMetrics.add(dps)
+	distMetrics.addValue(dps, sim.rand.GetSeed())
 
 	if sim.Options.SaveAllValues {
 		if cap(distMetrics.sample) < int(sim.Options.Iterations) {
@@ -41,22 +43,57 @@ func (distMetrics *DistributionMetrics) doneIteration(sim *Simulation) {
 		}
 		distMetrics.sample = append(distMetrics.sample, dps)
 	}
+}
+
+// Adds the value of one iteration, simmed with the given seed, to the aggregate values.
+func (distMetrics *DistributionMetrics) addValue(value float64, seed int64) {
+	distMetrics.add(value)
+
+	if value > distMetrics.max {
+		distMetrics.max = value
+		distMetrics.maxSeed = seed
+	}
+	if value <= distMetrics.min || distMetrics.min < 0 {
+		distMetrics.min = value
+		distMetrics.minSeed = seed
+	}
+
+	valueRounded := int32(math.Round(value/10) * 10)
+	distMetrics.hist[valueRounded]++
+	distMetrics.sketch.add(value)
+}
+
+// Adds the aggregate values of other, which covers the iterations right after those of distMetrics.
+func (distMetrics *DistributionMetrics) mergeMetrics(other *DistributionMetrics) {
+	if other.n == 0 {
+		return
+	}
+	distMetrics.aggregator = *distMetrics.aggregator.merge(&other.aggregator)
+	distMetrics.sample = append(distMetrics.sample, other.sample...)
 
-	if dps > distMetrics.max {
-		distMetrics.max = dps
-		distMetrics.maxSeed = sim.rand.GetSeed()
+	// Keep the first maximum and the last minimum, same as when the iterations are simmed in order.
+	if other.max > distMetrics.max {
+		distMetrics.max = other.max
+		distMetrics.maxSeed = other.maxSeed
 	}
-	if dps <= distMetrics.min || distMetrics.min < 0 {
-		distMetrics.min = dps
-		distMetrics.minSeed = sim.rand.GetSeed()
+	if other.min <= distMetrics.min || distMetrics.min < 0 {
+		distMetrics.min = other.min
+		distMetrics.minSeed = other.minSeed
 	}
 
-	dpsRounded := int32(math.Round(dps/10) * 10)
-	distMetrics.hist[dpsRounded]++
+	for dpsRounded, count := range other.hist {
+		distMetrics.hist[dpsRounded] += count
+	}
+	distMetrics.sketch.merge(&other.sketch)
 }
 
 func (distMetrics *DistributionMetrics) ToProto() *proto.DistributionMetrics {
 	mean, stdev := distMetrics.meanAndStdDev()
+	stderr := 0.0
+	if distMetrics.n > 1 {
+		stderr = distMetrics.stdErr()
+	}
+	percentiles := distMetrics.sketch.quantiles(0.05, 0.25, 0.5, 0.75, 0.95)
 
 	return &proto.DistributionMetrics{
 		Avg:       mean,
@@ -67,13 +104,24 @@ func (distMetrics *DistributionMetrics) ToProto() *proto.DistributionMetrics {
 		MinSeed:   distMetrics.minSeed,
 		Hist:      distMetrics.hist,
 		AllValues: distMetrics.sample,
+
+		Stderr:   stderr,
+		Ci95Low:  mean - confidenceZ95*stderr,
+		Ci95High: mean + confidenceZ95*stderr,
+
+		P5:  percentiles[0],
+		P25: percentiles[1],
+		P50: percentiles[2],
+		P75: percentiles[3],
+		P95: percentiles[4],
 	}
 }
 
 func NewDistributionMetrics() DistributionMetrics {
 	return DistributionMetrics{
-		hist: make(map[int32]int32),
-		min:  -1,
+		hist:   make(map[int32]int32),
+		sketch: newQuantileSketch(),
+		min:    -1,
 	}
 }
 
@@ -97,6 +145,12 @@ type UnitMetrics struct {
 	oomTimeSum   float64
 	actions      map[ActionID]*ActionMetrics
 	resources    []*ResourceMetrics
+
+	resourceCaps    []*ResourceCapMetrics
+	damageBreakdown damageBreakdown
+
+	// Only set if timeline metrics are enabled in the sim options.
+	timeline *timelineMetrics
 }
 
 // Metrics for the current iteration, for 1 agent. Keep this as a separate
@@ -150,13 +204,72 @@ type SpellMetrics struct {
 	Parries int32
 	Blocks  int32
 
-	// Partial or full resists aren't tracked, at the moment, cp. applyResistances()
-
 	TotalDamage    float64 // Damage done by all casts of this spell.
 	TotalThreat    float64 // Threat generated by all casts of this spell.
 	TotalHealing   float64 // Healing done by all casts of this spell.
 	TotalShielding float64 // Shielding done by all casts of this spell.
 	TotalCastTime  time.Duration
+
+	OutcomeDamage
+}
+
+var partialResistOutcomes = [3]HitOutcome{OutcomePartial1_4, OutcomePartial2_4, OutcomePartial3_4}
+
+// Damage of a spell split up by outcome. Full resists are counted as misses.
+type OutcomeDamage struct {
+	HitDamage    float64
+	CritDamage   float64
+	GlanceDamage float64
+	CrushDamage  float64
+
+	BlockedDamage    float64 // Damage done by blocked attacks, which can also be crits.
+	BlockAmount      float64 // Damage prevented by blocks.
+	GlanceDamageLost float64 // Damage prevented by the glancing blow penalty.
+
+	// Number and damage of partial resists, by 1/4, 2/4 and 3/4 of the damage.
+	PartialResists      [3]int32
+	PartialResistDamage [3]float64
+}
+
+func (od *OutcomeDamage) addDamage(result *SpellResult) {
+	switch {
+	case !result.Landed():
+		return
+	case result.Outcome.Matches(OutcomeGlance):
+		od.GlanceDamage += result.Damage
+	case result.Outcome.Matches(OutcomeCrush):
+		od.CrushDamage += result.Damage
+	case result.Outcome.Matches(OutcomeCrit):
+		od.CritDamage += result.Damage
+	default:
+		od.HitDamage += result.Damage
+	}
+
+	if result.Outcome.Matches(OutcomeBlock) {
+		od.BlockedDamage += result.Damage
+	}
+	od.BlockAmount += result.blockAmount
+	od.GlanceDamageLost += result.glanceDamageLost
+	for i, partial := range partialResistOutcomes {
+		if result.Outcome.Matches(partial) {
+			od.PartialResists[i]++
+			od.PartialResistDamage[i] += result.Damage
+		}
+	}
+}
+
+func (od *OutcomeDamage) mergeMetrics(other *OutcomeDamage) {
+	od.HitDamage += other.HitDamage
+	od.CritDamage += other.CritDamage
+	od.GlanceDamage += other.GlanceDamage
+	od.CrushDamage += other.CrushDamage
+	od.BlockedDamage += other.BlockedDamage
+	od.BlockAmount += other.BlockAmount
+	od.GlanceDamageLost += other.GlanceDamageLost
+	for i := range od.PartialResists {
+		od.PartialResists[i] += other.PartialResists[i]
+		od.PartialResistDamage[i] += other.PartialResistDamage[i]
+	}
 }
 
 type TargetedActionMetrics struct {
@@ -176,6 +289,8 @@ type TargetedActionMetrics struct {
 	Healing   float64
 	Shielding float64
 	CastTime  time.Duration
+
+	OutcomeDamage
 }
 
 func (tam *TargetedActionMetrics) ToProto() *proto.TargetedActionMetrics {
@@ -195,9 +310,36 @@ func (tam *TargetedActionMetrics) ToProto() *proto.TargetedActionMetrics {
 		Healing:    tam.Healing,
 		Shielding:  tam.Shielding,
 		CastTimeMs: float64(tam.CastTime.Milliseconds()),
+
+		HitDamage:           tam.HitDamage,
+		CritDamage:          tam.CritDamage,
+		GlanceDamage:        tam.GlanceDamage,
+		CrushDamage:         tam.CrushDamage,
+		BlockedDamage:       tam.BlockedDamage,
+		BlockAmount:         tam.BlockAmount,
+		GlanceDamageLost:    tam.GlanceDamageLost,
+		PartialResists:      tam.PartialResists[:],
+		PartialResistDamage: tam.PartialResistDamage[:],
 	}
 }
 
+func (tam *TargetedActionMetrics) mergeMetrics(other *TargetedActionMetrics) {
+	tam.Casts += other.Casts
+	tam.Hits += other.Hits
+	tam.Crits += other.Crits
+	tam.Misses += other.Misses
+	tam.Dodges += other.Dodges
+	tam.Parries += other.Parries
+	tam.Blocks += other.Blocks
+	tam.Glances += other.Glances
+	tam.Damage += other.Damage
+	tam.Threat += other.Threat
+	tam.Healing += other.Healing
+	tam.Shielding += other.Shielding
+	tam.CastTime += other.CastTime
+	tam.OutcomeDamage.mergeMetrics(&other.OutcomeDamage)
+}
+
 func NewUnitMetrics() UnitMetrics {
 	return UnitMetrics{
 		dps:     NewDistributionMetrics(),
@@ -208,6 +350,8 @@ func NewUnitMetrics() UnitMetrics {
 		hps:     NewDistributionMetrics(),
 		tto:     NewDistributionMetrics(),
 		actions: make(map[ActionID]*ActionMetrics),
+
+		damageBreakdown: newDamageBreakdown(),
 	}
 }
 
@@ -234,6 +378,12 @@ func (resourceMetrics *ResourceMetrics) ToProto() *proto.ResourceMetrics {
 	}
 }
 
+func (resourceMetrics *ResourceMetrics) mergeMetrics(other *ResourceMetrics) {
+	resourceMetrics.Events += other.Events
+	resourceMetrics.Gain += other.Gain
+	resourceMetrics.ActualGain += other.ActualGain
+}
+
 func (resourceMetrics *ResourceMetrics) reset() {
 	resourceMetrics.EventsFromPreviousIterations = resourceMetrics.Events
 	resourceMetrics.ActualGainFromPreviousIterations = resourceMetrics.ActualGain
@@ -312,6 +462,7 @@ func (unitMetrics *UnitMetrics) addSpellMetrics(spell *Spell, actionID ActionID,
 		tam.Healing += spellTargetMetrics.TotalHealing
 		tam.Shielding += spellTargetMetrics.TotalShielding
 		tam.CastTime += spellTargetMetrics.TotalCastTime
+		tam.OutcomeDamage.mergeMetrics(&spellTargetMetrics.OutcomeDamage)
 
 		target := spell.Unit.AttackTables[i][proto.CastType_CastTypeMainHand].Defender
 		target.Metrics.dtps.Total += spellTargetMetrics.TotalDamage
@@ -319,6 +470,7 @@ func (unitMetrics *UnitMetrics) addSpellMetrics(spell *Spell, actionID ActionID,
 		if spell.Unit.IsOpponent(target) {
 			unitMetrics.dps.Total += spellTargetMetrics.TotalDamage
 			unitMetrics.threat.Total += spellTargetMetrics.TotalThreat
+			unitMetrics.damageBreakdown.addSpellDamage(spell, spellTargetMetrics.TotalDamage)
 		} else {
 			unitMetrics.hps.Total += spellTargetMetrics.TotalHealing + spellTargetMetrics.TotalShielding
 		}
@@ -330,6 +482,9 @@ func (unitMetrics *UnitMetrics) addSpellMetrics(spell *Spell, actionID ActionID,
 // Assumes that doneIteration() has already been called on the pet metrics.
 func (unitMetrics *UnitMetrics) AddFinalPetMetrics(petMetrics *UnitMetrics) {
 	unitMetrics.dps.Total += petMetrics.dps.Total
+	if unitMetrics.timeline != nil && petMetrics.timeline != nil {
+		unitMetrics.timeline.addPetDamage(petMetrics.timeline)
+	}
 }
 
 func (unitMetrics *UnitMetrics) AddOOMTime(sim *Simulation, dur time.Duration) {
@@ -364,6 +519,13 @@ func (unitMetrics *UnitMetrics) reset() {
 	for _, resourceMetrics := range unitMetrics.resources {
 		resourceMetrics.reset()
 	}
+	for _, resourceCapMetrics := range unitMetrics.resourceCaps {
+		resourceCapMetrics.reset()
+	}
+	unitMetrics.damageBreakdown.reset()
+	if unitMetrics.timeline != nil {
+		unitMetrics.timeline.reset()
+	}
 }
 
 // This should be called when a Sim iteration is complete.
@@ -408,6 +570,63 @@ func (unitMetrics *UnitMetrics) doneIteration(unit *Unit, sim *Simulation) {
 	if unitMetrics.Died {
 		unitMetrics.numItersDead++
 	}
+	for _, resourceCapMetrics := range unitMetrics.resourceCaps {
+		resourceCapMetrics.doneIteration(sim)
+	}
+	unitMetrics.damageBreakdown.doneIteration(sim)
+	if unitMetrics.timeline != nil {
+		unitMetrics.timeline.doneIteration(sim)
+	}
+}
+
+// Adds the aggregate values of other, which covers the iterations right after those of unitMetrics.
+func (unitMetrics *UnitMetrics) mergeMetrics(other *UnitMetrics) {
+	unitMetrics.dps.mergeMetrics(&other.dps)
+	unitMetrics.dpasp.mergeMetrics(&other.dpasp)
+	unitMetrics.threat.mergeMetrics(&other.threat)
+	unitMetrics.dtps.mergeMetrics(&other.dtps)
+	unitMetrics.tmi.mergeMetrics(&other.tmi)
+	unitMetrics.hps.mergeMetrics(&other.hps)
+	unitMetrics.tto.mergeMetrics(&other.tto)
+
+	unitMetrics.numItersDead += other.numItersDead
+	unitMetrics.oomTimeSum += other.oomTimeSum
+	// Resource caps are registered in the same order on every copy of a unit.
+	for i, otherResourceCap := range other.resourceCaps {
+		unitMetrics.resourceCaps[i].mergeMetrics(otherResourceCap)
+	}
+	unitMetrics.damageBreakdown.mergeMetrics(&other.damageBreakdown)
+	if unitMetrics.timeline != nil && other.timeline != nil {
+		unitMetrics.timeline.mergeMetrics(other.timeline)
+	}
+
+	for actionID, otherAction := range other.actions {
+		action, ok := unitMetrics.actions[actionID]
+		if !ok || len(action.Targets) == 0 {
+			unitMetrics.actions[actionID] = otherAction
+			continue
+		}
+		for i := range otherAction.Targets {
+			action.Targets[i].mergeMetrics(&otherAction.Targets[i])
+		}
+	}
+
+	// Resource metrics are registered in the same order on every copy of a unit, unless some
+	// are only created while simming.
+	for i, otherResource := range other.resources {
+		if i < len(unitMetrics.resources) && unitMetrics.resources[i].ActionID == otherResource.ActionID && unitMetrics.resources[i].Type == otherResource.Type {
+			unitMetrics.resources[i].mergeMetrics(otherResource)
+			continue
+		}
+		idx := slices.IndexFunc(unitMetrics.resources, func(rm *ResourceMetrics) bool {
+			return rm.ActionID == otherResource.ActionID && rm.Type == otherResource.Type
+		})
+		if idx == -1 {
+			unitMetrics.resources = append(unitMetrics.resources, otherResource)
+		} else {
+			unitMetrics.resources[idx].mergeMetrics(otherResource)
+		}
+	}
 }
 
 func (unitMetrics *UnitMetrics) calculateTMI(unit *Unit, sim *Simulation) float64 {
@@ -494,6 +713,8 @@ func (unitMetrics *UnitMetrics) ToProto() *proto.UnitMetrics {
 		Tto:           unitMetrics.tto.ToProto(),
 		SecondsOomAvg: unitMetrics.oomTimeSum / n,
 		ChanceOfDeath: float64(unitMetrics.numItersDead) / n,
+
+		DamageBreakdown: unitMetrics.damageBreakdown.ToProto(unitMetrics.dps.n),
 	}
 
 	protoMetrics.Actions = make([]*proto.ActionMetrics, 0, len(unitMetrics.actions))
@@ -508,6 +729,14 @@ func (unitMetrics *UnitMetrics) ToProto() *proto.UnitMetrics {
 		}
 	}
 
+	for _, resourceCap := range unitMetrics.resourceCaps {
+		protoMetrics.ResourceCaps = append(protoMetrics.ResourceCaps, resourceCap.ToProto())
+	}
+
+	if unitMetrics.timeline != nil {
+		protoMetrics.Timeline = unitMetrics.timeline.ToProto()
+	}
+
 	return protoMetrics
 }
 
@@ -515,23 +744,38 @@ type AuraMetrics struct {
 	ID ActionID
 
 	// Metrics for the current iteration.
-	Uptime time.Duration
-	Procs  int32
+	Uptime      time.Duration
+	Procs       int32
+	Refreshes   int32 // Activations while the aura was already active.
+	Expirations int32 // Deactivations because the aura ran out, as opposed to being removed early.
 
 	// Aggregate values. These are updated after each iteration.
 	aggregator
-	procsSum int32
+	procsSum       int32
+	refreshesSum   int32
+	expirationsSum int32
 }
 
 func (auraMetrics *AuraMetrics) reset() {
 	auraMetrics.Uptime = 0
 	auraMetrics.Procs = 0
+	auraMetrics.Refreshes = 0
+	auraMetrics.Expirations = 0
 }
 
 // This should be called when a Sim iteration is complete.
 func (auraMetrics *AuraMetrics) doneIteration() {
 	auraMetrics.add(auraMetrics.Uptime.Seconds())
 	auraMetrics.procsSum += auraMetrics.Procs
+	auraMetrics.refreshesSum += auraMetrics.Refreshes
+	auraMetrics.expirationsSum += auraMetrics.Expirations
+}
+
+func (auraMetrics *AuraMetrics) mergeMetrics(other *AuraMetrics) {
+	auraMetrics.aggregator = *auraMetrics.aggregator.merge(&other.aggregator)
+	auraMetrics.procsSum += other.procsSum
+	auraMetrics.refreshesSum += other.refreshesSum
+	auraMetrics.expirationsSum += other.expirationsSum
 }
 
 func (auraMetrics *AuraMetrics) ToProto() *proto.AuraMetrics {
@@ -543,5 +787,7 @@ func (auraMetrics *AuraMetrics) ToProto() *proto.AuraMetrics {
 		UptimeSecondsAvg:   mean,
 		UptimeSecondsStdev: stdev,
 		ProcsAvg:           float64(auraMetrics.procsSum) / float64(auraMetrics.n),
+		RefreshesAvg:       float64(auraMetrics.refreshesSum) / float64(auraMetrics.n),
+		ExpirationsAvg:     float64(auraMetrics.expirationsSum) / float64(auraMetrics.n),
 	}
 }
@@ -31,7 +31,9 @@ type PresimOptions struct {
 	OnPresimResult func(presimResult *proto.UnitMetrics, iterations int32, duration time.Duration) bool
 }
 
-func (sim *Simulation) runPresims(request *proto.RaidSimRequest) *proto.RaidSimResult {
+// runPresim is called to sim each presim round, which allows the results of an earlier run of
+// the presims to be replayed on another copy of the environment.
+func (sim *Simulation) runPresims(request *proto.RaidSimRequest, runPresim func(*proto.RaidSimRequest) *proto.RaidSimResult) *proto.RaidSimResult {
 	const numPresimIterations = 100
 
 	// Run presims if requested.
@@ -69,6 +71,8 @@ func (sim *Simulation) runPresims(request *proto.RaidSimRequest) *proto.RaidSimR
 	presimRequest.SimOptions.RandomSeed = 1
 	presimRequest.SimOptions.Debug = false
 	presimRequest.SimOptions.DebugFirstIteration = false
+	presimRequest.SimOptions.CombatLog = false
+	presimRequest.SimOptions.ReplaySeed = 0
 	presimRequest.SimOptions.Iterations = numPresimIterations
 	duration := DurationFromSeconds(presimRequest.Encounter.Duration)
 
@@ -94,7 +98,7 @@ func (sim *Simulation) runPresims(request *proto.RaidSimRequest) *proto.RaidSimR
 		}
 
 		// Run the presim.
-		presimResult := runSim(presimRequest, nil, true)
+		presimResult := runPresim(presimRequest)
 		lastResult = presimResult
 
 		if presimResult.ErrorResult != "" {
@@ -0,0 +1,113 @@
+package core
+
+import (
+	"cmp"
+	"math"
+	"slices"
+)
+
+// Relative accuracy of quantiles estimated by a quantileSketch.
+const quantileSketchAccuracy = 0.005
+
+var quantileSketchGamma = (1 + quantileSketchAccuracy) / (1 - quantileSketchAccuracy)
+var quantileSketchLogGamma = math.Log(quantileSketchGamma)
+
+// quantileSketch estimates quantiles of a stream of values without storing them, using
+// logarithmically sized buckets (see DDSketch). Every estimate is within quantileSketchAccuracy
+// of the true value, relative to that value. Merging sketches just adds up bucket counts, so
+// the result doesn't depend on the order values were added in.
+type quantileSketch struct {
+	n         int
+	zeros     int
+	positives map[int32]int
+	negatives map[int32]int // Bucketed by absolute value.
+}
+
+func newQuantileSketch() quantileSketch {
+	return quantileSketch{
+		positives: make(map[int32]int),
+		negatives: make(map[int32]int),
+	}
+}
+
+func quantileSketchIndex(v float64) int32 {
+	return int32(math.Ceil(math.Log(v) / quantileSketchLogGamma))
+}
+
+// Representative value of a bucket, which has the same relative error to all values in it.
+func quantileSketchValue(index int32) float64 {
+	return 2 * math.Pow(quantileSketchGamma, float64(index)) / (quantileSketchGamma + 1)
+}
+
+func (qs *quantileSketch) add(v float64) {
+	qs.n++
+	switch {
+	case v > 0:
+		qs.positives[quantileSketchIndex(v)]++
+	case v < 0:
+		qs.negatives[quantileSketchIndex(-v)]++
+	default:
+		qs.zeros++
+	}
+}
+
+func (qs *quantileSketch) merge(other *quantileSketch) {
+	qs.n += other.n
+	qs.zeros += other.zeros
+	for index, count := range other.positives {
+		qs.positives[index] += count
+	}
+	for index, count := range other.negatives {
+		qs.negatives[index] += count
+	}
+}
+
+// Returns estimates for the quantiles at each of the fractions, which have to be in increasing
+// order.
+func (qs *quantileSketch) quantiles(fractions ...float64) []float64 {
+	results := make([]float64, len(fractions))
+	if qs.n == 0 {
+		return results
+	}
+
+	negativeIndices := sortedKeys(qs.negatives)
+	slices.Reverse(negativeIndices)
+	positiveIndices := sortedKeys(qs.positives)
+
+	// Walk the buckets from the lowest to the highest value.
+	type bucket struct {
+		value float64
+		count int
+	}
+	buckets := make([]bucket, 0, len(negativeIndices)+len(positiveIndices)+1)
+	for _, index := range negativeIndices {
+		buckets = append(buckets, bucket{-quantileSketchValue(index), qs.negatives[index]})
+	}
+	if qs.zeros > 0 {
+		buckets = append(buckets, bucket{0, qs.zeros})
+	}
+	for _, index := range positiveIndices {
+		buckets = append(buckets, bucket{quantileSketchValue(index), qs.positives[index]})
+	}
+
+	bucketIdx := 0
+	cumulative := buckets[0].count
+	for i, q := range fractions {
+		rank := q * float64(qs.n-1)
+		for float64(cumulative) <= rank && bucketIdx < len(buckets)-1 {
+			bucketIdx++
+			cumulative += buckets[bucketIdx].count
+		}
+		results[i] = buckets[bucketIdx].value
+	}
+	return results
+}
+
+func sortedKeys[K cmp.Ordered, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
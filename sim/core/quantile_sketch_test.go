@@ -0,0 +1,28 @@
+package core
+
+import (
+	"math"
+	"testing"
+)
+
+func TestQuantileSketch(t *testing.T) {
+	first := newQuantileSketch()
+	second := newQuantileSketch()
+	for i := 1; i <= 1000; i++ {
+		if i%2 == 0 {
+			first.add(float64(i))
+		} else {
+			second.add(float64(i))
+		}
+	}
+	second.add(0)
+	first.merge(&second)
+
+	fractions := []float64{0, 0.05, 0.5, 0.95, 1}
+	expected := []float64{0, 50, 500, 950, 1000}
+	for i, got := range first.quantiles(fractions...) {
+		if math.Abs(got-expected[i]) > expected[i]*quantileSketchAccuracy+1 {
+			t.Errorf("Quantile %.2f = %.3f, expected %.3f", fractions[i], got, expected[i])
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package core
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	googleProto "google.golang.org/protobuf/proto"
+
+	"github.com/wowsims/sod/sim/core/proto"
+)
+
+// raceCandidate is one variant of a raid sim request being compared in a simRace.
+type raceCandidate struct {
+	Request *proto.RaidSimRequest
+	// If set, sims this candidate instead of the runner of the race, for variants that can't be
+	// expressed in the request.
+	runner raidSimRunner
+
+	// Per-iteration values of the raced metric, for every iteration simmed so far.
+	Values []float64
+	// Per-iteration values of the reported metric, if the race has one.
+	ReportedValues []float64
+	// Result of the most recently simmed batch of iterations.
+	LastResult *proto.RaidSimResult
+
+	Eliminated bool
+}
+
+func (c *raceCandidate) Mean() float64 {
+	return c.meanOver(len(c.Values))
+}
+
+// Mean of the first n values, so candidates with different amounts of iterations can be ranked.
+func (c *raceCandidate) meanOver(n int) float64 {
+	n = min(n, len(c.Values))
+	if n == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range c.Values[:n] {
+		sum += v
+	}
+	return sum / float64(n)
+}
+
+// Compares two candidates using their paired per-iteration differences over the iterations
+// both have simmed. Returns the mean of a - b along with the half-width of its 95% confidence
+// interval.
+func compareRaceCandidates(a, b *raceCandidate) (float64, float64) {
+	var diff aggregator
+	for i := 0; i < min(len(a.Values), len(b.Values)); i++ {
+		diff.add(a.Values[i] - b.Values[i])
+	}
+	return diff.meanAndConfidence()
+}
+
+// simRace compares variants of a raid sim using common random numbers: every candidate is
+// simmed with the same seeds, so iteration i of each candidate sees the same random streams.
+// Differences between candidates are then mostly caused by the change itself rather than RNG,
+// which lets clearly worse candidates be dropped after only a few iterations.
+type simRace struct {
+	runner raidSimRunner
+	seed   int64
+
+	// Selects the raced metric from the results, defaults to the DPS of the measured player.
+	metric func(*proto.RaidSimResult) *proto.DistributionMetrics
+	// Optionally selects another metric to keep the values of, for reporting only.
+	reported func(*proto.RaidSimResult) *proto.DistributionMetrics
+	// Optional precision target of the raced metric. Batches never stop early, instead run stops
+	// once the leader is precise enough.
+	precision *proto.SimOptions
+
+	concurrency int
+	progress    chan *proto.ProgressMetrics
+
+	completedIterations int32
+	totalIterations     int32
+	completedSims       int32
+	totalSims           int32
+}
+
+func newSimRace(runner raidSimRunner, baseRequest *proto.RaidSimRequest, partyIdx int, playerIdx int, progress chan *proto.ProgressMetrics) *simRace {
+	seed := baseRequest.GetSimOptions().GetRandomSeed()
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	concurrency := runtime.NumCPU() + 1
+
+	// Empty player slots are skipped in the raid metrics.
+	metricsIdx := playerIdx - countEmptyPlayers(baseRequest.Raid.Parties[partyIdx].Players[:playerIdx])
+
+	return &simRace{
+		runner: runner,
+		seed:   seed,
+		metric: func(result *proto.RaidSimResult) *proto.DistributionMetrics {
+			return result.RaidMetrics.Parties[partyIdx].Players[metricsIdx].Dps
+		},
+		concurrency: concurrency,
+		progress:    progress,
+	}
+}
+
+func countEmptyPlayers(players []*proto.Player) int {
+	count := 0
+	for _, player := range players {
+		if player == nil || player.Class == proto.Class_ClassUnknown {
+			count++
+		}
+	}
+	return count
+}
+
+// Adds to the expected amount of work, used for progress reporting.
+func (race *simRace) expect(sims int, iterations int) {
+	atomic.AddInt32(&race.totalSims, int32(sims))
+	atomic.AddInt32(&race.totalIterations, int32(iterations))
+}
+
+func (race *simRace) reportProgress() {
+	if race.progress == nil {
+		return
+	}
+	completed := atomic.LoadInt32(&race.completedIterations)
+	completedSims := atomic.LoadInt32(&race.completedSims)
+	race.progress <- &proto.ProgressMetrics{
+		CompletedIterations: completed,
+		TotalIterations:     max(completed, atomic.LoadInt32(&race.totalIterations)),
+		CompletedSims:       completedSims,
+		TotalSims:           max(completedSims, atomic.LoadInt32(&race.totalSims)),
+	}
+}
+
+// Sims more iterations for each of the candidates, so that all of them have at least n values.
+// Iterations continue where the previous batch of a candidate stopped, keeping seeds aligned.
+func (race *simRace) extend(ctx context.Context, candidates []*raceCandidate, n int) error {
+	return race.extendFrom(ctx, candidates, n, race.seed)
+}
+
+// Seeds of confirmation runs start this far after the race seed, so they never overlap with
+// the seeds candidates were raced on.
+const confirmSeedOffset = 1 << 40
+
+// Re-sims the candidates on a fresh block of seeds, returning new candidates in the same order.
+// Candidates that won a race did so partly because they got lucky on its seeds, so comparing
+// them on those same seeds overstates their gain. Differences between the returned candidates
+// are unbiased. Repeated candidates are only simmed once.
+func (race *simRace) confirm(ctx context.Context, candidates []*raceCandidate, iterations int) ([]*raceCandidate, error) {
+	fresh := make(map[*raceCandidate]*raceCandidate, len(candidates))
+	var toSim []*raceCandidate
+	for _, candidate := range candidates {
+		if fresh[candidate] == nil {
+			fresh[candidate] = &raceCandidate{Request: candidate.Request, runner: candidate.runner}
+			toSim = append(toSim, fresh[candidate])
+		}
+	}
+	if err := race.extendFrom(ctx, toSim, iterations, race.seed+confirmSeedOffset); err != nil {
+		return nil, err
+	}
+	return MapSlice(candidates, func(c *raceCandidate) *raceCandidate { return fresh[c] }), nil
+}
+
+func (race *simRace) extendFrom(ctx context.Context, candidates []*raceCandidate, n int, seed int64) error {
+	tickets := make(chan struct{}, race.concurrency)
+	for i := 0; i < race.concurrency; i++ {
+		tickets <- struct{}{}
+	}
+
+	var waitGroup sync.WaitGroup
+	errs := make([]error, len(candidates))
+	for i, candidate := range candidates {
+		done := len(candidate.Values)
+		if done >= n {
+			continue
+		}
+
+		waitGroup.Add(1)
+		go func(i int, candidate *raceCandidate) {
+			defer waitGroup.Done()
+			<-tickets
+			defer func() { tickets <- struct{}{} }()
+			if ctx.Err() != nil {
+				errs[i] = ctx.Err()
+				return
+			}
+
+			request := googleProto.Clone(candidate.Request).(*proto.RaidSimRequest)
+			if request.SimOptions == nil {
+				request.SimOptions = &proto.SimOptions{}
+			}
+			request.SimOptions.Iterations = int32(n - done)
+			request.SimOptions.RandomSeed = seed + int64(done)
+			// Every batch has to sim all of its iterations to keep seeds aligned, see precision.
+			request.SimOptions.TargetDpsStderr = 0
+			request.SimOptions.TargetRelativeDpsStderr = 0
+			request.SimOptions.SaveAllValues = true
+			// Per-label RNG keeps the random streams aligned between candidates. IsTest also turns off
+			// sharding, so every raced sim runs on a single goroutine; the race runs them concurrently.
+			request.SimOptions.IsTest = true
+			request.SimOptions.Debug = false
+			request.SimOptions.DebugFirstIteration = false
+			request.SimOptions.CombatLog = false
+			request.SimOptions.ReplaySeed = 0
+
+			result := race.runBatch(candidate, request)
+			if result.ErrorResult != "" {
+				errs[i] = fmt.Errorf("simulation failed: %s", result.ErrorResult)
+				return
+			}
+
+			metrics := race.metric(result)
+			candidate.Values = append(candidate.Values, metrics.AllValues...)
+			if race.reported != nil {
+				candidate.ReportedValues = append(candidate.ReportedValues, race.reported(result).AllValues...)
+			}
+			candidate.LastResult = result
+
+			atomic.AddInt32(&race.completedIterations, int32(len(metrics.AllValues)))
+			atomic.AddInt32(&race.completedSims, 1)
+			race.reportProgress()
+		}(i, candidate)
+	}
+	waitGroup.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (race *simRace) runBatch(candidate *raceCandidate, request *proto.RaidSimRequest) (result *proto.RaidSimResult) {
+	defer func() {
+		if err := recover(); err != nil {
+			result = &proto.RaidSimResult{
+				ErrorResult: fmt.Sprintf("%v\nStack Trace:\n%s", err, string(debug.Stack())),
+			}
+		}
+	}()
+	if candidate.runner != nil {
+		return candidate.runner(request, nil, false)
+	}
+	return race.runner(request, nil, false)
+}
+
+// Races the candidates against each other. Starting at minIterations, each round doubles the
+// iterations of the remaining candidates and eliminates those whose confidence interval against
+// the current leader lies fully below zero. Stops once only keep candidates remain or
+// maxIterations is reached. With a precision target, stops once the leader meets it instead.
+func (race *simRace) run(ctx context.Context, candidates []*raceCandidate, minIterations int, maxIterations int, keep int) error {
+	keep = max(keep, 1)
+	n := min(max(minIterations, 2), maxIterations)
+
+	for {
+		alive := FilterSlice(candidates, func(c *raceCandidate) bool { return !c.Eliminated })
+		if err := race.extend(ctx, alive, n); err != nil {
+			return err
+		}
+
+		// Drop the worst candidates first, so we never go below the number we need to keep.
+		slices.SortStableFunc(alive, func(a, b *raceCandidate) int {
+			return cmp.Compare(b.meanOver(n), a.meanOver(n))
+		})
+		leader := alive[0]
+		remaining := len(alive)
+		for i := len(alive) - 1; i > 0 && remaining > keep; i-- {
+			mean, halfWidth := compareRaceCandidates(alive[i], leader)
+			if mean+halfWidth < 0 {
+				alive[i].Eliminated = true
+				remaining--
+			}
+		}
+
+		if n >= maxIterations || race.isPreciseEnough(leader) || (remaining <= keep && race.precision == nil) {
+			return nil
+		}
+		n = min(n*2, maxIterations)
+	}
+}
+
+// Whether the values of the candidate meet the precision target of the race.
+func (race *simRace) isPreciseEnough(candidate *raceCandidate) bool {
+	if race.precision == nil || len(candidate.Values) < 2 {
+		return false
+	}
+	var values aggregator
+	for _, value := range candidate.Values {
+		values.add(value)
+	}
+	stderr, target := stdErrAndTarget(race.precision, &values)
+	return stderr <= target
+}
+
+// Successive halving: starting at minIterations, each round sims the remaining candidates,
+// eliminates the worse half by mean and doubles the iterations. Unlike run, this doesn't wait
+// for confidence intervals to separate, so it scales to many candidates at a fixed budget.
+// Stops once only keep candidates remain or maxIterations is reached.
+func (race *simRace) halve(ctx context.Context, candidates []*raceCandidate, minIterations int, maxIterations int, keep int) error {
+	keep = max(keep, 1)
+	n := min(max(minIterations, 2), maxIterations)
+
+	for {
+		alive := FilterSlice(candidates, func(c *raceCandidate) bool { return !c.Eliminated })
+		if err := race.extend(ctx, alive, n); err != nil {
+			return err
+		}
+		if len(alive) <= keep || n >= maxIterations {
+			return nil
+		}
+
+		slices.SortStableFunc(alive, func(a, b *raceCandidate) int {
+			return cmp.Compare(b.meanOver(n), a.meanOver(n))
+		})
+		for _, candidate := range alive[max((len(alive)+1)/2, keep):] {
+			candidate.Eliminated = true
+		}
+		n = min(n*2, maxIterations)
+	}
+}
+
+// Expected amount of sims and iterations of halve, for progress reporting.
+func halvingWork(candidates int, minIterations int, maxIterations int, keep int) (int, int) {
+	keep = max(keep, 1)
+	n := min(max(minIterations, 2), maxIterations)
+	sims, iterations, done := 0, 0, 0
+	for {
+		sims += candidates
+		iterations += candidates * (n - done)
+		if candidates <= keep || n >= maxIterations {
+			return sims, iterations
+		}
+		candidates = max((candidates+1)/2, keep)
+		done = n
+		n = min(n*2, maxIterations)
+	}
+}
+
+// Summarizes per-iteration values like the distribution metrics of a sim, for candidates that
+// were simmed in several batches. Seeds and individual values are left out.
+func distributionFromValues(values []float64) *proto.DistributionMetrics {
+	distMetrics := NewDistributionMetrics()
+	for _, value := range values {
+		distMetrics.addValue(value, 0)
+	}
+	return distMetrics.ToProto()
+}
+
+// Finds the party and player index of the referenced player in the raid. With no reference,
+// the first player in the raid is used.
+func findRaidPlayer(raid *proto.Raid, ref *proto.UnitReference) (int, int, error) {
+	isSet := func(player *proto.Player) bool {
+		return player != nil && player.Class != proto.Class_ClassUnknown
+	}
+
+	if ref == nil || ref.Type == proto.UnitReference_Unknown {
+		for partyIdx, party := range raid.GetParties() {
+			for playerIdx, player := range party.GetPlayers() {
+				if isSet(player) {
+					return partyIdx, playerIdx, nil
+				}
+			}
+		}
+		return 0, 0, fmt.Errorf("no player found in raid")
+	}
+
+	if ref.Type != proto.UnitReference_Player {
+		return 0, 0, fmt.Errorf("expected a player reference, got %s", ref.Type)
+	}
+	partyIdx, playerIdx := int(ref.Index)/5, int(ref.Index)%5
+	if partyIdx >= len(raid.GetParties()) || playerIdx >= len(raid.Parties[partyIdx].GetPlayers()) || !isSet(raid.Parties[partyIdx].Players[playerIdx]) {
+		return 0, 0, fmt.Errorf("no player at raid index %d", ref.Index)
+	}
+	return partyIdx, playerIdx, nil
+}
@@ -20,6 +20,7 @@ type rageBar struct {
 	currentRage  float64
 
 	RageRefundMetrics *ResourceMetrics
+	capMetrics        *ResourceCapMetrics
 }
 
 type RageBarOptions struct {
@@ -100,6 +101,7 @@ func (unit *Unit) EnableRageBar(options RageBarOptions) {
 		unit:              unit,
 		startingRage:      max(0, min(options.StartingRage, MaxRage)),
 		RageRefundMetrics: unit.NewRageMetrics(ActionID{OtherID: proto.OtherAction_OtherActionRefund}),
+		capMetrics:        unit.Metrics.NewResourceCapMetrics(proto.ResourceType_ResourceTypeRage),
 	}
 }
 
@@ -122,6 +124,10 @@ func (rb *rageBar) AddRage(sim *Simulation, amount float64, metrics *ResourceMet
 	if sim.Log != nil {
 		rb.unit.Log(sim, "Gained %0.3f rage from %s (%0.3f --> %0.3f).", amount, metrics.ActionID, rb.currentRage, newRage)
 	}
+	if sim.CombatLog != nil {
+		sim.CombatLog.resourceChanged(sim, rb.unit, proto.ResourceType_ResourceTypeRage, metrics, rb.currentRage, newRage)
+	}
+	rb.capMetrics.resourceChanged(sim, rb.currentRage, newRage, MaxRage)
 
 	rb.currentRage = newRage
 	if !sim.Options.Interactive {
@@ -147,6 +153,10 @@ func (rb *rageBar) SpendRage(sim *Simulation, amount float64, metrics *ResourceM
 	if sim.Log != nil {
 		rb.unit.Log(sim, "Spent %0.3f rage from %s (%0.3f --> %0.3f).", amount, metrics.ActionID, rb.currentRage, newRage)
 	}
+	if sim.CombatLog != nil {
+		sim.CombatLog.resourceChanged(sim, rb.unit, proto.ResourceType_ResourceTypeRage, metrics, rb.currentRage, newRage)
+	}
+	rb.capMetrics.resourceChanged(sim, rb.currentRage, newRage, MaxRage)
 
 	rb.currentRage = newRage
 
@@ -53,8 +53,12 @@ func (party *Party) GetPartyBuffs(basePartyBuffs *proto.PartyBuffs) *proto.Party
 		partyBuffs = googleProto.Clone(basePartyBuffs).(*proto.PartyBuffs)
 	}
 	for _, player := range party.Players {
-		player.AddPartyBuffs(partyBuffs)
-		player.GetCharacter().AddPartyBuffs(partyBuffs)
+		playerPartyBuffs := partyBuffs
+		if party.Raid.excludesBuffsFrom(player) {
+			playerPartyBuffs = &proto.PartyBuffs{}
+		}
+		player.AddPartyBuffs(playerPartyBuffs)
+		player.GetCharacter().AddPartyBuffs(playerPartyBuffs)
 	}
 	return partyBuffs
 }
@@ -91,6 +95,15 @@ func (party *Party) doneIteration(sim *Simulation) {
 	party.hpsMetrics.doneIteration(sim)
 }
 
+func (party *Party) mergeMetrics(other *Party) {
+	for i, agent := range party.Players {
+		agent.GetCharacter().mergeMetrics(other.Players[i].GetCharacter())
+	}
+
+	party.dpsMetrics.mergeMetrics(&other.dpsMetrics)
+	party.hpsMetrics.mergeMetrics(&other.hpsMetrics)
+}
+
 func (party *Party) GetMetrics() *proto.PartyMetrics {
 	metrics := &proto.PartyMetrics{
 		Dps: party.dpsMetrics.ToProto(),
@@ -124,6 +137,9 @@ type Raid struct {
 
 	nextPetIndex int32
 
+	// Raid indices of players whose buffs aren't added to the raid and party buffs.
+	excludedBuffProviders []int32
+
 	replenishmentUnits         []*Unit   // All units who can receive replenishment.
 	curReplenishmentUnits      [][]*Unit // Units that currently have replenishment active, separated by source.
 	leftoverReplenishmentUnits []*Unit   // Units without replenishment currently active.
@@ -141,6 +157,12 @@ func (raid *Raid) GetActiveUnits() []*Unit {
 
 // Makes a new raid.
 func NewRaid(raidConfig *proto.Raid) *Raid {
+	return newRaid(raidConfig, nil)
+}
+
+// Makes a new raid in which the players at the given raid indices don't add their class,
+// talent and rune buffs to the raid and party buffs, as if someone else was in their place.
+func newRaid(raidConfig *proto.Raid, excludedBuffProviders []int32) *Raid {
 	numParties := int(raidConfig.NumActiveParties)
 	if numParties == 0 {
 		numParties = len(raidConfig.Parties)
@@ -150,6 +172,8 @@ func NewRaid(raidConfig *proto.Raid) *Raid {
 		dpsMetrics:   NewDistributionMetrics(),
 		hpsMetrics:   NewDistributionMetrics(),
 		nextPetIndex: int32(numParties) * 5,
+
+		excludedBuffProviders: excludedBuffProviders,
 	}
 
 	for partyIndex, partyConfig := range raidConfig.Parties {
@@ -225,13 +249,22 @@ func (raid *Raid) GetRaidBuffs(baseRaidBuffs *proto.RaidBuffs) *proto.RaidBuffs
 	}
 	for _, party := range raid.Parties {
 		for _, player := range party.Players {
-			player.AddRaidBuffs(raidBuffs)
-			player.GetCharacter().AddRaidBuffs(raidBuffs)
+			playerRaidBuffs := raidBuffs
+			if raid.excludesBuffsFrom(player) {
+				// Still let the player set up any effects of its own buffs.
+				playerRaidBuffs = &proto.RaidBuffs{}
+			}
+			player.AddRaidBuffs(playerRaidBuffs)
+			player.GetCharacter().AddRaidBuffs(playerRaidBuffs)
 		}
 	}
 	return raidBuffs
 }
 
+func (raid *Raid) excludesBuffsFrom(player Agent) bool {
+	return slices.Contains(raid.excludedBuffProviders, player.GetCharacter().Index)
+}
+
 // Precompute the playersAndPets array for each party.
 func (raid *Raid) updatePlayersAndPets() {
 	var raidPlayers []*Unit
@@ -379,13 +412,34 @@ func (raid *Raid) doneIteration(sim *Simulation) {
 	raid.hpsMetrics.doneIteration(sim)
 }
 
+// Adds the metrics of another copy of this raid, which simmed the iterations right after ours.
+func (raid *Raid) mergeMetrics(other *Raid) {
+	for i, party := range raid.Parties {
+		party.mergeMetrics(other.Parties[i])
+	}
+
+	raid.dpsMetrics.mergeMetrics(&other.dpsMetrics)
+	raid.hpsMetrics.mergeMetrics(&other.hpsMetrics)
+}
+
 func (raid *Raid) GetMetrics() *proto.RaidMetrics {
 	metrics := &proto.RaidMetrics{
 		Dps: raid.dpsMetrics.ToProto(),
 		Hps: raid.hpsMetrics.ToProto(),
 	}
 	for _, party := range raid.Parties {
-		metrics.Parties = append(metrics.Parties, party.GetMetrics())
+		partyMetrics := party.GetMetrics()
+		metrics.Parties = append(metrics.Parties, partyMetrics)
+
+		for _, player := range partyMetrics.Players {
+			if player.Timeline == nil {
+				continue
+			}
+			if metrics.Timeline == nil {
+				metrics.Timeline = &proto.TimelineMetrics{BucketSeconds: player.Timeline.BucketSeconds}
+			}
+			metrics.Timeline.Dps = mergeSeries(metrics.Timeline.Dps, player.Timeline.Dps)
+		}
 	}
 	return metrics
 }
@@ -0,0 +1,83 @@
+package core
+
+import (
+	"time"
+
+	"github.com/wowsims/sod/sim/core/proto"
+)
+
+// Tracks the time a unit spends with a resource at its maximum, where any further gains are
+// wasted.
+type ResourceCapMetrics struct {
+	Type proto.ResourceType
+
+	// Metrics for the current iteration.
+	tracking  bool // Whether the resource changed yet in this iteration.
+	atCap     bool
+	capStart  time.Duration
+	TimeAtCap time.Duration
+
+	// Aggregate values. These are updated after each iteration.
+	aggregator
+	simmedSeconds float64
+}
+
+func (rcm *ResourceCapMetrics) reset() {
+	rcm.tracking = false
+	rcm.atCap = false
+	rcm.TimeAtCap = 0
+}
+
+func (rcm *ResourceCapMetrics) resourceChanged(sim *Simulation, before float64, after float64, maxValue float64) {
+	now := max(sim.CurrentTime, 0)
+	if !rcm.tracking {
+		rcm.tracking = true
+		rcm.atCap = before >= maxValue
+		rcm.capStart = 0
+	}
+
+	atCap := after >= maxValue
+	if rcm.atCap && !atCap {
+		rcm.TimeAtCap += now - rcm.capStart
+	} else if !rcm.atCap && atCap {
+		rcm.capStart = now
+	}
+	rcm.atCap = atCap
+}
+
+// This should be called when a Sim iteration is complete.
+func (rcm *ResourceCapMetrics) doneIteration(sim *Simulation) {
+	if rcm.atCap {
+		rcm.TimeAtCap += sim.CurrentTime - rcm.capStart
+	}
+	rcm.add(rcm.TimeAtCap.Seconds())
+	rcm.simmedSeconds += sim.CurrentTime.Seconds()
+}
+
+func (rcm *ResourceCapMetrics) mergeMetrics(other *ResourceCapMetrics) {
+	rcm.aggregator = *rcm.aggregator.merge(&other.aggregator)
+	rcm.simmedSeconds += other.simmedSeconds
+}
+
+func (rcm *ResourceCapMetrics) ToProto() *proto.ResourceCapMetrics {
+	mean, stdev := rcm.meanAndStdDev()
+
+	protoMetrics := &proto.ResourceCapMetrics{
+		Type: rcm.Type,
+
+		SecondsAtCapAvg:   mean,
+		SecondsAtCapStdev: stdev,
+	}
+	if rcm.simmedSeconds > 0 {
+		protoMetrics.TimeFractionAtCap = rcm.sum / rcm.simmedSeconds
+	}
+	return protoMetrics
+}
+
+func (unitMetrics *UnitMetrics) NewResourceCapMetrics(resourceType proto.ResourceType) *ResourceCapMetrics {
+	newMetrics := &ResourceCapMetrics{
+		Type: resourceType,
+	}
+	unitMetrics.resourceCaps = append(unitMetrics.resourceCaps, newMetrics)
+	return newMetrics
+}
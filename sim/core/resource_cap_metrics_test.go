@@ -0,0 +1,28 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResourceCapMetrics(t *testing.T) {
+	sim := &Simulation{}
+	rcm := &ResourceCapMetrics{}
+
+	// Starts capped, spends at 2s, caps again at 5s and stays capped until the end at 10s.
+	sim.CurrentTime = time.Second * 2
+	rcm.resourceChanged(sim, 100, 60, 100)
+	sim.CurrentTime = time.Second * 3
+	rcm.resourceChanged(sim, 60, 90, 100)
+	sim.CurrentTime = time.Second * 5
+	rcm.resourceChanged(sim, 90, 100, 100)
+	sim.CurrentTime = time.Second * 10
+	rcm.doneIteration(sim)
+
+	if expected := time.Second * 7; rcm.TimeAtCap != expected {
+		t.Errorf("Unexpected time at cap %s, expected %s", rcm.TimeAtCap, expected)
+	}
+	if fraction := rcm.ToProto().TimeFractionAtCap; fraction != 0.7 {
+		t.Errorf("Unexpected fraction at cap %f, expected 0.7", fraction)
+	}
+}
@@ -0,0 +1,519 @@
+package core
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	googleProto "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/wowsims/sod/sim/core/proto"
+)
+
+const (
+	defaultRotationOptimizerPopulation    = 12
+	defaultRotationOptimizerGenerations   = 8
+	defaultRotationOptimizerMinIterations = 200
+	defaultRotationOptimizerMaxIterations = 3200
+	defaultRotationOptimizerThresholdStep = 0.1
+)
+
+func RotationOptimizer(ctx context.Context, request *proto.RotationOptimizerRequest, progress chan *proto.ProgressMetrics) *proto.RotationOptimizerResult {
+	optimizer := &rotationOptimizer{
+		SingleRaidSimRunner: runSim,
+		Request:             request,
+	}
+
+	result, err := optimizer.Run(ctx, progress)
+	if err != nil {
+		result = &proto.RotationOptimizerResult{
+			ErrorResult: err.Error(),
+		}
+	}
+
+	if progress != nil {
+		progress <- &proto.ProgressMetrics{
+			FinalRotationResult: result,
+		}
+		close(progress)
+	}
+
+	return result
+}
+
+// rotationOptimizer searches for a better version of a player's APL priority list, by
+// reordering items, toggling them on and off and nudging the numeric thresholds in their
+// conditions. Candidates are evolved with a small genetic search, and each generation is
+// compared with a simRace.
+type rotationOptimizer struct {
+	// SingleRaidSimRunner used to run each batch of iterations.
+	SingleRaidSimRunner raidSimRunner
+	// Request used for this optimization.
+	Request *proto.RotationOptimizerRequest
+
+	settings     *proto.RotationOptimizerSettings
+	baseRequest  *proto.RaidSimRequest
+	baseRotation *proto.APLRotation
+	player       *proto.Player
+	rand         Rand
+
+	optimizeOrder      bool
+	optimizeThresholds bool
+	optimizeToggles    bool
+	thresholdStep      float64
+
+	// Priority list indices the optimizer may change.
+	movable []int
+	// Numeric constants found in the conditions of movable items.
+	thresholds []aplThreshold
+}
+
+// aplThreshold is a numeric constant within the condition of a priority list item.
+type aplThreshold struct {
+	itemIdx int
+	// Position of the constant within the item, in the order of walkAPLConsts.
+	constIdx int
+	base     string
+}
+
+// aplGenome describes a candidate rotation relative to the base rotation.
+type aplGenome struct {
+	order      []int    // Base priority list index for each position.
+	enabled    []bool   // Indexed by base priority list index.
+	thresholds []string // Values for each of rotationOptimizer.thresholds.
+}
+
+func (g *aplGenome) clone() *aplGenome {
+	return &aplGenome{
+		order:      slices.Clone(g.order),
+		enabled:    slices.Clone(g.enabled),
+		thresholds: slices.Clone(g.thresholds),
+	}
+}
+
+func (g *aplGenome) key() string {
+	return fmt.Sprintf("%v|%v|%v", g.order, g.enabled, g.thresholds)
+}
+
+type rotationCandidate struct {
+	genome *aplGenome
+	race   *raceCandidate
+}
+
+func (ro *rotationOptimizer) Run(pctx context.Context, progress chan *proto.ProgressMetrics) (result *proto.RotationOptimizerResult, resultErr error) {
+	ctx, cancel := context.WithCancel(pctx)
+	defer func() {
+		if err := recover(); err != nil {
+			result = &proto.RotationOptimizerResult{
+				ErrorResult: fmt.Sprintf("%v\nStack Trace:\n%s", err, string(debug.Stack())),
+			}
+		}
+		cancel()
+	}()
+
+	if err := ro.setup(); err != nil {
+		return nil, err
+	}
+
+	population := max(int(ro.settings.PopulationSize), 2)
+	if ro.settings.PopulationSize == 0 {
+		population = defaultRotationOptimizerPopulation
+	}
+	generations := max(int(ro.settings.Generations), 1)
+	if ro.settings.Generations == 0 {
+		generations = defaultRotationOptimizerGenerations
+	}
+	minIterations := int(ro.settings.MinIterations)
+	if minIterations <= 0 {
+		minIterations = defaultRotationOptimizerMinIterations
+	}
+	maxIterations := int(ro.settings.MaxIterations)
+	if maxIterations <= 0 {
+		maxIterations = defaultRotationOptimizerMaxIterations
+	}
+	maxIterations = max(maxIterations, minIterations)
+	eliteCount := max(population/4, 2)
+
+	partyIdx, playerIdx, _ := findRaidPlayer(ro.baseRequest.Raid, ro.settings.Player)
+	race := newSimRace(ro.SingleRaidSimRunner, ro.baseRequest, partyIdx, playerIdx, progress)
+	race.expect(generations*population+2, generations*population*minIterations*2+2*maxIterations)
+	ro.rand = NewSplitMix(uint64(race.seed))
+
+	seen := map[string]bool{}
+	newCandidate := func(genome *aplGenome) *rotationCandidate {
+		seen[genome.key()] = true
+		return &rotationCandidate{
+			genome: genome,
+			race:   &raceCandidate{Request: ro.requestFor(genome)},
+		}
+	}
+
+	base := newCandidate(ro.baseGenome())
+	current := []*rotationCandidate{base}
+	for generation := 0; generation < generations; generation++ {
+		// Fill the generation up with children of the current elites.
+		next := slices.Clone(current)
+		for attempts := 0; len(next) < population && attempts < population*10; attempts++ {
+			parent := current[ro.rand.Next()%uint64(len(current))].genome
+			child := parent.clone()
+			if len(current) > 1 && ro.rand.NextFloat64() < 0.3 {
+				child = ro.crossover(child, current[ro.rand.Next()%uint64(len(current))].genome)
+			}
+			ro.mutate(child)
+			if !seen[child.key()] {
+				next = append(next, newCandidate(child))
+			}
+		}
+		if len(next) == len(current) && generation > 0 {
+			// The search space is exhausted.
+			break
+		}
+
+		for _, c := range next {
+			c.race.Eliminated = false
+		}
+		if err := race.run(ctx, MapSlice(next, func(c *rotationCandidate) *raceCandidate { return c.race }), minIterations, maxIterations, eliteCount); err != nil {
+			return nil, err
+		}
+
+		survivors := FilterSlice(next, func(c *rotationCandidate) bool { return !c.race.Eliminated })
+		slices.SortStableFunc(survivors, func(a, b *rotationCandidate) int {
+			n := min(len(a.race.Values), len(b.race.Values))
+			return cmp.Compare(b.race.meanOver(n), a.race.meanOver(n))
+		})
+		current = survivors[:min(len(survivors), eliteCount)]
+	}
+
+	// Confirm the best candidate against the base rotation on fresh seeds. If it doesn't hold
+	// up, its lead only came from the seeds it was chosen on.
+	best := current[0]
+	confirmed, err := race.confirm(ctx, []*raceCandidate{base.race, best.race}, maxIterations)
+	if err != nil {
+		return nil, err
+	}
+	baseConfirmed, bestConfirmed := confirmed[0], confirmed[1]
+	delta, halfWidth := compareRaceCandidates(bestConfirmed, baseConfirmed)
+	if delta <= 0 {
+		best, bestConfirmed = base, baseConfirmed
+		delta, halfWidth = 0, 0
+	}
+
+	result = &proto.RotationOptimizerResult{
+		BestRotation:        ro.rotationFor(best.genome),
+		Changes:             ro.describeChanges(best.genome),
+		BaseDps:             baseConfirmed.Mean(),
+		BestDps:             bestConfirmed.Mean(),
+		DpsDelta:            delta,
+		DpsDeltaCiLow:       delta - halfWidth,
+		DpsDeltaCiHigh:      delta + halfWidth,
+		Iterations:          int32(maxIterations),
+		CandidatesEvaluated: int32(len(seen)),
+	}
+	return result, nil
+}
+
+// Validates the request and finds the parts of the rotation that may be changed.
+func (ro *rotationOptimizer) setup() error {
+	ro.settings = ro.Request.GetSettings()
+	if ro.settings == nil {
+		ro.settings = &proto.RotationOptimizerSettings{}
+	}
+	if ro.Request.GetBaseSettings().GetRaid() == nil {
+		return fmt.Errorf("rotation optimizer: missing base settings")
+	}
+	ro.baseRequest = googleProto.Clone(ro.Request.BaseSettings).(*proto.RaidSimRequest)
+	if ro.baseRequest.SimOptions == nil {
+		ro.baseRequest.SimOptions = &proto.SimOptions{}
+	}
+
+	partyIdx, playerIdx, err := findRaidPlayer(ro.baseRequest.Raid, ro.settings.Player)
+	if err != nil {
+		return fmt.Errorf("rotation optimizer: %w", err)
+	}
+	ro.player = ro.baseRequest.Raid.Parties[partyIdx].Players[playerIdx]
+	if ro.player.GetDatabase() != nil {
+		addToDatabase(ro.player.GetDatabase())
+	}
+	ro.baseRotation = ro.player.GetRotation()
+	if ro.baseRotation.GetType() != proto.APLRotation_TypeAPL || len(ro.baseRotation.GetPriorityList()) == 0 {
+		return fmt.Errorf("rotation optimizer: player does not have an APL priority list")
+	}
+
+	ro.optimizeOrder = ro.settings.OptimizeOrder
+	ro.optimizeThresholds = ro.settings.OptimizeThresholds
+	ro.optimizeToggles = ro.settings.OptimizeToggles
+	if !ro.optimizeOrder && !ro.optimizeThresholds && !ro.optimizeToggles {
+		ro.optimizeOrder, ro.optimizeThresholds, ro.optimizeToggles = true, true, true
+	}
+	ro.thresholdStep = ro.settings.ThresholdStep
+	if ro.thresholdStep <= 0 {
+		ro.thresholdStep = defaultRotationOptimizerThresholdStep
+	}
+
+	ro.movable = nil
+	ro.thresholds = nil
+	for i, item := range ro.baseRotation.PriorityList {
+		if item.Hide || slices.Contains(ro.settings.FixedItems, int32(i)) {
+			continue
+		}
+		ro.movable = append(ro.movable, i)
+		for constIdx, config := range walkAPLConsts(item.Action) {
+			if _, ok := parseAPLThreshold(config.Val); ok {
+				ro.thresholds = append(ro.thresholds, aplThreshold{itemIdx: i, constIdx: constIdx, base: config.Val})
+			}
+		}
+	}
+
+	canReorder := ro.optimizeOrder && len(ro.movable) > 1
+	canToggle := ro.optimizeToggles && len(ro.movable) > 0
+	canNudge := ro.optimizeThresholds && len(ro.thresholds) > 0
+	if !canReorder && !canToggle && !canNudge {
+		return fmt.Errorf("rotation optimizer: nothing in the priority list can be optimized")
+	}
+	ro.optimizeOrder, ro.optimizeToggles, ro.optimizeThresholds = canReorder, canToggle, canNudge
+	return nil
+}
+
+func (ro *rotationOptimizer) baseGenome() *aplGenome {
+	genome := &aplGenome{
+		order:      make([]int, len(ro.baseRotation.PriorityList)),
+		enabled:    make([]bool, len(ro.baseRotation.PriorityList)),
+		thresholds: MapSlice(ro.thresholds, func(t aplThreshold) string { return t.base }),
+	}
+	for i, item := range ro.baseRotation.PriorityList {
+		genome.order[i] = i
+		genome.enabled[i] = !item.Hide
+	}
+	return genome
+}
+
+// Applies a single random change to the genome.
+func (ro *rotationOptimizer) mutate(genome *aplGenome) {
+	var ops []func()
+	if ro.optimizeOrder {
+		ops = append(ops, func() {
+			// Swap a movable item with the next movable item in the list.
+			var positions []int
+			for pos, idx := range genome.order {
+				if slices.Contains(ro.movable, idx) {
+					positions = append(positions, pos)
+				}
+			}
+			i := int(ro.rand.Next() % uint64(len(positions)-1))
+			a, b := positions[i], positions[i+1]
+			genome.order[a], genome.order[b] = genome.order[b], genome.order[a]
+		})
+	}
+	if ro.optimizeToggles {
+		ops = append(ops, func() {
+			idx := ro.movable[ro.rand.Next()%uint64(len(ro.movable))]
+			genome.enabled[idx] = !genome.enabled[idx]
+		})
+	}
+	if ro.optimizeThresholds {
+		ops = append(ops, func() {
+			i := ro.rand.Next() % uint64(len(ro.thresholds))
+			genome.thresholds[i] = nudgeAPLThreshold(genome.thresholds[i], ro.thresholdStep, ro.rand.NextFloat64() < 0.5)
+		})
+	}
+	ops[ro.rand.Next()%uint64(len(ops))]()
+}
+
+// Mixes the toggles and thresholds of two genomes, keeping the order of the first.
+func (ro *rotationOptimizer) crossover(a *aplGenome, b *aplGenome) *aplGenome {
+	child := a.clone()
+	for i := range child.enabled {
+		if ro.rand.NextFloat64() < 0.5 {
+			child.enabled[i] = b.enabled[i]
+		}
+	}
+	for i := range child.thresholds {
+		if ro.rand.NextFloat64() < 0.5 {
+			child.thresholds[i] = b.thresholds[i]
+		}
+	}
+	return child
+}
+
+func (ro *rotationOptimizer) rotationFor(genome *aplGenome) *proto.APLRotation {
+	rotation := googleProto.Clone(ro.baseRotation).(*proto.APLRotation)
+	items := rotation.PriorityList
+
+	for i, threshold := range ro.thresholds {
+		walkAPLConsts(items[threshold.itemIdx].Action)[threshold.constIdx].Val = genome.thresholds[i]
+	}
+	for i, item := range items {
+		item.Hide = !genome.enabled[i]
+	}
+	rotation.PriorityList = MapSlice(genome.order, func(idx int) *proto.APLListItem { return items[idx] })
+	return rotation
+}
+
+func (ro *rotationOptimizer) requestFor(genome *aplGenome) *proto.RaidSimRequest {
+	partyIdx, playerIdx, _ := findRaidPlayer(ro.baseRequest.Raid, ro.settings.Player)
+	request := googleProto.Clone(ro.baseRequest).(*proto.RaidSimRequest)
+	request.Raid.Parties[partyIdx].Players[playerIdx].Rotation = ro.rotationFor(genome)
+	return request
+}
+
+func (ro *rotationOptimizer) describeChanges(genome *aplGenome) []string {
+	label := func(idx int) string {
+		return fmt.Sprintf("#%d (%s)", idx+1, describeAPLAction(ro.baseRotation.PriorityList[idx].Action))
+	}
+
+	var changes []string
+	for pos, idx := range genome.order {
+		if pos != idx {
+			changes = append(changes, fmt.Sprintf("Moved %s to position %d", label(idx), pos+1))
+		}
+	}
+	for idx, enabled := range genome.enabled {
+		if enabled == ro.baseRotation.PriorityList[idx].Hide {
+			if enabled {
+				changes = append(changes, fmt.Sprintf("Enabled %s", label(idx)))
+			} else {
+				changes = append(changes, fmt.Sprintf("Disabled %s", label(idx)))
+			}
+		}
+	}
+	for i, threshold := range ro.thresholds {
+		if genome.thresholds[i] != threshold.base {
+			changes = append(changes, fmt.Sprintf("Changed threshold in %s from %s to %s", label(threshold.itemIdx), threshold.base, genome.thresholds[i]))
+		}
+	}
+	return changes
+}
+
+// Short description of an action, e.g. "cast_spell {SpellID: 11567}".
+func describeAPLAction(action *proto.APLAction) string {
+	msg := action.ProtoReflect()
+	field := msg.WhichOneof(msg.Descriptor().Oneofs().ByName("action"))
+	if field == nil {
+		return "unknown"
+	}
+	desc := string(field.Name())
+	if spellID := findFirstAPLActionID(msg.Get(field).Message()); spellID != nil {
+		desc += " " + ProtoToActionID(spellID).String()
+	}
+	return desc
+}
+
+func findFirstAPLActionID(msg protoreflect.Message) *proto.ActionID {
+	var found *proto.ActionID
+	walkAPLMessage(msg, func(m protoreflect.Message) bool {
+		if id, ok := m.Interface().(*proto.ActionID); ok {
+			found = id
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// Returns all constants within an action, in a stable order.
+func walkAPLConsts(action *proto.APLAction) []*proto.APLValueConst {
+	var consts []*proto.APLValueConst
+	walkAPLMessage(action.ProtoReflect(), func(m protoreflect.Message) bool {
+		if config, ok := m.Interface().(*proto.APLValueConst); ok {
+			consts = append(consts, config)
+		}
+		return true
+	})
+	return consts
+}
+
+// Visits msg and all of its nested messages in field number order, stopping when visit returns false.
+func walkAPLMessage(msg protoreflect.Message, visit func(protoreflect.Message) bool) bool {
+	if !msg.IsValid() {
+		return true
+	}
+	if !visit(msg) {
+		return false
+	}
+	fields := msg.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		field := fields.Get(i)
+		if field.Kind() != protoreflect.MessageKind || field.IsMap() || !msg.Has(field) {
+			continue
+		}
+		if field.IsList() {
+			list := msg.Get(field).List()
+			for j := 0; j < list.Len(); j++ {
+				if !walkAPLMessage(list.Get(j).Message(), visit) {
+					return false
+				}
+			}
+		} else if !walkAPLMessage(msg.Get(field).Message(), visit) {
+			return false
+		}
+	}
+	return true
+}
+
+type aplThresholdKind int
+
+const (
+	aplThresholdInt aplThresholdKind = iota
+	aplThresholdFloat
+	aplThresholdPercent
+	aplThresholdDuration
+)
+
+// Parses an APL constant the same way as newValueConst, returning false for non-numeric values.
+func parseAPLThreshold(val string) (aplThresholdKind, bool) {
+	if _, err := time.ParseDuration(val); err == nil && strings.ContainsAny(val, "hmsuµn") {
+		return aplThresholdDuration, true
+	}
+	if _, err := strconv.Atoi(val); err == nil {
+		return aplThresholdInt, true
+	}
+	if len(val) > 1 && val[len(val)-1] == '%' {
+		if _, err := strconv.ParseFloat(val[:len(val)-1], 64); err == nil {
+			return aplThresholdPercent, true
+		}
+	}
+	if _, err := strconv.ParseFloat(val, 64); err == nil {
+		return aplThresholdFloat, true
+	}
+	return 0, false
+}
+
+// Moves a numeric constant up or down by a relative step, keeping its format.
+func nudgeAPLThreshold(val string, step float64, up bool) string {
+	kind, ok := parseAPLThreshold(val)
+	if !ok {
+		return val
+	}
+	sign := -1.0
+	if up {
+		sign = 1.0
+	}
+	nudge := func(v float64, minChange float64) float64 {
+		return v + sign*math.Max(math.Abs(v)*step, minChange)
+	}
+	formatFloat := func(v float64, scale float64) string {
+		return strconv.FormatFloat(math.Round(v*scale)/scale, 'f', -1, 64)
+	}
+
+	switch kind {
+	case aplThresholdDuration:
+		dur, _ := time.ParseDuration(val)
+		return time.Duration(nudge(float64(dur), float64(time.Millisecond*100))).Round(time.Millisecond * 100).String()
+	case aplThresholdInt:
+		v, _ := strconv.Atoi(val)
+		return strconv.Itoa(int(math.Round(nudge(float64(v), 1))))
+	case aplThresholdPercent:
+		v, _ := strconv.ParseFloat(val[:len(val)-1], 64)
+		return formatFloat(nudge(v, 1), 10) + "%"
+	default:
+		v, _ := strconv.ParseFloat(val, 64)
+		return formatFloat(nudge(v, 0.01), 100)
+	}
+}
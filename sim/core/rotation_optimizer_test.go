@@ -0,0 +1,93 @@
+package core
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/wowsims/sod/sim/core/proto"
+)
+
+func TestNudgeAPLThreshold(t *testing.T) {
+	testCases := []struct {
+		val  string
+		up   bool
+		want string
+	}{
+		{val: "80", up: false, want: "72"},
+		{val: "3", up: true, want: "4"},
+		{val: "0", up: true, want: "1"},
+		{val: "20%", up: true, want: "22%"},
+		{val: "2s", up: false, want: "1.8s"},
+		{val: "1.5", up: true, want: "1.65"},
+		{val: "true", up: true, want: "true"},
+		{val: "test str", up: true, want: "test str"},
+	}
+
+	for _, tc := range testCases {
+		if got := nudgeAPLThreshold(tc.val, 0.1, tc.up); got != tc.want {
+			t.Errorf("nudgeAPLThreshold(%q, up=%v) = %q, expected %q", tc.val, tc.up, got, tc.want)
+		}
+	}
+}
+
+func TestWalkAPLConsts(t *testing.T) {
+	constVal := func(val string) *proto.APLValue {
+		return &proto.APLValue{Value: &proto.APLValue_Const{Const: &proto.APLValueConst{Val: val}}}
+	}
+
+	action := &proto.APLAction{
+		Condition: &proto.APLValue{Value: &proto.APLValue_And{And: &proto.APLValueAnd{Vals: []*proto.APLValue{
+			{Value: &proto.APLValue_Cmp{Cmp: &proto.APLValueCompare{Lhs: constVal("1"), Rhs: constVal("2s")}}},
+			constVal("3"),
+		}}}},
+		Action: &proto.APLAction_CastSpell{CastSpell: &proto.APLActionCastSpell{SpellId: &proto.ActionID{RawId: &proto.ActionID_SpellId{SpellId: 100}}}},
+	}
+
+	consts := walkAPLConsts(action)
+	if len(consts) != 3 || consts[0].Val != "1" || consts[1].Val != "2s" || consts[2].Val != "3" {
+		t.Fatalf("Unexpected consts %v", consts)
+	}
+
+	if desc := describeAPLAction(action); desc != "cast_spell {SpellID: 100}" {
+		t.Fatalf("Unexpected action description %q", desc)
+	}
+}
+
+func TestRotationOptimizer(t *testing.T) {
+	rsr := fakeCasterRaidSimRequest()
+
+	// Waiting at the top of the list keeps the caster from ever casting, so disabling it is a
+	// clear improvement.
+	rotation := rsr.Raid.Parties[0].Players[0].Rotation
+	wait := &proto.APLListItem{Action: &proto.APLAction{Action: &proto.APLAction_Wait{Wait: &proto.APLActionWait{
+		Duration: &proto.APLValue{Value: &proto.APLValue_Const{Const: &proto.APLValueConst{Val: "5s"}}},
+	}}}}
+	rotation.PriorityList = append([]*proto.APLListItem{wait}, rotation.PriorityList...)
+
+	result := RotationOptimizer(context.Background(), &proto.RotationOptimizerRequest{
+		BaseSettings: rsr,
+		Settings: &proto.RotationOptimizerSettings{
+			OptimizeToggles: true,
+			FixedItems:      []int32{1},
+			PopulationSize:  2,
+			Generations:     1,
+			MinIterations:   50,
+			MaxIterations:   200,
+		},
+	}, nil)
+	if result.ErrorResult != "" {
+		t.Fatalf("Rotation optimizer failed with error: %s", result.ErrorResult)
+	}
+
+	if !result.BestRotation.PriorityList[0].Hide || result.BestRotation.PriorityList[1].Hide {
+		t.Fatalf("Expected only the wait to be disabled, got changes %v", result.Changes)
+	}
+	if result.BaseDps != 0 || result.DpsDeltaCiLow <= 0 {
+		t.Fatalf("Expected a significant gain over no DPS, got %.2f dps (%.2f to %.2f) over %.2f", result.DpsDelta, result.DpsDeltaCiLow, result.DpsDeltaCiHigh, result.BaseDps)
+	}
+	// The delta and both means come from the same confirmation run.
+	if math.Abs(result.BestDps-result.BaseDps-result.DpsDelta) > 1e-6 {
+		t.Fatalf("Delta %.3f does not match best %.3f minus base %.3f", result.DpsDelta, result.BestDps, result.BaseDps)
+	}
+}
@@ -0,0 +1,275 @@
+package core
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"runtime/debug"
+	"slices"
+
+	googleProto "google.golang.org/protobuf/proto"
+
+	"github.com/wowsims/sod/sim/core/proto"
+)
+
+const (
+	defaultRuneOptimizerNumResults    = 10
+	defaultRuneOptimizerMinIterations = 100
+	defaultRuneOptimizerMaxIterations = 3200
+	defaultRuneOptimizerMaxLoadouts   = 4096
+)
+
+// Runes implemented by the sim for each class, from the class protos.
+var implementedRunes = map[proto.Class]map[int32]string{
+	proto.Class_ClassDruid:   proto.DruidRune_name,
+	proto.Class_ClassHunter:  proto.HunterRune_name,
+	proto.Class_ClassMage:    proto.MageRune_name,
+	proto.Class_ClassPriest:  proto.PriestRune_name,
+	proto.Class_ClassShaman:  proto.ShamanRune_name,
+	proto.Class_ClassWarlock: proto.WarlockRune_name,
+	proto.Class_ClassWarrior: proto.WarriorRune_name,
+}
+
+func RuneOptimizer(ctx context.Context, request *proto.RuneOptimizerRequest, progress chan *proto.ProgressMetrics) *proto.RuneOptimizerResult {
+	optimizer := &runeOptimizer{
+		SingleRaidSimRunner: runSim,
+		Request:             request,
+	}
+
+	result, err := optimizer.Run(ctx, progress)
+	if err != nil {
+		result = &proto.RuneOptimizerResult{
+			ErrorResult: err.Error(),
+		}
+	}
+
+	if progress != nil {
+		progress <- &proto.ProgressMetrics{
+			FinalRuneOptimizerResult: result,
+		}
+		close(progress)
+	}
+
+	return result
+}
+
+// runeOptimizer compares every legal combination of runes of a player. Each slot with an
+// equipped item can hold any of the class's runes for that type of item, as long as the sim
+// implements the rune and its metadata is in the database. The loadouts are compared with
+// successive halving, since there are often thousands of them.
+type runeOptimizer struct {
+	// SingleRaidSimRunner used to run each batch of iterations.
+	SingleRaidSimRunner raidSimRunner
+	// Request used for this optimization.
+	Request *proto.RuneOptimizerRequest
+
+	settings    *proto.RuneOptimizerSettings
+	baseRequest *proto.RaidSimRequest
+	partyIdx    int
+	playerIdx   int
+	player      *proto.Player
+}
+
+// The runes that may be engraved in one slot.
+type runeSlotOptions struct {
+	slot  proto.ItemSlot
+	runes []int32
+}
+
+type runeLoadout struct {
+	runes []int32 // Indexed like the slot options.
+	race  *raceCandidate
+}
+
+func (ro *runeOptimizer) Run(pctx context.Context, progress chan *proto.ProgressMetrics) (result *proto.RuneOptimizerResult, resultErr error) {
+	ctx, cancel := context.WithCancel(pctx)
+	defer func() {
+		if err := recover(); err != nil {
+			result = &proto.RuneOptimizerResult{
+				ErrorResult: fmt.Sprintf("%v\nStack Trace:\n%s", err, string(debug.Stack())),
+			}
+		}
+		cancel()
+	}()
+
+	ro.settings = ro.Request.GetSettings()
+	if ro.settings == nil {
+		ro.settings = &proto.RuneOptimizerSettings{}
+	}
+	if ro.Request.GetBaseSettings().GetRaid() == nil {
+		return nil, fmt.Errorf("rune optimizer: missing base settings")
+	}
+	ro.baseRequest = googleProto.Clone(ro.Request.BaseSettings).(*proto.RaidSimRequest)
+	if ro.baseRequest.SimOptions == nil {
+		ro.baseRequest.SimOptions = &proto.SimOptions{}
+	}
+
+	partyIdx, playerIdx, err := findRaidPlayer(ro.baseRequest.Raid, ro.settings.Player)
+	if err != nil {
+		return nil, fmt.Errorf("rune optimizer: %w", err)
+	}
+	ro.partyIdx, ro.playerIdx = partyIdx, playerIdx
+	ro.player = ro.baseRequest.Raid.Parties[partyIdx].Players[playerIdx]
+	for _, party := range ro.baseRequest.Raid.Parties {
+		for _, player := range party.GetPlayers() {
+			if player.GetDatabase() != nil {
+				addToDatabase(player.GetDatabase())
+			}
+		}
+	}
+	if ro.player.GetEquipment() == nil {
+		return nil, fmt.Errorf("rune optimizer: player has no equipment")
+	}
+
+	numResults := int(ro.settings.NumResults)
+	if numResults <= 0 {
+		numResults = defaultRuneOptimizerNumResults
+	}
+	minIterations := int(ro.settings.MinIterations)
+	if minIterations <= 0 {
+		minIterations = defaultRuneOptimizerMinIterations
+	}
+	maxIterations := int(ro.settings.MaxIterations)
+	if maxIterations <= 0 {
+		maxIterations = defaultRuneOptimizerMaxIterations
+	}
+	maxIterations = max(maxIterations, minIterations)
+	maxLoadouts := int(ro.settings.MaxLoadouts)
+	if maxLoadouts <= 0 {
+		maxLoadouts = defaultRuneOptimizerMaxLoadouts
+	}
+
+	options := ro.slotOptions()
+	if len(options) == 0 {
+		return nil, fmt.Errorf("rune optimizer: no runes to choose from for %s", ro.player.Class)
+	}
+	numLoadouts := 1
+	for _, option := range options {
+		numLoadouts *= len(option.runes)
+		if numLoadouts > maxLoadouts {
+			return nil, fmt.Errorf("rune optimizer: more than %d rune loadouts, fix some of the slots", maxLoadouts)
+		}
+	}
+
+	equipped := &runeLoadout{runes: MapSlice(options, func(option runeSlotOptions) int32 {
+		return ro.player.Equipment.Items[option.slot].Rune
+	})}
+	loadouts := []*runeLoadout{equipped}
+	for _, runes := range runeCombinations(options) {
+		if !slices.Equal(runes, equipped.runes) {
+			loadouts = append(loadouts, &runeLoadout{runes: runes})
+		}
+	}
+	for _, loadout := range loadouts {
+		loadout.race = &raceCandidate{Request: ro.requestFor(options, loadout.runes)}
+	}
+
+	race := newSimRace(ro.SingleRaidSimRunner, ro.baseRequest, partyIdx, playerIdx, progress)
+	sims, iterations := halvingWork(len(loadouts), minIterations, maxIterations, numResults)
+	race.expect(sims+numResults+1, iterations+(numResults+1)*maxIterations)
+	if err := race.halve(ctx, MapSlice(loadouts, func(l *runeLoadout) *raceCandidate { return l.race }), minIterations, maxIterations, numResults); err != nil {
+		return nil, err
+	}
+
+	// The best survivors are compared against the equipped runes on fresh seeds, as the
+	// baseline for the deltas.
+	survivors := FilterSlice(loadouts, func(l *runeLoadout) bool { return !l.race.Eliminated && l != equipped })
+	slices.SortStableFunc(survivors, func(a, b *runeLoadout) int {
+		return cmp.Compare(b.race.Mean(), a.race.Mean())
+	})
+	finalists := append([]*runeLoadout{equipped}, survivors[:min(len(survivors), numResults)]...)
+	confirmed, err := race.confirm(ctx, MapSlice(finalists, func(l *runeLoadout) *raceCandidate { return l.race }), maxIterations)
+	if err != nil {
+		return nil, err
+	}
+	for i, loadout := range finalists {
+		loadout.race = confirmed[i]
+	}
+	slices.SortStableFunc(finalists, func(a, b *runeLoadout) int {
+		return cmp.Compare(b.race.Mean(), a.race.Mean())
+	})
+
+	result = &proto.RuneOptimizerResult{
+		Equipped:       ro.loadoutToProto(options, equipped, equipped),
+		LoadoutsSimmed: int32(len(loadouts)),
+		Iterations:     int32(maxIterations),
+	}
+	for _, loadout := range finalists[:min(len(finalists), numResults)] {
+		result.Loadouts = append(result.Loadouts, ro.loadoutToProto(options, loadout, equipped))
+	}
+	return result, nil
+}
+
+// Returns the runes that may be engraved in each slot of the player, skipping slots with no
+// choice.
+func (ro *runeOptimizer) slotOptions() []runeSlotOptions {
+	implemented := implementedRunes[ro.player.Class]
+	var options []runeSlotOptions
+	for slot, spec := range ro.player.Equipment.Items {
+		item, ok := ItemsByID[spec.Id]
+		if !ok || slices.Contains(ro.settings.FixedSlots, proto.ItemSlot(slot)) {
+			continue
+		}
+
+		var runes []int32
+		for _, id := range sortedKeys(RunesByID) {
+			runeData := RunesByID[id]
+			if _, ok := implemented[id]; !ok || runeData.Class != ro.player.Class || runeData.Type != item.Type || runeData.RequiresLevel > ro.player.Level {
+				continue
+			}
+			if slices.Contains(ro.settings.ExcludedRunes, id) {
+				continue
+			}
+			runes = append(runes, id)
+		}
+		if len(runes) > 1 || (len(runes) == 1 && runes[0] != spec.Rune) {
+			options = append(options, runeSlotOptions{slot: proto.ItemSlot(slot), runes: runes})
+		}
+	}
+	return options
+}
+
+// Returns every combination of one rune per slot.
+func runeCombinations(options []runeSlotOptions) [][]int32 {
+	combinations := [][]int32{{}}
+	for _, option := range options {
+		var next [][]int32
+		for _, combination := range combinations {
+			for _, id := range option.runes {
+				next = append(next, append(slices.Clone(combination), id))
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
+
+func (ro *runeOptimizer) requestFor(options []runeSlotOptions, runes []int32) *proto.RaidSimRequest {
+	request := googleProto.Clone(ro.baseRequest).(*proto.RaidSimRequest)
+	equipment := request.Raid.Parties[ro.partyIdx].Players[ro.playerIdx].Equipment
+	for i, option := range options {
+		equipment.Items[option.slot].Rune = runes[i]
+	}
+	return request
+}
+
+func (ro *runeOptimizer) loadoutToProto(options []runeSlotOptions, loadout *runeLoadout, equipped *runeLoadout) *proto.RuneLoadout {
+	delta, halfWidth := 0.0, 0.0
+	if loadout != equipped {
+		delta, halfWidth = compareRaceCandidates(loadout.race, equipped.race)
+	}
+	result := &proto.RuneLoadout{
+		Dps:            loadout.race.Mean(),
+		DpsDelta:       delta,
+		DpsDeltaCiLow:  delta - halfWidth,
+		DpsDeltaCiHigh: delta + halfWidth,
+	}
+	for i, option := range options {
+		result.Runes = append(result.Runes, &proto.SlotRune{
+			Slot:   option.slot,
+			RuneId: loadout.runes[i],
+			Name:   RunesByID[loadout.runes[i]].Name,
+		})
+	}
+	return result
+}
@@ -0,0 +1,84 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/wowsims/sod/sim/core/proto"
+)
+
+func TestRuneOptimizer(t *testing.T) {
+	runeDps := map[int32]float64{
+		int32(proto.ShamanRune_RuneChestOverload):      10,
+		int32(proto.ShamanRune_RuneChestDualWieldSpec): 0,
+		int32(proto.ShamanRune_RuneHandsLavaBurst):     20,
+		int32(proto.ShamanRune_RuneHandsLavaLash):      5,
+	}
+	newRune := func(id int32, class proto.Class, itemType proto.ItemType, requiresLevel int32) *proto.SimRune {
+		return &proto.SimRune{Id: id, Class: class, Type: itemType, RequiresLevel: requiresLevel}
+	}
+	useTestDatabase(t, &proto.SimDatabase{
+		Items: []*proto.SimItem{
+			{Id: 21, Type: proto.ItemType_ItemTypeChest},
+			{Id: 22, Type: proto.ItemType_ItemTypeHands},
+		},
+		Runes: []*proto.SimRune{
+			newRune(int32(proto.ShamanRune_RuneChestOverload), proto.Class_ClassShaman, proto.ItemType_ItemTypeChest, 1),
+			newRune(int32(proto.ShamanRune_RuneChestDualWieldSpec), proto.Class_ClassShaman, proto.ItemType_ItemTypeChest, 1),
+			newRune(int32(proto.ShamanRune_RuneHandsLavaBurst), proto.Class_ClassShaman, proto.ItemType_ItemTypeHands, 1),
+			newRune(int32(proto.ShamanRune_RuneHandsLavaLash), proto.Class_ClassShaman, proto.ItemType_ItemTypeHands, 1),
+			// Runes the player can't engrave.
+			newRune(int32(proto.ShamanRune_RuneChestShieldMastery), proto.Class_ClassShaman, proto.ItemType_ItemTypeChest, 61),
+			newRune(int32(proto.WarriorRune_RuneFlagellation), proto.Class_ClassWarrior, proto.ItemType_ItemTypeChest, 1),
+		},
+	})
+
+	rsr := fakeCasterRaidSimRequest()
+	rsr.Raid.Parties[0].Players[0].Equipment = createEquipmentFromItems(
+		&itemWithSlot{Slot: proto.ItemSlot_ItemSlotChest, Item: &proto.ItemSpec{Id: 21, Rune: int32(proto.ShamanRune_RuneChestDualWieldSpec)}},
+		&itemWithSlot{Slot: proto.ItemSlot_ItemSlotHands, Item: &proto.ItemSpec{Id: 22, Rune: int32(proto.ShamanRune_RuneHandsLavaLash)}},
+	)
+
+	optimizer := &runeOptimizer{
+		SingleRaidSimRunner: func(rsr *proto.RaidSimRequest, _ chan *proto.ProgressMetrics, _ bool) *proto.RaidSimResult {
+			dps := 0.0
+			for _, spec := range rsr.Raid.Parties[0].Players[0].Equipment.Items {
+				dps += runeDps[spec.Rune]
+			}
+			return fakeBulkSimResult(rsr, dps)
+		},
+		Request: &proto.RuneOptimizerRequest{
+			BaseSettings: rsr,
+			Settings: &proto.RuneOptimizerSettings{
+				NumResults:    3,
+				MinIterations: 20,
+				MaxIterations: 80,
+			},
+		},
+	}
+	result, err := optimizer.Run(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Rune optimizer failed with error: %v", err)
+	}
+	if result.LoadoutsSimmed != 4 || len(result.Loadouts) != 3 || result.Equipped.Dps != 5 {
+		t.Fatalf("Expected 3 of 4 loadouts over 5 dps, got %d of %d over %.3f dps", len(result.Loadouts), result.LoadoutsSimmed, result.Equipped.Dps)
+	}
+
+	expected := []struct {
+		chest, hands proto.ShamanRune
+		dpsDelta     float64
+	}{
+		{proto.ShamanRune_RuneChestOverload, proto.ShamanRune_RuneHandsLavaBurst, 25},
+		{proto.ShamanRune_RuneChestDualWieldSpec, proto.ShamanRune_RuneHandsLavaBurst, 15},
+		{proto.ShamanRune_RuneChestOverload, proto.ShamanRune_RuneHandsLavaLash, 10},
+	}
+	for i, loadout := range result.Loadouts {
+		runes := loadout.Runes
+		if len(runes) != 2 || runes[0].Slot != proto.ItemSlot_ItemSlotChest || runes[1].Slot != proto.ItemSlot_ItemSlotHands {
+			t.Fatalf("Unexpected runes %v", runes)
+		}
+		if want := expected[i]; runes[0].RuneId != int32(want.chest) || runes[1].RuneId != int32(want.hands) || loadout.DpsDelta != want.dpsDelta {
+			t.Errorf("Expected %s and %s for %.3f more dps as loadout %d, got %v for %.3f", want.chest, want.hands, want.dpsDelta, i, runes, loadout.DpsDelta)
+		}
+	}
+}
@@ -41,9 +41,13 @@ type Simulation struct {
 
 	Log func(string, ...interface{})
 
+	// Records structured events of the first iteration if SimOptions.CombatLog is set, nil otherwise.
+	CombatLog *CombatLog
+
 	executePhase int32 // 20, 25, or 35 for the respective execute range, 100 otherwise
 
 	executePhaseCallbacks []func(*Simulation, int32) // 2nd parameter is 35 for 35%, 25 for 25% and 20 for 20%
+	executePhaseStarts    [3]time.Duration           // Start times of the phases in executePhaseThresholds.
 
 	nextExecuteDuration time.Duration
 	nextExecuteDamage   float64
@@ -51,6 +55,8 @@ type Simulation struct {
 	endOfCombatDuration time.Duration
 	endOfCombatDamage   float64
 
+	nextManaTick time.Duration
+
 	minTrackerTime time.Duration
 	trackers       []*auraTracker
 
@@ -108,7 +114,12 @@ func RunSim(rsr *proto.RaidSimRequest, progress chan *proto.ProgressMetrics) *pr
 	return runSim(rsr, progress, false)
 }
 
-func runSim(rsr *proto.RaidSimRequest, progress chan *proto.ProgressMetrics, skipPresim bool) (result *proto.RaidSimResult) {
+func runSim(rsr *proto.RaidSimRequest, progress chan *proto.ProgressMetrics, skipPresim bool) *proto.RaidSimResult {
+	return runSimWithExclusions(rsr, progress, skipPresim, simExclusions{})
+}
+
+// Like runSim, but with parts of the raid left out. Used by buff attribution.
+func runSimWithExclusions(rsr *proto.RaidSimRequest, progress chan *proto.ProgressMetrics, skipPresim bool, exclusions simExclusions) (result *proto.RaidSimResult) {
 	if !rsr.SimOptions.IsTest {
 		defer func() {
 			if err := recover(); err != nil {
@@ -136,8 +147,9 @@ func runSim(rsr *proto.RaidSimRequest, progress chan *proto.ProgressMetrics, ski
 		}()
 	}
 
-	sim := NewSim(rsr)
+	sim := newSim(rsr, exclusions)
 
+	var presimResults []*proto.RaidSimResult
 	if !skipPresim {
 		if progress != nil {
 			progress <- &proto.ProgressMetrics{
@@ -146,7 +158,11 @@ func runSim(rsr *proto.RaidSimRequest, progress chan *proto.ProgressMetrics, ski
 			}
 			runtime.Gosched() // allow time for message to make it back out.
 		}
-		presimResult := sim.runPresims(rsr)
+		presimResult := sim.runPresims(rsr, func(presimRequest *proto.RaidSimRequest) *proto.RaidSimResult {
+			presimResult := runSimWithExclusions(presimRequest, nil, true, exclusions)
+			presimResults = append(presimResults, presimResult)
+			return presimResult
+		})
 		if presimResult != nil && presimResult.ErrorResult != "" {
 			if progress != nil {
 				progress <- &proto.ProgressMetrics{
@@ -175,13 +191,21 @@ func runSim(rsr *proto.RaidSimRequest, progress chan *proto.ProgressMetrics, ski
 	}
 
 	// using a variable here allows us to mutate it in the deferred recover, sending out error info
-	result = sim.run()
+	if sim.Options.ReplaySeed != 0 {
+		result = sim.replay(rsr, presimResults)
+	} else {
+		result = sim.run(rsr, presimResults)
+	}
 
 	return result
 }
 
 func NewSim(rsr *proto.RaidSimRequest) *Simulation {
-	env, _, _ := NewEnvironment(rsr.Raid, rsr.Encounter, false)
+	return newSim(rsr, simExclusions{})
+}
+
+func newSim(rsr *proto.RaidSimRequest, exclusions simExclusions) *Simulation {
+	env, _, _ := newEnvironment(rsr.Raid, rsr.Encounter, false, exclusions)
 	return newSimWithEnv(env, rsr.SimOptions)
 }
 
@@ -191,6 +215,12 @@ func newSimWithEnv(env *Environment, simOptions *proto.SimOptions) *Simulation {
 		rseed = time.Now().UnixNano()
 	}
 
+	if simOptions.TimelineMetrics {
+		for _, unit := range env.AllUnits {
+			unit.Metrics.timeline = newTimelineMetrics()
+		}
+	}
+
 	return &Simulation{
 		Environment: env,
 		Options:     simOptions,
@@ -275,73 +305,182 @@ func (sim *Simulation) Reseed(seed int64) {
 }
 
 // Run runs the simulation for the configured number of iterations, and
-// collects all the metrics together.
-func (sim *Simulation) run() *proto.RaidSimResult {
+// collects all the metrics together. In target precision mode the iterations are simmed in
+// batches, until the DPS is precise enough.
+func (sim *Simulation) run(rsr *proto.RaidSimRequest, presimResults []*proto.RaidSimResult) *proto.RaidSimResult {
 	t0 := time.Now()
 
-	logsBuffer := &strings.Builder{}
-	if sim.Options.Debug || sim.Options.DebugFirstIteration {
-		sim.Log = func(message string, vals ...interface{}) {
-			logsBuffer.WriteString(fmt.Sprintf("[%0.2f] "+message+"\n", append([]interface{}{sim.CurrentTime.Seconds()}, vals...)...))
+	var st time.Time
+	reportProgress := func(completed int32) {
+		if sim.ProgressReport != nil && time.Since(st) > time.Millisecond*100 {
+			metrics := sim.Raid.GetMetrics()
+			sim.ProgressReport(&proto.ProgressMetrics{TotalIterations: sim.Options.Iterations, CompletedIterations: completed, Dps: metrics.Dps.Avg, Hps: metrics.Hps.Avg})
+			runtime.Gosched() // ensure that reporting threads are given time to report, mostly only important in wasm (only 1 thread)
+			st = time.Now()
+		}
+	}
+
+	var results iterationsResult
+	var end int32
+	for start := int32(0); start < sim.Options.Iterations && !sim.isPreciseEnough(); start = end {
+		end = sim.nextBatchEnd(start)
+		if numShards := sim.numShards(end - start); numShards > 1 {
+			results.append(sim.runShards(rsr, start, end, numShards, presimResults))
+		} else {
+			results.append(sim.runIterations(start, end, reportProgress))
 		}
 	}
 
+	result := &proto.RaidSimResult{
+		RaidMetrics:      sim.Raid.GetMetrics(),
+		EncounterMetrics: sim.Encounter.GetMetricsProto(),
+
+		Logs:                   results.logs,
+		CombatLog:              results.combatLog,
+		FirstIterationDuration: results.firstIterationDuration.Seconds(),
+		AvgIterationDuration:   results.totalDuration.Seconds() / float64(end),
+		Iterations:             end,
+	}
+
+	// Final progress report
+	if sim.ProgressReport != nil {
+		sim.ProgressReport(&proto.ProgressMetrics{TotalIterations: end, CompletedIterations: end, Dps: result.RaidMetrics.Dps.Avg, FinalRaidResult: result})
+	}
+
+	if end > 3000 {
+		log.Printf("running %d iterations took %s", end, time.Since(t0))
+	}
+
+	return result
+}
+
+// Logs and durations of a range of simmed iterations.
+type iterationsResult struct {
+	logs      string
+	combatLog []*proto.CombatLogEvent
+
+	firstIterationDuration time.Duration
+	totalDuration          time.Duration
+	numIterations          int32
+}
+
+// Appends the result for the iterations right after those of ir.
+func (ir *iterationsResult) append(other iterationsResult) {
+	if ir.numIterations == 0 {
+		ir.firstIterationDuration = other.firstIterationDuration
+	}
+	ir.logs += other.logs
+	ir.combatLog = append(ir.combatLog, other.combatLog...)
+	ir.totalDuration += other.totalDuration
+	ir.numIterations += other.numIterations
+}
+
+// Runs the iterations from start (inclusive) to end (exclusive). Only the combat log of
+// iteration 0 is recorded, if it is part of the range.
+// reportProgress is called before each iteration but the first, with the number of iterations
+// completed so far.
+func (sim *Simulation) runIterations(start int32, end int32, reportProgress func(completed int32)) iterationsResult {
+	logsBuffer := &strings.Builder{}
+	if sim.Options.Debug || (sim.Options.DebugFirstIteration && start == 0) {
+		sim.Log = sim.newBufferedLog(logsBuffer)
+	}
+
+	var combatLog *CombatLog
+	if sim.Options.CombatLog && start == 0 {
+		combatLog = newCombatLog(sim.Environment)
+		sim.CombatLog = combatLog
+	}
+
 	// Uncomment this to print logs directly to console.
 	// sim.Options.Debug = true
 	// sim.Log = func(message string, vals ...interface{}) {
 	// 	fmt.Printf(fmt.Sprintf("[%0.1f] "+message+"\n", append([]interface{}{sim.CurrentTime.Seconds()}, vals...)...))
 	// }
 
-	sim.runOnce()
-	firstIterationDuration := sim.Duration
-	if sim.Encounter.EndFightAtHealth != 0 {
-		firstIterationDuration = sim.CurrentTime
-	}
-	totalDuration := firstIterationDuration
-
-	if !sim.Options.Debug {
-		sim.Log = nil
-	}
-
-	var st time.Time
-	for i := int32(1); i < sim.Options.Iterations; i++ {
+	result := iterationsResult{numIterations: end - start}
+	for i := start; i < end; i++ {
 		// fmt.Printf("Iteration: %d\n", i)
-		if sim.ProgressReport != nil && time.Since(st) > time.Millisecond*100 {
-			metrics := sim.Raid.GetMetrics()
-			sim.ProgressReport(&proto.ProgressMetrics{TotalIterations: sim.Options.Iterations, CompletedIterations: i, Dps: metrics.Dps.Avg, Hps: metrics.Hps.Avg})
-			runtime.Gosched() // ensure that reporting threads are given time to report, mostly only important in wasm (only 1 thread)
-			st = time.Now()
+		if i > start {
+			reportProgress(i)
 		}
 
 		// Before each iteration, reset state to seed+iterations
-		sim.reseedRands(int64(i))
+		if i > 0 {
+			sim.reseedRands(int64(i))
+		}
 
 		sim.runOnce()
-		iterDuration := sim.Duration
-		if sim.Encounter.EndFightAtHealth != 0 {
-			iterDuration = sim.CurrentTime
+		iterDuration := sim.iterationDuration()
+		result.totalDuration += iterDuration
+
+		if i == start {
+			result.firstIterationDuration = iterDuration
+			if !sim.Options.Debug {
+				sim.Log = nil
+			}
+			sim.CombatLog = nil
 		}
-		totalDuration += iterDuration
 	}
+
+	result.logs = logsBuffer.String()
+	if combatLog != nil {
+		result.combatLog = combatLog.Events
+	}
+	return result
+}
+
+// Replays the single iteration that was simmed with Options.ReplaySeed, with debug logs and the
+// combat log enabled.
+func (sim *Simulation) replay(rsr *proto.RaidSimRequest, presimResults []*proto.RaidSimResult) *proto.RaidSimResult {
+	seed := sim.Options.ReplaySeed
+	if sim.Encounter.DurationIsEstimate && seed != sim.rseed {
+		// All iterations after the first one use its duration as estimate for the fight length,
+		// so it has to be simmed before any other iteration can be replayed.
+		estimateSim := sim.newShardSim(rsr, presimResults)
+		estimateSim.runIterations(0, 1, func(_ int32) {})
+		sim.BaseDuration = estimateSim.CurrentTime
+		sim.Encounter.DurationIsEstimate = false
+	}
+
+	logsBuffer := &strings.Builder{}
+	sim.Log = sim.newBufferedLog(logsBuffer)
+	sim.CombatLog = newCombatLog(sim.Environment)
+
+	sim.reseedRands(seed - sim.Options.RandomSeed)
+	sim.runOnce()
+	iterDuration := sim.iterationDuration()
+
 	result := &proto.RaidSimResult{
 		RaidMetrics:      sim.Raid.GetMetrics(),
 		EncounterMetrics: sim.Encounter.GetMetricsProto(),
 
 		Logs:                   logsBuffer.String(),
-		FirstIterationDuration: firstIterationDuration.Seconds(),
-		AvgIterationDuration:   totalDuration.Seconds() / float64(sim.Options.Iterations),
+		CombatLog:              sim.CombatLog.Events,
+		FirstIterationDuration: iterDuration.Seconds(),
+		AvgIterationDuration:   iterDuration.Seconds(),
+		Iterations:             1,
 	}
+	sim.Log = nil
+	sim.CombatLog = nil
 
-	// Final progress report
 	if sim.ProgressReport != nil {
-		sim.ProgressReport(&proto.ProgressMetrics{TotalIterations: sim.Options.Iterations, CompletedIterations: sim.Options.Iterations, Dps: result.RaidMetrics.Dps.Avg, FinalRaidResult: result})
+		sim.ProgressReport(&proto.ProgressMetrics{TotalIterations: 1, CompletedIterations: 1, Dps: result.RaidMetrics.Dps.Avg, FinalRaidResult: result})
 	}
+	return result
+}
 
-	if d := sim.Options.Iterations; d > 3000 {
-		log.Printf("running %d iterations took %s", d, time.Since(t0))
+func (sim *Simulation) newBufferedLog(logsBuffer *strings.Builder) func(string, ...interface{}) {
+	return func(message string, vals ...interface{}) {
+		logsBuffer.WriteString(fmt.Sprintf("[%0.2f] "+message+"\n", append([]interface{}{sim.CurrentTime.Seconds()}, vals...)...))
 	}
+}
 
-	return result
+// Length of the iteration that just finished.
+func (sim *Simulation) iterationDuration() time.Duration {
+	if sim.Encounter.EndFightAtHealth != 0 {
+		return sim.CurrentTime
+	}
+	return sim.Duration
 }
 
 // RunOnce is the main event loop. It will run the simulation for number of seconds.
@@ -385,6 +524,7 @@ func (sim *Simulation) reset() {
 	sim.executePhase = 0
 	sim.nextExecutePhase()
 	sim.executePhaseCallbacks = nil
+	sim.executePhaseStarts = [3]time.Duration{NeverExpires, NeverExpires, NeverExpires}
 
 	// Use duration as an end check if not using health.
 	sim.endOfCombatDuration = sim.Duration
@@ -408,6 +548,9 @@ func (sim *Simulation) reset() {
 	sim.Environment.reset(sim)
 
 	sim.initManaTickAction()
+	if sim.Options.TimelineMetrics {
+		sim.initTimelineSampleAction()
+	}
 }
 
 func (sim *Simulation) PrePull() {
@@ -539,6 +682,7 @@ func (sim *Simulation) advance(nextTime time.Duration) {
 	// execute phases 35%, 25%, and 20% in the first advance() call.
 	for sim.CurrentTime >= sim.nextExecuteDuration || sim.Encounter.DamageTaken >= sim.nextExecuteDamage {
 		sim.nextExecutePhase()
+		sim.executePhaseStarts[slices.Index(executePhaseThresholds[:], sim.executePhase)] = max(sim.CurrentTime, 0)
 		for _, callback := range sim.executePhaseCallbacks {
 			callback(sim, sim.executePhase)
 		}
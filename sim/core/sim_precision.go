@@ -0,0 +1,61 @@
+package core
+
+import (
+	"math"
+
+	"github.com/wowsims/sod/sim/core/proto"
+)
+
+// Number of iterations simmed before the precision is checked for the first time.
+const precisionFirstBatchIterations = 1000
+
+// Minimum number of iterations in every later batch.
+const precisionMinBatchIterations = 500
+
+func hasPrecisionTarget(options *proto.SimOptions) bool {
+	return options.TargetDpsStderr > 0 || options.TargetRelativeDpsStderr > 0
+}
+
+// Returns the end of the next batch of iterations starting at start. Without a precision
+// target, that's simply all iterations.
+func (sim *Simulation) nextBatchEnd(start int32) int32 {
+	if !hasPrecisionTarget(sim.Options) {
+		return sim.Options.Iterations
+	}
+	if start == 0 {
+		return min(precisionFirstBatchIterations, sim.Options.Iterations)
+	}
+
+	// The standard error shrinks with the square root of the iterations, which gives a good
+	// estimate of how many are needed in total.
+	stderr, target := sim.dpsStdErrAndTarget()
+	needed := float64(start) * (stderr / target) * (stderr / target) * 1.05
+	return int32(min(max(needed, float64(start+precisionMinBatchIterations)), float64(sim.Options.Iterations)))
+}
+
+// Returns whether the iterations simmed so far already meet the precision target.
+func (sim *Simulation) isPreciseEnough() bool {
+	if !hasPrecisionTarget(sim.Options) || sim.Raid.dpsMetrics.n < 2 {
+		return false
+	}
+	stderr, target := sim.dpsStdErrAndTarget()
+	return stderr <= target
+}
+
+// Returns the current standard error of the raid DPS, along with the strictest target for it.
+func (sim *Simulation) dpsStdErrAndTarget() (float64, float64) {
+	return stdErrAndTarget(sim.Options, &sim.Raid.dpsMetrics.aggregator)
+}
+
+// Returns the standard error of the DPS values, along with the strictest target of the options
+// for it.
+func stdErrAndTarget(options *proto.SimOptions, dps *aggregator) (float64, float64) {
+	target := math.Inf(1)
+	if options.TargetDpsStderr > 0 {
+		target = options.TargetDpsStderr
+	}
+	if options.TargetRelativeDpsStderr > 0 {
+		target = min(target, options.TargetRelativeDpsStderr*dps.sum/float64(dps.n))
+	}
+	return dps.stdErr(), target
+}
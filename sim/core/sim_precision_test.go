@@ -0,0 +1,32 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestTargetPrecision(t *testing.T) {
+	simWithTarget := func(target float64) (int32, float64, float64) {
+		rsr := fakeCasterRaidSimRequest()
+		rsr.SimOptions.Iterations = 20000
+		rsr.SimOptions.TargetRelativeDpsStderr = target
+		result := RunRaidSim(rsr)
+		if result.ErrorResult != "" {
+			t.Fatalf("Sim failed with error: %s", result.ErrorResult)
+		}
+		return result.Iterations, result.RaidMetrics.Dps.Stderr, result.RaidMetrics.Dps.Avg
+	}
+
+	// A loose target is met by the first batch already.
+	if iterations, _, _ := simWithTarget(0.01); iterations != precisionFirstBatchIterations {
+		t.Errorf("Expected the sim to stop after the first batch, ran %d iterations", iterations)
+	}
+
+	// A strict one takes more batches, but still less than all iterations.
+	iterations, stderr, dps := simWithTarget(0.0002)
+	if iterations <= precisionFirstBatchIterations || iterations >= 20000 {
+		t.Fatalf("Expected the sim to stop between the first batch and all iterations, ran %d iterations", iterations)
+	}
+	if stderr > dps*0.0002 {
+		t.Fatalf("Stderr %.4f is above the target for %.3f dps after %d iterations", stderr, dps, iterations)
+	}
+}
@@ -0,0 +1,178 @@
+package core
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wowsims/sod/sim/core/proto"
+)
+
+// Iterations of a sim are only split into shards when each shard gets at least this many.
+const minIterationsPerShard = 500
+
+// Upper limit on the number of shards, so large sims don't build too many environments.
+const maxSimShards = 16
+
+// A contiguous range of iterations, simmed on its own copy of the environment.
+type simShard struct {
+	start int32
+	end   int32
+
+	sim  *Simulation
+	done bool
+
+	result iterationsResult
+
+	// Raid DPS and HPS of the iterations completed so far, for progress reports.
+	progressDps aggregator
+	progressHps aggregator
+}
+
+// Returns the number of shards a batch of iterations of this sim is split into. The layout only
+// depends on the number of iterations and not on the number of workers, so results for a
+// fixed seed are the same no matter how many goroutines are used.
+func (sim *Simulation) numShards(iterations int32) int {
+	// Test sims use a separate random stream for each label, which is seeded lazily and so
+	// depends on the earlier iterations. Interactive sims wait for input after each action.
+	if sim.Options.IsTest || sim.Options.Interactive || sim.Encounter.DurationIsEstimate {
+		return 1
+	}
+	return max(1, min(int(iterations/minIterationsPerShard), maxSimShards))
+}
+
+// Runs the iterations from start to end split into numShards shards, spread across
+// Options.Concurrency workers, and merges their metrics in order. The first shard is simmed on
+// sim itself, the others each get a new copy of the environment, with the results of
+// presimResults replayed onto it.
+func (sim *Simulation) runShards(rsr *proto.RaidSimRequest, start int32, end int32, numShards int, presimResults []*proto.RaidSimResult) iterationsResult {
+	iterations := end - start
+
+	shards := make([]*simShard, numShards)
+	for i := range shards {
+		shards[i] = &simShard{
+			start: start + int32(int64(iterations)*int64(i)/int64(numShards)),
+			end:   start + int32(int64(iterations)*int64(i+1)/int64(numShards)),
+		}
+	}
+	shards[0].sim = sim
+
+	concurrency := int(sim.Options.Concurrency)
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+
+	var progressLock sync.Mutex
+	var st time.Time
+	reportProgress := func(shard *simShard) {
+		if sim.ProgressReport == nil {
+			return
+		}
+		progressLock.Lock()
+		defer progressLock.Unlock()
+
+		shard.progressDps = shard.sim.Raid.dpsMetrics.aggregator
+		shard.progressHps = shard.sim.Raid.hpsMetrics.aggregator
+		if time.Since(st) > time.Millisecond*100 {
+			var dps, hps aggregator
+			for _, other := range shards {
+				dps = *dps.merge(&other.progressDps)
+				hps = *hps.merge(&other.progressHps)
+			}
+			dpsAvg, _ := dps.meanAndStdDev()
+			hpsAvg, _ := hps.meanAndStdDev()
+			sim.ProgressReport(&proto.ProgressMetrics{TotalIterations: sim.Options.Iterations, CompletedIterations: int32(dps.n), Dps: dpsAvg, Hps: hpsAvg})
+			runtime.Gosched()
+			st = time.Now()
+		}
+	}
+
+	// Shards are merged into sim in order as soon as all earlier ones are merged, so their
+	// environments can be dropped early.
+	var mergeLock sync.Mutex
+	mergedShards := 0
+	mergeDoneShards := func(shard *simShard) {
+		mergeLock.Lock()
+		defer mergeLock.Unlock()
+
+		shard.done = true
+		for mergedShards < numShards && shards[mergedShards].done {
+			if merged := shards[mergedShards]; merged.sim != sim {
+				sim.Raid.mergeMetrics(merged.sim.Raid)
+				sim.Encounter.mergeMetrics(&merged.sim.Encounter)
+				merged.sim = nil
+			}
+			mergedShards++
+		}
+	}
+
+	var nextShard int32 = -1
+	var failed atomic.Bool
+	var errStr string
+	var waitGroup sync.WaitGroup
+	for w := 0; w < min(concurrency, numShards); w++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			defer func() {
+				if err := recover(); err != nil {
+					if !failed.Swap(true) {
+						errStr = fmt.Sprintf("%v\nStack Trace:\n%s", err, string(debug.Stack()))
+					}
+				}
+			}()
+
+			for !failed.Load() {
+				idx := int(atomic.AddInt32(&nextShard, 1))
+				if idx >= numShards {
+					return
+				}
+				shard := shards[idx]
+				if shard.sim == nil {
+					shard.sim = sim.newShardSim(rsr, presimResults)
+				}
+
+				shard.result = shard.sim.runIterations(shard.start, shard.end, func(_ int32) {
+					reportProgress(shard)
+				})
+				reportProgress(shard)
+				mergeDoneShards(shard)
+			}
+		}()
+	}
+	waitGroup.Wait()
+
+	if failed.Load() {
+		// Rethrown on the calling goroutine, so runSim turns it into an error result.
+		panic(errStr)
+	}
+
+	var result iterationsResult
+	for _, shard := range shards {
+		result.append(shard.result)
+	}
+	return result
+}
+
+// Creates another copy of the environment for simming a shard, in the same state as sim is
+// after running its presims.
+func (sim *Simulation) newShardSim(rsr *proto.RaidSimRequest, presimResults []*proto.RaidSimResult) *Simulation {
+	shardSim := newSim(rsr, sim.exclusions)
+
+	if len(presimResults) > 0 {
+		round := 0
+		shardSim.runPresims(rsr, func(_ *proto.RaidSimRequest) *proto.RaidSimResult {
+			round++
+			return presimResults[round-1]
+		})
+	}
+
+	shardSim.BaseDuration = sim.BaseDuration
+	shardSim.Duration = sim.Duration
+	shardSim.Encounter.DurationIsEstimate = sim.Encounter.DurationIsEstimate
+
+	return shardSim
+}
@@ -0,0 +1,47 @@
+package core
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/wowsims/sod/sim/core/proto"
+	googleProto "google.golang.org/protobuf/proto"
+)
+
+func TestShardedRaidSim(t *testing.T) {
+	rsr := fakeCasterRaidSimRequest()
+	rsr.SimOptions.Iterations = 2000
+	if numShards := NewSim(rsr).numShards(rsr.SimOptions.Iterations); numShards != 4 {
+		t.Fatalf("Expected 4 shards, got %d", numShards)
+	}
+
+	simWithConcurrency := func(concurrency int32) *proto.RaidSimResult {
+		request := googleProto.Clone(rsr).(*proto.RaidSimRequest)
+		request.SimOptions.Concurrency = concurrency
+		result := RunRaidSim(request)
+		if result.ErrorResult != "" {
+			t.Fatalf("Sim failed with error: %s", result.ErrorResult)
+		}
+
+		// Action metrics are collected from a map, so their order is random.
+		for _, party := range result.RaidMetrics.Parties {
+			for _, player := range party.Players {
+				slices.SortFunc(player.Actions, func(a, b *proto.ActionMetrics) int {
+					return strings.Compare(a.Id.String(), b.Id.String())
+				})
+			}
+		}
+		return result
+	}
+
+	// The shards are the same no matter how many workers sim them, so are the merged results.
+	single := simWithConcurrency(1)
+	sharded := simWithConcurrency(4)
+	if !googleProto.Equal(single, sharded) {
+		t.Fatalf("Sharded sim results differ: %.6f dps on one worker, %.6f dps on four", single.RaidMetrics.Dps.Avg, sharded.RaidMetrics.Dps.Avg)
+	}
+	if single.Iterations != rsr.SimOptions.Iterations || single.RaidMetrics.Parties[0].Players[0].Dps.Avg == 0 {
+		t.Fatalf("Expected %d iterations with nonzero DPS, got %d iterations at %.3f dps", rsr.SimOptions.Iterations, single.Iterations, single.RaidMetrics.Parties[0].Players[0].Dps.Avg)
+	}
+}
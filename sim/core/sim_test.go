@@ -0,0 +1,41 @@
+package core
+
+import (
+	"math"
+	"testing"
+
+	"github.com/wowsims/sod/sim/core/proto"
+	googleProto "google.golang.org/protobuf/proto"
+)
+
+func TestReplaySeed(t *testing.T) {
+	rsr := fakeCasterRaidSimRequest()
+	result := RunRaidSim(rsr)
+	if result.ErrorResult != "" {
+		t.Fatalf("Sim failed with error: %s", result.ErrorResult)
+	}
+	dps := result.RaidMetrics.Parties[0].Players[0].Dps
+	if dps.Min == dps.Max {
+		t.Fatalf("Expected iterations with different DPS, got %.3f in all of them", dps.Min)
+	}
+
+	replayDps := func(seed int64) float64 {
+		request := googleProto.Clone(rsr).(*proto.RaidSimRequest)
+		request.SimOptions.ReplaySeed = seed
+		replay := RunRaidSim(request)
+		if replay.ErrorResult != "" {
+			t.Fatalf("Replay failed with error: %s", replay.ErrorResult)
+		}
+		if replay.Iterations != 1 || replay.Logs == "" || len(replay.CombatLog) == 0 {
+			t.Fatalf("Expected logs and combat log for a single replayed iteration, got %d iterations", replay.Iterations)
+		}
+		return replay.RaidMetrics.Parties[0].Players[0].Dps.Avg
+	}
+
+	if got := replayDps(dps.MaxSeed); math.Abs(got-dps.Max) > 1e-6 {
+		t.Fatalf("Replay of max seed %d gave %.3f dps, expected %.3f", dps.MaxSeed, got, dps.Max)
+	}
+	if got := replayDps(dps.MinSeed); math.Abs(got-dps.Min) > 1e-6 {
+		t.Fatalf("Replay of min seed %d gave %.3f dps, expected %.3f", dps.MinSeed, got, dps.Min)
+	}
+}
@@ -559,6 +559,9 @@ func (spell *Spell) SkipCastAndApplyEffects(sim *Simulation, target *Unit) {
 func (spell *Spell) applyEffects(sim *Simulation, target *Unit) {
 	spell.SpellMetrics[target.UnitIndex].Casts++
 	spell.casts++
+	if spell.Flags.Matches(SpellFlagMCD) && spell.Unit.Metrics.timeline != nil {
+		spell.Unit.Metrics.timeline.addCooldownUse(sim, spell.ActionID)
+	}
 
 	spell.ApplyEffects(sim, target, spell)
 }
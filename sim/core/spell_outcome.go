@@ -179,6 +179,66 @@ func (spell *Spell) OutcomeMeleeWhite(sim *Simulation, result *SpellResult, atta
 	}
 }
 
+// Chances of each outcome of a white attack, as rolled by OutcomeMeleeWhite or
+// OutcomeRangedHitAndCrit. Hit is the chance of a normal hit.
+type WhiteAttackChances struct {
+	Miss   float64
+	Dodge  float64
+	Parry  float64
+	Glance float64
+	Block  float64
+	Crit   float64
+	Hit    float64
+}
+
+// Chance for the attack to land, i.e. not be missed, dodged or parried.
+func (chances WhiteAttackChances) Landed() float64 {
+	return 1 - chances.Miss - chances.Dodge - chances.Parry
+}
+
+func (spell *Spell) MeleeWhiteChances(attackTable *AttackTable) WhiteAttackChances {
+	var chances WhiteAttackChances
+	remaining := 1.0
+	// Entries are checked in order against a single roll, so each can only take what is left.
+	take := func(chance float64) float64 {
+		chance = max(0, min(chance, remaining))
+		remaining -= chance
+		return chance
+	}
+
+	missChance := attackTable.BaseMissChance - spell.PhysicalHitChance(attackTable)
+	if spell.Unit.AutoAttacks.IsDualWielding && !spell.Unit.PseudoStats.DisableDWMissPenalty {
+		missChance += 0.19
+	}
+	chances.Miss = take(missChance)
+	if !spell.Flags.Matches(SpellFlagCannotBeDodged) {
+		chances.Dodge = take(attackTable.BaseDodgeChance - spell.ExpertisePercentage() - spell.Unit.PseudoStats.DodgeReduction)
+	}
+	if spell.Unit.PseudoStats.InFrontOfTarget {
+		chances.Parry = take(attackTable.BaseParryChance - spell.ExpertisePercentage())
+	}
+	chances.Glance = take(attackTable.BaseGlanceChance)
+	if spell.Unit.PseudoStats.InFrontOfTarget {
+		chances.Block = take(attackTable.BaseBlockChance)
+	}
+	chances.Crit = take(spell.PhysicalCritChance(attackTable))
+	chances.Hit = remaining
+	return chances
+}
+
+func (spell *Spell) RangedWhiteChances(attackTable *AttackTable) WhiteAttackChances {
+	var chances WhiteAttackChances
+	chances.Miss = max(0, min(attackTable.BaseMissChance-spell.PhysicalHitChance(attackTable), 1))
+	if spell.Unit.PseudoStats.InFrontOfTarget {
+		chances.Block = max(0, min(attackTable.BaseBlockChance, 1-chances.Miss))
+	}
+	// Crits use a separate roll, so they can also be blocked.
+	critChance := max(0, min(spell.PhysicalCritChance(attackTable), 1))
+	chances.Crit = (1 - chances.Miss) * critChance
+	chances.Hit = (1 - chances.Miss - chances.Block) * (1 - critChance)
+	return chances
+}
+
 func (spell *Spell) OutcomeMeleeSpecialHit(sim *Simulation, result *SpellResult, attackTable *AttackTable) {
 	unit := spell.Unit
 	roll := sim.RandomFloat("White Hit Table")
@@ -421,7 +481,9 @@ func (result *SpellResult) applyAttackTableBlock(spell *Spell, attackTable *Atta
 	if roll < *chance {
 		result.Outcome |= OutcomeBlock
 		spell.SpellMetrics[result.Target.UnitIndex].Blocks++
-		result.Damage = max(0, result.Damage-result.Target.BlockValue())
+		blockAmount := min(result.Damage, result.Target.BlockValue())
+		result.blockAmount = blockAmount
+		result.Damage -= blockAmount
 		return true
 	}
 	return false
@@ -461,7 +523,9 @@ func (result *SpellResult) applyAttackTableGlance(spell *Spell, attackTable *Att
 	if roll < *chance {
 		result.Outcome = OutcomeGlance
 		spell.SpellMetrics[result.Target.UnitIndex].Glances++
-		result.Damage *= attackTable.GlanceMultiplierMin + glanceRoll*(attackTable.GlanceMultiplierMax-attackTable.GlanceMultiplierMin)
+		glanceMultiplier := attackTable.GlanceMultiplierMin + glanceRoll*(attackTable.GlanceMultiplierMax-attackTable.GlanceMultiplierMin)
+		result.glanceDamageLost = result.Damage * (1 - glanceMultiplier)
+		result.Damage *= glanceMultiplier
 		return true
 	}
 	return false
@@ -541,7 +605,9 @@ func (result *SpellResult) applyEnemyAttackTableBlock(spell *Spell, attackTable
 	if roll < *chance {
 		result.Outcome |= OutcomeBlock
 		spell.SpellMetrics[result.Target.UnitIndex].Blocks++
-		result.Damage = max(0, result.Damage-result.Target.BlockValue())
+		blockAmount := min(result.Damage, result.Target.BlockValue())
+		result.blockAmount = blockAmount
+		result.Damage -= blockAmount
 		return true
 	}
 	return false
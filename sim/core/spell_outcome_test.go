@@ -0,0 +1,67 @@
+package core
+
+import (
+	"math"
+	"testing"
+
+	"github.com/wowsims/sod/sim/core/stats"
+)
+
+func TestMeleeWhiteChances(t *testing.T) {
+	attacker := &Unit{
+		Type:        PlayerUnit,
+		Level:       60,
+		PseudoStats: stats.NewPseudoStats(),
+	}
+	attacker.stats[stats.MeleeHit] = 2 * MeleeHitRatingPerHitChance
+	attacker.stats[stats.MeleeCrit] = 20 * CritRatingPerCritChance
+	attacker.AutoAttacks.IsDualWielding = true
+
+	defender := &Unit{
+		Type:        EnemyUnit,
+		Level:       63,
+		PseudoStats: stats.NewPseudoStats(),
+	}
+	spell := &Spell{Unit: attacker}
+	attackTable := NewAttackTable(attacker, defender, nil)
+
+	chances := spell.MeleeWhiteChances(attackTable)
+	expectChance := func(name string, got float64, want float64) {
+		if math.Abs(got-want) > 1e-9 {
+			t.Errorf("Unexpected %s chance %f, expected %f", name, got, want)
+		}
+	}
+
+	// 8% base miss against +3 levels, minus 1% unsuppressed hit, plus 19% for dual wielding.
+	expectChance("miss", chances.Miss, 0.08-0.01+0.19)
+	expectChance("dodge", chances.Dodge, 0.065)
+	expectChance("parry", chances.Parry, 0)
+	expectChance("glance", chances.Glance, 0.4)
+	expectChance("block", chances.Block, 0)
+	// 20% crit minus 3% skill based and 1.8% aura crit suppression against +3 levels.
+	expectChance("crit", chances.Crit, 0.2-0.03-0.018)
+	expectChance("hit", chances.Hit, 1-chances.Miss-chances.Dodge-chances.Glance-chances.Crit)
+	expectChance("landed", chances.Landed(), 1-chances.Miss-chances.Dodge)
+}
+
+func TestOutcomeDamage(t *testing.T) {
+	var od OutcomeDamage
+	od.addDamage(&SpellResult{Outcome: OutcomeHit, Damage: 100})
+	od.addDamage(&SpellResult{Outcome: OutcomeCrit | OutcomeBlock, Damage: 150, blockAmount: 30})
+	od.addDamage(&SpellResult{Outcome: OutcomeGlance, Damage: 70, glanceDamageLost: 30})
+	od.addDamage(&SpellResult{Outcome: OutcomeHit | OutcomePartial2_4, Damage: 50})
+	od.addDamage(&SpellResult{Outcome: OutcomeMiss})
+
+	if od.HitDamage != 150 || od.CritDamage != 150 {
+		t.Errorf("Unexpected hit damage %f and crit damage %f", od.HitDamage, od.CritDamage)
+	}
+	if od.BlockedDamage != 150 || od.BlockAmount != 30 {
+		t.Errorf("Unexpected blocked damage %f and block amount %f", od.BlockedDamage, od.BlockAmount)
+	}
+	if od.GlanceDamage != 70 || od.GlanceDamageLost != 30 {
+		t.Errorf("Unexpected glance damage %f and glance damage lost %f", od.GlanceDamage, od.GlanceDamageLost)
+	}
+	if od.PartialResists != [3]int32{0, 1, 0} || od.PartialResistDamage[1] != 50 {
+		t.Errorf("Unexpected partial resists %v with damage %v", od.PartialResists, od.PartialResistDamage)
+	}
+}
@@ -19,6 +19,9 @@ type SpellResult struct {
 	ResistanceMultiplier float64 // Partial Resists / Armor multiplier
 	PreOutcomeDamage     float64 // Damage done by this cast before Outcome is applied
 
+	blockAmount      float64 // Damage prevented by a block, added to the metrics with the damage.
+	glanceDamageLost float64 // Damage prevented by the glancing blow penalty.
+
 	inUse bool
 }
 
@@ -32,6 +35,8 @@ func (spell *Spell) NewResult(target *Unit) *SpellResult {
 	result.Damage = 0
 	result.Threat = 0
 	result.Outcome = OutcomeEmpty // for blocks
+	result.blockAmount = 0
+	result.glanceDamageLost = 0
 	result.inUse = true
 
 	return result
@@ -297,6 +302,13 @@ func (spell *Spell) dealDamageInternal(sim *Simulation, isPeriodic bool, result
 	if sim.CurrentTime >= 0 {
 		spell.SpellMetrics[result.Target.UnitIndex].TotalDamage += result.Damage
 		spell.SpellMetrics[result.Target.UnitIndex].TotalThreat += result.Threat
+		spell.SpellMetrics[result.Target.UnitIndex].OutcomeDamage.addDamage(result)
+		if spell.Unit.IsOpponent(result.Target) {
+			spell.Unit.Metrics.damageBreakdown.addDamage(sim, result.Damage)
+			if spell.Unit.Metrics.timeline != nil {
+				spell.Unit.Metrics.timeline.addDamage(sim, result.Damage)
+			}
+		}
 	}
 
 	// Mark total damage done in raid so far for health based fights.
@@ -312,6 +324,9 @@ func (spell *Spell) dealDamageInternal(sim *Simulation, isPeriodic bool, result
 			spell.Unit.Log(sim, "%s %s %s. (Threat: %0.3f)", result.Target.LogLabel(), spell.ActionID, result.DamageString(), result.Threat)
 		}
 	}
+	if sim.CombatLog != nil {
+		sim.CombatLog.spellResult(sim, spell, result, isPeriodic, false)
+	}
 
 	if !spell.Flags.Matches(SpellFlagNoOnDamageDealt) {
 		if isPeriodic {
@@ -398,6 +413,9 @@ func (spell *Spell) dealHealingInternal(sim *Simulation, isPeriodic bool, result
 			spell.Unit.Log(sim, "%s %s %s. (Threat: %0.3f)", result.Target.LogLabel(), spell.ActionID, result.HealingString(), result.Threat)
 		}
 	}
+	if sim.CombatLog != nil {
+		sim.CombatLog.spellResult(sim, spell, result, isPeriodic, true)
+	}
 
 	if isPeriodic {
 		spell.Unit.OnPeriodicHealDealt(sim, spell, result)
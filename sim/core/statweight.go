@@ -1,8 +1,11 @@
 package core
 
 import (
+	"fmt"
 	"math"
 	"runtime"
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -51,6 +54,8 @@ type StatWeightValues struct {
 	WeightsStdev  UnitStats
 	EpValues      UnitStats
 	EpValuesStdev UnitStats
+
+	Breakdowns []*proto.StatWeightBreakdown
 }
 
 func NewStatWeightValues() StatWeightValues {
@@ -68,6 +73,7 @@ func (swv *StatWeightValues) ToProto() *proto.StatWeightValues {
 		WeightsStdev:  swv.WeightsStdev.ToProto(),
 		EpValues:      swv.EpValues.ToProto(),
 		EpValuesStdev: swv.EpValuesStdev.ToProto(),
+		Breakdowns:    swv.Breakdowns,
 	}
 }
 
@@ -78,6 +84,8 @@ type StatWeightsResult struct {
 	Dtps   StatWeightValues
 	Tmi    StatWeightValues
 	PDeath StatWeightValues
+
+	Curves []*proto.StatCurve
 }
 
 func NewStatWeightsResult() *StatWeightsResult {
@@ -99,6 +107,7 @@ func (swr *StatWeightsResult) ToProto() *proto.StatWeightsResult {
 		Dtps:   swr.Dtps.ToProto(),
 		Tmi:    swr.Tmi.ToProto(),
 		PDeath: swr.PDeath.ToProto(),
+		Curves: swr.Curves,
 	}
 }
 
@@ -149,6 +158,12 @@ func CalcStatWeight(swr *proto.StatWeightsRequest, referenceStat stats.Stat, pro
 		return &StatWeightsResult{}
 	}
 
+	// In target precision mode the baseline decides the number of iterations, which all other
+	// sims then use as well so their iterations stay paired.
+	simOptions.Iterations = baselineResult.Iterations
+	simOptions.TargetDpsStderr = 0
+	simOptions.TargetRelativeDpsStderr = 0
+
 	var waitGroup sync.WaitGroup
 
 	// Do half the iterations with a positive, and half with a negative value for better accuracy.
@@ -170,7 +185,7 @@ func CalcStatWeight(swr *proto.StatWeightsRequest, referenceStat stats.Stat, pro
 		tickets <- struct{}{}
 	}
 
-	doStat := func(stat stats.UnitStat, value float64, isLow bool) {
+	doStat := func(stat stats.UnitStat, value float64, onResult func(*proto.RaidSimResult)) {
 		defer waitGroup.Done()
 		// wait until we have CPU time available.
 		<-tickets
@@ -210,11 +225,7 @@ func CalcStatWeight(swr *proto.StatWeightsRequest, referenceStat stats.Stat, pro
 			panic("Stat weights error: " + errorStr)
 		}
 
-		if isLow {
-			resultsLow[stat] = simResult
-		} else {
-			resultsHigh[stat] = simResult
-		}
+		onResult(simResult)
 		tickets <- struct{}{}
 	}
 
@@ -227,7 +238,16 @@ func CalcStatWeight(swr *proto.StatWeightsRequest, referenceStat stats.Stat, pro
 	statModsHigh[referenceStat] = defaultStatMod
 
 	statsToWeigh := stats.ProtoArrayToStatsList(swr.StatsToWeigh)
-	for _, s := range statsToWeigh {
+
+	// Breakdowns and final stat weights need the weights of every stat that the weighed stats
+	// add to as well.
+	var derivatives [stats.Len]stats.Stats
+	simmedStats := statsToWeigh
+	if swr.IncludeBreakdown || swr.FinalStatWeights {
+		derivatives = gearStatDerivatives(raidProto, swr.Encounter)
+		simmedStats = derivedStatsClosure(append(slices.Clone(statsToWeigh), referenceStat), &derivatives)
+	}
+	for _, s := range simmedStats {
 		stat := stats.UnitStatFromStat(s)
 		statMod := defaultStatMod
 		if stat.EqualsStat(stats.Expertise) {
@@ -255,8 +275,50 @@ func CalcStatWeight(swr *proto.StatWeightsRequest, referenceStat stats.Stat, pro
 		atomic.AddInt32(&iterationsTotal, swr.SimOptions.Iterations*2)
 		atomic.AddInt32(&simsTotal, 2)
 
-		go doStat(stat, statModsLow[stat], true)
-		go doStat(stat, statModsHigh[stat], false)
+		go doStat(stat, statModsLow[stat], func(result *proto.RaidSimResult) { resultsLow[stat] = result })
+		go doStat(stat, statModsHigh[stat], func(result *proto.RaidSimResult) { resultsHigh[stat] = result })
+	}
+
+	// For curves, each requested stat is also simmed at evenly spaced points around the current
+	// stats. The middle point is the baseline.
+	curveSettings := swr.CurveSettings
+	pointsPerSide := int(curveSettings.GetPointsPerSide())
+	var curveStats []stats.UnitStat
+	curveSteps := make([]float64, stats.UnitStatsLen)
+	curveResults := make([][]*proto.RaidSimResult, stats.UnitStatsLen)
+	if pointsPerSide > 0 {
+		for _, s := range statsToWeigh {
+			curveStats = append(curveStats, stats.UnitStatFromStat(s))
+		}
+		for _, s := range swr.PseudoStatsToWeigh {
+			curveStats = append(curveStats, stats.UnitStatFromPseudoStat(s))
+		}
+
+		stepSizes := NewUnitStats()
+		if curveSettings.StepSizes != nil {
+			stepSizes = unitStatsFromProto(curveSettings.StepSizes)
+		}
+		for _, stat := range curveStats {
+			curveSteps[stat] = statModsHigh[stat]
+			if step := stepSizes.Get(stat); step > 0 {
+				curveSteps[stat] = step
+			}
+
+			points := make([]*proto.RaidSimResult, 2*pointsPerSide+1)
+			points[pointsPerSide] = baselineResult
+			curveResults[stat] = points
+			for i := range points {
+				if i == pointsPerSide {
+					continue
+				}
+				idx := i
+				waitGroup.Add(1)
+				atomic.AddInt32(&iterationsTotal, simOptions.Iterations)
+				atomic.AddInt32(&simsTotal, 1)
+
+				go doStat(stat, float64(i-pointsPerSide)*curveSteps[stat], func(result *proto.RaidSimResult) { points[idx] = result })
+			}
+		}
 	}
 
 	// Wait for thread results.
@@ -311,6 +373,27 @@ func CalcStatWeight(swr *proto.StatWeightsRequest, referenceStat stats.Stat, pro
 		result.PDeath.WeightsStdev.AddStat(stat, 0)
 	}
 
+	// Compute breakdowns and final stat weights.
+	if swr.IncludeBreakdown || swr.FinalStatWeights {
+		for _, weightResults := range []*StatWeightValues{&result.Dps, &result.Hps, &result.Tps, &result.Dtps, &result.Tmi, &result.PDeath} {
+			finalWeights, finalWeightsStdev, err := finalStatWeights(weightResults.Weights.Stats, weightResults.WeightsStdev.Stats, &derivatives, simmedStats)
+			if err != nil {
+				panic("Stat weights error: " + err.Error())
+			}
+			if swr.IncludeBreakdown {
+				for _, stat := range statsToWeigh {
+					weightResults.Breakdowns = append(weightResults.Breakdowns, statWeightBreakdown(stat, weightResults.Weights.Stats[stat], &finalWeights, &derivatives))
+				}
+			}
+			if swr.FinalStatWeights {
+				for _, stat := range simmedStats {
+					weightResults.Weights.Stats[stat] = finalWeights[stat]
+					weightResults.WeightsStdev.Stats[stat] = finalWeightsStdev[stat]
+				}
+			}
+		}
+	}
+
 	// Compute EP results.
 	for i := range statModsLow {
 		stat := stats.UnitStatFromIdx(i)
@@ -336,5 +419,200 @@ func CalcStatWeight(swr *proto.StatWeightsRequest, referenceStat stats.Stat, pro
 		calcEpResults(&result.PDeath, DTPSReferenceStat)
 	}
 
+	// Compute curve results.
+	if len(curveStats) > 0 {
+		breakpointThreshold := curveSettings.BreakpointThreshold
+		if breakpointThreshold <= 0 || breakpointThreshold >= 1 {
+			breakpointThreshold = defaultBreakpointThreshold
+		}
+
+		finalStats := ComputeStats(&proto.ComputeStatsRequest{
+			Raid:      raidProto,
+			Encounter: swr.Encounter,
+		}).RaidStats.Parties[0].Players[0].FinalStats
+
+		for _, stat := range curveStats {
+			curve := calcStatCurve(stat, curveSteps[stat], curveResults[stat], breakpointThreshold)
+			if stat.IsStat() {
+				curve.BaseValue = finalStats.Stats[stat.StatIdx()]
+			}
+			result.Curves = append(result.Curves, curve)
+		}
+	}
+
 	return result
 }
+
+// Returns the final stats gained from a point of each stat on gear, using the stat dependencies
+// and item stat multipliers of the player once all effects are applied. Dynamic dependencies,
+// e.g. from procs, aren't included.
+func gearStatDerivatives(raidProto *proto.Raid, encounter *proto.Encounter) [stats.Len]stats.Stats {
+	if encounter == nil {
+		encounter = &proto.Encounter{}
+	}
+	env, _, _ := NewEnvironment(googleProto.Clone(raidProto).(*proto.Raid), encounter, false)
+	character := env.Raid.Parties[0].Players[0].GetCharacter()
+
+	var derivatives [stats.Len]stats.Stats
+	for i := range derivatives {
+		var gearStats stats.Stats
+		gearStats[i] = character.itemStatMultipliers[i]
+		derivatives[i] = character.ApplyStatDependencies(gearStats)
+	}
+	return derivatives
+}
+
+// Adds every stat that the listed stats add to.
+func derivedStatsClosure(statList []stats.Stat, derivatives *[stats.Len]stats.Stats) []stats.Stat {
+	for i := 0; i < len(statList); i++ {
+		for derived, amount := range derivatives[statList[i]] {
+			if amount != 0 && !slices.Contains(statList, stats.Stat(derived)) {
+				statList = append(statList, stats.Stat(derived))
+			}
+		}
+	}
+	return statList
+}
+
+// Solves the weights of the final stats from the weights of the gear stats. A point of a gear
+// stat adds derivatives[stat] to the final stats, so its weight is the sum of the final stat
+// weights scaled by those amounts. weighed has to include every stat that its stats add to, see
+// derivedStatsClosure, which makes this a linear system with a weight per weighed stat. Stdevs
+// are combined as if the gear weights were independent. Returns an error naming the stats whose
+// weights the derivatives don't determine.
+func finalStatWeights(gearWeights stats.Stats, gearWeightsStdev stats.Stats, derivatives *[stats.Len]stats.Stats, weighed []stats.Stat) (stats.Stats, stats.Stats, error) {
+	// Gauss-Jordan elimination of the derivatives between weighed stats, augmented with the
+	// identity, which turns into their inverse.
+	n := len(weighed)
+	matrix := make([][]float64, n)
+	for i, stat := range weighed {
+		matrix[i] = make([]float64, 2*n)
+		for j, derived := range weighed {
+			matrix[i][j] = derivatives[stat][derived]
+		}
+		matrix[i][n+i] = 1
+	}
+
+	var unsolved []string
+	for col, row := 0, 0; col < n; col++ {
+		pivot := row
+		for r := row + 1; r < n; r++ {
+			if math.Abs(matrix[r][col]) > math.Abs(matrix[pivot][col]) {
+				pivot = r
+			}
+		}
+		if math.Abs(matrix[pivot][col]) < 1e-12 {
+			unsolved = append(unsolved, weighed[col].StatName())
+			continue
+		}
+		matrix[row], matrix[pivot] = matrix[pivot], matrix[row]
+		scale := matrix[row][col]
+		for j := range matrix[row] {
+			matrix[row][j] /= scale
+		}
+		for r := range matrix {
+			if factor := matrix[r][col]; r != row && factor != 0 {
+				for j := range matrix[r] {
+					matrix[r][j] -= factor * matrix[row][j]
+				}
+			}
+		}
+		row++
+	}
+	if len(unsolved) > 0 {
+		return stats.Stats{}, stats.Stats{}, fmt.Errorf("final stat weights of %s can't be solved from the gear stat weights", strings.Join(unsolved, ", "))
+	}
+
+	var weights, stdevs stats.Stats
+	for i, stat := range weighed {
+		variance := 0.0
+		for j, gearStat := range weighed {
+			inverse := matrix[i][n+j]
+			weights[stat] += inverse * gearWeights[gearStat]
+			variance += inverse * inverse * gearWeightsStdev[gearStat] * gearWeightsStdev[gearStat]
+		}
+		stdevs[stat] = math.Sqrt(variance)
+	}
+	return weights, stdevs, nil
+}
+
+func statWeightBreakdown(stat stats.Stat, gearWeight float64, finalWeights *stats.Stats, derivatives *[stats.Len]stats.Stats) *proto.StatWeightBreakdown {
+	breakdown := &proto.StatWeightBreakdown{
+		Stat:        proto.Stat(stat),
+		GearWeight:  gearWeight,
+		FinalWeight: finalWeights[stat],
+	}
+	for derived, amount := range derivatives[stat] {
+		if amount != 0 {
+			breakdown.Contributions = append(breakdown.Contributions, &proto.StatContribution{
+				Stat:   proto.Stat(derived),
+				Amount: amount,
+				Weight: amount * finalWeights[derived],
+			})
+		}
+	}
+	return breakdown
+}
+
+// Relative drop of the DPS gained per point of a stat at which a breakpoint is reported.
+const defaultBreakpointThreshold = 0.5
+
+// Builds the DPS curve of a stat from sims at evenly spaced stat deltas, which all use the same
+// seed as the baseline in the middle. Slopes between neighbouring points are compared with
+// paired per-iteration differences, so a breakpoint is only reported when the drop in slope is
+// larger than the noise.
+func calcStatCurve(stat stats.UnitStat, step float64, results []*proto.RaidSimResult, breakpointThreshold float64) *proto.StatCurve {
+	curve := &proto.StatCurve{}
+	if stat.IsStat() {
+		curve.UnitStat = &proto.StatCurve_Stat{Stat: proto.Stat(stat.StatIdx())}
+	} else {
+		curve.UnitStat = &proto.StatCurve_PseudoStat{PseudoStat: proto.PseudoStat(stat.PseudoStatIdx())}
+	}
+
+	points := MapSlice(results, func(result *proto.RaidSimResult) *raceCandidate {
+		return &raceCandidate{Values: result.RaidMetrics.Parties[0].Players[0].Dps.AllValues}
+	})
+
+	center := len(results) / 2
+	for i, result := range results {
+		point := &proto.StatCurvePoint{
+			StatDelta: float64(i-center) * step,
+			Dps:       result.RaidMetrics.Parties[0].Players[0].Dps.Avg,
+		}
+		if i != center {
+			delta, halfWidth := compareRaceCandidates(points[i], points[center])
+			point.DpsDelta = delta
+			point.DpsDeltaCiLow = delta - halfWidth
+			point.DpsDeltaCiHigh = delta + halfWidth
+		}
+		curve.Points = append(curve.Points, point)
+	}
+
+	// Per-iteration DPS gained per point of the stat between neighbouring points, and its mean.
+	slopes := make([]*raceCandidate, len(results)-1)
+	slopeAggregators := make([]aggregator, len(slopes))
+	for i := range slopes {
+		slopes[i] = &raceCandidate{Values: make([]float64, min(len(points[i].Values), len(points[i+1].Values)))}
+		for it := range slopes[i].Values {
+			slopes[i].Values[it] = (points[i+1].Values[it] - points[i].Values[it]) / step
+			slopeAggregators[i].add(slopes[i].Values[it])
+		}
+	}
+
+	for i := 1; i < len(results)-1; i++ {
+		below, _ := slopeAggregators[i-1].meanAndConfidence()
+		above, aboveHalfWidth := slopeAggregators[i].meanAndConfidence()
+		drop, dropHalfWidth := compareRaceCandidates(slopes[i-1], slopes[i])
+		if below <= 0 || above > below*(1-breakpointThreshold) || drop-dropHalfWidth <= 0 {
+			continue
+		}
+		curve.Breakpoints = append(curve.Breakpoints, &proto.StatBreakpoint{
+			StatDelta:   curve.Points[i].StatDelta,
+			WeightBelow: below,
+			WeightAbove: above,
+			IsCap:       math.Abs(above) <= aboveHalfWidth,
+		})
+	}
+
+	return curve
+}
@@ -0,0 +1,255 @@
+package core
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/wowsims/sod/sim/core/proto"
+	"github.com/wowsims/sod/sim/core/stats"
+)
+
+func init() {
+	RegisterAgentFactory(
+		proto.Player_ShadowPriest{},
+		proto.Spec_SpecShadowPriest,
+		newFakeShadowPriest,
+		func(player *proto.Player, spec interface{}) {
+			playerSpec, ok := spec.(*proto.Player_ShadowPriest)
+			if !ok {
+				panic("Invalid spec value for Shadow Priest!")
+			}
+			player.Spec = playerSpec
+		},
+	)
+}
+
+// A fake Shadow Priest that casts the fake dot, has mana, and gets spell power from spirit
+// like with 5 points in Spiritual Guidance.
+func newFakeShadowPriest(char *Character, player *proto.Player) Agent {
+	priest := NewFakeElementalShaman(char, player).(*FakeAgent)
+	priest.EnableManaBar()
+	priest.AddStatDependency(stats.Spirit, stats.SpellPower, 0.25)
+	return priest
+}
+
+func TestCalcStatCurve(t *testing.T) {
+	// Per-iteration DPS at stat deltas -2..+2 in steps of 2, sharing noise like sims with the same seed.
+	newResults := func(dps func(delta float64) float64) []*proto.RaidSimResult {
+		var results []*proto.RaidSimResult
+		for i := -2; i <= 2; i++ {
+			delta := float64(i) * 2
+			var values []float64
+			for it := 0; it < 100; it++ {
+				values = append(values, dps(delta)+math.Sin(float64(it))*50)
+			}
+			results = append(results, &proto.RaidSimResult{RaidMetrics: &proto.RaidMetrics{Parties: []*proto.PartyMetrics{{Players: []*proto.UnitMetrics{{
+				Dps: &proto.DistributionMetrics{Avg: dps(delta), AllValues: values},
+			}}}}}})
+		}
+		return results
+	}
+
+	capped := calcStatCurve(stats.UnitStatFromStat(stats.MeleeHit), 2, newResults(func(delta float64) float64 {
+		return 1000 + 10*min(delta, 0)
+	}), defaultBreakpointThreshold)
+	if len(capped.Points) != 5 || capped.Points[0].StatDelta != -4 || capped.Points[4].StatDelta != 4 {
+		t.Fatalf("Unexpected points %v", capped.Points)
+	}
+	if delta := capped.Points[0].DpsDelta; math.Abs(delta+40) > 1e-6 {
+		t.Errorf("Expected a DPS delta of -40 at -4, got %.3f", delta)
+	}
+	if len(capped.Breakpoints) != 1 {
+		t.Fatalf("Expected 1 breakpoint, got %v", capped.Breakpoints)
+	}
+	if bp := capped.Breakpoints[0]; bp.StatDelta != 0 || !bp.IsCap || math.Abs(bp.WeightBelow-10) > 1e-6 {
+		t.Errorf("Expected a cap at 0 with a weight of 10 below, got %v", bp)
+	}
+
+	// A drop in slope smaller than the threshold isn't a breakpoint.
+	softened := calcStatCurve(stats.UnitStatFromStat(stats.MeleeHit), 2, newResults(func(delta float64) float64 {
+		return 1000 + 10*min(delta, 0) + 7*max(delta, 0)
+	}), defaultBreakpointThreshold)
+	if len(softened.Breakpoints) != 0 {
+		t.Errorf("Expected no breakpoints, got %v", softened.Breakpoints)
+	}
+}
+
+func TestFinalStatWeights(t *testing.T) {
+	// A point of Agility on gear adds 1.1 Agility, which adds 2.2 AP and 0.055 crit. AP on gear
+	// is multiplied by 1.1.
+	var derivatives [stats.Len]stats.Stats
+	for i := range derivatives {
+		derivatives[i][i] = 1
+	}
+	derivatives[stats.Agility] = stats.Stats{stats.Agility: 1.1, stats.AttackPower: 2.2, stats.MeleeCrit: 0.055}
+	derivatives[stats.AttackPower][stats.AttackPower] = 1.1
+
+	gearWeights := stats.Stats{stats.Agility: 1.1*0.2 + 2.2*0.5 + 0.055*10, stats.AttackPower: 1.1 * 0.5, stats.MeleeCrit: 10}
+	weighed := derivedStatsClosure([]stats.Stat{stats.Agility}, &derivatives)
+	if len(weighed) != 3 {
+		t.Fatalf("Expected Agility, Attack Power and Melee Crit to be weighed, got %v", weighed)
+	}
+
+	weights, _, err := finalStatWeights(gearWeights, stats.Stats{}, &derivatives, weighed)
+	if err != nil {
+		t.Fatalf("finalStatWeights() returned error: %v", err)
+	}
+	for stat, expected := range map[stats.Stat]float64{stats.Agility: 0.2, stats.AttackPower: 0.5, stats.MeleeCrit: 10} {
+		if math.Abs(weights[stat]-expected) > 1e-9 {
+			t.Errorf("Expected a final weight of %.3f for %s, got %.3f", expected, stat.StatName(), weights[stat])
+		}
+	}
+
+	breakdown := statWeightBreakdown(stats.Agility, gearWeights[stats.Agility], &weights, &derivatives)
+	total := 0.0
+	for _, contribution := range breakdown.Contributions {
+		total += contribution.Weight
+	}
+	if len(breakdown.Contributions) != 3 || math.Abs(total-breakdown.GearWeight) > 1e-9 {
+		t.Errorf("Expected 3 contributions adding up to %.3f, got %v", breakdown.GearWeight, breakdown.Contributions)
+	}
+}
+
+func TestFinalStatWeightsCycle(t *testing.T) {
+	// Spirit adds Intellect and Intellect adds Spirit, so neither can be solved before the other.
+	var derivatives [stats.Len]stats.Stats
+	for i := range derivatives {
+		derivatives[i][i] = 1
+	}
+	derivatives[stats.Spirit][stats.Intellect] = 0.5
+	derivatives[stats.Intellect][stats.Spirit] = 0.25
+
+	gearWeights := stats.Stats{stats.Spirit: 0.2 + 0.5*0.4, stats.Intellect: 0.4 + 0.25*0.2}
+	gearWeightsStdev := stats.Stats{stats.Spirit: 0.1}
+	weighed := []stats.Stat{stats.Spirit, stats.Intellect}
+	weights, stdevs, err := finalStatWeights(gearWeights, gearWeightsStdev, &derivatives, weighed)
+	if err != nil {
+		t.Fatalf("finalStatWeights() returned error: %v", err)
+	}
+	for stat, expected := range map[stats.Stat]float64{stats.Spirit: 0.2, stats.Intellect: 0.4} {
+		if math.Abs(weights[stat]-expected) > 1e-9 {
+			t.Errorf("Expected a final weight of %.3f for %s, got %.3f", expected, stat.StatName(), weights[stat])
+		}
+		if stdevs[stat] == 0 {
+			t.Errorf("Expected a stdev for %s", stat.StatName())
+		}
+	}
+
+	// A point of Spirit adding exactly what a point of Intellect adds leaves both undetermined.
+	derivatives[stats.Spirit] = derivatives[stats.Intellect]
+	if _, _, err := finalStatWeights(gearWeights, gearWeightsStdev, &derivatives, weighed); err == nil || !strings.Contains(err.Error(), "Intellect") {
+		t.Errorf("Expected an error naming Intellect, got %v", err)
+	}
+}
+
+func TestStatWeightCurves(t *testing.T) {
+	rsr := fakeCasterRaidSimRequest()
+	result := StatWeights(&proto.StatWeightsRequest{
+		Player:          rsr.Raid.Parties[0].Players[0],
+		RaidBuffs:       &proto.RaidBuffs{},
+		PartyBuffs:      rsr.Raid.Parties[0].Buffs,
+		Debuffs:         &proto.Debuffs{},
+		Encounter:       rsr.Encounter,
+		SimOptions:      &proto.SimOptions{Iterations: 400, RandomSeed: 101},
+		StatsToWeigh:    []proto.Stat{proto.Stat_StatSpellPower, proto.Stat_StatMeleeHit},
+		EpReferenceStat: proto.Stat_StatSpellPower,
+		CurveSettings: &proto.StatCurveSettings{
+			PointsPerSide: 2,
+			StepSizes:     &proto.UnitStats{Stats: stats.Stats{stats.SpellPower: 20}.ToFloatArray()},
+		},
+	})
+	if len(result.Curves) != 2 {
+		t.Fatalf("Expected 2 curves, got %d", len(result.Curves))
+	}
+
+	spellPower, hit := result.Curves[0], result.Curves[1]
+	if spellPower.GetStat() != proto.Stat_StatSpellPower || len(spellPower.Points) != 5 || spellPower.Points[0].StatDelta != -40 || spellPower.Points[4].StatDelta != 40 {
+		t.Fatalf("Unexpected spell power curve %v", spellPower)
+	}
+	// Every tick of the fake dot deals 100 + spell power damage with the same rolls at every
+	// point, so the DPS is exactly proportional to it.
+	baseDps := spellPower.Points[2].Dps
+	for _, point := range spellPower.Points {
+		expected := baseDps * (100 + spellPower.BaseValue + point.StatDelta) / (100 + spellPower.BaseValue)
+		if math.Abs(point.Dps-expected) > 1e-6 || math.Abs(point.DpsDelta-(expected-baseDps)) > 1e-6 {
+			t.Errorf("Expected %.3f DPS at %+.0f spell power, got %v", expected, point.StatDelta, point)
+		}
+	}
+	if len(spellPower.Breakpoints) != 0 {
+		t.Errorf("Expected no spell power breakpoints, got %v", spellPower.Breakpoints)
+	}
+
+	// Melee hit does nothing for the fake dot, so every point has exactly the baseline DPS.
+	for _, point := range hit.Points {
+		if point.Dps != baseDps || point.DpsDelta != 0 {
+			t.Errorf("Expected no DPS change from melee hit, got %v", point)
+		}
+	}
+	if len(hit.Breakpoints) != 0 {
+		t.Errorf("Expected no melee hit breakpoints, got %v", hit.Breakpoints)
+	}
+}
+
+func TestStatWeightBreakdown(t *testing.T) {
+	rsr := fakeCasterRaidSimRequest()
+	player := rsr.Raid.Parties[0].Players[0]
+	player.Class = proto.Class_ClassPriest
+	player.Spec = &proto.Player_ShadowPriest{}
+	result := StatWeights(&proto.StatWeightsRequest{
+		Player:           player,
+		RaidBuffs:        &proto.RaidBuffs{},
+		PartyBuffs:       rsr.Raid.Parties[0].Buffs,
+		Debuffs:          &proto.Debuffs{},
+		Encounter:        rsr.Encounter,
+		SimOptions:       &proto.SimOptions{Iterations: 400, RandomSeed: 101},
+		StatsToWeigh:     []proto.Stat{proto.Stat_StatSpirit, proto.Stat_StatIntellect},
+		EpReferenceStat:  proto.Stat_StatSpellPower,
+		IncludeBreakdown: true,
+		FinalStatWeights: true,
+	})
+	if len(result.Dps.Breakdowns) != 2 {
+		t.Fatalf("Expected 2 breakdowns, got %d", len(result.Dps.Breakdowns))
+	}
+
+	spellPowerWeight := result.Dps.Weights.Stats[stats.SpellPower]
+	if spellPowerWeight <= 0 {
+		t.Fatalf("Expected spell power to increase DPS, got a weight of %.3f", spellPowerWeight)
+	}
+	for _, breakdown := range result.Dps.Breakdowns {
+		total := 0.0
+		for _, contribution := range breakdown.Contributions {
+			total += contribution.Weight
+		}
+		if math.Abs(total-breakdown.GearWeight) > 1e-6 {
+			t.Errorf("Contributions of %s add up to %.3f instead of %.3f", breakdown.Stat, total, breakdown.GearWeight)
+		}
+		if weight := result.Dps.Weights.Stats[breakdown.Stat]; weight != breakdown.FinalWeight {
+			t.Errorf("Expected the final weight of %s in the weights, got %.3f instead of %.3f", breakdown.Stat, weight, breakdown.FinalWeight)
+		}
+		// Neither stat does anything for the fake dot on its own.
+		if math.Abs(breakdown.FinalWeight) > 1e-6 {
+			t.Errorf("Expected a final weight of 0 for %s, got %.3f", breakdown.Stat, breakdown.FinalWeight)
+		}
+	}
+
+	// Spirit is worth exactly what its spell power is worth.
+	spirit := result.Dps.Breakdowns[0]
+	if math.Abs(spirit.GearWeight-0.25*spellPowerWeight) > 1e-6 {
+		t.Errorf("Expected a spirit weight of %.3f from its spell power, got %.3f", 0.25*spellPowerWeight, spirit.GearWeight)
+	}
+	if !slices.ContainsFunc(spirit.Contributions, func(c *proto.StatContribution) bool {
+		return c.Stat == proto.Stat_StatSpellPower && c.Amount == 0.25 && math.Abs(c.Weight-spirit.GearWeight) <= 1e-6
+	}) {
+		t.Errorf("Expected spirit to add 0.25 spell power, got %v", spirit.Contributions)
+	}
+
+	// Intellect adds mana, which the fake dot doesn't cost.
+	intellect := result.Dps.Breakdowns[1]
+	if intellect.GearWeight != 0 || !slices.ContainsFunc(intellect.Contributions, func(c *proto.StatContribution) bool {
+		return c.Stat == proto.Stat_StatMana && c.Amount > 0 && c.Weight == 0
+	}) {
+		t.Errorf("Expected intellect to add mana without value, got %v", intellect)
+	}
+}
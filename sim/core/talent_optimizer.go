@@ -0,0 +1,493 @@
+package core
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"runtime/debug"
+	"slices"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	googleProto "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/wowsims/sod/sim/core/proto"
+)
+
+const (
+	defaultTalentOptimizerPopulation    = 24
+	defaultTalentOptimizerGenerations   = 10
+	defaultTalentOptimizerMinIterations = 200
+	defaultTalentOptimizerMaxIterations = 3200
+	defaultTalentOptimizerNumResults    = 5
+
+	talentPointsPerRow = 5
+	// Talent points are gained from level 10 on.
+	talentPointsLevelOffset = 9
+)
+
+// TalentTreeLayout holds the talents of one tree, in the order of the talents string.
+type TalentTreeLayout []TalentLayout
+
+// TalentLayout describes where a talent sits in its tree, like the trees in
+// ui/core/talents/trees/<class>.json.
+type TalentLayout struct {
+	Row       int32
+	Col       int32
+	MaxPoints int32
+	// Talent that must be fully learned before this one, if any.
+	Prereq *TalentLocation
+}
+
+type TalentLocation struct {
+	Row int32
+	Col int32
+}
+
+type classTalentTrees struct {
+	talents googleProto.Message
+	trees   [3]TalentTreeLayout
+}
+
+var talentTreesByClass = make(map[proto.Class]classTalentTrees)
+
+// Registers the talent trees of a class for the talent optimizer. talents is an empty talents
+// proto of the class, e.g. &proto.WarriorTalents{}, whose fields follow the order of the trees.
+func RegisterTalentTrees(class proto.Class, talents googleProto.Message, trees [3]TalentTreeLayout) {
+	talentTreesByClass[class] = classTalentTrees{talents: talents, trees: trees}
+}
+
+// Returns the talents proto and talent trees registered for a class, if any.
+func RegisteredTalentTrees(class proto.Class) (googleProto.Message, [3]TalentTreeLayout, bool) {
+	classTrees, ok := talentTreesByClass[class]
+	return classTrees.talents, classTrees.trees, ok
+}
+
+func TalentOptimizer(ctx context.Context, request *proto.TalentOptimizerRequest, progress chan *proto.ProgressMetrics) *proto.TalentOptimizerResult {
+	optimizer := &talentOptimizer{
+		SingleRaidSimRunner: runSim,
+		Request:             request,
+	}
+
+	result, err := optimizer.Run(ctx, progress)
+	if err != nil {
+		result = &proto.TalentOptimizerResult{
+			ErrorResult: err.Error(),
+		}
+	}
+
+	if progress != nil {
+		progress <- &proto.ProgressMetrics{
+			FinalTalentOptimizerResult: result,
+		}
+		close(progress)
+	}
+
+	return result
+}
+
+// talentOptimizer searches for better talent builds of a player within a point budget. Each
+// generation moves points between talents of the best builds so far, keeping the trees valid
+// and the fixed picks in place, and races the new builds against the old ones.
+type talentOptimizer struct {
+	// SingleRaidSimRunner used to run each batch of iterations.
+	SingleRaidSimRunner raidSimRunner
+	// Request used for this optimization.
+	Request *proto.TalentOptimizerRequest
+
+	settings    *proto.TalentOptimizerSettings
+	baseRequest *proto.RaidSimRequest
+	partyIdx    int
+	playerIdx   int
+	talents     googleProto.Message
+	trees       []TalentTreeLayout
+	points      int32
+	fixed       talentBuild
+	rand        Rand
+}
+
+// talentBuild holds the points in each talent, indexed by tree and then by talent.
+type talentBuild [][]int32
+
+func (b talentBuild) clone() talentBuild {
+	return MapSlice(b, func(tree []int32) []int32 { return slices.Clone(tree) })
+}
+
+func (b talentBuild) total() int32 {
+	total := int32(0)
+	for _, tree := range b {
+		for _, points := range tree {
+			total += points
+		}
+	}
+	return total
+}
+
+// Formats the build like the talents picker in the UI does.
+func (b talentBuild) String() string {
+	return strings.TrimRight(strings.Join(MapSlice(b, func(tree []int32) string {
+		return strings.TrimRight(strings.Join(MapSlice(tree, func(points int32) string { return fmt.Sprint(points) }), ""), "0")
+	}), "-"), "-")
+}
+
+type talentCandidate struct {
+	build talentBuild
+	race  *raceCandidate
+}
+
+func (to *talentOptimizer) Run(pctx context.Context, progress chan *proto.ProgressMetrics) (result *proto.TalentOptimizerResult, resultErr error) {
+	ctx, cancel := context.WithCancel(pctx)
+	defer func() {
+		if err := recover(); err != nil {
+			result = &proto.TalentOptimizerResult{
+				ErrorResult: fmt.Sprintf("%v\nStack Trace:\n%s", err, string(debug.Stack())),
+			}
+		}
+		cancel()
+	}()
+
+	baseBuild, err := to.setup()
+	if err != nil {
+		return nil, err
+	}
+
+	population := max(int(to.settings.PopulationSize), 2)
+	if to.settings.PopulationSize == 0 {
+		population = defaultTalentOptimizerPopulation
+	}
+	generations := max(int(to.settings.Generations), 1)
+	if to.settings.Generations == 0 {
+		generations = defaultTalentOptimizerGenerations
+	}
+	minIterations := int(to.settings.MinIterations)
+	if minIterations <= 0 {
+		minIterations = defaultTalentOptimizerMinIterations
+	}
+	maxIterations := int(to.settings.MaxIterations)
+	if maxIterations <= 0 {
+		maxIterations = defaultTalentOptimizerMaxIterations
+	}
+	maxIterations = max(maxIterations, minIterations)
+	numResults := int(to.settings.NumResults)
+	if numResults <= 0 {
+		numResults = defaultTalentOptimizerNumResults
+	}
+	eliteCount := max(population/4, numResults)
+
+	race := newSimRace(to.SingleRaidSimRunner, to.baseRequest, to.partyIdx, to.playerIdx, progress)
+	if to.settings.OptimizeThreat {
+		metricsIdx := to.playerIdx - countEmptyPlayers(to.baseRequest.Raid.Parties[to.partyIdx].Players[:to.playerIdx])
+		race.metric = func(result *proto.RaidSimResult) *proto.DistributionMetrics {
+			return result.RaidMetrics.Parties[to.partyIdx].Players[metricsIdx].Threat
+		}
+	}
+	race.expect(generations*population+numResults+1, generations*population*minIterations*2+(numResults+1)*maxIterations)
+	to.rand = NewSplitMix(uint64(race.seed))
+
+	seen := map[string]*talentCandidate{}
+	newCandidate := func(build talentBuild) *talentCandidate {
+		request := googleProto.Clone(to.baseRequest).(*proto.RaidSimRequest)
+		request.Raid.Parties[to.partyIdx].Players[to.playerIdx].TalentsString = build.String()
+		candidate := &talentCandidate{
+			build: build,
+			race:  &raceCandidate{Request: request},
+		}
+		seen[build.String()] = candidate
+		return candidate
+	}
+
+	base := newCandidate(baseBuild)
+	current := []*talentCandidate{base}
+	for generation := 0; generation < generations; generation++ {
+		// Fill the generation up with neighbours of the current best builds.
+		next := slices.Clone(current)
+		var neighbours []talentBuild
+		for _, c := range current {
+			for _, neighbour := range to.neighbours(c.build) {
+				if seen[neighbour.String()] == nil {
+					neighbours = append(neighbours, neighbour)
+				}
+			}
+		}
+		for len(next) < population && len(neighbours) > 0 {
+			i := int(to.rand.Next() % uint64(len(neighbours)))
+			if seen[neighbours[i].String()] == nil {
+				next = append(next, newCandidate(neighbours[i]))
+			}
+			neighbours = slices.Delete(neighbours, i, i+1)
+		}
+		if len(next) == len(current) {
+			// No more builds to try around the current ones.
+			break
+		}
+
+		for _, c := range next {
+			c.race.Eliminated = false
+		}
+		if err := race.run(ctx, MapSlice(next, func(c *talentCandidate) *raceCandidate { return c.race }), minIterations, maxIterations, eliteCount); err != nil {
+			return nil, err
+		}
+
+		survivors := FilterSlice(next, func(c *talentCandidate) bool { return !c.race.Eliminated })
+		slices.SortStableFunc(survivors, func(a, b *talentCandidate) int {
+			n := min(len(a.race.Values), len(b.race.Values))
+			return cmp.Compare(b.race.meanOver(n), a.race.meanOver(n))
+		})
+		current = survivors[:min(len(survivors), eliteCount)]
+	}
+
+	// Final paired comparison between the best builds and the base talents, on fresh seeds.
+	finalists := current[:min(len(current), numResults)]
+	compared := []*talentCandidate{base}
+	for _, c := range finalists {
+		if c != base {
+			compared = append(compared, c)
+		}
+	}
+	confirmed, err := race.confirm(ctx, MapSlice(compared, func(c *talentCandidate) *raceCandidate { return c.race }), maxIterations)
+	if err != nil {
+		return nil, err
+	}
+	for i, c := range compared {
+		c.race = confirmed[i]
+	}
+	slices.SortStableFunc(finalists, func(a, b *talentCandidate) int {
+		return cmp.Compare(b.race.Mean(), a.race.Mean())
+	})
+
+	result = &proto.TalentOptimizerResult{
+		Base:                to.buildToProto(base, base),
+		CandidatesEvaluated: int32(len(seen)),
+		Iterations:          int32(maxIterations),
+	}
+	for _, c := range finalists {
+		result.Builds = append(result.Builds, to.buildToProto(c, base))
+	}
+	return result, nil
+}
+
+// Validates the request and returns the build to start from.
+func (to *talentOptimizer) setup() (talentBuild, error) {
+	to.settings = to.Request.GetSettings()
+	if to.settings == nil {
+		to.settings = &proto.TalentOptimizerSettings{}
+	}
+	if to.Request.GetBaseSettings().GetRaid() == nil {
+		return nil, fmt.Errorf("talent optimizer: missing base settings")
+	}
+	to.baseRequest = googleProto.Clone(to.Request.BaseSettings).(*proto.RaidSimRequest)
+	if to.baseRequest.SimOptions == nil {
+		to.baseRequest.SimOptions = &proto.SimOptions{}
+	}
+
+	partyIdx, playerIdx, err := findRaidPlayer(to.baseRequest.Raid, to.settings.Player)
+	if err != nil {
+		return nil, fmt.Errorf("talent optimizer: %w", err)
+	}
+	to.partyIdx, to.playerIdx = partyIdx, playerIdx
+	player := to.baseRequest.Raid.Parties[partyIdx].Players[playerIdx]
+	for _, party := range to.baseRequest.Raid.Parties {
+		for _, p := range party.GetPlayers() {
+			if p.GetDatabase() != nil {
+				addToDatabase(p.GetDatabase())
+			}
+		}
+	}
+
+	classTrees, ok := talentTreesByClass[player.Class]
+	if !ok {
+		return nil, fmt.Errorf("talent optimizer: no talent trees for %s", player.Class)
+	}
+	to.talents = classTrees.talents
+	to.trees = classTrees.trees[:]
+	to.points = to.settings.Points
+	if to.points <= 0 {
+		to.points = max(player.Level-talentPointsLevelOffset, 0)
+	}
+
+	to.fixed, err = to.parseBuild(to.settings.FixedTalents)
+	if err != nil {
+		return nil, fmt.Errorf("talent optimizer: fixed talents: %w", err)
+	}
+	if !to.isValid(to.fixed) {
+		return nil, fmt.Errorf("talent optimizer: fixed talents %q aren't a valid build with %d points", to.settings.FixedTalents, to.points)
+	}
+
+	base, err := to.parseBuild(player.TalentsString)
+	if err != nil {
+		return nil, fmt.Errorf("talent optimizer: player talents: %w", err)
+	}
+	if !to.isValid(base) {
+		return nil, fmt.Errorf("talent optimizer: player talents %q aren't a valid build with %d points", player.TalentsString, to.points)
+	}
+	for treeIdx, tree := range base {
+		for talentIdx := range tree {
+			if base[treeIdx][talentIdx] < to.fixed[treeIdx][talentIdx] {
+				return nil, fmt.Errorf("talent optimizer: player talents %q don't include the fixed talents %q", player.TalentsString, to.settings.FixedTalents)
+			}
+		}
+	}
+	return base, nil
+}
+
+// Parses a talents string with FillTalentsProto, after checking that it fits the trees.
+func (to *talentOptimizer) parseBuild(talentsString string) (talentBuild, error) {
+	treeStrs := strings.Split(talentsString, "-")
+	if len(treeStrs) > len(to.trees) {
+		return nil, fmt.Errorf("%q has more than %d trees", talentsString, len(to.trees))
+	}
+	for treeIdx, treeStr := range treeStrs {
+		if len(treeStr) > len(to.trees[treeIdx]) {
+			return nil, fmt.Errorf("%q has more than %d talents in tree %d", talentsString, len(to.trees[treeIdx]), treeIdx+1)
+		}
+		if strings.Trim(treeStr, "0123456789") != "" {
+			return nil, fmt.Errorf("%q is not a talents string", talentsString)
+		}
+	}
+
+	talents := to.talents.ProtoReflect().New()
+	FillTalentsProto(talents, talentsString, to.treeSizes())
+	build := MapSlice(to.trees, func(tree TalentTreeLayout) []int32 { return make([]int32, len(tree)) })
+	for treeIdx, tree := range build {
+		for talentIdx := range tree {
+			fd := to.talentField(treeIdx, talentIdx)
+			if fd.Kind() == protoreflect.BoolKind {
+				if talents.Get(fd).Bool() {
+					tree[talentIdx] = 1
+				}
+			} else {
+				tree[talentIdx] = int32(talents.Get(fd).Int())
+			}
+		}
+	}
+	return build, nil
+}
+
+func (to *talentOptimizer) treeSizes() [3]int {
+	var sizes [3]int
+	for treeIdx, tree := range to.trees {
+		sizes[treeIdx] = len(tree)
+	}
+	return sizes
+}
+
+// Field of the talents proto holding the talent, numbered like FillTalentsProto does.
+func (to *talentOptimizer) talentField(treeIdx int, talentIdx int) protoreflect.FieldDescriptor {
+	offset := 0
+	for _, tree := range to.trees[:treeIdx] {
+		offset += len(tree)
+	}
+	return to.talents.ProtoReflect().Descriptor().Fields().ByNumber(protowire.Number(offset + talentIdx + 1))
+}
+
+// Whether the build could be picked in the talents picker: it stays within the point budget
+// and every talent has its prerequisite and enough points in the rows above it.
+func (to *talentOptimizer) isValid(build talentBuild) bool {
+	if build.total() > to.points {
+		return false
+	}
+	for treeIdx, tree := range to.trees {
+		var pointsByRow []int32
+		for talentIdx, talent := range tree {
+			row := int(talent.Row)
+			for len(pointsByRow) <= row {
+				pointsByRow = append(pointsByRow, 0)
+			}
+			pointsByRow[row] += build[treeIdx][talentIdx]
+		}
+
+		for talentIdx, talent := range tree {
+			points := build[treeIdx][talentIdx]
+			if points < 0 || points > talent.MaxPoints {
+				return false
+			}
+			if points == 0 {
+				continue
+			}
+			row := talent.Row
+			pointsAbove := int32(0)
+			for _, rowPoints := range pointsByRow[:row] {
+				pointsAbove += rowPoints
+			}
+			if pointsAbove < row*talentPointsPerRow {
+				return false
+			}
+			if prereq := talent.Prereq; prereq != nil {
+				prereqIdx := slices.IndexFunc(tree, func(t TalentLayout) bool {
+					return t.Row == prereq.Row && t.Col == prereq.Col
+				})
+				if prereqIdx == -1 || build[treeIdx][prereqIdx] < tree[prereqIdx].MaxPoints {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// Returns the valid builds that differ from build by spending an unspent point, or by moving
+// either one point or all movable points of one talent into another talent.
+func (to *talentOptimizer) neighbours(build talentBuild) []talentBuild {
+	var neighbours []talentBuild
+	addPoints := func(from talentBuild, points int32, skipTree int, skipTalent int) {
+		for treeIdx, tree := range to.trees {
+			for talentIdx, talent := range tree {
+				if (treeIdx == skipTree && talentIdx == skipTalent) || from[treeIdx][talentIdx]+points > talent.MaxPoints {
+					continue
+				}
+				neighbour := from.clone()
+				neighbour[treeIdx][talentIdx] += points
+				if to.isValid(neighbour) {
+					neighbours = append(neighbours, neighbour)
+				}
+			}
+		}
+	}
+
+	if build.total() < to.points {
+		addPoints(build, 1, -1, -1)
+	}
+	for treeIdx, tree := range build {
+		for talentIdx, points := range tree {
+			movable := points - to.fixed[treeIdx][talentIdx]
+			for _, moved := range slices.Compact([]int32{1, movable}) {
+				if moved <= 0 || moved > movable {
+					continue
+				}
+				removed := build.clone()
+				removed[treeIdx][talentIdx] -= moved
+				addPoints(removed, moved, treeIdx, talentIdx)
+			}
+		}
+	}
+	return neighbours
+}
+
+// Describes the differences between two builds, e.g. "cruelty 3 -> 5".
+func (to *talentOptimizer) describeChanges(base talentBuild, build talentBuild) []string {
+	var changes []string
+	for treeIdx, tree := range to.trees {
+		for talentIdx := range tree {
+			if before, after := base[treeIdx][talentIdx], build[treeIdx][talentIdx]; before != after {
+				changes = append(changes, fmt.Sprintf("%s %d -> %d", to.talentField(treeIdx, talentIdx).JSONName(), before, after))
+			}
+		}
+	}
+	return changes
+}
+
+func (to *talentOptimizer) buildToProto(candidate *talentCandidate, base *talentCandidate) *proto.TalentBuild {
+	delta, halfWidth := 0.0, 0.0
+	if candidate != base {
+		delta, halfWidth = compareRaceCandidates(candidate.race, base.race)
+	}
+	return &proto.TalentBuild{
+		TalentsString: candidate.build.String(),
+		Value:         candidate.race.Mean(),
+		Delta:         delta,
+		DeltaCiLow:    delta - halfWidth,
+		DeltaCiHigh:   delta + halfWidth,
+		Changes:       to.describeChanges(base.build, candidate.build),
+	}
+}
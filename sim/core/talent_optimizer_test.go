@@ -0,0 +1,120 @@
+package core
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/wowsims/sod/sim/core/proto"
+)
+
+func TestTalentBuildValidity(t *testing.T) {
+	// Any talents proto works, as long as the fields of the first tree are numbers.
+	to := &talentOptimizer{
+		talents: &proto.WarriorTalents{},
+		trees: []TalentTreeLayout{{
+			{Row: 0, Col: 0, MaxPoints: 5},
+			{Row: 0, Col: 1, MaxPoints: 3},
+			{Row: 1, Col: 0, MaxPoints: 1},
+			{Row: 1, Col: 1, MaxPoints: 2, Prereq: &TalentLocation{Row: 0, Col: 0}},
+		}, {}, {}},
+		points: 8,
+	}
+
+	for talents, expected := range map[string]bool{
+		"5":    true,
+		"5012": true,
+		"001":  false, // Not enough points in the rows above.
+		"4301": false, // Prerequisite isn't full.
+		"5312": false, // Over the point budget.
+		"6":    false, // Over the talent's max points.
+	} {
+		build, err := to.parseBuild(talents)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %s", talents, err)
+		}
+		if build.String() != talents {
+			t.Errorf("Expected %q to format as itself, got %q", talents, build.String())
+		}
+		if valid := to.isValid(build); valid != expected {
+			t.Errorf("Expected validity of %q to be %v, got %v", talents, expected, valid)
+		}
+	}
+
+	base, _ := to.parseBuild("5")
+	to.fixed, _ = to.parseBuild("")
+	for _, neighbour := range to.neighbours(base) {
+		if !to.isValid(neighbour) || neighbour.String() == base.String() {
+			t.Errorf("Unexpected neighbour %q of %q", neighbour, base)
+		}
+	}
+}
+
+func TestTalentOptimizer(t *testing.T) {
+	// A small first tree, with a talent in the second row that takes 5 points above it.
+	registered, ok := talentTreesByClass[proto.Class_ClassShaman]
+	RegisterTalentTrees(proto.Class_ClassShaman, &proto.ShamanTalents{}, [3]TalentTreeLayout{{
+		{Row: 0, Col: 0, MaxPoints: 5},
+		{Row: 0, Col: 1, MaxPoints: 5},
+		{Row: 1, Col: 0, MaxPoints: 2},
+	}})
+	t.Cleanup(func() {
+		if ok {
+			talentTreesByClass[proto.Class_ClassShaman] = registered
+		} else {
+			delete(talentTreesByClass, proto.Class_ClassShaman)
+		}
+	})
+
+	// Each point is worth 1, 2 and 3 dps in the three talents.
+	talentsDps := func(talentsString string) float64 {
+		dps := 0.0
+		for i, points := range strings.Split(talentsString, "-")[0] {
+			dps += float64(i+1) * float64(points-'0')
+		}
+		return dps
+	}
+
+	rsr := fakeCasterRaidSimRequest()
+	rsr.Raid.Parties[0].Players[0].TalentsString = "5"
+	optimizer := &talentOptimizer{
+		SingleRaidSimRunner: func(rsr *proto.RaidSimRequest, _ chan *proto.ProgressMetrics, _ bool) *proto.RaidSimResult {
+			return fakeBulkSimResult(rsr, talentsDps(rsr.Raid.Parties[0].Players[0].TalentsString))
+		},
+		Request: &proto.TalentOptimizerRequest{
+			BaseSettings: rsr,
+			Settings: &proto.TalentOptimizerSettings{
+				Points:         7,
+				FixedTalents:   "1",
+				PopulationSize: 8,
+				Generations:    6,
+				MinIterations:  20,
+				MaxIterations:  40,
+				NumResults:     3,
+			},
+		},
+	}
+	result, err := optimizer.Run(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Talent optimizer failed with error: %v", err)
+	}
+	if result.Base.TalentsString != "5" || len(result.Builds) != 3 {
+		t.Fatalf("Unexpected result %v", result)
+	}
+
+	// The best build keeps a point in the fixed talent and spends the rest on the better ones.
+	if best := result.Builds[0]; best.TalentsString != "142" || best.Delta != talentsDps("142")-talentsDps("5") {
+		t.Errorf("Expected 142 as the best build, got %v", best)
+	}
+	for i, build := range result.Builds {
+		if build.TalentsString[0] == '0' || build.Value != talentsDps(build.TalentsString) {
+			t.Errorf("Unexpected build %v", build)
+		}
+		if (build.TalentsString == result.Base.TalentsString) != (len(build.Changes) == 0) {
+			t.Errorf("Unexpected changes %v for build %s", build.Changes, build.TalentsString)
+		}
+		if i > 0 && build.Value > result.Builds[i-1].Value {
+			t.Errorf("Builds aren't sorted by DPS: %.3f > %.3f", build.Value, result.Builds[i-1].Value)
+		}
+	}
+}
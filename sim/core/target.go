@@ -89,6 +89,13 @@ func (encounter *Encounter) doneIteration(sim *Simulation) {
 	}
 }
 
+// Adds the metrics of another copy of this encounter, which simmed the iterations right after ours.
+func (encounter *Encounter) mergeMetrics(other *Encounter) {
+	for i, target := range encounter.Targets {
+		target.mergeMetrics(&other.Targets[i].Unit)
+	}
+}
+
 func (encounter *Encounter) GetMetricsProto() *proto.EncounterMetrics {
 	metrics := &proto.EncounterMetrics{
 		Targets: make([]*proto.UnitMetrics, len(encounter.Targets)),
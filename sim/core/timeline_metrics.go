@@ -0,0 +1,196 @@
+package core
+
+import (
+	"time"
+
+	"github.com/wowsims/sod/sim/core/proto"
+)
+
+// Length of the time buckets of timeline metrics.
+const timelineBucketDuration = time.Second
+
+// How often resources are sampled for timeline metrics.
+const timelineSampleInterval = time.Millisecond * 250
+
+func timelineBucket(t time.Duration) int {
+	// Prepull damage and auras count towards the first bucket.
+	return int(max(t, 0) / timelineBucketDuration)
+}
+
+// Adds value to bucket, growing the series as needed.
+func addToBucket(series []float64, bucket int, value float64) []float64 {
+	if bucket >= len(series) {
+		series = append(series, make([]float64, bucket+1-len(series))...)
+	}
+	series[bucket] += value
+	return series
+}
+
+func mergeSeries(series []float64, other []float64) []float64 {
+	for bucket, value := range other {
+		series = addToBucket(series, bucket, value)
+	}
+	return series
+}
+
+// timelineMetrics aggregates a unit's damage, resources, aura uptime and cooldown usage over
+// the course of the fight, in buckets of timelineBucketDuration. It is only tracked if
+// SimOptions.TimelineMetrics is set.
+type timelineMetrics struct {
+	// Damage for the current iteration, cleared on reset.
+	damage []float64
+
+	// Aggregate values. These are updated after each iteration.
+	simmedSeconds []float64 // Simmed time in each bucket, summed over iterations.
+	iterations    []float64 // Number of iterations that reached each bucket.
+	damageSum     []float64
+
+	resourceSamples []float64 // Number of resource samples taken in each bucket.
+	resources       map[proto.ResourceType][]float64
+	auraUptime      map[ActionID][]float64 // In seconds.
+	cooldownUses    map[ActionID][]float64
+}
+
+func newTimelineMetrics() *timelineMetrics {
+	return &timelineMetrics{
+		resources:    make(map[proto.ResourceType][]float64),
+		auraUptime:   make(map[ActionID][]float64),
+		cooldownUses: make(map[ActionID][]float64),
+	}
+}
+
+func (tm *timelineMetrics) reset() {
+	clear(tm.damage)
+}
+
+func (tm *timelineMetrics) addDamage(sim *Simulation, damage float64) {
+	tm.damage = addToBucket(tm.damage, timelineBucket(sim.CurrentTime), damage)
+}
+
+// Adds the time between start and end to the uptime of the aura.
+func (tm *timelineMetrics) addAuraUptime(actionID ActionID, start time.Duration, end time.Duration) {
+	start = max(start, 0)
+	uptime := tm.auraUptime[actionID]
+	for start < end {
+		bucket := timelineBucket(start)
+		bucketEnd := min(end, time.Duration(bucket+1)*timelineBucketDuration)
+		uptime = addToBucket(uptime, bucket, (bucketEnd - start).Seconds())
+		start = bucketEnd
+	}
+	tm.auraUptime[actionID] = uptime
+}
+
+func (tm *timelineMetrics) addCooldownUse(sim *Simulation, actionID ActionID) {
+	tm.cooldownUses[actionID] = addToBucket(tm.cooldownUses[actionID], timelineBucket(sim.CurrentTime), 1)
+}
+
+func (tm *timelineMetrics) sampleResources(sim *Simulation, unit *Unit) {
+	bucket := timelineBucket(sim.CurrentTime)
+	tm.resourceSamples = addToBucket(tm.resourceSamples, bucket, 1)
+
+	sample := func(resourceType proto.ResourceType, value float64) {
+		tm.resources[resourceType] = addToBucket(tm.resources[resourceType], bucket, value)
+	}
+	if unit.HasManaBar() {
+		sample(proto.ResourceType_ResourceTypeMana, unit.CurrentMana())
+	}
+	if unit.HasRageBar() {
+		sample(proto.ResourceType_ResourceTypeRage, unit.CurrentRage())
+	}
+	if unit.HasEnergyBar() {
+		sample(proto.ResourceType_ResourceTypeEnergy, unit.CurrentEnergy())
+	}
+	if unit.HasFocusBar() {
+		sample(proto.ResourceType_ResourceTypeFocus, unit.CurrentFocus())
+	}
+}
+
+// Adds the damage of the current iteration of a pet to its owner.
+func (tm *timelineMetrics) addPetDamage(pet *timelineMetrics) {
+	tm.damage = mergeSeries(tm.damage, pet.damage)
+}
+
+// This should be called when a Sim iteration is complete.
+func (tm *timelineMetrics) doneIteration(sim *Simulation) {
+	end := sim.CurrentTime
+	for bucket := 0; time.Duration(bucket)*timelineBucketDuration < end; bucket++ {
+		bucketTime := min(timelineBucketDuration, end-time.Duration(bucket)*timelineBucketDuration)
+		tm.simmedSeconds = addToBucket(tm.simmedSeconds, bucket, bucketTime.Seconds())
+		tm.iterations = addToBucket(tm.iterations, bucket, 1)
+	}
+	tm.damageSum = mergeSeries(tm.damageSum, tm.damage)
+}
+
+// Adds the aggregate values of other, which covers the iterations right after those of tm.
+func (tm *timelineMetrics) mergeMetrics(other *timelineMetrics) {
+	tm.simmedSeconds = mergeSeries(tm.simmedSeconds, other.simmedSeconds)
+	tm.iterations = mergeSeries(tm.iterations, other.iterations)
+	tm.damageSum = mergeSeries(tm.damageSum, other.damageSum)
+	tm.resourceSamples = mergeSeries(tm.resourceSamples, other.resourceSamples)
+	for resourceType, values := range other.resources {
+		tm.resources[resourceType] = mergeSeries(tm.resources[resourceType], values)
+	}
+	for actionID, uptime := range other.auraUptime {
+		tm.auraUptime[actionID] = mergeSeries(tm.auraUptime[actionID], uptime)
+	}
+	for actionID, uses := range other.cooldownUses {
+		tm.cooldownUses[actionID] = mergeSeries(tm.cooldownUses[actionID], uses)
+	}
+}
+
+// Divides each bucket of series by the same bucket of divisors, for the buckets of divisors.
+func divideSeries(series []float64, divisors []float64) []float64 {
+	result := make([]float64, len(divisors))
+	for bucket, divisor := range divisors {
+		if bucket < len(series) && divisor != 0 {
+			result[bucket] = series[bucket] / divisor
+		}
+	}
+	return result
+}
+
+func (tm *timelineMetrics) ToProto() *proto.TimelineMetrics {
+	metrics := &proto.TimelineMetrics{
+		BucketSeconds: timelineBucketDuration.Seconds(),
+		Dps:           divideSeries(tm.damageSum, tm.simmedSeconds),
+	}
+
+	for _, resourceType := range sortedKeys(tm.resources) {
+		metrics.Resources = append(metrics.Resources, &proto.ResourceTimeline{
+			Type: resourceType,
+			Avg:  divideSeries(tm.resources[resourceType], tm.resourceSamples[:min(len(tm.resourceSamples), len(tm.simmedSeconds))]),
+		})
+	}
+	for actionID, uptime := range tm.auraUptime {
+		metrics.Auras = append(metrics.Auras, &proto.AuraTimeline{
+			Id:     actionID.ToProto(),
+			Uptime: divideSeries(uptime, tm.simmedSeconds),
+		})
+	}
+	for actionID, uses := range tm.cooldownUses {
+		metrics.Cooldowns = append(metrics.Cooldowns, &proto.CooldownTimeline{
+			Id:   actionID.ToProto(),
+			Uses: divideSeries(uses, tm.iterations),
+		})
+	}
+	return metrics
+}
+
+// Periodically samples the resources of all units with timeline metrics.
+func (sim *Simulation) initTimelineSampleAction() {
+	pa := &PendingAction{
+		NextActionAt: 0,
+		Priority:     ActionPriorityLow,
+	}
+	pa.OnAction = func(sim *Simulation) {
+		for _, unit := range sim.Environment.AllUnits {
+			if unit.IsEnabled() && unit.Metrics.timeline != nil {
+				unit.Metrics.timeline.sampleResources(sim, unit)
+			}
+		}
+
+		pa.NextActionAt = sim.CurrentTime + timelineSampleInterval
+		sim.AddPendingAction(pa)
+	}
+	sim.AddPendingAction(pa)
+}
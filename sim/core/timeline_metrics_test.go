@@ -0,0 +1,24 @@
+package core
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTimelineAuraUptime(t *testing.T) {
+	tm := newTimelineMetrics()
+	actionID := ActionID{SpellID: 1}
+
+	// Two iterations of 3.5s, with the aura active from prepull until 1.5s and from 3s on.
+	for i := 0; i < 2; i++ {
+		tm.addAuraUptime(actionID, -time.Second, time.Millisecond*1500)
+		tm.addAuraUptime(actionID, time.Second*3, time.Millisecond*3500)
+		tm.simmedSeconds = mergeSeries(tm.simmedSeconds, []float64{1, 1, 1, 0.5})
+	}
+
+	uptime := tm.ToProto().Auras[0].Uptime
+	if expected := []float64{1, 0.5, 0, 1}; !slices.Equal(uptime, expected) {
+		t.Errorf("Unexpected uptime %v, expected %v", uptime, expected)
+	}
+}
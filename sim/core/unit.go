@@ -560,6 +560,12 @@ func (unit *Unit) startPull(sim *Simulation) {
 	}
 }
 
+// Adds the metrics of another copy of this unit, which simmed the iterations right after ours.
+func (unit *Unit) mergeMetrics(other *Unit) {
+	unit.Metrics.mergeMetrics(&other.Metrics)
+	unit.auraTracker.mergeMetrics(&other.auraTracker)
+}
+
 func (unit *Unit) doneIteration(sim *Simulation) {
 	unit.Hardcast = Hardcast{}
 
@@ -570,6 +576,10 @@ func (unit *Unit) doneIteration(sim *Simulation) {
 	for _, spell := range unit.Spellbook {
 		spell.doneIteration()
 	}
+
+	if unit.Rotation != nil {
+		unit.Rotation.doneIteration(sim)
+	}
 }
 
 func (unit *Unit) GetSpellsMatchingSchool(school SpellSchool) []*Spell {
@@ -0,0 +1,358 @@
+package core
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"runtime/debug"
+	"slices"
+	"strings"
+
+	googleProto "google.golang.org/protobuf/proto"
+
+	"github.com/wowsims/sod/sim/core/proto"
+)
+
+const (
+	defaultUpgradeFinderItemsPerSlot     = 5
+	defaultUpgradeFinderPresimIterations = 200
+	defaultUpgradeFinderMinIterations    = 200
+	defaultUpgradeFinderMaxIterations    = 3200
+)
+
+func UpgradeFinder(ctx context.Context, request *proto.UpgradeFinderRequest, progress chan *proto.ProgressMetrics) *proto.UpgradeFinderResult {
+	finder := &upgradeFinder{
+		SingleRaidSimRunner: runSim,
+		Request:             request,
+	}
+
+	result, err := finder.Run(ctx, progress)
+	if err != nil {
+		result = &proto.UpgradeFinderResult{
+			ErrorResult: err.Error(),
+		}
+	}
+
+	if progress != nil {
+		progress <- &proto.ProgressMetrics{
+			FinalUpgradeFinderResult: result,
+		}
+		close(progress)
+	}
+
+	return result
+}
+
+// upgradeFinder ranks every item the player may equip in each slot by the DPS change its EP
+// predicts, using the filters and stat weights of the gear optimizer. EP misses the value of
+// item effects, so each item with an effect gets a short presim, and the DPS it adds beyond
+// its EP is added to its estimate. The best items of each slot are then simmed against the
+// equipped gear, one slot at a time.
+type upgradeFinder struct {
+	// SingleRaidSimRunner used to run each batch of iterations.
+	SingleRaidSimRunner raidSimRunner
+	// Request used for this search.
+	Request *proto.UpgradeFinderRequest
+
+	settings *proto.UpgradeFinderSettings
+	gear     *gearOptimizer
+}
+
+// upgradeCandidate is an item that may replace the equipped item of a slot.
+type upgradeCandidate struct {
+	*gearCandidate
+	slot      proto.ItemSlot
+	estimate  float64 // DPS change expected from EP and the presim.
+	presimmed bool
+	race      *raceCandidate
+}
+
+func (uf *upgradeFinder) Run(pctx context.Context, progress chan *proto.ProgressMetrics) (result *proto.UpgradeFinderResult, resultErr error) {
+	ctx, cancel := context.WithCancel(pctx)
+	defer func() {
+		if err := recover(); err != nil {
+			result = &proto.UpgradeFinderResult{
+				ErrorResult: fmt.Sprintf("%v\nStack Trace:\n%s", err, string(debug.Stack())),
+			}
+		}
+		cancel()
+	}()
+
+	uf.settings = uf.Request.GetSettings()
+	if uf.settings == nil {
+		uf.settings = &proto.UpgradeFinderSettings{}
+	}
+	uf.gear = &gearOptimizer{
+		SingleRaidSimRunner: uf.SingleRaidSimRunner,
+		Request: &proto.GearOptimizerRequest{
+			BaseSettings: uf.Request.GetBaseSettings(),
+			Settings: &proto.GearOptimizerSettings{
+				Player:    uf.settings.Player,
+				Filters:   uf.settings.Filters,
+				EpWeights: uf.settings.EpWeights,
+				DualWield: uf.settings.DualWield,
+			},
+		},
+	}
+	gear := uf.gear
+	if err := gear.setup(); err != nil {
+		return nil, fmt.Errorf("upgrade finder: %w", err)
+	}
+
+	itemsPerSlot := int(uf.settings.ItemsPerSlot)
+	if itemsPerSlot <= 0 {
+		itemsPerSlot = defaultUpgradeFinderItemsPerSlot
+	}
+	presimIterations := int(uf.settings.PresimIterations)
+	if presimIterations <= 0 {
+		presimIterations = defaultUpgradeFinderPresimIterations
+	}
+	minIterations := int(uf.settings.MinIterations)
+	if minIterations <= 0 {
+		minIterations = defaultUpgradeFinderMinIterations
+	}
+	maxIterations := int(uf.settings.MaxIterations)
+	if maxIterations <= 0 {
+		maxIterations = defaultUpgradeFinderMaxIterations
+	}
+	maxIterations = max(maxIterations, minIterations, presimIterations)
+
+	candidates := gear.collectCandidates()
+	if gear.settings.EpWeights != nil {
+		gear.weights = unitStatsFromProto(gear.settings.EpWeights)
+	} else {
+		gear.weights = gear.computeWeights(candidates, progress)
+	}
+	for _, slotCandidates := range candidates {
+		for _, candidate := range slotCandidates {
+			gear.pickRandomSuffix(candidate)
+			candidate.ep = gear.itemEP(candidate)
+		}
+	}
+
+	// Each item with an effect is presimmed once, in the first slot it may go in.
+	slots := uf.searchedSlots()
+	upgrades := make(map[proto.ItemSlot][]*upgradeCandidate, len(slots))
+	equippedEP := make(map[proto.ItemSlot]float64, len(slots))
+	var presims []*upgradeCandidate
+	presimmedItems := map[int32]bool{}
+	for _, slot := range slots {
+		equippedEP[slot] = uf.equippedEP(slot)
+		for _, candidate := range uf.slotCandidates(candidates, slot) {
+			upgrade := &upgradeCandidate{gearCandidate: candidate, slot: slot}
+			upgrade.estimate = gear.slotEP(candidate, slot) - equippedEP[slot]
+			upgrade.presimmed = HasItemEffect(candidate.item.ID)
+			if upgrade.presimmed && !presimmedItems[candidate.item.ID] {
+				presimmedItems[candidate.item.ID] = true
+				upgrade.race = &raceCandidate{Request: uf.requestFor(upgrade)}
+				presims = append(presims, upgrade)
+			}
+			upgrades[slot] = append(upgrades[slot], upgrade)
+		}
+	}
+
+	race := newSimRace(gear.SingleRaidSimRunner, gear.baseRequest, gear.partyIdx, gear.playerIdx, progress)
+	base := &raceCandidate{Request: googleProto.Clone(gear.baseRequest).(*proto.RaidSimRequest)}
+	race.expect(len(presims)+1, (len(presims)+1)*presimIterations+len(slots)*itemsPerSlot*minIterations*2+maxIterations)
+	if err := race.extend(ctx, append([]*raceCandidate{base}, MapSlice(presims, func(u *upgradeCandidate) *raceCandidate { return u.race })...), presimIterations); err != nil {
+		return nil, err
+	}
+	effectValues := make(map[int32]float64, len(presims))
+	for _, presim := range presims {
+		delta, _ := compareRaceCandidates(presim.race, base)
+		effectValues[presim.item.ID] = delta - presim.estimate
+	}
+
+	// The equipped gear is the baseline of every slot, so it's simmed to the end first.
+	if err := race.extend(ctx, []*raceCandidate{base}, maxIterations); err != nil {
+		return nil, err
+	}
+
+	result = &proto.UpgradeFinderResult{
+		ItemsPresimmed: int32(len(presims)),
+	}
+	for _, slot := range slots {
+		slotUpgrades := upgrades[slot]
+		result.ItemsRanked += int32(len(slotUpgrades))
+		for _, upgrade := range slotUpgrades {
+			upgrade.estimate += effectValues[upgrade.item.ID]
+		}
+		slices.SortStableFunc(slotUpgrades, func(a, b *upgradeCandidate) int {
+			return cmp.Compare(b.estimate, a.estimate)
+		})
+		slotUpgrades = slotUpgrades[:min(len(slotUpgrades), itemsPerSlot)]
+		for _, upgrade := range slotUpgrades {
+			if upgrade.race == nil {
+				upgrade.race = &raceCandidate{Request: uf.requestFor(upgrade)}
+			}
+		}
+		result.ItemsSimmed += int32(len(slotUpgrades))
+
+		// Items clearly worse than the best one of the slot drop out early.
+		races := MapSlice(slotUpgrades, func(u *upgradeCandidate) *raceCandidate { return u.race })
+		if len(races) > 0 {
+			if err := race.run(ctx, races, minIterations, maxIterations, 1); err != nil {
+				return nil, err
+			}
+			if err := race.extend(ctx, FilterSlice(races, func(c *raceCandidate) bool { return !c.Eliminated }), maxIterations); err != nil {
+				return nil, err
+			}
+		}
+
+		result.Slots = append(result.Slots, uf.slotToProto(slot, slotUpgrades, base))
+	}
+	return result, nil
+}
+
+// Returns the slots to search. The off hand is skipped when a two-hander is equipped.
+func (uf *upgradeFinder) searchedSlots() []proto.ItemSlot {
+	slots := uf.settings.Slots
+	if len(slots) == 0 {
+		for slot := range uf.gear.equipment.Items {
+			slots = append(slots, proto.ItemSlot(slot))
+		}
+	}
+
+	mainHand, ok := ItemsByID[uf.gear.equipment.Items[proto.ItemSlot_ItemSlotMainHand].Id]
+	usesTwoHander := ok && mainHand.HandType == proto.HandType_HandTypeTwoHand
+	return FilterSlice(slots, func(slot proto.ItemSlot) bool {
+		return int(slot) < len(uf.gear.equipment.Items) && !(slot == proto.ItemSlot_ItemSlotOffHand && usesTwoHander)
+	})
+}
+
+func pairedSlot(slot proto.ItemSlot) (proto.ItemSlot, bool) {
+	switch slot {
+	case proto.ItemSlot_ItemSlotFinger1:
+		return proto.ItemSlot_ItemSlotFinger2, true
+	case proto.ItemSlot_ItemSlotFinger2:
+		return proto.ItemSlot_ItemSlotFinger1, true
+	case proto.ItemSlot_ItemSlotTrinket1:
+		return proto.ItemSlot_ItemSlotTrinket2, true
+	case proto.ItemSlot_ItemSlotTrinket2:
+		return proto.ItemSlot_ItemSlotTrinket1, true
+	}
+	return 0, false
+}
+
+// Returns the candidates that may replace the equipped item of the slot, keeping the rest of
+// the equipment valid.
+func (uf *upgradeFinder) slotCandidates(candidates [][]*gearCandidate, slot proto.ItemSlot) []*gearCandidate {
+	equipment := uf.gear.equipment
+	equipped := equipment.Items[slot]
+	return FilterSlice(candidates[slot], func(candidate *gearCandidate) bool {
+		if candidate.spec.Id == equipped.Id && candidate.spec.RandomSuffix == equipped.RandomSuffix {
+			return false
+		}
+		// Unique rings and trinkets may not be equipped twice.
+		if other, ok := pairedSlot(slot); ok && candidate.unique {
+			if otherItem, ok := ItemsByID[equipment.Items[other].Id]; ok && (otherItem.ID == candidate.item.ID || otherItem.Name == candidate.item.Name) {
+				return false
+			}
+		}
+		if slot == proto.ItemSlot_ItemSlotOffHand && candidate.unique && candidate.item.ID == equipment.Items[proto.ItemSlot_ItemSlotMainHand].Id {
+			return false
+		}
+		return true
+	})
+}
+
+func (uf *upgradeFinder) equippedEP(slot proto.ItemSlot) float64 {
+	spec := uf.gear.equipment.Items[slot]
+	item, ok := ItemsByID[spec.Id]
+	if !ok {
+		return 0
+	}
+	candidate := &gearCandidate{item: item, spec: spec}
+	candidate.ep = uf.gear.itemEP(candidate)
+	return uf.gear.slotEP(candidate, slot)
+}
+
+// Builds the request with the item of the candidate replacing the equipped one, keeping the
+// rune and enchant of the slot where they still fit. Two-handers also empty the off hand.
+func (uf *upgradeFinder) requestFor(upgrade *upgradeCandidate) *proto.RaidSimRequest {
+	gear := uf.gear
+	request := googleProto.Clone(gear.baseRequest).(*proto.RaidSimRequest)
+	equipment := googleProto.Clone(gear.equipment).(*proto.EquipmentSpec)
+	request.Raid.Parties[gear.partyIdx].Players[gear.playerIdx].Equipment = equipment
+
+	equipped := gear.equipment.Items[upgrade.slot]
+	spec := googleProto.Clone(upgrade.spec).(*proto.ItemSpec)
+	if item, ok := ItemsByID[equipped.Id]; ok && item.HandType == upgrade.item.HandType && item.Type == upgrade.item.Type {
+		spec.Enchant = equipped.Enchant
+	}
+	spec.Rune = equipped.Rune
+	equipment.Items[upgrade.slot] = spec
+
+	if upgrade.slot == proto.ItemSlot_ItemSlotMainHand && upgrade.item.HandType == proto.HandType_HandTypeTwoHand {
+		equipment.Items[proto.ItemSlot_ItemSlotOffHand] = &proto.ItemSpec{}
+	}
+	return request
+}
+
+func (uf *upgradeFinder) slotToProto(slot proto.ItemSlot, upgrades []*upgradeCandidate, base *raceCandidate) *proto.SlotUpgrades {
+	result := &proto.SlotUpgrades{
+		Slot:        slot,
+		Equipped:    uf.gear.equipment.Items[slot],
+		EquippedDps: base.Mean(),
+	}
+	for _, upgrade := range upgrades {
+		delta, halfWidth := compareRaceCandidates(upgrade.race, base)
+		result.Upgrades = append(result.Upgrades, &proto.ItemUpgrade{
+			Item:              upgrade.spec,
+			Name:              upgrade.item.Name,
+			EstimatedDpsDelta: upgrade.estimate,
+			Presimmed:         upgrade.presimmed,
+			Dps:               upgrade.race.Mean(),
+			DpsDelta:          delta,
+			DpsDeltaCiLow:     delta - halfWidth,
+			DpsDeltaCiHigh:    delta + halfWidth,
+			Iterations:        int32(len(upgrade.race.Values)),
+			Sources:           itemSourceNames(uiItemsByID[upgrade.item.ID]),
+		})
+	}
+	slices.SortStableFunc(result.Upgrades, func(a, b *proto.ItemUpgrade) int {
+		return cmp.Compare(b.DpsDelta, a.DpsDelta)
+	})
+	return result
+}
+
+// Describes where an item comes from, e.g. "Drop: Mekgineer Thermaplugg (Gnomeregan)".
+func itemSourceNames(uiItem *proto.UIItem) []string {
+	withZone := func(name string, zoneID int32) string {
+		zone, ok := uiZonesByID[zoneID]
+		switch {
+		case !ok:
+			return name
+		case name == "":
+			return zone.Name
+		}
+		return fmt.Sprintf("%s (%s)", name, zone.Name)
+	}
+
+	var names []string
+	for _, source := range uiItem.GetSources() {
+		switch source := source.Source.(type) {
+		case *proto.UIItemSource_Crafted:
+			names = append(names, "Crafted: "+source.Crafted.Profession.String())
+		case *proto.UIItemSource_Drop:
+			name := source.Drop.OtherName
+			if npc, ok := uiNpcsByID[source.Drop.NpcId]; ok {
+				name = npc.Name
+			}
+			names = append(names, "Drop: "+withZone(name, source.Drop.ZoneId))
+		case *proto.UIItemSource_Quest:
+			name := source.Quest.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", source.Quest.Id)
+			}
+			names = append(names, "Quest: "+name)
+		case *proto.UIItemSource_SoldBy:
+			names = append(names, "Sold by: "+withZone(source.SoldBy.NpcName, source.SoldBy.ZoneId))
+		case *proto.UIItemSource_Rep:
+			names = append(names, fmt.Sprintf("Reputation: %s (%s)",
+				strings.TrimPrefix(source.Rep.RepFactionId.String(), "RepFaction"),
+				strings.TrimPrefix(source.Rep.RepLevel.String(), "RepLevel")))
+		}
+	}
+	return names
+}
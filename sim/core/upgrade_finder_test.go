@@ -0,0 +1,135 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/wowsims/sod/sim/core/proto"
+	"github.com/wowsims/sod/sim/core/stats"
+)
+
+func TestUpgradeRingCandidates(t *testing.T) {
+	const uniqueRing, otherRing = 993001, 993002
+	addToDatabase(&proto.SimDatabase{Items: []*proto.SimItem{
+		{Id: uniqueRing, Name: "Unique Ring", Type: proto.ItemType_ItemTypeFinger},
+		{Id: otherRing, Name: "Other Ring", Type: proto.ItemType_ItemTypeFinger},
+	}})
+
+	candidates := make([][]*gearCandidate, len(proto.ItemSlot_name))
+	candidates[proto.ItemSlot_ItemSlotFinger2] = []*gearCandidate{
+		{item: ItemsByID[uniqueRing], spec: &proto.ItemSpec{Id: uniqueRing}, unique: true},
+		{item: ItemsByID[otherRing], spec: &proto.ItemSpec{Id: otherRing}},
+	}
+
+	for _, equipped := range []int32{uniqueRing, otherRing} {
+		equipment := createEquipmentFromItems()
+		equipment.Items[proto.ItemSlot_ItemSlotFinger1] = &proto.ItemSpec{Id: equipped}
+		uf := &upgradeFinder{gear: &gearOptimizer{equipment: equipment}}
+
+		ids := MapSlice(uf.slotCandidates(candidates, proto.ItemSlot_ItemSlotFinger2), func(candidate *gearCandidate) int32 {
+			return candidate.item.ID
+		})
+		// Only the unique ring can't be worn twice.
+		expected := []int32{uniqueRing, otherRing}
+		if equipped == uniqueRing {
+			expected = []int32{otherRing}
+		}
+		if !slices.Equal(ids, expected) {
+			t.Errorf("Unexpected candidates %v with %d equipped, expected %v", ids, equipped, expected)
+		}
+	}
+}
+
+func TestUpgradeFinder(t *testing.T) {
+	items := []*proto.SimItem{
+		newSpellPowerItem(1, proto.ItemType_ItemTypeHead, 5),
+		newSpellPowerItem(2, proto.ItemType_ItemTypeHead, 20),
+		newSpellPowerItem(3, proto.ItemType_ItemTypeHead, 15),
+		newSpellPowerItem(4, proto.ItemType_ItemTypeHead, 1),
+		newSpellPowerItem(5, proto.ItemType_ItemTypeHead, 0),
+		newSpellPowerItem(11, proto.ItemType_ItemTypeFinger, 30),
+		newSpellPowerItem(12, proto.ItemType_ItemTypeFinger, 25),
+		newSpellPowerItem(13, proto.ItemType_ItemTypeFinger, 10),
+		newSpellPowerItem(14, proto.ItemType_ItemTypeFinger, 40),
+	}
+	// Unique items are also told apart by name.
+	for _, item := range items {
+		item.Name = fmt.Sprintf("Item %d", item.Id)
+	}
+	useTestDatabase(t, &proto.SimDatabase{Items: items}, &proto.UIItem{Id: 11, Unique: true}, &proto.UIItem{Id: 12, Unique: true}, &proto.UIItem{Id: 13, Unique: true}, &proto.UIItem{Id: 14, Unique: true})
+	// Head 5 has no stats, but an effect worth 30 dps that only the presim finds.
+	itemEffects[5] = func(Agent) {}
+	t.Cleanup(func() { delete(itemEffects, 5) })
+	runner := func(rsr *proto.RaidSimRequest, progress chan *proto.ProgressMetrics, isTest bool) *proto.RaidSimResult {
+		result := fakeSpellPowerSimRunner(rsr, progress, isTest)
+		if rsr.Raid.Parties[0].Players[0].Equipment.Items[proto.ItemSlot_ItemSlotHead].Id == 5 {
+			result = fakeBulkSimResult(rsr, result.RaidMetrics.Dps.Avg+30)
+		}
+		return result
+	}
+
+	rsr := fakeCasterRaidSimRequest()
+	rsr.Raid.Parties[0].Players[0].Equipment = createEquipmentFromItems(
+		&itemWithSlot{Slot: proto.ItemSlot_ItemSlotHead, Item: &proto.ItemSpec{Id: 1}},
+		&itemWithSlot{Slot: proto.ItemSlot_ItemSlotFinger1, Item: &proto.ItemSpec{Id: 11}},
+		&itemWithSlot{Slot: proto.ItemSlot_ItemSlotFinger2, Item: &proto.ItemSpec{Id: 12}},
+	)
+
+	slots := []proto.ItemSlot{proto.ItemSlot_ItemSlotHead, proto.ItemSlot_ItemSlotFinger1}
+	finder := &upgradeFinder{
+		SingleRaidSimRunner: runner,
+		Request: &proto.UpgradeFinderRequest{
+			BaseSettings: rsr,
+			Settings: &proto.UpgradeFinderSettings{
+				EpWeights:        &proto.UnitStats{Stats: stats.Stats{stats.SpellPower: 1}.ToFloatArray()},
+				Slots:            slots,
+				ItemsPerSlot:     3,
+				PresimIterations: 20,
+				MinIterations:    50,
+				MaxIterations:    100,
+			},
+		},
+	}
+	result, err := finder.Run(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Upgrade finder failed with error: %v", err)
+	}
+	if result.ErrorResult != "" {
+		t.Fatalf("Upgrade finder failed with error: %s", result.ErrorResult)
+	}
+	// Every head but the equipped one, and the rings other than the unique one in the other
+	// finger slot, are ranked. Only the best 3 heads are simmed.
+	if len(result.Slots) != 2 || result.ItemsRanked != 6 || result.ItemsSimmed != 5 || result.ItemsPresimmed != 1 {
+		t.Fatalf("Expected 5 of 6 ranked items simmed in 2 slots with 1 presim, got %d of %d in %d slots with %d presims", result.ItemsSimmed, result.ItemsRanked, len(result.Slots), result.ItemsPresimmed)
+	}
+
+	expected := []struct {
+		equippedDps float64
+		items       []int32
+		deltas      []float64
+		iterations  []int32
+	}{
+		{60, []int32{5, 2, 3}, []float64{25, 15, 10}, []int32{100, 50, 50}},
+		{60, []int32{14, 13}, []float64{10, -20}, []int32{100, 50}},
+	}
+	for i, slotUpgrades := range result.Slots {
+		if slotUpgrades.Slot != slots[i] || slotUpgrades.EquippedDps != expected[i].equippedDps {
+			t.Errorf("Expected upgrades for %s over %.0f dps, got %s over %.3f dps", slots[i], expected[i].equippedDps, slotUpgrades.Slot, slotUpgrades.EquippedDps)
+		}
+		ids := MapSlice(slotUpgrades.Upgrades, func(upgrade *proto.ItemUpgrade) int32 { return upgrade.Item.Id })
+		deltas := MapSlice(slotUpgrades.Upgrades, func(upgrade *proto.ItemUpgrade) float64 { return upgrade.DpsDelta })
+		if !slices.Equal(ids, expected[i].items) || !slices.Equal(deltas, expected[i].deltas) {
+			t.Errorf("Expected upgrades %v with deltas %v for %s, got %v with %v", expected[i].items, expected[i].deltas, slots[i], ids, deltas)
+		}
+		// Items worse than the best one of the slot drop out of the race early.
+		if iterations := MapSlice(slotUpgrades.Upgrades, func(upgrade *proto.ItemUpgrade) int32 { return upgrade.Iterations }); !slices.Equal(iterations, expected[i].iterations) {
+			t.Errorf("Expected %v iterations for %s, got %v", expected[i].iterations, slots[i], iterations)
+		}
+	}
+
+	if head := result.Slots[0].Upgrades[0]; !head.Presimmed || head.EstimatedDpsDelta != 25 {
+		t.Errorf("Expected the presim to estimate head 5 at 25 dps, got %v", head)
+	}
+}
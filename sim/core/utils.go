@@ -105,6 +105,27 @@ func WithinToleranceFloat64(expectedValue float64, actualValue float64, toleranc
 	return actualValue >= (expectedValue-tolerance) && actualValue <= (expectedValue+tolerance)
 }
 
+// Number of ticks happening in [nextTick, end], for a resource that ticks every period.
+func numTicksUntil(nextTick time.Duration, period time.Duration, end time.Duration) int {
+	if nextTick == NeverExpires || nextTick > end {
+		return 0
+	}
+	return int((end-nextTick)/period) + 1
+}
+
+// Time until a resource that gains perTick every period reaches the desired amount, or
+// NeverExpires if it never will.
+func timeToTickedResource(sim *Simulation, current float64, maxValue float64, desired float64, perTick float64, nextTick time.Duration, period time.Duration) time.Duration {
+	if current >= desired {
+		return 0
+	}
+	if desired > maxValue || perTick <= 0 || nextTick == NeverExpires {
+		return NeverExpires
+	}
+	ticks := int(math.Ceil((desired - current) / perTick))
+	return nextTick + time.Duration(ticks-1)*period - sim.CurrentTime
+}
+
 // Returns a new slice by applying f to each element in src.
 func MapSlice[I any, O any](src []I, f func(I) O) []O {
 	dst := make([]O, len(src))
@@ -192,3 +213,21 @@ func (x *aggregator) meanAndStdDev() (float64, float64) {
 	stdDev := math.Sqrt(x.sumSq/float64(x.n) - mean*mean)
 	return mean, stdDev
 }
+
+// Z-score used for 95% confidence intervals.
+const confidenceZ95 = 1.959964
+
+// Returns the mean along with the half-width of its 95% confidence interval.
+func (x *aggregator) meanAndConfidence() (float64, float64) {
+	return x.sum / math.Max(float64(x.n), 1), confidenceZ95 * x.stdErr()
+}
+
+// Returns the standard error of the mean, based on the sample variance.
+func (x *aggregator) stdErr() float64 {
+	if x.n < 2 {
+		return math.Inf(1)
+	}
+	mean := x.sum / float64(x.n)
+	variance := math.Max(x.sumSq-mean*mean*float64(x.n), 0) / float64(x.n-1)
+	return math.Sqrt(variance / float64(x.n))
+}
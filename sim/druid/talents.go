@@ -4,9 +4,72 @@ import (
 	"time"
 
 	"github.com/wowsims/sod/sim/core"
+	"github.com/wowsims/sod/sim/core/proto"
 	"github.com/wowsims/sod/sim/core/stats"
 )
 
+// Layout of the talent trees, in the order of the talents string. Matches
+// ui/core/talents/trees/druid.json.
+var talentTrees = [3]core.TalentTreeLayout{
+	{ // Balance
+		{Row: 0, Col: 0, MaxPoints: 5}, // improvedWrath
+		{Row: 0, Col: 1, MaxPoints: 1}, // naturesGrasp
+		{Row: 0, Col: 2, MaxPoints: 4, Prereq: &core.TalentLocation{Row: 0, Col: 1}}, // improvedNaturesGrasp
+		{Row: 1, Col: 0, MaxPoints: 3}, // improvedEntanglingRoots
+		{Row: 1, Col: 1, MaxPoints: 5}, // improvedMoonfire
+		{Row: 1, Col: 2, MaxPoints: 5}, // naturalWeapons
+		{Row: 1, Col: 3, MaxPoints: 3}, // naturalShapeshifter
+		{Row: 2, Col: 0, MaxPoints: 3}, // improvedThorns
+		{Row: 2, Col: 2, MaxPoints: 1, Prereq: &core.TalentLocation{Row: 1, Col: 2}}, // omenOfClarity
+		{Row: 2, Col: 3, MaxPoints: 2}, // naturesReach
+		{Row: 3, Col: 1, MaxPoints: 5, Prereq: &core.TalentLocation{Row: 1, Col: 1}}, // vengeance
+		{Row: 3, Col: 2, MaxPoints: 5}, // improvedStarfire
+		{Row: 4, Col: 1, MaxPoints: 1}, // naturesGrace
+		{Row: 4, Col: 2, MaxPoints: 3}, // moonglow
+		{Row: 5, Col: 1, MaxPoints: 5, Prereq: &core.TalentLocation{Row: 4, Col: 1}}, // moonfury
+		{Row: 6, Col: 1, MaxPoints: 1}, // moonkinForm
+	},
+	{ // Feral Combat
+		{Row: 0, Col: 1, MaxPoints: 5}, // ferocity
+		{Row: 0, Col: 2, MaxPoints: 5}, // feralAggression
+		{Row: 1, Col: 0, MaxPoints: 5}, // feralInstinct
+		{Row: 1, Col: 1, MaxPoints: 2}, // brutalImpact
+		{Row: 1, Col: 2, MaxPoints: 5}, // thickHide
+		{Row: 2, Col: 0, MaxPoints: 2}, // felineSwiftness
+		{Row: 2, Col: 1, MaxPoints: 1}, // feralCharge
+		{Row: 2, Col: 2, MaxPoints: 3}, // sharpenedClaws
+		{Row: 3, Col: 0, MaxPoints: 2}, // improvedShred
+		{Row: 3, Col: 1, MaxPoints: 3}, // predatoryStrikes
+		{Row: 3, Col: 2, MaxPoints: 2, Prereq: &core.TalentLocation{Row: 2, Col: 2}}, // bloodFrenzy
+		{Row: 3, Col: 3, MaxPoints: 2}, // primalFury
+		{Row: 4, Col: 0, MaxPoints: 2}, // savageFury
+		{Row: 4, Col: 2, MaxPoints: 1}, // faerieFireFeral
+		{Row: 5, Col: 1, MaxPoints: 5, Prereq: &core.TalentLocation{Row: 3, Col: 1}}, // heartOfTheWild
+		{Row: 6, Col: 1, MaxPoints: 1}, // leaderOfThePack
+	},
+	{ // Restoration
+		{Row: 0, Col: 1, MaxPoints: 5}, // improvedMarkOfTheWild
+		{Row: 0, Col: 2, MaxPoints: 5}, // furor
+		{Row: 1, Col: 0, MaxPoints: 5}, // improvedHealingTouch
+		{Row: 1, Col: 1, MaxPoints: 5}, // naturesFocus
+		{Row: 1, Col: 2, MaxPoints: 2}, // improvedEnrage
+		{Row: 2, Col: 1, MaxPoints: 3}, // reflection
+		{Row: 2, Col: 2, MaxPoints: 1}, // insectSwarm
+		{Row: 2, Col: 3, MaxPoints: 5}, // subtlety
+		{Row: 3, Col: 1, MaxPoints: 5}, // tranquilSpirit
+		{Row: 3, Col: 3, MaxPoints: 3}, // improvedRejuvenation
+		{Row: 4, Col: 0, MaxPoints: 1, Prereq: &core.TalentLocation{Row: 1, Col: 0}}, // naturesSwiftness
+		{Row: 4, Col: 2, MaxPoints: 5, Prereq: &core.TalentLocation{Row: 2, Col: 2}}, // giftOfNature
+		{Row: 4, Col: 3, MaxPoints: 2}, // improvedTranquility
+		{Row: 5, Col: 2, MaxPoints: 5}, // improvedRegrowth
+		{Row: 6, Col: 1, MaxPoints: 1, Prereq: &core.TalentLocation{Row: 3, Col: 1}}, // swiftmend
+	},
+}
+
+func init() {
+	core.RegisterTalentTrees(proto.Class_ClassDruid, &proto.DruidTalents{}, talentTrees)
+}
+
 func (druid *Druid) ThickHideMultiplier() float64 {
 	thickHideMulti := 1.0
 
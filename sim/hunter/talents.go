@@ -8,6 +8,67 @@ import (
 	"github.com/wowsims/sod/sim/core/stats"
 )
 
+// Layout of the talent trees, in the order of the talents string. Matches
+// ui/core/talents/trees/hunter.json.
+var talentTrees = [3]core.TalentTreeLayout{
+	{ // Beast Mastery
+		{Row: 0, Col: 1, MaxPoints: 5}, // improvedAspectOfTheHawk
+		{Row: 0, Col: 2, MaxPoints: 5}, // enduranceTraining
+		{Row: 1, Col: 0, MaxPoints: 2}, // improvedEyesOfTheBeast
+		{Row: 1, Col: 1, MaxPoints: 5}, // improvedAspectOfTheMonkey
+		{Row: 1, Col: 2, MaxPoints: 3}, // thickHide
+		{Row: 1, Col: 3, MaxPoints: 2}, // improvedRevivePet
+		{Row: 2, Col: 0, MaxPoints: 2}, // pathfinding
+		{Row: 2, Col: 1, MaxPoints: 1}, // bestialSwiftness
+		{Row: 2, Col: 2, MaxPoints: 5}, // unleashedFury
+		{Row: 3, Col: 1, MaxPoints: 2}, // improvedMendPet
+		{Row: 3, Col: 2, MaxPoints: 5}, // ferocity
+		{Row: 4, Col: 0, MaxPoints: 2}, // spiritBond
+		{Row: 4, Col: 1, MaxPoints: 1}, // intimidation
+		{Row: 4, Col: 3, MaxPoints: 2}, // bestialDiscipline
+		{Row: 5, Col: 2, MaxPoints: 5, Prereq: &core.TalentLocation{Row: 3, Col: 2}}, // frenzy
+		{Row: 6, Col: 1, MaxPoints: 1, Prereq: &core.TalentLocation{Row: 4, Col: 1}}, // bestialWrath
+	},
+	{ // Marksmanship
+		{Row: 0, Col: 1, MaxPoints: 5}, // improvedConcussiveShot
+		{Row: 0, Col: 2, MaxPoints: 5}, // efficiency
+		{Row: 1, Col: 1, MaxPoints: 5}, // improvedHuntersMark
+		{Row: 1, Col: 2, MaxPoints: 5}, // lethalShots
+		{Row: 2, Col: 0, MaxPoints: 1}, // aimedShot
+		{Row: 2, Col: 1, MaxPoints: 5}, // improvedArcaneShot
+		{Row: 2, Col: 3, MaxPoints: 3}, // hawkEye
+		{Row: 3, Col: 1, MaxPoints: 5}, // improvedSerpentSting
+		{Row: 3, Col: 2, MaxPoints: 5, Prereq: &core.TalentLocation{Row: 1, Col: 2}}, // mortalShots
+		{Row: 4, Col: 0, MaxPoints: 1}, // scatterShot
+		{Row: 4, Col: 1, MaxPoints: 3}, // barrage
+		{Row: 4, Col: 2, MaxPoints: 3}, // improvedScorpidSting
+		{Row: 5, Col: 2, MaxPoints: 5}, // rangedWeaponSpecialization
+		{Row: 6, Col: 1, MaxPoints: 1, Prereq: &core.TalentLocation{Row: 4, Col: 1}}, // trueshotAura
+	},
+	{ // Survival
+		{Row: 0, Col: 0, MaxPoints: 3}, // monsterSlaying
+		{Row: 0, Col: 1, MaxPoints: 3}, // humanoidSlaying
+		{Row: 0, Col: 2, MaxPoints: 5}, // deflection
+		{Row: 1, Col: 0, MaxPoints: 5}, // entrapment
+		{Row: 1, Col: 1, MaxPoints: 2}, // savageStrikes
+		{Row: 1, Col: 2, MaxPoints: 5}, // improvedWingClip
+		{Row: 2, Col: 0, MaxPoints: 2}, // cleverTraps
+		{Row: 2, Col: 1, MaxPoints: 5}, // survivalist
+		{Row: 2, Col: 2, MaxPoints: 1}, // deterrence
+		{Row: 3, Col: 0, MaxPoints: 2}, // trapMastery
+		{Row: 3, Col: 1, MaxPoints: 3}, // surefooted
+		{Row: 3, Col: 3, MaxPoints: 2}, // improvedFeignDeath
+		{Row: 4, Col: 1, MaxPoints: 3}, // killerInstinct
+		{Row: 4, Col: 2, MaxPoints: 1, Prereq: &core.TalentLocation{Row: 2, Col: 2}}, // counterattack
+		{Row: 5, Col: 2, MaxPoints: 5}, // lightningReflexes
+		{Row: 6, Col: 1, MaxPoints: 1, Prereq: &core.TalentLocation{Row: 4, Col: 1}}, // wyvernSting
+	},
+}
+
+func init() {
+	core.RegisterTalentTrees(proto.Class_ClassHunter, &proto.HunterTalents{}, talentTrees)
+}
+
 func (hunter *Hunter) ApplyTalents() {
 	if hunter.pet != nil {
 		hunter.applyFrenzy()
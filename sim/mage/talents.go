@@ -4,9 +4,74 @@ import (
 	"time"
 
 	"github.com/wowsims/sod/sim/core"
+	"github.com/wowsims/sod/sim/core/proto"
 	"github.com/wowsims/sod/sim/core/stats"
 )
 
+// Layout of the talent trees, in the order of the talents string. Matches
+// ui/core/talents/trees/mage.json.
+var talentTrees = [3]core.TalentTreeLayout{
+	{ // Arcane
+		{Row: 0, Col: 0, MaxPoints: 2}, // arcaneSubtlety
+		{Row: 0, Col: 1, MaxPoints: 5}, // arcaneFocus
+		{Row: 0, Col: 2, MaxPoints: 5}, // improvedArcaneMissiles
+		{Row: 1, Col: 0, MaxPoints: 2}, // wandSpecialization
+		{Row: 1, Col: 1, MaxPoints: 5}, // magicAbsorption
+		{Row: 1, Col: 2, MaxPoints: 5}, // arcaneConcentration
+		{Row: 2, Col: 0, MaxPoints: 2}, // magicAttunement
+		{Row: 2, Col: 1, MaxPoints: 3}, // improvedArcaneExplosion
+		{Row: 2, Col: 2, MaxPoints: 1}, // arcaneResilience
+		{Row: 3, Col: 0, MaxPoints: 2}, // improvedManaShield
+		{Row: 3, Col: 1, MaxPoints: 2}, // improvedCounterspell
+		{Row: 3, Col: 3, MaxPoints: 3}, // arcaneMeditation
+		{Row: 4, Col: 1, MaxPoints: 1}, // presenceOfMind
+		{Row: 4, Col: 2, MaxPoints: 5, Prereq: &core.TalentLocation{Row: 2, Col: 2}}, // arcaneMind
+		{Row: 5, Col: 1, MaxPoints: 3, Prereq: &core.TalentLocation{Row: 4, Col: 1}}, // arcaneInstability
+		{Row: 6, Col: 1, MaxPoints: 1, Prereq: &core.TalentLocation{Row: 5, Col: 1}}, // arcanePower
+	},
+	{ // Fire
+		{Row: 0, Col: 1, MaxPoints: 5}, // improvedFireball
+		{Row: 0, Col: 2, MaxPoints: 5}, // impact
+		{Row: 1, Col: 0, MaxPoints: 5}, // ignite
+		{Row: 1, Col: 1, MaxPoints: 2}, // flameThrowing
+		{Row: 1, Col: 2, MaxPoints: 3}, // improvedFireBlast
+		{Row: 2, Col: 0, MaxPoints: 2}, // incinerate
+		{Row: 2, Col: 1, MaxPoints: 3}, // improvedFlamestrike
+		{Row: 2, Col: 2, MaxPoints: 1}, // pyroblast
+		{Row: 2, Col: 3, MaxPoints: 2}, // burningSoul
+		{Row: 3, Col: 0, MaxPoints: 3}, // improvedScorch
+		{Row: 3, Col: 1, MaxPoints: 2}, // improvedFireWard
+		{Row: 3, Col: 3, MaxPoints: 3}, // masterOfElements
+		{Row: 4, Col: 1, MaxPoints: 3}, // criticalMass
+		{Row: 4, Col: 2, MaxPoints: 1, Prereq: &core.TalentLocation{Row: 2, Col: 2}}, // blastWave
+		{Row: 5, Col: 2, MaxPoints: 5}, // firePower
+		{Row: 6, Col: 1, MaxPoints: 1, Prereq: &core.TalentLocation{Row: 4, Col: 1}}, // combustion
+	},
+	{ // Frost
+		{Row: 0, Col: 0, MaxPoints: 2}, // frostWarding
+		{Row: 0, Col: 1, MaxPoints: 5}, // improvedFrostbolt
+		{Row: 0, Col: 2, MaxPoints: 3}, // elementalPrecision
+		{Row: 1, Col: 0, MaxPoints: 5}, // iceShards
+		{Row: 1, Col: 1, MaxPoints: 3}, // frostbite
+		{Row: 1, Col: 2, MaxPoints: 2}, // improvedFrostNova
+		{Row: 1, Col: 3, MaxPoints: 3}, // permafrost
+		{Row: 2, Col: 0, MaxPoints: 3}, // piercingIce
+		{Row: 2, Col: 1, MaxPoints: 1}, // coldSnap
+		{Row: 2, Col: 3, MaxPoints: 3}, // improvedBlizzard
+		{Row: 3, Col: 0, MaxPoints: 2}, // arcticReach
+		{Row: 3, Col: 1, MaxPoints: 3}, // frostChanneling
+		{Row: 3, Col: 2, MaxPoints: 5, Prereq: &core.TalentLocation{Row: 1, Col: 2}}, // shatter
+		{Row: 4, Col: 1, MaxPoints: 1}, // iceBlock
+		{Row: 4, Col: 2, MaxPoints: 3}, // improvedConeOfCold
+		{Row: 5, Col: 2, MaxPoints: 5}, // wintersChill
+		{Row: 6, Col: 1, MaxPoints: 1, Prereq: &core.TalentLocation{Row: 4, Col: 1}}, // iceBarrier
+	},
+}
+
+func init() {
+	core.RegisterTalentTrees(proto.Class_ClassMage, &proto.MageTalents{}, talentTrees)
+}
+
 func (mage *Mage) ApplyTalents() {
 	mage.applyIgnite()
 	mage.applyArcaneConcentration()
@@ -4,9 +4,72 @@ import (
 	"time"
 
 	"github.com/wowsims/sod/sim/core"
+	"github.com/wowsims/sod/sim/core/proto"
 	"github.com/wowsims/sod/sim/core/stats"
 )
 
+// Layout of the talent trees, in the order of the talents string. Matches
+// ui/core/talents/trees/priest.json.
+var talentTrees = [3]core.TalentTreeLayout{
+	{ // Discipline
+		{Row: 0, Col: 1, MaxPoints: 5}, // unbreakableWill
+		{Row: 0, Col: 2, MaxPoints: 5}, // wandSpecialization
+		{Row: 1, Col: 0, MaxPoints: 5}, // silentResolve
+		{Row: 1, Col: 1, MaxPoints: 2}, // improvedPowerWordFortitude
+		{Row: 1, Col: 2, MaxPoints: 3}, // improvedPowerWordShield
+		{Row: 1, Col: 3, MaxPoints: 2}, // martyrdom
+		{Row: 2, Col: 1, MaxPoints: 1}, // innerFocus
+		{Row: 2, Col: 2, MaxPoints: 3}, // meditation
+		{Row: 3, Col: 0, MaxPoints: 3}, // improvedInnerFire
+		{Row: 3, Col: 1, MaxPoints: 5}, // mentalAgility
+		{Row: 3, Col: 3, MaxPoints: 2}, // improvedManaBurn
+		{Row: 4, Col: 1, MaxPoints: 5}, // mentalStrength
+		{Row: 4, Col: 2, MaxPoints: 1, Prereq: &core.TalentLocation{Row: 2, Col: 2}}, // divineSpirit
+		{Row: 5, Col: 2, MaxPoints: 5}, // forceOfWill
+		{Row: 6, Col: 1, MaxPoints: 1, Prereq: &core.TalentLocation{Row: 4, Col: 1}}, // powerInfusion
+	},
+	{ // Holy
+		{Row: 0, Col: 0, MaxPoints: 2}, // healingFocus
+		{Row: 0, Col: 1, MaxPoints: 3}, // improvedRenew
+		{Row: 0, Col: 2, MaxPoints: 5}, // holySpecialization
+		{Row: 1, Col: 1, MaxPoints: 5}, // spellWarding
+		{Row: 1, Col: 2, MaxPoints: 5}, // divineFury
+		{Row: 2, Col: 0, MaxPoints: 1}, // holyNova
+		{Row: 2, Col: 1, MaxPoints: 3}, // blessedRecovery
+		{Row: 2, Col: 3, MaxPoints: 3}, // inspiration
+		{Row: 3, Col: 0, MaxPoints: 2}, // holyReach
+		{Row: 3, Col: 1, MaxPoints: 3}, // improvedHealing
+		{Row: 3, Col: 2, MaxPoints: 2, Prereq: &core.TalentLocation{Row: 1, Col: 2}}, // searingLight
+		{Row: 4, Col: 0, MaxPoints: 2}, // improvedPrayerOfHealing
+		{Row: 4, Col: 1, MaxPoints: 1}, // spiritOfRedemption
+		{Row: 4, Col: 2, MaxPoints: 5}, // spiritualGuidance
+		{Row: 5, Col: 2, MaxPoints: 5}, // spiritualHealing
+		{Row: 6, Col: 1, MaxPoints: 1, Prereq: &core.TalentLocation{Row: 4, Col: 1}}, // lightwell
+	},
+	{ // Shadow
+		{Row: 0, Col: 1, MaxPoints: 5}, // spiritTap
+		{Row: 0, Col: 2, MaxPoints: 5}, // blackout
+		{Row: 1, Col: 0, MaxPoints: 3}, // shadowAffinity
+		{Row: 1, Col: 1, MaxPoints: 2}, // improvedShadowWordPain
+		{Row: 1, Col: 2, MaxPoints: 5}, // shadowFocus
+		{Row: 2, Col: 0, MaxPoints: 2}, // improvedPsychicScream
+		{Row: 2, Col: 1, MaxPoints: 5}, // improvedMindBlast
+		{Row: 2, Col: 2, MaxPoints: 1}, // mindFlay
+		{Row: 3, Col: 1, MaxPoints: 2}, // improvedFade
+		{Row: 3, Col: 2, MaxPoints: 3}, // shadowReach
+		{Row: 3, Col: 3, MaxPoints: 5}, // shadowWeaving
+		{Row: 4, Col: 0, MaxPoints: 1, Prereq: &core.TalentLocation{Row: 2, Col: 0}}, // silence
+		{Row: 4, Col: 1, MaxPoints: 1}, // vampiricEmbrace
+		{Row: 4, Col: 2, MaxPoints: 2, Prereq: &core.TalentLocation{Row: 4, Col: 1}}, // improvedVampiricEmbrace
+		{Row: 5, Col: 2, MaxPoints: 5}, // darkness
+		{Row: 6, Col: 1, MaxPoints: 1, Prereq: &core.TalentLocation{Row: 4, Col: 1}}, // shadowform
+	},
+}
+
+func init() {
+	core.RegisterTalentTrees(proto.Class_ClassPriest, &proto.PriestTalents{}, talentTrees)
+}
+
 func (priest *Priest) ApplyTalents() {
 	priest.applyInspiration()
 	priest.applyShadowWeaving()
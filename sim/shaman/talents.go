@@ -5,9 +5,71 @@ import (
 	"time"
 
 	"github.com/wowsims/sod/sim/core"
+	"github.com/wowsims/sod/sim/core/proto"
 	"github.com/wowsims/sod/sim/core/stats"
 )
 
+// Layout of the talent trees, in the order of the talents string. Matches
+// ui/core/talents/trees/shaman.json.
+var talentTrees = [3]core.TalentTreeLayout{
+	{ // Elemental
+		{Row: 0, Col: 1, MaxPoints: 5}, // convection
+		{Row: 0, Col: 2, MaxPoints: 5}, // concussion
+		{Row: 1, Col: 0, MaxPoints: 2}, // earthsGrasp
+		{Row: 1, Col: 1, MaxPoints: 3}, // elementalWarding
+		{Row: 1, Col: 2, MaxPoints: 3}, // callOfFlame
+		{Row: 2, Col: 0, MaxPoints: 1}, // elementalFocus
+		{Row: 2, Col: 1, MaxPoints: 5}, // reverberation
+		{Row: 2, Col: 2, MaxPoints: 5}, // callOfThunder
+		{Row: 3, Col: 0, MaxPoints: 2}, // improvedFireTotems
+		{Row: 3, Col: 1, MaxPoints: 3}, // eyeOfTheStorm
+		{Row: 3, Col: 3, MaxPoints: 3}, // elementalDevastation
+		{Row: 4, Col: 0, MaxPoints: 2}, // stormReach
+		{Row: 4, Col: 1, MaxPoints: 1}, // elementalFury
+		{Row: 5, Col: 2, MaxPoints: 5, Prereq: &core.TalentLocation{Row: 2, Col: 2}}, // lightningMastery
+		{Row: 6, Col: 1, MaxPoints: 1, Prereq: &core.TalentLocation{Row: 4, Col: 1}}, // elementalMastery
+	},
+	{ // Enhancement
+		{Row: 0, Col: 1, MaxPoints: 5}, // ancestralKnowledge
+		{Row: 0, Col: 2, MaxPoints: 5}, // shieldSpecialization
+		{Row: 1, Col: 0, MaxPoints: 2}, // guardianTotems
+		{Row: 1, Col: 1, MaxPoints: 5}, // thunderingStrikes
+		{Row: 1, Col: 2, MaxPoints: 2}, // improvedGhostWolf
+		{Row: 1, Col: 3, MaxPoints: 3}, // improvedLightningShield
+		{Row: 2, Col: 0, MaxPoints: 2}, // enhancingTotems
+		{Row: 2, Col: 2, MaxPoints: 1}, // twoHandedAxesAndMaces
+		{Row: 2, Col: 3, MaxPoints: 5}, // anticipation
+		{Row: 3, Col: 1, MaxPoints: 5, Prereq: &core.TalentLocation{Row: 1, Col: 1}}, // flurry
+		{Row: 3, Col: 2, MaxPoints: 5}, // toughness
+		{Row: 4, Col: 0, MaxPoints: 2}, // improvedWeaponTotems
+		{Row: 4, Col: 1, MaxPoints: 3}, // elementalWeapons
+		{Row: 4, Col: 2, MaxPoints: 1}, // parry
+		{Row: 5, Col: 2, MaxPoints: 5}, // weaponMastery
+		{Row: 6, Col: 1, MaxPoints: 1, Prereq: &core.TalentLocation{Row: 4, Col: 1}}, // stormstrike
+	},
+	{ // Restoration
+		{Row: 0, Col: 1, MaxPoints: 5}, // improvedHealingWave
+		{Row: 0, Col: 2, MaxPoints: 5}, // tidalFocus
+		{Row: 1, Col: 0, MaxPoints: 2}, // improvedReincarnation
+		{Row: 1, Col: 1, MaxPoints: 3}, // ancestralHealing
+		{Row: 1, Col: 2, MaxPoints: 5}, // totemicFocus
+		{Row: 2, Col: 0, MaxPoints: 3}, // naturesGuidance
+		{Row: 2, Col: 1, MaxPoints: 5}, // healingFocus
+		{Row: 2, Col: 2, MaxPoints: 1}, // totemicMastery
+		{Row: 2, Col: 3, MaxPoints: 3}, // healingGrace
+		{Row: 3, Col: 1, MaxPoints: 5}, // restorativeTotems
+		{Row: 3, Col: 2, MaxPoints: 5}, // tidalMastery
+		{Row: 4, Col: 0, MaxPoints: 3}, // healingWay
+		{Row: 4, Col: 2, MaxPoints: 1}, // naturesSwiftness
+		{Row: 5, Col: 2, MaxPoints: 5}, // purification
+		{Row: 6, Col: 1, MaxPoints: 1, Prereq: &core.TalentLocation{Row: 3, Col: 1}}, // manaTideTotem
+	},
+}
+
+func init() {
+	core.RegisterTalentTrees(proto.Class_ClassShaman, &proto.ShamanTalents{}, talentTrees)
+}
+
 // import (
 // 	"time"
 
@@ -0,0 +1,86 @@
+package sim
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wowsims/sod/sim/core"
+	"github.com/wowsims/sod/sim/core/proto"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type jsonTalentLocation struct {
+	RowIdx int32 `json:"rowIdx"`
+	ColIdx int32 `json:"colIdx"`
+}
+
+type jsonTalent struct {
+	FieldName      string              `json:"fieldName"`
+	Location       jsonTalentLocation  `json:"location"`
+	MaxPoints      int32               `json:"maxPoints"`
+	PrereqLocation *jsonTalentLocation `json:"prereqLocation"`
+}
+
+type jsonTalentTree struct {
+	Name    string       `json:"name"`
+	Talents []jsonTalent `json:"talents"`
+}
+
+// The talent optimizer's layouts are copied from the UI talent trees, so they have to stay in sync.
+func TestTalentTreesMatchUI(t *testing.T) {
+	for classValue, className := range proto.Class_name {
+		class := proto.Class(classValue)
+		talents, trees, ok := core.RegisteredTalentTrees(class)
+		if !ok {
+			continue
+		}
+
+		fileName := strings.ToLower(strings.TrimPrefix(className, "Class")) + ".json"
+		data, err := os.ReadFile(filepath.Join("..", "ui", "core", "talents", "trees", fileName))
+		if err != nil {
+			t.Fatalf("%s: %v", class, err)
+		}
+		var uiTrees []jsonTalentTree
+		if err := json.Unmarshal(data, &uiTrees); err != nil {
+			t.Fatalf("%s: %v", fileName, err)
+		}
+		if len(uiTrees) != len(trees) {
+			t.Fatalf("%s: UI has %d trees, registered %d", class, len(uiTrees), len(trees))
+		}
+
+		fields := talents.ProtoReflect().Descriptor().Fields()
+		offset := 0
+		for treeIdx, uiTree := range uiTrees {
+			layout := trees[treeIdx]
+			if len(uiTree.Talents) != len(layout) {
+				t.Errorf("%s %s: UI has %d talents, registered %d", class, uiTree.Name, len(uiTree.Talents), len(layout))
+				offset += len(layout)
+				continue
+			}
+			for talentIdx, uiTalent := range uiTree.Talents {
+				talent := layout[talentIdx]
+				if talent.Row != uiTalent.Location.RowIdx || talent.Col != uiTalent.Location.ColIdx || talent.MaxPoints != uiTalent.MaxPoints {
+					t.Errorf("%s %s: talent %d is at %d,%d with %d points, UI has %s at %d,%d with %d points",
+						class, uiTree.Name, talentIdx, talent.Row, talent.Col, talent.MaxPoints,
+						uiTalent.FieldName, uiTalent.Location.RowIdx, uiTalent.Location.ColIdx, uiTalent.MaxPoints)
+				}
+				switch {
+				case (talent.Prereq == nil) != (uiTalent.PrereqLocation == nil):
+					t.Errorf("%s %s: %s prerequisite is %v, UI has %v", class, uiTree.Name, uiTalent.FieldName, talent.Prereq, uiTalent.PrereqLocation)
+				case talent.Prereq != nil && (talent.Prereq.Row != uiTalent.PrereqLocation.RowIdx || talent.Prereq.Col != uiTalent.PrereqLocation.ColIdx):
+					t.Errorf("%s %s: %s prerequisite is at %d,%d, UI has %d,%d", class, uiTree.Name, uiTalent.FieldName,
+						talent.Prereq.Row, talent.Prereq.Col, uiTalent.PrereqLocation.RowIdx, uiTalent.PrereqLocation.ColIdx)
+				}
+
+				field := fields.ByNumber(protowire.Number(offset + talentIdx + 1))
+				if field == nil || field.JSONName() != uiTalent.FieldName {
+					t.Errorf("%s %s: talent %d maps to proto field %v, UI has %s", class, uiTree.Name, talentIdx, field, uiTalent.FieldName)
+				}
+			}
+			offset += len(layout)
+		}
+	}
+}
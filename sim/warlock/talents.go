@@ -8,6 +8,71 @@ import (
 	"github.com/wowsims/sod/sim/core/stats"
 )
 
+// Layout of the talent trees, in the order of the talents string. Matches
+// ui/core/talents/trees/warlock.json.
+var talentTrees = [3]core.TalentTreeLayout{
+	{ // Affliction
+		{Row: 0, Col: 1, MaxPoints: 5}, // suppression
+		{Row: 0, Col: 2, MaxPoints: 5}, // improvedCorruption
+		{Row: 1, Col: 0, MaxPoints: 3}, // improvedCurseOfWeakness
+		{Row: 1, Col: 1, MaxPoints: 2}, // improvedDrainSoul
+		{Row: 1, Col: 2, MaxPoints: 2}, // improvedLifeTap
+		{Row: 1, Col: 3, MaxPoints: 5}, // improvedDrainLife
+		{Row: 2, Col: 0, MaxPoints: 3}, // improvedCurseOfAgony
+		{Row: 2, Col: 1, MaxPoints: 5}, // felConcentration
+		{Row: 2, Col: 2, MaxPoints: 1}, // amplifyCurse
+		{Row: 3, Col: 0, MaxPoints: 2}, // grimReach
+		{Row: 3, Col: 1, MaxPoints: 2}, // nightfall
+		{Row: 3, Col: 3, MaxPoints: 2}, // improvedDrainMana
+		{Row: 4, Col: 1, MaxPoints: 1}, // siphonLife
+		{Row: 4, Col: 2, MaxPoints: 1, Prereq: &core.TalentLocation{Row: 2, Col: 2}}, // curseOfExhaustion
+		{Row: 4, Col: 3, MaxPoints: 4, Prereq: &core.TalentLocation{Row: 4, Col: 2}}, // improvedCurseOfExhaustion
+		{Row: 5, Col: 1, MaxPoints: 5, Prereq: &core.TalentLocation{Row: 4, Col: 1}}, // shadowMastery
+		{Row: 6, Col: 1, MaxPoints: 1}, // darkPact
+	},
+	{ // Demonology
+		{Row: 0, Col: 0, MaxPoints: 2}, // improvedHealthstone
+		{Row: 0, Col: 1, MaxPoints: 3}, // improvedImp
+		{Row: 0, Col: 2, MaxPoints: 5}, // demonicEmbrace
+		{Row: 1, Col: 0, MaxPoints: 2}, // improvedHealthFunnel
+		{Row: 1, Col: 1, MaxPoints: 3}, // improvedVoidwalker
+		{Row: 1, Col: 2, MaxPoints: 5}, // felIntellect
+		{Row: 2, Col: 0, MaxPoints: 3}, // improvedSayaad
+		{Row: 2, Col: 1, MaxPoints: 1}, // felDomination
+		{Row: 2, Col: 2, MaxPoints: 5}, // felStamina
+		{Row: 3, Col: 1, MaxPoints: 2, Prereq: &core.TalentLocation{Row: 2, Col: 1}}, // masterSummoner
+		{Row: 3, Col: 2, MaxPoints: 5}, // unholyPower
+		{Row: 4, Col: 0, MaxPoints: 5}, // improvedSubjugateDemon
+		{Row: 4, Col: 1, MaxPoints: 1}, // demonicSacrifice
+		{Row: 4, Col: 3, MaxPoints: 2}, // improvedFirestone
+		{Row: 5, Col: 2, MaxPoints: 5, Prereq: &core.TalentLocation{Row: 3, Col: 2}}, // masterDemonologist
+		{Row: 6, Col: 1, MaxPoints: 1, Prereq: &core.TalentLocation{Row: 4, Col: 1}}, // soulLink
+		{Row: 6, Col: 2, MaxPoints: 2}, // improvedSpellstone
+	},
+	{ // Destruction
+		{Row: 0, Col: 1, MaxPoints: 5}, // improvedShadowBolt
+		{Row: 0, Col: 2, MaxPoints: 5}, // cataclysm
+		{Row: 1, Col: 1, MaxPoints: 5}, // bane
+		{Row: 1, Col: 2, MaxPoints: 5}, // aftermath
+		{Row: 2, Col: 0, MaxPoints: 2}, // improvedFirebolt
+		{Row: 2, Col: 1, MaxPoints: 2}, // improvedLashOfPain
+		{Row: 2, Col: 2, MaxPoints: 5}, // devastation
+		{Row: 2, Col: 3, MaxPoints: 1}, // shadowburn
+		{Row: 3, Col: 0, MaxPoints: 2}, // intensity
+		{Row: 3, Col: 1, MaxPoints: 2}, // destructiveReach
+		{Row: 3, Col: 3, MaxPoints: 5}, // improvedSearingPain
+		{Row: 4, Col: 0, MaxPoints: 2, Prereq: &core.TalentLocation{Row: 3, Col: 0}}, // pyroclasm
+		{Row: 4, Col: 1, MaxPoints: 5}, // improvedImmolate
+		{Row: 4, Col: 2, MaxPoints: 1, Prereq: &core.TalentLocation{Row: 2, Col: 2}}, // ruin
+		{Row: 5, Col: 2, MaxPoints: 5}, // emberstorm
+		{Row: 6, Col: 1, MaxPoints: 1, Prereq: &core.TalentLocation{Row: 4, Col: 1}}, // conflagrate
+	},
+}
+
+func init() {
+	core.RegisterTalentTrees(proto.Class_ClassWarlock, &proto.WarlockTalents{}, talentTrees)
+}
+
 // TODO: Classic warlock talents
 func (warlock *Warlock) ApplyTalents() {
 	// Demonic Embrace
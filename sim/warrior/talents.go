@@ -8,6 +8,73 @@ import (
 	"github.com/wowsims/sod/sim/core/stats"
 )
 
+// Layout of the talent trees, in the order of the talents string. Matches
+// ui/core/talents/trees/warrior.json.
+var talentTrees = [3]core.TalentTreeLayout{
+	{ // Arms
+		{Row: 0, Col: 0, MaxPoints: 3}, // improvedHeroicStrike
+		{Row: 0, Col: 1, MaxPoints: 5}, // deflection
+		{Row: 0, Col: 2, MaxPoints: 3}, // improvedRend
+		{Row: 1, Col: 0, MaxPoints: 2}, // improvedCharge
+		{Row: 1, Col: 1, MaxPoints: 5}, // tacticalMastery
+		{Row: 1, Col: 3, MaxPoints: 3}, // improvedThunderClap
+		{Row: 2, Col: 0, MaxPoints: 2}, // improvedOverpower
+		{Row: 2, Col: 1, MaxPoints: 1, Prereq: &core.TalentLocation{Row: 1, Col: 1}}, // angerManagement
+		{Row: 2, Col: 2, MaxPoints: 3, Prereq: &core.TalentLocation{Row: 0, Col: 2}}, // deepWounds
+		{Row: 3, Col: 1, MaxPoints: 5}, // twoHandedWeaponSpecialization
+		{Row: 3, Col: 2, MaxPoints: 2, Prereq: &core.TalentLocation{Row: 2, Col: 2}}, // impale
+		{Row: 4, Col: 0, MaxPoints: 5}, // axeSpecialization
+		{Row: 4, Col: 1, MaxPoints: 1}, // sweepingStrikes
+		{Row: 4, Col: 2, MaxPoints: 5}, // maceSpecialization
+		{Row: 4, Col: 3, MaxPoints: 5}, // swordSpecialization
+		{Row: 5, Col: 0, MaxPoints: 5}, // polearmSpecialization
+		{Row: 5, Col: 2, MaxPoints: 3}, // improvedHamstring
+		{Row: 6, Col: 1, MaxPoints: 1, Prereq: &core.TalentLocation{Row: 4, Col: 1}}, // mortalStrike
+	},
+	{ // Fury
+		{Row: 0, Col: 1, MaxPoints: 5}, // boomingVoice
+		{Row: 0, Col: 2, MaxPoints: 5}, // cruelty
+		{Row: 1, Col: 1, MaxPoints: 5}, // improvedDemoralizingShout
+		{Row: 1, Col: 2, MaxPoints: 5}, // unbridledWrath
+		{Row: 2, Col: 0, MaxPoints: 3}, // improvedCleave
+		{Row: 2, Col: 1, MaxPoints: 1}, // piercingHowl
+		{Row: 2, Col: 2, MaxPoints: 3}, // bloodCraze
+		{Row: 2, Col: 3, MaxPoints: 5}, // improvedBattleShout
+		{Row: 3, Col: 0, MaxPoints: 5}, // dualWieldSpecialization
+		{Row: 3, Col: 1, MaxPoints: 2}, // improvedExecute
+		{Row: 3, Col: 2, MaxPoints: 5}, // enrage
+		{Row: 4, Col: 0, MaxPoints: 5}, // improvedSlam
+		{Row: 4, Col: 1, MaxPoints: 1}, // deathWish
+		{Row: 4, Col: 3, MaxPoints: 2}, // improvedIntercept
+		{Row: 5, Col: 0, MaxPoints: 2}, // improvedBerserkerRage
+		{Row: 5, Col: 2, MaxPoints: 5, Prereq: &core.TalentLocation{Row: 3, Col: 2}}, // flurry
+		{Row: 6, Col: 1, MaxPoints: 1, Prereq: &core.TalentLocation{Row: 4, Col: 1}}, // bloodthirst
+	},
+	{ // Protection
+		{Row: 0, Col: 1, MaxPoints: 5}, // shieldSpecialization
+		{Row: 0, Col: 2, MaxPoints: 5}, // anticipation
+		{Row: 1, Col: 0, MaxPoints: 2}, // improvedBloodrage
+		{Row: 1, Col: 2, MaxPoints: 5}, // toughness
+		{Row: 1, Col: 3, MaxPoints: 5}, // ironWill
+		{Row: 2, Col: 0, MaxPoints: 1, Prereq: &core.TalentLocation{Row: 1, Col: 0}}, // lastStand
+		{Row: 2, Col: 1, MaxPoints: 3, Prereq: &core.TalentLocation{Row: 0, Col: 1}}, // improvedShieldBlock
+		{Row: 2, Col: 2, MaxPoints: 3}, // improvedRevenge
+		{Row: 2, Col: 3, MaxPoints: 5}, // defiance
+		{Row: 3, Col: 0, MaxPoints: 3}, // improvedSunderArmor
+		{Row: 3, Col: 1, MaxPoints: 3}, // improvedDisarm
+		{Row: 3, Col: 2, MaxPoints: 2}, // improvedTaunt
+		{Row: 4, Col: 0, MaxPoints: 2}, // improvedShieldWall
+		{Row: 4, Col: 1, MaxPoints: 1}, // concussionBlow
+		{Row: 4, Col: 2, MaxPoints: 2}, // improvedShieldBash
+		{Row: 5, Col: 2, MaxPoints: 5}, // oneHandedWeaponSpecialization
+		{Row: 6, Col: 1, MaxPoints: 1, Prereq: &core.TalentLocation{Row: 4, Col: 1}}, // shieldSlam
+	},
+}
+
+func init() {
+	core.RegisterTalentTrees(proto.Class_ClassWarrior, &proto.WarriorTalents{}, talentTrees)
+}
+
 func (warrior *Warrior) ToughnessArmorMultiplier() float64 {
 	return 1.0 + 0.02*float64(warrior.Talents.Toughness)
 }
@@ -31,6 +31,13 @@ func main() {
 	js.Global().Set("statWeights", js.FuncOf(statWeights))
 	js.Global().Set("statWeightsAsync", js.FuncOf(statWeightsAsync))
 	js.Global().Set("bulkSimAsync", js.FuncOf(bulkSimAsync))
+	js.Global().Set("rotationOptimizerAsync", js.FuncOf(asyncAPI(core.RunRotationOptimizerAsync)))
+	js.Global().Set("buffAttributionAsync", js.FuncOf(asyncAPI(core.RunBuffAttributionAsync)))
+	js.Global().Set("gearOptimizerAsync", js.FuncOf(asyncAPI(core.RunGearOptimizerAsync)))
+	js.Global().Set("runeOptimizerAsync", js.FuncOf(asyncAPI(core.RunRuneOptimizerAsync)))
+	js.Global().Set("talentOptimizerAsync", js.FuncOf(asyncAPI(core.RunTalentOptimizerAsync)))
+	js.Global().Set("consumesOptimizerAsync", js.FuncOf(asyncAPI(core.RunConsumesOptimizerAsync)))
+	js.Global().Set("upgradeFinderAsync", js.FuncOf(asyncAPI(core.RunUpgradeFinderAsync)))
 	js.Global().Call("wasmready")
 	<-c
 }
@@ -217,6 +224,24 @@ func bulkSimAsync(this js.Value, args []js.Value) interface{} {
 	return result
 }
 
+// Wraps an async API that takes a context, like the optimizers. The request is decoded from
+// args[0] and progress is reported to args[1].
+func asyncAPI[T googleProto.Message](run func(context.Context, T, chan *proto.ProgressMetrics)) func(js.Value, []js.Value) interface{} {
+	return func(this js.Value, args []js.Value) interface{} {
+		var zero T
+		request := zero.ProtoReflect().Type().New().Interface().(T)
+		if err := googleProto.Unmarshal(getArgsBinary(args[0]), request); err != nil {
+			log.Printf("Failed to parse request: %s", err)
+			return nil
+		}
+		reporter := make(chan *proto.ProgressMetrics, 100)
+		run(context.Background(), request, reporter)
+
+		result := processAsyncProgress(args[1], reporter)
+		return result
+	}
+}
+
 // Assumes args[0] is a Uint8Array
 func getArgsBinary(value js.Value) []byte {
 	data := make([]byte, value.Get("length").Int())
@@ -248,7 +273,7 @@ reader:
 			js.CopyBytesToJS(outArray, outbytes)
 			progFunc.Invoke(outArray)
 
-			if progMetric.FinalWeightResult != nil || progMetric.FinalRaidResult != nil || progMetric.FinalBulkResult != nil {
+			if core.IsFinalProgress(progMetric) {
 				return outArray
 			}
 		}
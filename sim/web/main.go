@@ -114,6 +114,13 @@ var asyncAPIHandlers = map[string]asyncAPIHandler{
 		// We should have all the async APIs take in context and let it be cancelled via its async ID.
 		core.RunBulkSimAsync(context.Background(), msg.(*proto.BulkSimRequest), reporter)
 	}},
+	"/rotationOptimizerAsync": newAsyncAPIHandler(core.RunRotationOptimizerAsync),
+	"/buffAttributionAsync":   newAsyncAPIHandler(core.RunBuffAttributionAsync),
+	"/gearOptimizerAsync":     newAsyncAPIHandler(core.RunGearOptimizerAsync),
+	"/runeOptimizerAsync":     newAsyncAPIHandler(core.RunRuneOptimizerAsync),
+	"/talentOptimizerAsync":   newAsyncAPIHandler(core.RunTalentOptimizerAsync),
+	"/consumesOptimizerAsync": newAsyncAPIHandler(core.RunConsumesOptimizerAsync),
+	"/upgradeFinderAsync":     newAsyncAPIHandler(core.RunUpgradeFinderAsync),
 }
 
 type server struct {
@@ -130,6 +137,17 @@ type asyncAPIHandler struct {
 	handle func(googleProto.Message, chan *proto.ProgressMetrics)
 }
 
+// Creates the handler of an async API that takes a context, like the optimizers.
+func newAsyncAPIHandler[T googleProto.Message](run func(context.Context, T, chan *proto.ProgressMetrics)) asyncAPIHandler {
+	var zero T
+	return asyncAPIHandler{
+		msg: func() googleProto.Message { return zero.ProtoReflect().Type().New().Interface() },
+		handle: func(msg googleProto.Message, reporter chan *proto.ProgressMetrics) {
+			run(context.Background(), msg.(T), reporter)
+		},
+	}
+}
+
 type asyncProgress struct {
 	id             string
 	latestProgress atomic.Value
@@ -194,7 +212,7 @@ func (s *server) handleAsyncAPI(w http.ResponseWriter, r *http.Request) {
 					return
 				}
 				simProgress.latestProgress.Store(progMetric)
-				if progMetric.FinalRaidResult != nil || progMetric.FinalWeightResult != nil || progMetric.FinalBulkResult != nil {
+				if core.IsFinalProgress(progMetric) {
 					return
 				}
 			}
@@ -254,7 +272,7 @@ func (s *server) setupAsyncServer() {
 		}
 
 		// If this was the last result, delete the cache for this simulation.
-		if latest.FinalRaidResult != nil || latest.FinalWeightResult != nil || latest.FinalBulkResult != nil {
+		if core.IsFinalProgress(latest) {
 			s.progMut.Lock()
 			delete(s.asyncProgresses, msg.ProgressId)
 			s.progMut.Unlock()
@@ -32,9 +32,17 @@ import {
 	APLValueCurrentRage,
 	APLValueCurrentEnergy,
 	APLValueCurrentComboPoints,
+	APLValueResourceAt,
+	APLValueResourceAt_Resource as ProjectedResource,
+	APLValueTimeToResource,
 	APLValueGCDIsReady,
 	APLValueGCDTimeToReady,
 	APLValueAutoTimeToNext,
+	APLValueAutoSwingSpeed,
+	APLValueAutoTimeSinceLast,
+	APLValueAutoAttackChance,
+	APLValueAutoAttackChance_Outcome as AttackOutcome,
+	APLValueAutoNextSwingParryHasted,
 	APLValueSpellCanCast,
 	APLValueSpellIsReady,
 	APLValueSpellTimeToReady,
@@ -334,6 +342,61 @@ function autoTypeFieldConfig(field: string): AplHelpers.APLPickerBuilderFieldCon
 	};
 }
 
+function handTypeFieldConfig(field: string): AplHelpers.APLPickerBuilderFieldConfig<any, any> {
+	return {
+		field: field,
+		newValue: () => AutoType.MainHand,
+		factory: (parent, player, config) => new TextDropdownPicker(parent, player, {
+			...config,
+			defaultLabel: 'None',
+			equals: (a, b) => a == b,
+			values: [
+				{ value: AutoType.MainHand, label: 'Main Hand' },
+				{ value: AutoType.OffHand, label: 'Off Hand' },
+				{ value: AutoType.Ranged, label: 'Ranged' },
+			],
+		}),
+	};
+}
+
+function projectedResourceFieldConfig(field: string): AplHelpers.APLPickerBuilderFieldConfig<any, any> {
+	return {
+		field: field,
+		newValue: () => ProjectedResource.Energy,
+		factory: (parent, player, config) => new TextDropdownPicker(parent, player, {
+			...config,
+			defaultLabel: 'None',
+			equals: (a, b) => a == b,
+			values: [
+				{ value: ProjectedResource.Mana, label: 'Mana' },
+				{ value: ProjectedResource.Energy, label: 'Energy' },
+				{ value: ProjectedResource.Focus, label: 'Focus' },
+			],
+		}),
+	};
+}
+
+function attackOutcomeFieldConfig(field: string): AplHelpers.APLPickerBuilderFieldConfig<any, any> {
+	return {
+		field: field,
+		newValue: () => AttackOutcome.Hit,
+		factory: (parent, player, config) => new TextDropdownPicker(parent, player, {
+			...config,
+			defaultLabel: 'None',
+			equals: (a, b) => a == b,
+			values: [
+				{ value: AttackOutcome.Hit, label: 'Hit' },
+				{ value: AttackOutcome.Miss, label: 'Miss' },
+				{ value: AttackOutcome.Dodge, label: 'Dodge' },
+				{ value: AttackOutcome.Parry, label: 'Parry' },
+				{ value: AttackOutcome.Glance, label: 'Glance' },
+				{ value: AttackOutcome.Block, label: 'Block' },
+				{ value: AttackOutcome.Crit, label: 'Crit' },
+			],
+		}),
+	};
+}
+
 function executePhaseThresholdFieldConfig(field: string): AplHelpers.APLPickerBuilderFieldConfig<any, any> {
 	return {
 		field: field,
@@ -617,6 +680,49 @@ const valueKindFactories: {[f in NonNullable<APLValueKind>]: ValueKindConfig<APL
 		newValue: APLValueCurrentComboPoints.create,
 		fields: [],
 	}),
+	'resourceAt': inputBuilder({
+		label: 'Resource At',
+		submenu: ['Resources'],
+		shortDescription: 'Projected amount of a resource after the given delay, from passive regeneration only.',
+		fullDescription: `
+		<p>Assumes nothing is spent in the meantime. For Mana, this also assumes the 5-second rule is not refreshed.</p>
+		`,
+		newValue: () => APLValueResourceAt.create({
+			resource: ProjectedResource.Energy,
+			delay: {
+				value: {
+					oneofKind: 'const',
+					const: {
+						val: '0ms',
+					},
+				},
+			},
+		}),
+		fields: [
+			projectedResourceFieldConfig('resource'),
+			valueFieldConfig('delay', {
+				label: 'Delay',
+			}),
+		],
+	}),
+	'timeToResource': inputBuilder({
+		label: 'Time To Resource',
+		submenu: ['Resources'],
+		shortDescription: 'Time until passive regeneration brings a resource up to the given amount.',
+		fullDescription: `
+		<p>Assumes nothing is spent in the meantime. For Mana, this also assumes the 5-second rule is not refreshed.</p>
+		<p>Returns a very large value if the amount can not be reached, e.g. because it is above the maximum.</p>
+		`,
+		newValue: () => APLValueTimeToResource.create({
+			resource: ProjectedResource.Energy,
+		}),
+		fields: [
+			projectedResourceFieldConfig('resource'),
+			valueFieldConfig('amount', {
+				label: 'Amount',
+			}),
+		],
+	}),
 
 	// GCD
 	'gcdIsReady': inputBuilder({
@@ -644,6 +750,47 @@ const valueKindFactories: {[f in NonNullable<APLValueKind>]: ValueKindConfig<APL
 			autoTypeFieldConfig('autoType')
 		],
 	}),
+	'autoSwingSpeed': inputBuilder({
+		label: 'Swing Speed',
+		submenu: ['Auto'],
+		shortDescription: 'Current time between two attacks of the weapon, including haste.',
+		newValue: () => APLValueAutoSwingSpeed.create({ autoType: AutoType.MainHand }),
+		fields: [
+			handTypeFieldConfig('autoType')
+		],
+	}),
+	'autoTimeSinceLast': inputBuilder({
+		label: 'Time Since Last Auto',
+		submenu: ['Auto'],
+		shortDescription: 'Amount of time since the last attack of the chosen type, or since the start of the fight if there was none yet.',
+		newValue: APLValueAutoTimeSinceLast.create,
+		fields: [
+			autoTypeFieldConfig('autoType')
+		],
+	}),
+	'autoAttackChance': inputBuilder({
+		label: 'Auto Attack Chance',
+		submenu: ['Auto'],
+		shortDescription: 'Chance for the next attack of the weapon against the current target to have the chosen outcome, based on the attack table.',
+		fullDescription: `
+			<p><b>Hit</b> is the chance for the attack to land, i.e. not be missed, dodged or parried.</p>
+		`,
+		newValue: () => APLValueAutoAttackChance.create({ autoType: AutoType.MainHand, outcome: AttackOutcome.Hit }),
+		fields: [
+			handTypeFieldConfig('autoType'),
+			attackOutcomeFieldConfig('outcome'),
+		],
+	}),
+	'autoNextSwingParryHasted': inputBuilder({
+		label: 'Next Swing Parry Hasted',
+		submenu: ['Auto'],
+		shortDescription: '<b>True</b> if the next main hand swing was moved forward by parrying an attack, otherwise <b>False</b>.',
+		fullDescription: `
+			<p>Whether a swing glances is only decided when it lands, so use <b>Auto Attack Chance</b> with <b>Glance</b> for that instead.</p>
+		`,
+		newValue: APLValueAutoNextSwingParryHasted.create,
+		fields: [],
+	}),
 
 	// Spells
 	'spellCurrentCost': inputBuilder({
@@ -71,6 +71,7 @@ class BulkSimResultRenderer {
 		const dpsDeltaSpan = document.createElement('span');
 		dpsDeltaSpan.textContent = `${this.formatDpsDelta(dpsDelta)}`;
 		dpsDeltaSpan.classList.add(dpsDelta >= 0 ? 'bulk-result-header-positive' : 'bulk-result-header-negative');
+		dpsDeltaSpan.title = `Raid DPS ${this.formatDpsDelta(result.raidDpsDelta)} (95% confidence: ${this.formatDpsDelta(result.raidDpsDeltaCiLow)} to ${this.formatDpsDelta(result.raidDpsDeltaCiHigh)}) over ${result.iterations} iterations`;
 		dpsDiv.appendChild(dpsDeltaSpan);
 
 		const itemsContainer = document.createElement('div');
@@ -224,6 +225,7 @@ export class BulkTab extends SimTab {
 	private doCombos: boolean;
 	private fastMode: boolean;
 	private autoEnchant: boolean;
+	private optimizeEnchants: boolean;
 	private gemIconElements: HTMLImageElement[];
 
 	constructor(parentElem: HTMLElement, simUI: IndividualSimUI<Spec>) {
@@ -249,6 +251,7 @@ export class BulkTab extends SimTab {
 		this.doCombos = true;
 		this.fastMode = true;
 		this.autoEnchant = true;
+		this.optimizeEnchants = false;
 		this.gemIconElements = [];
 		this.buildTabContent();
 
@@ -270,6 +273,7 @@ export class BulkTab extends SimTab {
 			this.doCombos = settings.combinations;
 			this.fastMode = settings.fastMode;
 			this.autoEnchant = settings.autoEnchant;
+			this.optimizeEnchants = settings.optimizeEnchants;
 		}
 	}
 
@@ -292,6 +296,8 @@ export class BulkTab extends SimTab {
 			combinations: this.doCombos,
 			fastMode: this.fastMode,
 			autoEnchant: this.autoEnchant,
+			optimizeEnchants: this.optimizeEnchants,
+			enchantEpWeights: this.optimizeEnchants ? this.simUI.player.getEpWeights().toProto() : undefined,
 			iterationsPerCombo: this.simUI.sim.getIterations(), // TODO(Riotdog-GehennasEU): Define a new UI element for the iteration setting.
 		});
 	}
@@ -309,6 +315,16 @@ export class BulkTab extends SimTab {
 			}
 		}
 
+		if (this.optimizeEnchants) {
+			// The sim picks the legal enchants for each item from these.
+			const slots = new Set(this.items.flatMap(is => getEligibleItemSlots(this.simUI.sim.db.lookupItemSpec(is)!.item)));
+			for (const slot of slots) {
+				for (const enchant of this.simUI.player.getEnchants(slot)) {
+					itemsDb.enchants.push(SimEnchant.fromJson(UIEnchant.toJson(enchant), { ignoreUnknownFields: true }));
+				}
+			}
+		}
+
 		return itemsDb;
 	}
 
@@ -435,10 +451,7 @@ export class BulkTab extends SimTab {
 			bulkSimButton.innerHTML = `<i class="fa fa-spinner fa-spin"></i>&nbsp;Running`;
 
 
-			let simStart = new Date().getTime();
-			let lastTotal = 0;
-			let rounds = 0;
-			let currentRound = 0;
+			const simStart = new Date().getTime();
 			let combinations = 0;
 
 			this.runBulkSim((progressMetrics: ProgressMetrics) => {
@@ -450,19 +463,8 @@ export class BulkTab extends SimTab {
 				if (combinations == 0) {
 					combinations = progressMetrics.totalSims;
 				}
-				if (this.fastMode) {
-					if (rounds == 0 && progressMetrics.totalSims > 0) {
-						rounds = Math.ceil(Math.log(progressMetrics.totalSims / 20) / Math.log(2)) + 1;
-						currentRound = 1;
-					}
-					if (progressMetrics.totalSims < lastTotal) {
-						currentRound += 1;
-						simStart = new Date().getTime();
-					}
-				}
 
-				this.setSimProgress(progressMetrics, iterPerSecond, currentRound, rounds, combinations);
-				lastTotal = progressMetrics.totalSims;
+				this.setSimProgress(progressMetrics, iterPerSecond, combinations);
 
 				if (progressMetrics.finalBulkResult != null) {
 					// reset state
@@ -611,7 +613,7 @@ export class BulkTab extends SimTab {
 
 		new BooleanPicker<BulkTab>(settingsBlock.bodyElement, this, {
 			label: "Fast Mode",
-			labelTooltip: "Fast mode reduces accuracy but will run faster.",
+			labelTooltip: "Fast mode starts with fewer iterations and drops combinations that are clearly worse than the best one after each round, so it runs faster.",
 			changedEvent: (_obj: BulkTab) => this.itemsChangedEmitter,
 			getValue: (_obj) => this.fastMode,
 			setValue: (id: EventID, obj: BulkTab, value: boolean) => { obj.fastMode = value }
@@ -632,20 +634,25 @@ export class BulkTab extends SimTab {
 				obj.autoEnchant = value
 			}
 		});
+		new BooleanPicker<BulkTab>(settingsBlock.bodyElement, this, {
+			label: "Optimize Enchants",
+			labelTooltip: "When checked bulk simulator will try the best enchants by EP, and all proc enchants, on each replacement item without an enchant, and show the best one.",
+			changedEvent: (_obj: BulkTab) => this.itemsChangedEmitter,
+			getValue: (_obj) => this.optimizeEnchants,
+			setValue: (id: EventID, obj: BulkTab, value: boolean) => {
+				obj.optimizeEnchants = value
+			}
+		});
 	}
 
-	private setSimProgress(progress: ProgressMetrics, iterPerSecond: number, currentRound: number, rounds: number, combinations: number) {
+	private setSimProgress(progress: ProgressMetrics, iterPerSecond: number, combinations: number) {
+		// In fast mode the total assumes every combination gets all iterations, combinations that
+		// are dropped early make it finish sooner.
 		const secondsRemain = ((progress.totalIterations - progress.completedIterations) / iterPerSecond).toFixed();
 
-		let roundsText = "";
-		if (rounds > 0) {
-			roundsText = `${currentRound} / ${rounds} refining rounds`;
-		}
-
 		this.pendingResults.setContent(`
       <div class="results-sim">
         <div class="">${combinations} total combinations.</div>
-        <div class="">${roundsText}</div>
         <div class=""> ${progress.completedSims} / ${progress.totalSims}<br>simulations complete</div>
         <div class="">
           ${progress.completedIterations} / ${progress.totalIterations}<br>iterations complete
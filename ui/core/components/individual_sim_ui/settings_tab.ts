@@ -15,6 +15,7 @@ import {
 import { professionNames, raceNames } from "../../proto_utils/names";
 import { specToEligibleRaces } from "../../proto_utils/utils";
 import { Player } from "../../player";
+import { Raid } from "../../raid";
 import { SavedEncounter, SavedSettings } from "../../proto/ui";
 import { EventID, TypedEvent } from "../../typed_event";
 import { getEnumValues } from "../../utils";
@@ -273,6 +274,19 @@ export class SettingsTab extends SimTab {
 				label: 'Misc Debuffs',
 			}, this.simUI);
 		}
+
+		new BooleanPicker<Raid>(contentBlock.bodyElement, this.simUI.sim.raid, {
+			label: 'Ramp Up Debuffs',
+			labelTooltip: 'Apply debuffs from other raid members over the opening seconds of the fight, e.g. Sunder Armor gaining a stack every GCD, instead of having them active from the pull.',
+			inline: true,
+			changedEvent: (raid: Raid) => raid.debuffsChangeEmitter,
+			getValue: (raid: Raid) => raid.getDebuffs().rampUp,
+			setValue: (eventID: EventID, raid: Raid, newValue: boolean) => {
+				const newDebuffs = raid.getDebuffs();
+				newDebuffs.rampUp = newValue;
+				raid.setDebuffs(eventID, newDebuffs);
+			},
+		});
 	}
 
 	private buildSavedDataPickers() {
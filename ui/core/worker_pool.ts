@@ -1,10 +1,17 @@
+import { MessageType } from '@protobuf-ts/runtime';
+
 import { REPO_NAME } from './constants/other.js';
 
-import { BulkSimRequest, BulkSimResult, ComputeStatsRequest, ComputeStatsResult, ProgressMetrics, RaidSimRequest, RaidSimResult, StatWeightsRequest, StatWeightsResult } from './proto/api.js';
+import { BuffAttributionRequest, BuffAttributionResult, BulkSimRequest, BulkSimResult, ComputeStatsRequest, ComputeStatsResult, ConsumesOptimizerRequest, ConsumesOptimizerResult, GearOptimizerRequest, GearOptimizerResult, ProgressMetrics, RaidSimRequest, RaidSimResult, RotationOptimizerRequest, RotationOptimizerResult, RuneOptimizerRequest, RuneOptimizerResult, StatWeightsRequest, StatWeightsResult, TalentOptimizerRequest, TalentOptimizerResult, UpgradeFinderRequest, UpgradeFinderResult } from './proto/api.js';
 
 
 const SIM_WORKER_URL = `/${REPO_NAME}/sim_worker.js`;
 
+// Whether the progress holds the final result of an async call.
+function isFinalProgress(progress: ProgressMetrics): boolean {
+	return Object.entries(progress).some(([key, value]) => key.startsWith('final') && value != null);
+}
+
 export class WorkerPool {
 	private workers: Array<SimWorker>;
 
@@ -59,6 +66,49 @@ export class WorkerPool {
 		return result.finalBulkResult!;
 	}
 
+	// Runs an async API call on the least busy worker, reporting progress until finalResult is set.
+	private async runAsync<Req extends object, Res extends object>(apiName: string, label: string, requestType: MessageType<Req>, resultType: MessageType<Res>, request: Req, onProgress: Function, finalResult: (progress: ProgressMetrics) => Res | undefined): Promise<Res> {
+		console.log(label + ' request: ' + requestType.toJsonString(request, { enumAsInteger: true }));
+		const worker = this.getLeastBusyWorker();
+		const id = worker.makeTaskId();
+		// Add handler for the progress events
+		worker.addPromiseFunc(id + "progress", this.newProgressHandler(id, worker, onProgress), (_err) => { })
+
+		// Now start the async call
+		const resultData = await worker.doApiCall(apiName, requestType.toBinary(request), id);
+		const result = finalResult(ProgressMetrics.fromBinary(resultData))!;
+		console.log(label + ' result: ' + resultType.toJsonString(result));
+		return result;
+	}
+
+	async rotationOptimizerAsync(request: RotationOptimizerRequest, onProgress: Function): Promise<RotationOptimizerResult> {
+		return this.runAsync('rotationOptimizerAsync', 'Rotation optimizer', RotationOptimizerRequest, RotationOptimizerResult, request, onProgress, progress => progress.finalRotationResult);
+	}
+
+	async buffAttributionAsync(request: BuffAttributionRequest, onProgress: Function): Promise<BuffAttributionResult> {
+		return this.runAsync('buffAttributionAsync', 'Buff attribution', BuffAttributionRequest, BuffAttributionResult, request, onProgress, progress => progress.finalBuffAttributionResult);
+	}
+
+	async gearOptimizerAsync(request: GearOptimizerRequest, onProgress: Function): Promise<GearOptimizerResult> {
+		return this.runAsync('gearOptimizerAsync', 'Gear optimizer', GearOptimizerRequest, GearOptimizerResult, request, onProgress, progress => progress.finalGearOptimizerResult);
+	}
+
+	async runeOptimizerAsync(request: RuneOptimizerRequest, onProgress: Function): Promise<RuneOptimizerResult> {
+		return this.runAsync('runeOptimizerAsync', 'Rune optimizer', RuneOptimizerRequest, RuneOptimizerResult, request, onProgress, progress => progress.finalRuneOptimizerResult);
+	}
+
+	async talentOptimizerAsync(request: TalentOptimizerRequest, onProgress: Function): Promise<TalentOptimizerResult> {
+		return this.runAsync('talentOptimizerAsync', 'Talent optimizer', TalentOptimizerRequest, TalentOptimizerResult, request, onProgress, progress => progress.finalTalentOptimizerResult);
+	}
+
+	async consumesOptimizerAsync(request: ConsumesOptimizerRequest, onProgress: Function): Promise<ConsumesOptimizerResult> {
+		return this.runAsync('consumesOptimizerAsync', 'Consumes optimizer', ConsumesOptimizerRequest, ConsumesOptimizerResult, request, onProgress, progress => progress.finalConsumesOptimizerResult);
+	}
+
+	async upgradeFinderAsync(request: UpgradeFinderRequest, onProgress: Function): Promise<UpgradeFinderResult> {
+		return this.runAsync('upgradeFinderAsync', 'Upgrade finder', UpgradeFinderRequest, UpgradeFinderResult, request, onProgress, progress => progress.finalUpgradeFinderResult);
+	}
+
 	async raidSimAsync(request: RaidSimRequest, onProgress: Function): Promise<RaidSimResult> {
 		console.log('Raid sim request: ' + RaidSimRequest.toJsonString(request));
 		const worker = this.getLeastBusyWorker();
@@ -82,7 +132,7 @@ export class WorkerPool {
 			var progress = ProgressMetrics.fromBinary(progressData);
 			onProgress(progress);
 			// If we are done, stop adding the handler.
-			if (progress.finalRaidResult != null || progress.finalWeightResult != null) {
+			if (isFinalProgress(progress)) {
 				return;
 			}
 
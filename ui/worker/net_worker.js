@@ -21,7 +21,7 @@ addEventListener('message', async (e) => {
 
 	var content = await response.arrayBuffer();
 	var outputData;
-	if (msg == "raidSimAsync" || msg == "statWeightsAsync" || msg == "bulkSimAsync") {
+	if (msg.endsWith("Async")) {
 		while (true) {
 			let progressResponse = await fetch("/asyncProgress", {
 				method: 'POST',
@@ -25,6 +25,17 @@ addEventListener('message', async (e) => {
 
 	let handled = false;
 
+	// Wraps an async API, posting its progress updates back to the UI.
+	const withProgress = (func) => (data) => {
+		return func(data, (result) => {
+			postMessage({
+				msg: "progress",
+				outputData: result,
+				id: id + "progress",
+			});
+		});
+	};
+
 	[
 		['bulkSimAsync', (data) => {
 			return bulkSimAsync(data, (result) => {
@@ -35,6 +46,13 @@ addEventListener('message', async (e) => {
 				});
 			});
 		}],
+		['rotationOptimizerAsync', withProgress(rotationOptimizerAsync)],
+		['buffAttributionAsync', withProgress(buffAttributionAsync)],
+		['gearOptimizerAsync', withProgress(gearOptimizerAsync)],
+		['runeOptimizerAsync', withProgress(runeOptimizerAsync)],
+		['talentOptimizerAsync', withProgress(talentOptimizerAsync)],
+		['consumesOptimizerAsync', withProgress(consumesOptimizerAsync)],
+		['upgradeFinderAsync', withProgress(upgradeFinderAsync)],
 		['computeStats', computeStats],
 		['computeStatsJson', computeStatsJson],
 		['raidSim', raidSim],